@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/limitcool/starter/configs"
 	"github.com/limitcool/starter/internal/pkg/env"
@@ -59,6 +60,24 @@ func InitConfig(cmd *cobra.Command, args []string) *configs.Config {
 	return cfg
 }
 
+// WatchConfig 监听配置文件变化，重新解析后交给reload应用支持热更新的配置
+// 解析或应用失败时保留当前配置
+func WatchConfig(reload func(*configs.Config) error) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		cfg := &configs.Config{}
+		if err := viper.Unmarshal(cfg); err != nil {
+			logger.Error("Config unmarshal failed, keeping current config", "path", e.Name, "error", err)
+			return
+		}
+		if err := reload(cfg); err != nil {
+			logger.Error("Config reload failed, keeping current config", "path", e.Name, "error", err)
+			return
+		}
+		logger.Info("Config reloaded", "path", e.Name)
+	})
+	viper.WatchConfig()
+}
+
 // InitLogger 配置全局日志
 func InitLogger(cfg *configs.Config) {
 	// 获取环境
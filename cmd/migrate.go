@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"os"
+	"time"
 
 	"github.com/limitcool/starter/internal/datastore/sqldb"
 	"github.com/limitcool/starter/internal/migration"
+	"github.com/limitcool/starter/internal/pkg/lock"
 	"github.com/limitcool/starter/internal/pkg/logger"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 // migrateCmd 表示migrate子命令
@@ -84,6 +89,9 @@ func runMigration(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// 多个实例同时部署时只有一个执行迁移
+	defer lockMigrations(db)()
+
 	// 检查是否需要重置数据库
 	fresh, _ := cmd.Flags().GetBool("fresh")
 	if fresh {
@@ -134,6 +142,9 @@ func runMigrationRollback(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// 多个实例同时部署时只有一个执行迁移
+	defer lockMigrations(db)()
+
 	// 回滚迁移
 	if err := migrator.Rollback(); err != nil {
 		logger.Error("Database migration rollback failed", "error", err)
@@ -222,6 +233,9 @@ func runMigrationReset(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// 多个实例同时部署时只有一个执行迁移
+	defer lockMigrations(db)()
+
 	// 重置迁移
 	if err := migrator.Reset(); err != nil {
 		logger.Error("Database migration reset failed", "error", err)
@@ -230,3 +244,30 @@ func runMigrationReset(cmd *cobra.Command, args []string) {
 
 	logger.Info("Database migration reset completed successfully")
 }
+
+// lockMigrations 获取迁移锁，其他实例正在迁移时等待其完成，返回释放锁的函数
+// 数据库不支持咨询锁时不加锁
+func lockMigrations(db *gorm.DB) func() {
+	locker, err := lock.NewDBLocker(db)
+	if err != nil {
+		logger.Warn("Migration lock unavailable, running without lock", "error", err)
+		return func() {}
+	}
+
+	ctx := context.Background()
+	l, err := locker.TryAcquire(ctx, "migrations")
+	if errors.Is(err, lock.ErrNotAcquired) {
+		logger.Info("Another instance is running migrations, waiting for it to finish")
+		l, err = locker.Acquire(ctx, "migrations", lock.WithRetryInterval(time.Second))
+	}
+	if err != nil {
+		logger.Error("Failed to acquire migration lock", "error", err)
+		os.Exit(1)
+	}
+
+	return func() {
+		if err := l.Release(ctx); err != nil {
+			logger.Warn("Failed to release migration lock", "error", err)
+		}
+	}
+}
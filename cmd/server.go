@@ -65,6 +65,9 @@ func runServer(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// 监听配置文件变化，热更新存储路径规则
+	WatchConfig(application.ReloadConfig)
+
 	// 运行应用
 	if err := application.Run(); err != nil {
 		logger.Error("Application run failed", "error", err)
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/limitcool/starter/internal/datastore/sqldb"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/limitcool/starter/internal/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// storageCmd 表示storage子命令
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "File storage maintenance commands",
+	Long:  `File storage maintenance commands, such as reconciling storage with database records.`,
+}
+
+// storageMigrateCmd 表示storage migrate子命令
+var storageMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate files between storage backends",
+	Long: `Migrate files between storage backends.
+
+Streams every file referenced by the database from the source storage to the
+target storage, verifies checksums, and updates the storage type of the records.
+Progress is tracked in the database, so an interrupted migration resumes where
+it stopped. Use --delete-source to remove the source files after migration.`,
+	Run: runStorageMigrate,
+}
+
+// storageReconcileCmd 表示storage reconcile子命令
+var storageReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reconcile file storage with database records",
+	Long: `Reconcile file storage with database records.
+
+Expires pending uploads that were never confirmed, finds blobs in storage without
+a database record, and finds records whose blob is missing from storage.
+Use --dry-run to only print the report without changing anything.`,
+	Run: runStorageReconcile,
+}
+
+// storageRewrapCmd 表示storage rewrap子命令
+var storageRewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "Re-wrap encrypted file keys with the active master key",
+	Long: `Re-wrap encrypted file keys with the active master key.
+
+Run after adding a new master key and making it the active key. The data key
+of every encrypted private file is re-encrypted with the active master key;
+file contents are not re-encrypted. Plaintext private files of encrypted usages,
+such as files uploaded directly to object storage, are encrypted as well.
+Old master keys can be removed from the configuration once this completes.`,
+	Run: runStorageRewrap,
+}
+
+func init() {
+	rootCmd.AddCommand(storageCmd)
+	storageCmd.AddCommand(storageReconcileCmd)
+	storageCmd.AddCommand(storageMigrateCmd)
+	storageCmd.AddCommand(storageRewrapCmd)
+
+	storageReconcileCmd.Flags().Bool("dry-run", false, "Only print the report, do not delete anything")
+	storageReconcileCmd.Flags().Bool("delete-orphans", false, "Delete blobs in storage that have no database record")
+
+	storageMigrateCmd.Flags().String("from", "", "Source storage type (local, s3)")
+	storageMigrateCmd.Flags().String("to", "", "Target storage type (local, s3)")
+	storageMigrateCmd.Flags().Int("concurrency", 4, "Number of files migrated concurrently")
+	storageMigrateCmd.Flags().Bool("verify", true, "Read back each file from the target storage and verify its checksum")
+	storageMigrateCmd.Flags().Bool("delete-source", false, "Delete files from the source storage after migration")
+	_ = storageMigrateCmd.MarkFlagRequired("from")
+	_ = storageMigrateCmd.MarkFlagRequired("to")
+}
+
+// runStorageReconcile 执行存储对账
+func runStorageReconcile(cmd *cobra.Command, args []string) {
+	// 加载配置
+	cfg := InitConfig(cmd, args)
+
+	// 设置日志
+	InitLogger(cfg)
+
+	// 检查数据库是否启用
+	if !cfg.Database.Enabled {
+		logger.Fatal("Database not enabled, please enable it in the configuration file")
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if cmd.Flags().Changed("delete-orphans") {
+		cfg.Storage.Reconcile.DeleteOrphans, _ = cmd.Flags().GetBool("delete-orphans")
+	}
+
+	logger.Info("Starting storage reconcile", "dry_run", dryRun, "delete_orphans", cfg.Storage.Reconcile.DeleteOrphans)
+
+	// 初始化数据库连接
+	db := sqldb.NewDBWithConfig(*cfg)
+	if db == nil {
+		logger.Error("Failed to initialize database connection")
+		os.Exit(1)
+	}
+
+	// 初始化文件存储
+	storage, err := filestore.NewFileStorage(*cfg)
+	if err != nil {
+		logger.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	report, err := handler.NewReconcileService(db, storage, cfg).Run(ctx, dryRun)
+	if err != nil {
+		logger.Error("Storage reconcile failed", "error", err)
+		os.Exit(1)
+	}
+
+	// 打印对账报告
+	for _, item := range report.ExpiredPending {
+		logger.Info("Expired pending upload",
+			"file_id", item.FileID,
+			"path", item.Path,
+			"public", item.IsPublic,
+			"removed", item.Removed)
+	}
+	for _, item := range report.OrphanBlobs {
+		logger.Info("Orphan blob",
+			"path", item.Path,
+			"public", item.IsPublic,
+			"size", item.Size,
+			"removed", item.Removed)
+	}
+	for _, item := range report.MissingBlobs {
+		logger.Warn("Missing blob",
+			"file_id", item.FileID,
+			"path", item.Path,
+			"public", item.IsPublic)
+	}
+	for _, msg := range report.Errors {
+		logger.Error("Reconcile error", "error", msg)
+	}
+
+	report.LogSummary(ctx)
+}
+
+// runStorageMigrate 执行存储迁移
+func runStorageMigrate(cmd *cobra.Command, args []string) {
+	// 加载配置
+	cfg := InitConfig(cmd, args)
+
+	// 设置日志
+	InitLogger(cfg)
+
+	// 检查数据库是否启用
+	if !cfg.Database.Enabled {
+		logger.Fatal("Database not enabled, please enable it in the configuration file")
+	}
+
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	opts := handler.StorageMigrateOptions{}
+	opts.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+	opts.Verify, _ = cmd.Flags().GetBool("verify")
+	opts.DeleteSource, _ = cmd.Flags().GetBool("delete-source")
+
+	logger.Info("Starting storage migration",
+		"from", from,
+		"to", to,
+		"concurrency", opts.Concurrency,
+		"verify", opts.Verify,
+		"delete_source", opts.DeleteSource)
+
+	// 初始化数据库连接
+	db := sqldb.NewDBWithConfig(*cfg)
+	if db == nil {
+		logger.Error("Failed to initialize database connection")
+		os.Exit(1)
+	}
+
+	// 初始化源存储和目标存储
+	source, err := filestore.NewFileStorageByType(*cfg, types.StorageType(from))
+	if err != nil {
+		logger.Error("Failed to initialize source storage", "error", err)
+		os.Exit(1)
+	}
+	target, err := filestore.NewFileStorageByType(*cfg, types.StorageType(to))
+	if err != nil {
+		logger.Error("Failed to initialize target storage", "error", err)
+		os.Exit(1)
+	}
+
+	// 启用加密时先解密再加密，使校验和按明文计算
+	if source, err = filestore.WithEncryption(*cfg, source); err != nil {
+		logger.Error("Failed to initialize storage encryption", "error", err)
+		os.Exit(1)
+	}
+	if target, err = filestore.WithEncryption(*cfg, target); err != nil {
+		logger.Error("Failed to initialize storage encryption", "error", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	report, err := handler.NewStorageMigrateService(db, source, target).Run(ctx, opts)
+	if err != nil {
+		logger.Error("Storage migration failed", "error", err)
+		os.Exit(1)
+	}
+
+	for _, msg := range report.Errors {
+		logger.Error("Migration error", "error", msg)
+	}
+
+	logger.Info("Storage migration completed",
+		"source", report.Source,
+		"target", report.Target,
+		"total", report.Total,
+		"migrated", report.Migrated,
+		"failed", report.Failed,
+		"bytes", report.Bytes,
+		"source_deleted", report.SourceDeleted)
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runStorageRewrap 使用当前主密钥重新加密数据密钥
+func runStorageRewrap(cmd *cobra.Command, args []string) {
+	// 加载配置
+	cfg := InitConfig(cmd, args)
+
+	// 设置日志
+	InitLogger(cfg)
+
+	// 初始化文件存储
+	storage, err := filestore.NewFileStorage(*cfg)
+	if err != nil {
+		logger.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
+	encrypted, ok := storage.(*filestore.EncryptedStorage)
+	if !ok {
+		logger.Fatal("Storage encryption not enabled, please enable it in the configuration file")
+	}
+
+	// 先收集路径，避免遍历时修改文件
+	ctx := context.Background()
+	var paths []string
+	err = encrypted.ListFiles(ctx, false, func(info filestore.FileInfo) error {
+		paths = append(paths, info.Path)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to list private files", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Starting key re-wrap", "active_key", encrypted.ActiveKeyID(), "files", len(paths))
+
+	counts := make(map[string]int)
+	failed := 0
+	for _, path := range paths {
+		action, err := encrypted.Rewrap(ctx, path, false)
+		if err != nil {
+			logger.Error("Failed to re-wrap file", "path", path, "error", err)
+			failed++
+			continue
+		}
+		if action != filestore.RewrapSkipped {
+			logger.Info("File re-wrapped", "path", path, "action", action)
+		}
+		counts[action]++
+	}
+
+	logger.Info("Key re-wrap completed",
+		"rewrapped", counts[filestore.RewrapRewrapped],
+		"encrypted", counts[filestore.RewrapEncrypted],
+		"skipped", counts[filestore.RewrapSkipped],
+		"failed", failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -19,17 +19,20 @@ const (
 )
 
 type Config struct {
-	App      App
-	Driver   DBDriver
-	Database Database
-	JwtAuth  JwtAuth
-	Mongo    Mongo
-	Redis    RedisConfig         // Redis配置
-	Log      logconfig.LogConfig // 使用 pkg/logconfig 中的 LogConfig
-	Storage  Storage             // 文件存储配置
-	Admin    Admin               // 管理员配置
-	I18n     I18n                // 国际化配置
-	Pprof    Pprof               // 性能分析配置
+	App       App
+	Driver    DBDriver
+	Database  Database
+	JwtAuth   JwtAuth
+	Mongo     Mongo
+	Redis     RedisConfig         // Redis配置
+	HTTPCache HTTPCache           // HTTP响应缓存配置
+	Lock      Lock                // 分布式锁配置
+	Bloom     Bloom               // 布隆过滤器配置
+	Log       logconfig.LogConfig // 使用 pkg/logconfig 中的 LogConfig
+	Storage   Storage             // 文件存储配置
+	Admin     Admin               // 管理员配置
+	I18n      I18n                // 国际化配置
+	Pprof     Pprof               // 性能分析配置
 }
 
 // Config app config
@@ -61,6 +64,46 @@ type Database struct {
 	ConnMaxLifeTime time.Duration
 	SlowThreshold   time.Duration // 慢查询时长，默认500ms
 	SSLMode         string        // SSL模式，默认disable，可选值：disable, require, verify-ca, verify-full
+	Cache           RepoCache     // 仓库查询缓存配置
+}
+
+// RepoCache 仓库查询缓存配置，缓存按ID和唯一字段的查询结果，更新和删除后自动失效
+type RepoCache struct {
+	Enabled    bool                     // 是否启用，启用Redis时使用应用缓存，否则使用进程内缓存
+	DefaultTTL time.Duration            // 未在Entities中配置的实体的过期时间，0表示只缓存Entities中的实体
+	Entities   map[string]time.Duration // 按表名配置过期时间，如 user: 5m
+}
+
+// HTTPCache HTTP响应缓存配置，启用Redis时使用应用缓存，否则使用进程内缓存
+type HTTPCache struct {
+	Enabled bool          // 是否启用
+	TTL     time.Duration // 服务端缓存的过期时间
+	MaxAge  time.Duration // 客户端缓存时间（Cache-Control max-age），0表示客户端每次使用ETag重新验证
+}
+
+// LockBackend 分布式锁的实现
+type LockBackend string
+
+const (
+	LockRedis    LockBackend = "redis"    // Redis，多个实例时使用Redlock
+	LockDatabase LockBackend = "database" // 数据库咨询锁
+	LockMemory   LockBackend = "memory"   // 进程内，只用于单实例部署
+)
+
+// Lock 分布式锁配置，用于定时任务的领导者选举等跨实例协调
+type Lock struct {
+	Backend LockBackend   // 为空时依次选择Redis、数据库、进程内
+	Redis   []string      // Redis实现使用的实例名称，多个相互独立的实例时使用Redlock，默认default
+	TTL     time.Duration // 锁的过期时间，持有期间自动续期
+}
+
+// Bloom 用户ID布隆过滤器配置，启用Redis时所有实例共享位图，只在领导者实例上重建
+type Bloom struct {
+	Enabled           bool          // 是否启用
+	Key               string        // Redis位图的键，会加上缓存键前缀
+	Capacity          uint64        // 预计元素数量
+	FalsePositiveRate float64       // 误判率
+	Interval          time.Duration // 从数据库重建的间隔，0表示只在启动时重建
 }
 
 // Config jwt config
@@ -89,19 +132,33 @@ type RedisConfig struct {
 	Cache CacheConfig `yaml:"cache" json:"cache"` // 缓存配置
 }
 
+// RedisMode Redis部署模式
+type RedisMode string
+
+const (
+	RedisSingle   RedisMode = "single"   // 单节点
+	RedisSentinel RedisMode = "sentinel" // 哨兵，自动故障转移
+	RedisCluster  RedisMode = "cluster"  // 集群
+)
+
 // RedisInstance Redis实例配置
 type RedisInstance struct {
-	Enabled      bool          `yaml:"enabled" json:"enabled"`             // 是否启用
-	Addr         string        `yaml:"addr" json:"addr"`                   // 地址
-	Password     string        `yaml:"password" json:"password"`           // 密码
-	DB           int           `yaml:"db" json:"db"`                       // 数据库索引
-	MinIdleConn  int           `yaml:"min_idle_conn" json:"min_idle_conn"` // 最小空闲连接数
-	DialTimeout  time.Duration `yaml:"dial_timeout" json:"dial_timeout"`   // 连接超时
-	ReadTimeout  time.Duration `yaml:"read_timeout" json:"read_timeout"`   // 读取超时
-	WriteTimeout time.Duration `yaml:"write_timeout" json:"write_timeout"` // 写入超时
-	PoolSize     int           `yaml:"pool_size" json:"pool_size"`         // 连接池大小
-	PoolTimeout  time.Duration `yaml:"pool_timeout" json:"pool_timeout"`   // 连接池超时
-	EnableTrace  bool          `yaml:"enable_trace" json:"enable_trace"`   // 是否启用链路追踪
+	Enabled          bool          `yaml:"enabled" json:"enabled"`                     // 是否启用
+	Mode             RedisMode     `yaml:"mode" json:"mode"`                           // 部署模式，默认single
+	Addr             string        `yaml:"addr" json:"addr"`                           // 地址
+	Addrs            []string      `yaml:"addrs" json:"addrs"`                         // 哨兵或集群节点地址，为空时使用Addr
+	MasterName       string        `yaml:"master_name" json:"master_name"`             // 哨兵模式的主节点名称
+	Password         string        `yaml:"password" json:"password"`                   // 密码
+	SentinelPassword string        `yaml:"sentinel_password" json:"sentinel_password"` // 哨兵的密码
+	DB               int           `yaml:"db" json:"db"`                               // 数据库索引，集群模式只能为0
+	MinIdleConn      int           `yaml:"min_idle_conn" json:"min_idle_conn"`         // 最小空闲连接数
+	DialTimeout      time.Duration `yaml:"dial_timeout" json:"dial_timeout"`           // 连接超时
+	ReadTimeout      time.Duration `yaml:"read_timeout" json:"read_timeout"`           // 读取超时
+	WriteTimeout     time.Duration `yaml:"write_timeout" json:"write_timeout"`         // 写入超时
+	PoolSize         int           `yaml:"pool_size" json:"pool_size"`                 // 连接池大小
+	PoolTimeout      time.Duration `yaml:"pool_timeout" json:"pool_timeout"`           // 连接池超时
+	EnableTrace      bool          `yaml:"enable_trace" json:"enable_trace"`           // 是否启用链路追踪，记录命令的span和耗时日志
+	SlowThreshold    time.Duration `yaml:"slow_threshold" json:"slow_threshold"`       // 慢命令时长，启用链路追踪时生效，默认100ms
 }
 
 // CacheConfig 缓存配置
@@ -121,12 +178,21 @@ type CacheConfig struct {
 
 // Storage 文件存储配置
 type Storage struct {
-	Enabled    bool              // 是否启用文件存储
-	Type       types.StorageType // 存储类型: local, s3, oss
-	Local      LocalStorage      // 本地存储配置
-	S3         S3Storage         // S3存储配置
-	OSS        OSSStorage        // 阿里云OSS存储配置
-	PathConfig PathConfig        // 路径配置
+	Enabled     bool              // 是否启用文件存储
+	Type        types.StorageType // 存储类型: local, s3, oss
+	Local       LocalStorage      // 本地存储配置
+	S3          S3Storage         // S3存储配置
+	OSS         OSSStorage        // 阿里云OSS存储配置
+	PathConfig  PathConfig        // 路径配置
+	Image       ImageConfig       // 图片处理配置
+	Quota       QuotaConfig       // 存储配额配置
+	Reconcile   ReconcileConfig   // 存储对账配置
+	Replication ReplicationConfig // 存储复制配置
+	Encryption  EncryptionConfig  // 存储加密配置
+	Trash       TrashConfig       // 回收站配置
+	Scan        ScanConfig        // 上传文件扫描配置
+	UploadEvent UploadEventConfig // 上传事件回调配置
+	Share       ShareConfig       // 分享链接配置
 }
 
 // LocalStorage 本地存储配置
@@ -153,14 +219,143 @@ type OSSStorage struct {
 	Endpoint  string // 端点URL
 }
 
-// PathConfig 存储路径配置
+// PathConfig 存储路径规则配置，Usages为空时使用内置规则
 type PathConfig struct {
-	Avatar    string // 头像存储路径
-	Document  string // 文档存储路径
-	Image     string // 图片存储路径
-	Video     string // 视频存储路径
-	Audio     string // 音频存储路径
-	Temporary string // 临时文件存储路径
+	Default string               // 未配置的用途使用的规则，为空时使用general
+	Strict  bool                 // 是否拒绝未配置的用途，开启后忽略Default
+	Usages  map[string]UsageRule // 按文件用途配置的规则，配置后完全替换内置规则
+}
+
+// UsageRule 文件用途规则
+type UsageRule struct {
+	BaseDir     string   // 存储目录，如 documents/contracts
+	DateLayout  string   // 日期分组格式（Go时间格式，如 2006/01），为空时不按日期分组
+	UserDir     bool     // 是否按上传者分组（user_{id}）
+	MaxFileSize int64    // 最大文件大小（字节），0表示不限制
+	AllowedExts []string // 允许的扩展名，为空表示不限制
+	MimeTypes   []string // 允许的MIME类型，支持 image/* 通配，为空表示不限制
+	Public      bool     // 上传时未指定is_public时是否公开
+	Roles       []string // 允许上传的角色(admin, user)，为空表示不限制
+	Versioned   bool     // 是否启用版本管理，上传时可以通过replaces替换已有文件
+	MaxVersions int      // 保留的历史版本数，0表示不限制
+}
+
+// ImageConfig 图片处理配置
+type ImageConfig struct {
+	Enabled          bool                      // 是否启用图片处理
+	GenerateOnUpload bool                      // 是否在上传时生成衍生图，否则在首次请求时生成
+	StripMetadata    bool                      // 是否移除EXIF/GPS等元数据
+	MaxPixels        int64                     // 生成衍生图时允许的最大像素数（宽×高），超过时不解码，0表示使用默认值（4000万）
+	Variants         map[string][]ImageVariant // 按文件用途配置的衍生图规格，为空时使用内置规格
+}
+
+// ImageVariant 衍生图规格
+type ImageVariant struct {
+	Name    string // 规格名称，如 small、thumb
+	Width   int    // 目标宽度，0表示按高度等比计算
+	Height  int    // 目标高度，0表示按宽度等比计算
+	Mode    string // 缩放模式: fit(等比缩放), fill(裁剪填充)
+	Format  string // 输出格式: jpeg, png，为空时保持原格式
+	Quality int    // JPEG输出质量(1-100)
+}
+
+// QuotaConfig 存储配额配置
+// 总配额优先级：管理员单独设置 > 角色配额 > 默认配额；用途配额优先级：管理员单独设置 > 用途配额
+type QuotaConfig struct {
+	Enabled bool                  // 是否启用配额限制，未启用时仍统计用量
+	Default QuotaLimit            // 每个用户的默认总配额
+	Roles   map[string]QuotaLimit // 按角色配置的总配额(admin, user)
+	Usages  map[string]QuotaLimit // 按文件用途配置的每用户配额
+}
+
+// QuotaLimit 配额限制，0表示不限制
+type QuotaLimit struct {
+	MaxBytes int64 // 最大总字节数
+	MaxFiles int64 // 最大文件数
+}
+
+// ReconcileConfig 存储对账配置
+type ReconcileConfig struct {
+	Enabled       bool          // 是否定期执行对账
+	Interval      time.Duration // 执行间隔
+	DryRun        bool          // 仅生成报告，不清理数据
+	PendingTTL    time.Duration // 待上传记录的过期时间，超过后删除记录及已上传的内容
+	OrphanMinAge  time.Duration // 孤立文件的最小存在时间，避免误删正在上传的文件
+	DeleteOrphans bool          // 是否删除存储中没有记录的孤立文件
+}
+
+// ReplicationConfig 存储复制配置，Type为主存储，Secondary为备用存储
+type ReplicationConfig struct {
+	Enabled          bool              // 是否启用复制
+	Mode             string            // 复制模式: mirror(同时写入备用存储), failover(主存储失败或文件不存在时从备用存储读取)
+	Secondary        types.StorageType // 备用存储类型: local, s3
+	Async            bool              // 镜像模式下是否异步写入备用存储
+	QueueSize        int               // 复制队列大小
+	MaxRetries       int               // 复制失败的最大重试次数
+	RetryInterval    time.Duration     // 重试间隔
+	FailureThreshold int               // 连续失败多少次后标记为不健康
+	ProbeInterval    time.Duration     // 不健康的存储多久后重新尝试
+}
+
+// EncryptionConfig 私有文件加密配置
+type EncryptionConfig struct {
+	Enabled   bool              // 是否启用加密
+	ActiveKey string            // 当前用于加密的主密钥ID，为空时使用第一个密钥
+	Keys      []MasterKeyConfig // 主密钥列表，轮换后保留旧密钥用于解密
+	Usages    []string          // 需要加密的文件用途，如 contract, backup
+}
+
+// MasterKeyConfig 主密钥配置
+type MasterKeyConfig struct {
+	ID      string // 密钥ID，写入加密文件头
+	Key     string // base64编码的32字节密钥
+	KeyFile string // 密钥文件路径（原始32字节或base64文本），Key为空时使用
+}
+
+// ShareConfig 分享链接配置
+// 分享密码输错的次数按链接和访问者IP分别统计，任一达到限制后锁定，锁定期间不再校验密码
+type ShareConfig struct {
+	MaxPasswordFailures int           // 每个分享链接允许输错密码的次数，0表示不限制
+	MaxIPFailures       int           // 每个IP允许输错分享密码的次数（所有链接合计），0表示不限制
+	LockoutDuration     time.Duration // 统计错误次数的时间窗口，也是达到限制后的锁定时间
+}
+
+// TrashConfig 回收站配置
+type TrashConfig struct {
+	Enabled       bool          // 是否启用回收站，关闭时删除文件立即永久删除
+	Retention     time.Duration // 回收站中文件的保留时间，超过后永久删除
+	PurgeInterval time.Duration // 清理过期文件的间隔
+}
+
+// ScanConfig 上传文件扫描配置
+// 通过服务器上传的文件同步扫描，客户端直传的文件确认后进入隔离状态，由后台任务异步扫描
+type ScanConfig struct {
+	Enabled  bool            // 是否启用扫描
+	Interval time.Duration   // 检查待扫描文件的间隔
+	Timeout  time.Duration   // 扫描中的文件超过该时间未完成时重新扫描
+	ClamAV   ClamAVConfig    // ClamAV病毒扫描配置
+	Rules    ScanRulesConfig // 内容策略规则
+}
+
+// ClamAVConfig ClamAV病毒扫描配置
+type ClamAVConfig struct {
+	Enabled bool          // 是否启用ClamAV扫描
+	Network string        // 连接方式: tcp, unix，为空时按地址判断
+	Address string        // clamd地址，如 127.0.0.1:3310 或 /run/clamav/clamd.ctl
+	Timeout time.Duration // 单个文件的扫描超时
+}
+
+// ScanRulesConfig 内容策略规则
+type ScanRulesConfig struct {
+	MaxArchiveDepth int      // 压缩包最大嵌套层数，0表示不限制
+	ForbiddenNames  []string // 禁止的文件名模式，同时检查压缩包内的文件，如 *.exe、autorun.inf
+}
+
+// UploadEventConfig 上传事件回调配置
+// 对象存储在客户端直传完成后通过事件通知回调，自动确认上传
+type UploadEventConfig struct {
+	Enabled bool   // 是否启用事件回调接口
+	Token   string // 回调认证令牌，对应MinIO webhook的auth_token，以 Authorization: Bearer 方式提交
 }
 
 // Admin 管理员配置
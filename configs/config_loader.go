@@ -38,6 +38,10 @@ func LoadConfig(configPath string) *Config {
 			MaxOpenConn:     100,
 			ConnMaxLifeTime: 3600,
 			SlowThreshold:   500,
+			Cache: RepoCache{
+				Enabled:  false,
+				Entities: map[string]time.Duration{"user": 5 * time.Minute},
+			},
 		},
 		JwtAuth: JwtAuth{
 			AccessSecret:  "access_secret",
@@ -54,30 +58,34 @@ func LoadConfig(configPath string) *Config {
 		Redis: RedisConfig{
 			Instances: map[string]RedisInstance{
 				"default": {
-					Enabled:      true,
-					Addr:         "localhost:6379",
-					Password:     "",
-					DB:           0,
-					MinIdleConn:  10,
-					DialTimeout:  5 * time.Second,
-					ReadTimeout:  3 * time.Second,
-					WriteTimeout: 3 * time.Second,
-					PoolSize:     100,
-					PoolTimeout:  4 * time.Second,
-					EnableTrace:  false,
+					Enabled:       true,
+					Mode:          RedisSingle,
+					Addr:          "localhost:6379",
+					Password:      "",
+					DB:            0,
+					MinIdleConn:   10,
+					DialTimeout:   5 * time.Second,
+					ReadTimeout:   3 * time.Second,
+					WriteTimeout:  3 * time.Second,
+					PoolSize:      100,
+					PoolTimeout:   4 * time.Second,
+					EnableTrace:   false,
+					SlowThreshold: 100 * time.Millisecond,
 				},
 				"session": {
-					Enabled:      false,
-					Addr:         "localhost:6379",
-					Password:     "",
-					DB:           1,
-					MinIdleConn:  5,
-					DialTimeout:  5 * time.Second,
-					ReadTimeout:  3 * time.Second,
-					WriteTimeout: 3 * time.Second,
-					PoolSize:     50,
-					PoolTimeout:  4 * time.Second,
-					EnableTrace:  false,
+					Enabled:       false,
+					Mode:          RedisSingle,
+					Addr:          "localhost:6379",
+					Password:      "",
+					DB:            1,
+					MinIdleConn:   5,
+					DialTimeout:   5 * time.Second,
+					ReadTimeout:   3 * time.Second,
+					WriteTimeout:  3 * time.Second,
+					PoolSize:      50,
+					PoolTimeout:   4 * time.Second,
+					EnableTrace:   false,
+					SlowThreshold: 100 * time.Millisecond,
 				},
 			},
 			Cache: CacheConfig{
@@ -92,6 +100,22 @@ func LoadConfig(configPath string) *Config {
 				LocalCacheSize:    10000,
 			},
 		},
+		HTTPCache: HTTPCache{
+			Enabled: false,
+			TTL:     time.Minute,
+			MaxAge:  0,
+		},
+		Lock: Lock{
+			Redis: []string{"default"},
+			TTL:   30 * time.Second,
+		},
+		Bloom: Bloom{
+			Enabled:           false,
+			Key:               "bloom:users",
+			Capacity:          1_000_000,
+			FalsePositiveRate: 0.01,
+			Interval:          time.Hour,
+		},
 		Log: logconfig.DefaultLogConfig(),
 		Storage: Storage{
 			Enabled: true,
@@ -108,12 +132,63 @@ func LoadConfig(configPath string) *Config {
 				Endpoint:  "",
 			},
 			PathConfig: PathConfig{
-				Avatar:    "avatars",
-				Document:  "documents",
-				Image:     "images",
-				Video:     "videos",
-				Audio:     "audios",
-				Temporary: "temp",
+				Default: "general",
+			},
+			Image: ImageConfig{
+				Enabled:          true,
+				GenerateOnUpload: false,
+				StripMetadata:    true,
+			},
+			Quota: QuotaConfig{
+				Enabled: false,
+				Default: QuotaLimit{
+					MaxBytes: 1 << 30, // 1GB
+					MaxFiles: 10000,
+				},
+			},
+			Reconcile: ReconcileConfig{
+				Enabled:       false,
+				Interval:      6 * time.Hour,
+				DryRun:        false,
+				PendingTTL:    24 * time.Hour,
+				OrphanMinAge:  24 * time.Hour,
+				DeleteOrphans: false,
+			},
+			Replication: ReplicationConfig{
+				Enabled:          false,
+				Mode:             "mirror",
+				Async:            true,
+				QueueSize:        1000,
+				MaxRetries:       5,
+				RetryInterval:    10 * time.Second,
+				FailureThreshold: 3,
+				ProbeInterval:    30 * time.Second,
+			},
+			Encryption: EncryptionConfig{
+				Enabled: false,
+			},
+			Share: ShareConfig{
+				MaxPasswordFailures: 5,
+				MaxIPFailures:       20,
+				LockoutDuration:     15 * time.Minute,
+			},
+			Trash: TrashConfig{
+				Enabled:       false,
+				Retention:     30 * 24 * time.Hour,
+				PurgeInterval: time.Hour,
+			},
+			Scan: ScanConfig{
+				Enabled:  false,
+				Interval: 5 * time.Second,
+				Timeout:  10 * time.Minute,
+				ClamAV: ClamAVConfig{
+					Enabled: false,
+					Address: "127.0.0.1:3310",
+					Timeout: time.Minute,
+				},
+				Rules: ScanRulesConfig{
+					MaxArchiveDepth: 3,
+				},
 			},
 		},
 		Admin: Admin{
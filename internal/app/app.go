@@ -3,20 +3,28 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/datastore/redisdb"
 	"github.com/limitcool/starter/internal/datastore/sqldb"
 	"github.com/limitcool/starter/internal/filestore"
 	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/bloom"
 	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/lock"
 	"github.com/limitcool/starter/internal/pkg/logger"
 	"gorm.io/gorm"
 )
@@ -25,12 +33,23 @@ import (
 type App struct {
 	config      *configs.Config
 	db          *gorm.DB
-	redis       *redis.Client
+	redis       *redisdb.Clients
 	cache       cache.Cache
+	cacheNames  []string    // 注册到缓存工厂的缓存名称，关闭应用时移除
+	memCache    cache.Cache // 未启用Redis时仓库查询缓存和响应缓存使用的进程内缓存
+	respCache   *middleware.ResponseCache
+	locker      lock.Locker
+	userFilter  bloom.Filter // 用户ID布隆过滤器，未启用时为nil
 	storage     filestore.FileStorage
+	paths       *filestore.PathManager
 	router      *gin.Engine
 	server      *http.Server
 	pprofServer *http.Server // pprof服务器
+
+	// 后台任务的生命周期，关闭应用时取消
+	jobCtx    context.Context
+	jobCancel context.CancelFunc
+	leaders   sync.WaitGroup // 以领导者身份运行的任务和过滤器重建，关闭应用时等待退出
 }
 
 // InitStep 初始化步骤
@@ -43,6 +62,7 @@ type InitStep struct {
 // New 创建新的应用实例
 func New(config *configs.Config) (*App, error) {
 	app := &App{config: config}
+	app.jobCtx, app.jobCancel = context.WithCancel(context.Background())
 
 	// 定义初始化步骤
 	steps := app.getInitSteps()
@@ -84,19 +104,70 @@ func (app *App) GetCache() cache.Cache {
 	return app.cache
 }
 
+// GetRedis 获取指定名称的Redis客户端，实例未配置或未启用时返回nil
+func (app *App) GetRedis(name string) redis.UniversalClient {
+	if app.redis == nil {
+		return nil
+	}
+	client, _ := app.redis.Get(name)
+	return client
+}
+
+// GetResponseCache 获取HTTP响应缓存，未启用时返回nil
+func (app *App) GetResponseCache() *middleware.ResponseCache {
+	return app.respCache
+}
+
+// GetLocker 获取分布式锁
+func (app *App) GetLocker() lock.Locker {
+	return app.locker
+}
+
+// GetUserFilter 获取用户ID布隆过滤器，未启用时返回nil
+func (app *App) GetUserFilter() bloom.Filter {
+	return app.userFilter
+}
+
 func (app *App) GetStorage() filestore.FileStorage {
 	return app.storage
 }
 
+func (app *App) GetPathManager() *filestore.PathManager {
+	return app.paths
+}
+
+// ReloadConfig 应用配置文件的变化，目前只有存储路径规则支持热更新，其他配置需要重启生效
+func (app *App) ReloadConfig(config *configs.Config) error {
+	if app.paths == nil {
+		return nil
+	}
+	if err := app.paths.Reload(config.Storage.PathConfig); err != nil {
+		return fmt.Errorf("failed to reload storage path rules: %w", err)
+	}
+
+	logger.Info("Storage path rules reloaded", "usages", len(app.paths.Usages()))
+	return nil
+}
+
 // getInitSteps 获取初始化步骤列表
 func (app *App) getInitSteps() []InitStep {
 	steps := []InitStep{
 		// 数据库和Redis根据配置启用，失败时不影响应用启动（内部有禁用检查）
 		{Name: "database", Required: false, Init: app.initDatabase},
 		{Name: "redis", Required: false, Init: app.initRedis},
+		{Name: "repo_cache", Required: false, Init: app.initRepoCache},
+		{Name: "response_cache", Required: false, Init: app.initResponseCache},
+		{Name: "lock", Required: false, Init: app.initLocker},
+		{Name: "bloom", Required: false, Init: app.initBloom},
+
+		// 存储路径规则在启动时校验，配置无效时拒绝启动
+		{Name: "paths", Required: true, Init: app.initPaths},
 
 		// 存储服务是可选的，某些功能可能需要它
 		{Name: "storage", Required: false, Init: app.initStorage},
+		{Name: "reconcile", Required: false, Init: app.initReconcile},
+		{Name: "trash", Required: false, Init: app.initTrash},
+		{Name: "scan", Required: false, Init: app.initScan},
 
 		// 核心组件，必须成功初始化
 		{Name: "router", Required: true, Init: app.initRouter},
@@ -136,7 +207,8 @@ func (a *App) initDatabase() error {
 	return nil
 }
 
-// initRedis 初始化Redis连接
+// initRedis 初始化所有启用的Redis实例
+// 每个实例以实例名注册到缓存工厂，default实例同时作为应用缓存
 func (a *App) initRedis() error {
 	// 检查Redis配置
 	if len(a.config.Redis.Instances) == 0 {
@@ -144,48 +216,276 @@ func (a *App) initRedis() error {
 		return nil
 	}
 
-	// 获取默认Redis实例配置
-	var redisConfig configs.RedisInstance
-	var exists bool
-	if redisConfig, exists = a.config.Redis.Instances["default"]; !exists || !redisConfig.Enabled {
-		logger.Info("Redis disabled - default instance not enabled")
+	// 连接所有启用的实例
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clients, err := redisdb.Open(ctx, a.config.Redis.Instances)
+	if err != nil {
+		return err
+	}
+	if clients.Len() == 0 {
+		logger.Info("Redis disabled - no instance enabled")
+		return nil
+	}
+	a.redis = clients
+	logger.Info("Redis connected successfully", "instances", clients.Names())
+
+	cacheOpts := []cache.Option{
+		cache.WithExpiration(a.config.Redis.Cache.DefaultTTL),
+		cache.WithKeyPrefix(a.config.Redis.Cache.KeyPrefix),
+		cache.WithLoadOptions(
+			cache.WithDistributedLock(a.config.Redis.Cache.EnableProtection),
+			cache.WithLockTimeout(a.config.Redis.Cache.ProtectionTimeout),
+			cache.WithNilValueTTL(a.config.Redis.Cache.NilValueTTL),
+		),
+	}
+
+	for _, name := range clients.Names() {
+		client, _ := clients.Get(name)
+		var c cache.Cache = cache.NewRedisCache(client, cacheOpts...)
+
+		if name == "default" {
+			// 启用本地缓存时使用两级缓存，写入和删除通过发布订阅通知其他实例
+			if a.config.Redis.Cache.LocalCache {
+				layered, err := cache.NewLayeredCache(c, cache.LayeredOptions{
+					LocalTTL:    a.config.Redis.Cache.LocalCacheTTL,
+					LocalSize:   a.config.Redis.Cache.LocalCacheSize,
+					Invalidator: cache.NewRedisInvalidator(client, a.config.Redis.Cache.KeyPrefix+"cache:invalidate"),
+				})
+				if err != nil {
+					return fmt.Errorf("failed to create layered cache: %w", err)
+				}
+				c = layered
+				logger.Info("Local cache enabled",
+					"ttl", a.config.Redis.Cache.LocalCacheTTL,
+					"size", a.config.Redis.Cache.LocalCacheSize)
+			}
+			a.cache = c
+		}
+
+		// 缓存与客户端由应用关闭，工厂只负责按名称查找
+		if err := cache.GetFactory().Register(name, c); err != nil {
+			return fmt.Errorf("failed to register cache for Redis instance %s: %w", name, err)
+		}
+		a.cacheNames = append(a.cacheNames, name)
+	}
+	return nil
+}
+
+// queryCache 仓库查询缓存和响应缓存使用的缓存，未启用Redis时使用进程内缓存
+func (a *App) queryCache() cache.Cache {
+	if a.cache != nil {
+		return a.cache
+	}
+	if a.memCache == nil {
+		a.memCache = cache.NewMemoryCache()
+	}
+	return a.memCache
+}
+
+// initRepoCache 为数据库连接启用仓库查询缓存
+// 只启用响应缓存时也注册插件，不缓存查询，只在实体更新和删除后失效带有实体标签的响应
+func (a *App) initRepoCache() error {
+	dbCache := a.config.Database.Cache
+	if a.db == nil || (!dbCache.Enabled && !a.config.HTTPCache.Enabled) {
 		return nil
 	}
 
-	logger.Info("Connecting to Redis", "addr", redisConfig.Addr)
+	var opts model.RepoCacheOptions
+	if dbCache.Enabled {
+		opts = model.RepoCacheOptions{
+			DefaultTTL: dbCache.DefaultTTL,
+			Entities:   dbCache.Entities,
+		}
+	}
+	if err := a.db.Use(model.NewRepoCache(a.queryCache(), opts)); err != nil {
+		return fmt.Errorf("failed to enable repository cache: %w", err)
+	}
 
-	// 创建Redis客户端
-	client := redis.NewClient(&redis.Options{
-		Addr:         redisConfig.Addr,
-		Password:     redisConfig.Password,
-		DB:           redisConfig.DB,
-		MinIdleConns: redisConfig.MinIdleConn,
-		DialTimeout:  redisConfig.DialTimeout,
-		ReadTimeout:  redisConfig.ReadTimeout,
-		WriteTimeout: redisConfig.WriteTimeout,
-		PoolSize:     redisConfig.PoolSize,
-		PoolTimeout:  redisConfig.PoolTimeout,
+	logger.Info("Repository cache enabled",
+		"query_cache", dbCache.Enabled,
+		"default_ttl", dbCache.DefaultTTL,
+		"entities", dbCache.Entities,
+		"redis", a.cache != nil)
+	return nil
+}
+
+// initResponseCache 初始化HTTP响应缓存
+func (a *App) initResponseCache() error {
+	if !a.config.HTTPCache.Enabled {
+		return nil
+	}
+
+	a.respCache = middleware.NewResponseCache(a.queryCache(), middleware.ResponseCacheOptions{
+		TTL:    a.config.HTTPCache.TTL,
+		MaxAge: a.config.HTTPCache.MaxAge,
 	})
 
-	// 检查Redis连接
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	logger.Info("Response cache enabled",
+		"ttl", a.config.HTTPCache.TTL,
+		"max_age", a.config.HTTPCache.MaxAge,
+		"redis", a.cache != nil)
+	return nil
+}
 
-	if err := client.Ping(ctx).Err(); err != nil {
-		return fmt.Errorf("failed to ping Redis: %w", err)
+// initLocker 初始化分布式锁，未配置实现时依次选择Redis、数据库、进程内
+func (a *App) initLocker() error {
+	cfg := a.config.Lock
+	opts := []lock.Option{lock.WithTTL(cfg.TTL)}
+
+	backend := cfg.Backend
+	if backend == "" {
+		backend = configs.LockMemory
+		if _, err := a.redisClients(cfg.Redis); err == nil {
+			backend = configs.LockRedis
+		} else if a.db != nil {
+			if _, err := lock.NewDBLocker(a.db); err == nil {
+				backend = configs.LockDatabase
+			}
+		}
 	}
 
-	logger.Info("Redis connected successfully")
+	switch backend {
+	case configs.LockRedis:
+		clients, err := a.redisClients(cfg.Redis)
+		if err != nil {
+			return err
+		}
+		if a.locker, err = lock.NewRedisLocker(clients, opts...); err != nil {
+			return err
+		}
+	case configs.LockDatabase:
+		if a.db == nil {
+			return fmt.Errorf("database lock requires database")
+		}
+		locker, err := lock.NewDBLocker(a.db, opts...)
+		if err != nil {
+			return err
+		}
+		a.locker = locker
+	case configs.LockMemory:
+		a.locker = lock.NewMemoryLocker(opts...)
+	default:
+		return fmt.Errorf("unknown lock backend %q", backend)
+	}
 
-	// 创建Redis缓存
-	redisCache := cache.NewRedisCache(
-		client,
-		cache.WithExpiration(a.config.Redis.Cache.DefaultTTL),
-		cache.WithKeyPrefix(a.config.Redis.Cache.KeyPrefix),
-	)
+	logger.Info("Lock initialized", "backend", backend, "ttl", cfg.TTL)
+	return nil
+}
+
+// redisClients 按名称获取Redis客户端，任一实例不可用时返回错误
+func (a *App) redisClients(names []string) ([]redis.UniversalClient, error) {
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+
+	clients := make([]redis.UniversalClient, 0, len(names))
+	for _, name := range names {
+		client := a.GetRedis(name)
+		if client == nil {
+			return nil, fmt.Errorf("redis instance %s is not enabled", name)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
 
-	a.redis = client
-	a.cache = redisCache
+// runAsLeader 多实例部署时只在当选的实例上运行任务，失去领导权时取消任务的ctx并重新竞选
+// 未初始化锁时直接运行，关闭应用时都会等待任务退出
+func (a *App) runAsLeader(key string, job func(ctx context.Context)) {
+	a.leaders.Add(1)
+	if a.locker == nil {
+		go func() {
+			defer a.leaders.Done()
+			job(a.jobCtx)
+		}()
+		return
+	}
+
+	go func() {
+		defer a.leaders.Done()
+		lock.NewElection(a.locker, key).Run(a.jobCtx, func(ctx context.Context) error {
+			job(ctx)
+			return nil
+		})
+	}()
+}
+
+// initBloom 创建用户ID布隆过滤器，启动时从数据库重建一次，之后定期重建
+// 启用Redis时所有实例共享位图，只在领导者实例上重建；否则每个实例重建自己的过滤器
+func (a *App) initBloom() error {
+	cfg := a.config.Bloom
+	if !cfg.Enabled {
+		logger.Info("Bloom filter disabled")
+		return nil
+	}
+
+	if a.db == nil {
+		return fmt.Errorf("bloom filter requires database")
+	}
+
+	if client := a.GetRedis("default"); client != nil {
+		filter, err := bloom.NewRedisFilter(client, a.config.Redis.Cache.KeyPrefix+cfg.Key, cfg.Capacity, cfg.FalsePositiveRate)
+		if err != nil {
+			return fmt.Errorf("failed to create bloom filter: %w", err)
+		}
+		a.userFilter = filter
+		a.runAsLeader("jobs:bloom_users", func(ctx context.Context) {
+			bloom.Schedule(ctx, filter, a.userIDs, cfg.Interval)
+		})
+	} else {
+		filter, err := bloom.NewMemoryFilter(cfg.Capacity, cfg.FalsePositiveRate)
+		if err != nil {
+			return fmt.Errorf("failed to create bloom filter: %w", err)
+		}
+		a.userFilter = filter
+		a.leaders.Add(1)
+		go func() {
+			defer a.leaders.Done()
+			bloom.Schedule(a.jobCtx, filter, a.userIDs, cfg.Interval)
+		}()
+	}
+
+	logger.Info("Bloom filter initialized successfully",
+		"redis", a.GetRedis("default") != nil,
+		"capacity", cfg.Capacity,
+		"false_positive_rate", cfg.FalsePositiveRate,
+		"interval", cfg.Interval)
+	return nil
+}
+
+// userIDs 按ID分批遍历所有用户，作为布隆过滤器的数据源
+func (a *App) userIDs(ctx context.Context, add func(items ...string) error) error {
+	var lastID int64
+	for {
+		var ids []int64
+		err := a.db.WithContext(ctx).Model(&model.User{}).Where("id > ?", lastID).
+			Order("id").Limit(1000).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		items := make([]string, len(ids))
+		for i, id := range ids {
+			items[i] = strconv.FormatInt(id, 10)
+		}
+		if err := add(items...); err != nil {
+			return err
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// initPaths 校验并加载存储路径规则
+func (a *App) initPaths() error {
+	paths, err := filestore.NewPathManagerFromConfig(a.config.Storage.PathConfig)
+	if err != nil {
+		return fmt.Errorf("invalid storage path rules: %w", err)
+	}
+	a.paths = paths
+
+	logger.Info("Storage path rules loaded", "usages", len(paths.Usages()))
 	return nil
 }
 
@@ -203,12 +503,78 @@ func (a *App) initStorage() error {
 	return nil
 }
 
+// initReconcile 启动定期存储对账任务
+func (a *App) initReconcile() error {
+	if !a.config.Storage.Reconcile.Enabled {
+		logger.Info("Storage reconcile disabled")
+		return nil
+	}
+
+	if a.db == nil || a.storage == nil {
+		return fmt.Errorf("storage reconcile requires database and storage")
+	}
+
+	reconciler := handler.NewReconcileService(a.db, a.storage, a.config)
+	a.runAsLeader("jobs:storage_reconcile", reconciler.Start)
+
+	logger.Info("Storage reconcile initialized successfully",
+		"interval", a.config.Storage.Reconcile.Interval)
+	return nil
+}
+
+// initTrash 启动定期清理回收站任务
+func (a *App) initTrash() error {
+	if !a.config.Storage.Trash.Enabled {
+		logger.Info("Storage trash disabled")
+		return nil
+	}
+
+	if a.db == nil || a.storage == nil {
+		return fmt.Errorf("storage trash requires database and storage")
+	}
+
+	trash := handler.NewTrashService(a.db, a.storage, a.config)
+	a.runAsLeader("jobs:storage_trash", trash.Start)
+
+	logger.Info("Storage trash initialized successfully",
+		"retention", a.config.Storage.Trash.Retention)
+	return nil
+}
+
+// initScan 启动客户端直传文件的异步扫描任务
+func (a *App) initScan() error {
+	if !a.config.Storage.Scan.Enabled {
+		logger.Info("Storage scan disabled")
+		return nil
+	}
+
+	if a.db == nil || a.storage == nil {
+		return fmt.Errorf("storage scan requires database and storage")
+	}
+
+	scan := handler.NewScanService(a.db, a.storage, a.config)
+	if err := scan.Err(); err != nil {
+		return fmt.Errorf("invalid storage scan config: %w", err)
+	}
+	go scan.Start(a.jobCtx)
+
+	logger.Info("Storage scan initialized successfully",
+		"clamav", a.config.Storage.Scan.ClamAV.Enabled,
+		"interval", a.config.Storage.Scan.Interval)
+	return nil
+}
+
 // initRouter 初始化路由
 func (a *App) initRouter() error {
 	r, err := newRouter(
 		a.config,
 		handler.NewUserHandler(a),
 		handler.NewFileHandler(a),
+		handler.NewFileLibraryHandler(a),
+		handler.NewFileVersionHandler(a),
+		handler.NewFileShareHandler(a),
+		handler.NewTrashHandler(a),
+		handler.NewFileArchiveHandler(a),
 		handler.NewAdminHandler(a),
 	)
 	if err != nil {
@@ -301,6 +667,9 @@ func (a *App) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// 停止后台任务
+	a.jobCancel()
+
 	// 关闭pprof服务器
 	if a.pprofServer != nil {
 		if err := a.pprofServer.Shutdown(ctx); err != nil {
@@ -317,6 +686,25 @@ func (a *App) Shutdown() error {
 		}
 	}
 
+	// 等待领导者任务释放锁，之后才能关闭存储、数据库、缓存和Redis连接
+	leadersDone := make(chan struct{})
+	go func() {
+		a.leaders.Wait()
+		close(leadersDone)
+	}()
+	select {
+	case <-leadersDone:
+	case <-ctx.Done():
+		logger.Warn("Timed out waiting for leader tasks to stop")
+	}
+
+	// 停止存储复制任务
+	if closer, ok := a.storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close storage", "error", err)
+		}
+	}
+
 	// 关闭数据库连接
 	if a.db != nil {
 		sqlDB, err := a.db.DB()
@@ -329,12 +717,28 @@ func (a *App) Shutdown() error {
 		}
 	}
 
-	// 关闭Redis连接
+	// 从缓存工厂移除应用注册的缓存
+	for _, name := range a.cacheNames {
+		cache.GetFactory().Unregister(name)
+	}
+
+	// 停止本地缓存的失效订阅
+	if layered, ok := a.cache.(*cache.LayeredCache); ok {
+		if err := layered.Close(); err != nil {
+			logger.Error("Failed to close local cache", "error", err)
+		}
+	}
+
+	if a.memCache != nil {
+		a.memCache.Close()
+	}
+
+	// 关闭所有Redis实例的连接
 	if a.redis != nil {
 		if err := a.redis.Close(); err != nil {
 			logger.Error("Failed to close Redis connection", "error", err)
 		} else {
-			logger.Info("Redis connection closed")
+			logger.Info("Redis connection closed", "instances", a.redis.Names())
 		}
 	}
 
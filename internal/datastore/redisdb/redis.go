@@ -0,0 +1,140 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// NewClient 按实例配置创建Redis客户端，不检查连接
+// 单节点返回*redis.Client，哨兵返回自动故障转移的*redis.Client，集群返回*redis.ClusterClient
+func NewClient(name string, c configs.RedisInstance) (redis.UniversalClient, error) {
+	addrs := addrsOf(c)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("redis instance %s: no address configured", name)
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               c.DB,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		MasterName:       c.MasterName,
+		MinIdleConns:     c.MinIdleConn,
+		DialTimeout:      c.DialTimeout,
+		ReadTimeout:      c.ReadTimeout,
+		WriteTimeout:     c.WriteTimeout,
+		PoolSize:         c.PoolSize,
+		PoolTimeout:      c.PoolTimeout,
+	}
+
+	var client redis.UniversalClient
+	switch c.Mode {
+	case "", configs.RedisSingle:
+		if len(addrs) > 1 {
+			return nil, fmt.Errorf("redis instance %s: single mode accepts one address, got %d", name, len(addrs))
+		}
+		client = redis.NewClient(opts.Simple())
+	case configs.RedisSentinel:
+		if c.MasterName == "" {
+			return nil, fmt.Errorf("redis instance %s: sentinel mode requires master_name", name)
+		}
+		client = redis.NewFailoverClient(opts.Failover())
+	case configs.RedisCluster:
+		// 集群不支持SELECT，忽略DB会把数据写到意料之外的位置
+		if c.DB != 0 {
+			return nil, fmt.Errorf("redis instance %s: cluster mode does not support db %d", name, c.DB)
+		}
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		return nil, fmt.Errorf("redis instance %s: unknown mode %s", name, c.Mode)
+	}
+
+	if c.EnableTrace {
+		client.AddHook(NewTraceHook(name, c.SlowThreshold))
+	}
+	return client, nil
+}
+
+// Clients 按名称访问的Redis客户端
+type Clients struct {
+	clients map[string]redis.UniversalClient
+}
+
+// Open 创建所有启用的实例并检查连接，任一实例失败时关闭已创建的客户端
+func Open(ctx context.Context, instances map[string]configs.RedisInstance) (*Clients, error) {
+	c := &Clients{clients: make(map[string]redis.UniversalClient)}
+
+	for name, instance := range instances {
+		if !instance.Enabled {
+			continue
+		}
+
+		client, err := NewClient(name, instance)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.clients[name] = client
+
+		logger.InfoContext(ctx, "Connecting to Redis", "instance", name, "mode", modeOf(instance), "addrs", addrsOf(instance))
+		if err := client.Ping(ctx).Err(); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to ping Redis instance %s: %w", name, err)
+		}
+	}
+	return c, nil
+}
+
+// Get 获取指定名称的客户端，实例未配置或未启用时返回false
+func (c *Clients) Get(name string) (redis.UniversalClient, bool) {
+	client, ok := c.clients[name]
+	return client, ok
+}
+
+// Names 已创建的实例名称，按字母排序
+func (c *Clients) Names() []string {
+	names := make([]string, 0, len(c.clients))
+	for name := range c.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len 已创建的实例数量
+func (c *Clients) Len() int {
+	return len(c.clients)
+}
+
+// Close 关闭所有客户端
+func (c *Clients) Close() error {
+	var errs []error
+	for name, client := range c.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close Redis instance %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addrsOf 实例的节点地址，未配置Addrs时使用Addr
+func addrsOf(c configs.RedisInstance) []string {
+	if len(c.Addrs) == 0 && c.Addr != "" {
+		return []string{c.Addr}
+	}
+	return c.Addrs
+}
+
+// modeOf 实例的部署模式，未配置时为单节点
+func modeOf(c configs.RedisInstance) configs.RedisMode {
+	if c.Mode == "" {
+		return configs.RedisSingle
+	}
+	return c.Mode
+}
@@ -0,0 +1,126 @@
+package redisdb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName 链路追踪的instrumentation名称
+const tracerName = "github.com/limitcool/starter/internal/datastore/redisdb"
+
+// defaultSlowThreshold 未配置慢命令时长时的默认值
+const defaultSlowThreshold = 100 * time.Millisecond
+
+// startKey 上下文中记录命令开始时间的键
+type startKey struct{}
+
+// TraceHook 为每个命令和管道创建span并记录耗时
+// span通过全局TracerProvider导出，未配置时不产生开销；耗时记录为Debug日志，超过慢命令时长时记录Warn日志
+type TraceHook struct {
+	instance      string
+	slowThreshold time.Duration
+	tracer        trace.Tracer
+}
+
+var _ redis.Hook = (*TraceHook)(nil)
+
+// NewTraceHook 创建链路追踪钩子，slowThreshold为0时使用100ms
+func NewTraceHook(instance string, slowThreshold time.Duration) *TraceHook {
+	if slowThreshold <= 0 {
+		slowThreshold = defaultSlowThreshold
+	}
+	return &TraceHook{
+		instance:      instance,
+		slowThreshold: slowThreshold,
+		tracer:        otel.Tracer(tracerName),
+	}
+}
+
+// BeforeProcess 开始命令的span
+func (h *TraceHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis."+cmd.Name(), cmd.Name(), 1), nil
+}
+
+// AfterProcess 结束命令的span并记录耗时
+func (h *TraceHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.end(ctx, cmd.Name(), 1, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline 开始管道的span
+func (h *TraceHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis.pipeline", pipelineName(cmds), len(cmds)), nil
+}
+
+// AfterProcessPipeline 结束管道的span并记录耗时，记录第一个失败命令的错误
+func (h *TraceHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	h.end(ctx, pipelineName(cmds), len(cmds), err)
+	return nil
+}
+
+// start 创建span并记录开始时间
+func (h *TraceHook) start(ctx context.Context, spanName, operation string, count int) context.Context {
+	ctx, _ = h.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.redis.instance", h.instance),
+			attribute.Int("db.redis.num_cmd", count),
+		),
+	)
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+// end 结束span并记录耗时日志，键不存在（redis.Nil）不视为错误
+func (h *TraceHook) end(ctx context.Context, operation string, count int, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start)
+
+	fields := []any{"instance", h.instance, "command", operation, "elapsed", elapsed}
+	if count > 1 {
+		fields = append(fields, "count", count)
+	}
+	switch {
+	case err != nil && err != redis.Nil:
+		logger.WarnContext(ctx, "Redis command failed", append(fields, "error", err)...)
+	case elapsed >= h.slowThreshold:
+		logger.WarnContext(ctx, "Slow Redis command", append(fields, "threshold", h.slowThreshold)...)
+	default:
+		logger.DebugContext(ctx, "Redis command", fields...)
+	}
+}
+
+// pipelineName 管道中的命令名称，如 get set
+func pipelineName(cmds []redis.Cmder) string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	return strings.Join(names, " ")
+}
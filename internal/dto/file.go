@@ -1,14 +1,17 @@
 package dto
 
+import "time"
+
 // FileUploadResponse 文件上传响应
 type FileUploadResponse struct {
-	FileID      string   `json:"file_id"`      // 文件ID
-	UploadURL   string   `json:"upload_url"`   // 上传URL
-	Method      string   `json:"method"`       // HTTP方法
-	ExpiresIn   int      `json:"expires_in"`   // 过期时间（分钟）
-	StorageType string   `json:"storage_type"` // 存储类型
-	Usage       string   `json:"usage"`        // 文件用途
-	PathInfo    PathInfo `json:"path_info"`    // 路径信息
+	FileID      string            `json:"file_id"`           // 文件ID
+	UploadURL   string            `json:"upload_url"`        // 上传URL
+	Method      string            `json:"method"`            // HTTP方法
+	Headers     map[string]string `json:"headers,omitempty"` // 表单上传时需要与文件一起提交的表单字段，文件字段需放在最后
+	ExpiresIn   int               `json:"expires_in"`        // 过期时间（分钟）
+	StorageType string            `json:"storage_type"`      // 存储类型
+	Usage       string            `json:"usage"`             // 文件用途
+	PathInfo    PathInfo          `json:"path_info"`         // 路径信息
 }
 
 // PathInfo 路径信息
@@ -25,6 +28,8 @@ type FileDownloadResponse struct {
 	IsPublic    bool   `json:"is_public"`    // 是否公开
 	Size        int64  `json:"size"`         // 文件大小
 	StorageType string `json:"storage_type"` // 存储类型
+	SHA256      string `json:"sha256"`       // SHA-256摘要
+	MD5         string `json:"md5"`          // MD5摘要
 }
 
 // FileUploadCompleteResponse 文件上传完成响应
@@ -36,19 +41,163 @@ type FileUploadCompleteResponse struct {
 	StorageType string `json:"storage_type"` // 存储类型
 	IsPublic    bool   `json:"is_public"`    // 是否公开
 	Usage       string `json:"usage"`        // 文件用途
+	SHA256      string `json:"sha256"`       // SHA-256摘要
+	MD5         string `json:"md5"`          // MD5摘要
+	Version     int    `json:"version"`      // 版本号
+}
+
+// FileVariantResponse 文件衍生图响应
+type FileVariantResponse struct {
+	FileID      string `json:"file_id"`      // 原始文件ID
+	Name        string `json:"name"`         // 规格名称
+	DownloadURL string `json:"download_url"` // 下载URL
+	Width       int    `json:"width"`        // 宽度
+	Height      int    `json:"height"`       // 高度
+	Size        int64  `json:"size"`         // 文件大小
+	MimeType    string `json:"mime_type"`    // MIME类型
 }
 
 // FileUploadRequest 文件上传请求
 type FileUploadRequest struct {
 	Filename    string `json:"filename" binding:"required"`
 	ContentType string `json:"content_type" binding:"required"`
-	IsPublic    bool   `json:"is_public"`
-	Usage       string `json:"usage" binding:"required"` // avatar, banner, document, etc.
-	Size        int64  `json:"size,omitempty"`           // 文件大小（可选，用于预验证）
+	IsPublic    *bool  `json:"is_public"`                                           // 是否公开（可选，默认使用文件用途的配置）
+	Usage       string `json:"usage" binding:"required"`                            // avatar, banner, document, etc.
+	Size        int64  `json:"size,omitempty"`                                      // 文件大小（可选，用于预验证）
+	Method      string `json:"method,omitempty" binding:"omitempty,oneof=PUT POST"` // 上传方式（可选，POST表示浏览器表单上传）
 }
 
 // FileConfirmRequest 文件确认上传请求
 type FileConfirmRequest struct {
 	FileID string `json:"file_id" binding:"required"`
 	Size   int64  `json:"size" binding:"required"`
+	SHA256 string `json:"sha256,omitempty"` // 客户端计算的SHA-256摘要（可选，用于完整性校验）
+}
+
+// StorageUsageResponse 存储用量响应
+type StorageUsageResponse struct {
+	UserID  int64              `json:"user_id"` // 用户ID
+	Enabled bool               `json:"enabled"` // 是否启用配额限制
+	Role    string             `json:"role"`    // 配额角色
+	Total   StorageUsageItem   `json:"total"`   // 总用量
+	Usages  []StorageUsageItem `json:"usages"`  // 按文件用途的用量
+}
+
+// StorageUsageItem 存储用量项
+type StorageUsageItem struct {
+	Usage      string `json:"usage,omitempty"` // 文件用途
+	UsedBytes  int64  `json:"used_bytes"`      // 已用字节数
+	UsedFiles  int64  `json:"used_files"`      // 文件数
+	MaxBytes   int64  `json:"max_bytes"`       // 最大字节数（0表示不限制）
+	MaxFiles   int64  `json:"max_files"`       // 最大文件数（0表示不限制）
+	Overridden bool   `json:"overridden"`      // 是否为单独设置的配额
+}
+
+// StorageQuotaRequest 设置存储配额请求
+type StorageQuotaRequest struct {
+	Usage    string `json:"usage"`                     // 文件用途，为空表示总配额
+	MaxBytes int64  `json:"max_bytes" binding:"min=0"` // 最大字节数（0表示不限制）
+	MaxFiles int64  `json:"max_files" binding:"min=0"` // 最大文件数（0表示不限制）
+}
+
+// FileListRequest 用户文件列表请求
+type FileListRequest struct {
+	PageRequest
+	Usage     string `form:"usage"`      // 文件用途
+	Type      string `form:"type"`       // 文件类型（image/document/video/audio/other）
+	Keyword   string `form:"keyword"`    // 文件名关键字
+	Tag       string `form:"tag"`        // 标签名称
+	IsPublic  *bool  `form:"is_public"`  // 是否公开
+	StartTime string `form:"start_time"` // 上传时间起（RFC3339）
+	EndTime   string `form:"end_time"`   // 上传时间止（RFC3339）
+}
+
+// FileItem 用户文件列表项
+type FileItem struct {
+	ID           string    `json:"id"`            // 文件ID
+	OriginalName string    `json:"original_name"` // 原始文件名
+	Usage        string    `json:"usage"`         // 文件用途
+	Size         int64     `json:"size"`          // 文件大小
+	MimeType     string    `json:"mime_type"`     // MIME类型
+	Extension    string    `json:"extension"`     // 扩展名
+	IsPublic     bool      `json:"is_public"`     // 是否公开
+	StorageType  string    `json:"storage_type"`  // 存储类型
+	SHA256       string    `json:"sha256"`        // SHA-256摘要
+	Tags         []string  `json:"tags"`          // 标签
+	UploadedAt   time.Time `json:"uploaded_at"`   // 上传时间
+	CreatedAt    time.Time `json:"created_at"`    // 创建时间
+}
+
+// FileRenameRequest 文件重命名请求
+type FileRenameRequest struct {
+	Name string `json:"name" binding:"required,max=255"` // 新文件名
+}
+
+// FileVisibilityRequest 修改文件可见性请求
+type FileVisibilityRequest struct {
+	IsPublic *bool `json:"is_public" binding:"required"` // 是否公开
+}
+
+// FileTagsRequest 设置文件标签请求
+type FileTagsRequest struct {
+	Tags []string `json:"tags" binding:"max=20,dive,max=50"` // 标签列表，为空表示清除标签
+}
+
+// FileShareRequest 创建文件分享链接请求
+type FileShareRequest struct {
+	Password      string     `json:"password" binding:"max=72"`                  // 访问密码（可选）
+	ExpiresAt     *time.Time `json:"expires_at"`                                 // 过期时间（可选，RFC3339）
+	MaxDownloads  int        `json:"max_downloads" binding:"min=0"`              // 最大下载次数（0表示不限制）
+	AllowedEmails []string   `json:"allowed_emails" binding:"max=50,dive,email"` // 允许访问的邮箱（可选，需登录后访问）
+}
+
+// FileShareResponse 文件分享链接响应
+type FileShareResponse struct {
+	ID             uint       `json:"id"`               // 分享ID
+	FileID         string     `json:"file_id"`          // 文件ID
+	Token          string     `json:"token"`            // 访问令牌
+	URL            string     `json:"url"`              // 访问地址
+	HasPassword    bool       `json:"has_password"`     // 是否需要密码
+	ExpiresAt      *time.Time `json:"expires_at"`       // 过期时间
+	MaxDownloads   int        `json:"max_downloads"`    // 最大下载次数
+	DownloadCount  int        `json:"download_count"`   // 下载次数
+	AccessCount    int        `json:"access_count"`     // 访问次数
+	LastAccessedAt *time.Time `json:"last_accessed_at"` // 最后访问时间
+	AllowedEmails  []string   `json:"allowed_emails"`   // 允许访问的邮箱
+	Status         string     `json:"status"`           // 状态（active/expired/exhausted/revoked）
+	CreatedAt      time.Time  `json:"created_at"`       // 创建时间
+}
+
+// TrashItem 回收站列表项
+type TrashItem struct {
+	ID           string    `json:"id"`            // 文件ID
+	OriginalName string    `json:"original_name"` // 原始文件名
+	Usage        string    `json:"usage"`         // 文件用途
+	Size         int64     `json:"size"`          // 文件大小
+	MimeType     string    `json:"mime_type"`     // MIME类型
+	IsPublic     bool      `json:"is_public"`     // 恢复后是否公开
+	UploadedBy   int64     `json:"uploaded_by"`   // 上传者ID
+	DeletedAt    time.Time `json:"deleted_at"`    // 删除时间
+	PurgeAt      time.Time `json:"purge_at"`      // 永久删除时间
+}
+
+// FileVersionItem 文件版本列表项
+type FileVersionItem struct {
+	Version      int       `json:"version"`       // 版本号
+	OriginalName string    `json:"original_name"` // 原始文件名
+	Size         int64     `json:"size"`          // 文件大小
+	MimeType     string    `json:"mime_type"`     // MIME类型
+	SHA256       string    `json:"sha256"`        // SHA-256摘要
+	UploadedBy   int64     `json:"uploaded_by"`   // 上传者ID
+	UploadedAt   time.Time `json:"uploaded_at"`   // 上传时间
+	Latest       bool      `json:"latest"`        // 是否为最新版本
+}
+
+// FileArchiveRequest 批量打包下载请求，file_ids、tag和usage至少指定一个，同时指定时取交集
+type FileArchiveRequest struct {
+	FileIDs []string `json:"file_ids" binding:"max=1000"` // 文件ID列表
+	Tag     string   `json:"tag"`                         // 标签名称
+	Usage   string   `json:"usage"`                       // 文件用途
+	UserID  int64    `json:"user_id"`                     // 上传者ID，仅管理员接口有效
+	Name    string   `json:"name" binding:"max=200"`      // 压缩包文件名（不含扩展名）
 }
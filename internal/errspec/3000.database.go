@@ -33,4 +33,6 @@ var (
 	ErrQueryUserFileTotal  = errorx.Define(dbI18n, 3016, "query user file total failed", http.StatusBadRequest)        // 查询用户文件总数失败
 	ErrQueryFileList       = errorx.Define(dbI18n, 3017, "query file list failed", http.StatusBadRequest)              // 查询文件列表失败
 	ErrQueryFileTotal      = errorx.Define(dbI18n, 3018, "query file total failed", http.StatusBadRequest)             // 查询文件总数失败
+	ErrQueryFileVariant    = errorx.Define(dbI18n, 3019, "query file variant failed", http.StatusInternalServerError)  // 查询文件衍生图失败
+	ErrQueryStorageUsage   = errorx.Define(dbI18n, 3020, "query storage usage failed", http.StatusInternalServerError) // 查询存储用量失败
 )
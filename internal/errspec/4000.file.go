@@ -29,4 +29,30 @@ var (
 	ErrFileIDEmpty             = errorx.Define(fileI18n, 4012, "file id can not be empty", http.StatusBadRequest)              // 文件ID不能为空
 	ErrGetUploadFile           = errorx.Define(fileI18n, 4013, "get upload file failed", http.StatusBadRequest)                // 获取上传文件失败
 	ErrOpenUploadFile          = errorx.Define(fileI18n, 4014, "open upload file failed", http.StatusBadRequest)               // 打开上传文件失败
+	ErrFileVariantNotFound     = errorx.Define(fileI18n, 4015, "file variant does not exist", http.StatusNotFound)             // 文件衍生图不存在
+	ErrFileNotImage            = errorx.Define(fileI18n, 4016, "file is not an image", http.StatusBadRequest)                  // 文件不是图片
+	ErrFileVariantGenerate     = errorx.Define(fileI18n, 4017, "generate file variant failed", http.StatusInternalServerError) // 生成文件衍生图失败
+	ErrFileChecksumMismatch    = errorx.Define(fileI18n, 4018, "file checksum mismatch", http.StatusBadRequest)                // 文件校验和不匹配
+	ErrStorageQuotaExceeded    = errorx.Define(fileI18n, 4019, "storage quota exceeded", http.StatusForbidden)                 // 存储配额已用尽
+	ErrFileNameInvalid         = errorx.Define(fileI18n, 4020, "invalid file name", http.StatusBadRequest)                     // 文件名无效
+	ErrFileVisibilityUpdate    = errorx.Define(fileI18n, 4021, "set file visibility failed", http.StatusInternalServerError)   // 修改文件可见性失败
+	ErrShareNotFound           = errorx.Define(fileI18n, 4022, "share link does not exist", http.StatusNotFound)               // 分享链接不存在
+	ErrShareExpired            = errorx.Define(fileI18n, 4023, "share link has expired", http.StatusGone)                      // 分享链接已过期
+	ErrShareLimitReached       = errorx.Define(fileI18n, 4024, "share download limit reached", http.StatusGone)                // 分享链接下载次数已用尽
+	ErrSharePasswordInvalid    = errorx.Define(fileI18n, 4025, "invalid share password", http.StatusForbidden)                 // 分享密码错误
+	ErrShareForbidden          = errorx.Define(fileI18n, 4026, "share link access denied", http.StatusForbidden)               // 无权访问分享链接
+	ErrFileTrash               = errorx.Define(fileI18n, 4027, "move file to trash failed", http.StatusInternalServerError)    // 移入回收站失败
+	ErrFileRestore             = errorx.Define(fileI18n, 4028, "restore file failed", http.StatusInternalServerError)          // 恢复文件失败
+	ErrFileArchiveEmpty        = errorx.Define(fileI18n, 4029, "no files to archive", http.StatusNotFound)                     // 没有可打包的文件
+	ErrFileArchiveTooMany      = errorx.Define(fileI18n, 4030, "too many files to archive", http.StatusBadRequest)             // 打包的文件数超过限制
+	ErrFileRejected            = errorx.Define(fileI18n, 4031, "file rejected by scanner", http.StatusUnprocessableEntity)     // 文件未通过安全扫描
+	ErrFileScan                = errorx.Define(fileI18n, 4032, "file scan failed", http.StatusInternalServerError)             // 文件扫描失败
+	ErrFileVersionNotFound     = errorx.Define(fileI18n, 4033, "file version does not exist", http.StatusNotFound)             // 文件版本不存在
+	ErrFileVersioningDisabled  = errorx.Define(fileI18n, 4034, "file versioning not enabled", http.StatusBadRequest)           // 文件用途未启用版本管理
+	ErrFileVersionUsage        = errorx.Define(fileI18n, 4035, "file usage does not match", http.StatusBadRequest)             // 新版本的文件用途与原文件不一致
+	ErrFileVersionCreate       = errorx.Define(fileI18n, 4036, "create file version failed", http.StatusInternalServerError)   // 创建文件版本失败
+	ErrUploadMethodUnsupported = errorx.Define(fileI18n, 4037, "upload method not supported", http.StatusBadRequest)           // 存储不支持该上传方式
+	ErrFileImageTooLarge       = errorx.Define(fileI18n, 4038, "image dimensions too large", http.StatusUnprocessableEntity)   // 图片尺寸超过限制
+	ErrSharePasswordLocked     = errorx.Define(fileI18n, 4039, "too many share password attempts", http.StatusTooManyRequests) // 分享密码错误次数过多
+	ErrFileTooLarge            = errorx.Define(fileI18n, 4040, "file exceeds size limit", http.StatusRequestEntityTooLarge)    // 文件大小超过用途的限制
 )
@@ -0,0 +1,62 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// Checksum 文件校验和
+type Checksum struct {
+	SHA256 string // SHA-256十六进制摘要，用于去重和完整性校验
+	MD5    string // MD5十六进制摘要，与S3单段上传的ETag一致
+	Size   int64  // 内容大小（字节）
+}
+
+// ChecksumReader 在读取过程中计算校验和的Reader
+type ChecksumReader struct {
+	reader io.Reader
+	sha256 hash.Hash
+	md5    hash.Hash
+	size   int64
+}
+
+// NewChecksumReader 创建校验和Reader
+func NewChecksumReader(reader io.Reader) *ChecksumReader {
+	return &ChecksumReader{
+		reader: reader,
+		sha256: sha256.New(),
+		md5:    md5.New(),
+	}
+}
+
+// Read 读取数据并更新摘要
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.sha256.Write(p[:n])
+		r.md5.Write(p[:n])
+		r.size += int64(n)
+	}
+	return n, err
+}
+
+// Checksum 获取已读取内容的校验和
+func (r *ChecksumReader) Checksum() *Checksum {
+	return &Checksum{
+		SHA256: hex.EncodeToString(r.sha256.Sum(nil)),
+		MD5:    hex.EncodeToString(r.md5.Sum(nil)),
+		Size:   r.size,
+	}
+}
+
+// ComputeChecksum 读取全部内容并计算校验和
+func ComputeChecksum(reader io.Reader) (*Checksum, error) {
+	cr := NewChecksumReader(reader)
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return nil, err
+	}
+	return cr.Checksum(), nil
+}
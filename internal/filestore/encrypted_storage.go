@@ -0,0 +1,204 @@
+package filestore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 重新加密结果
+const (
+	RewrapSkipped   = "skipped"   // 无需处理
+	RewrapRewrapped = "rewrapped" // 已使用当前主密钥重新加密数据密钥
+	RewrapEncrypted = "encrypted" // 明文文件已加密
+)
+
+// ErrDecryptionRequired 加密文件在存储中保存的是密文，没有可直接访问的下载URL，需要通过应用服务器解密下载
+var ErrDecryptionRequired = errors.New("加密文件需要通过应用服务器下载")
+
+// Replicator 支持复制到备用存储的存储
+type Replicator interface {
+	Replicate(ctx context.Context, filePath string, isPublic bool) error
+}
+
+// readCloser 组合Reader和底层文件的Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// EncryptedStorage 加密存储装饰器
+// 按文件用途加密私有文件，读取这些文件时根据文件头自动解密，启用前写入的明文文件原样返回
+type EncryptedStorage struct {
+	FileStorage
+	keyring  *Keyring
+	prefixes []string
+}
+
+// NewEncryptedStorage 创建加密存储，usages为需要加密的文件用途，按内置路径规则识别用途
+func NewEncryptedStorage(storage FileStorage, keyring *Keyring, usages []string) (*EncryptedStorage, error) {
+	return NewEncryptedStorageWithPaths(storage, keyring, usages, NewPathManager())
+}
+
+// NewEncryptedStorageWithPaths 创建加密存储，按指定的路径规则识别用途
+func NewEncryptedStorageWithPaths(storage FileStorage, keyring *Keyring, usages []string, pathManager *PathManager) (*EncryptedStorage, error) {
+	prefixes := make([]string, 0, len(usages))
+	for _, usage := range usages {
+		baseDir, exists := pathManager.GetBaseDir(FileUsage(usage))
+		if !exists {
+			return nil, fmt.Errorf("未知的文件用途: %s", usage)
+		}
+		prefixes = append(prefixes, strings.TrimSuffix(baseDir, "/")+"/")
+	}
+
+	return &EncryptedStorage{
+		FileStorage: storage,
+		keyring:     keyring,
+		prefixes:    prefixes,
+	}, nil
+}
+
+// ActiveKeyID 获取当前主密钥ID
+func (s *EncryptedStorage) ActiveKeyID() string {
+	return s.keyring.ActiveKeyID()
+}
+
+// ShouldEncrypt 判断文件是否需要加密，只加密配置用途下的私有文件（包括回收站中的文件）
+func (s *EncryptedStorage) ShouldEncrypt(filePath string, isPublic bool) bool {
+	if isPublic {
+		return false
+	}
+	filePath = OriginalPath(filePath)
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(filePath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadFile 上传文件，需要加密时流式加密后写入
+func (s *EncryptedStorage) UploadFile(ctx context.Context, filePath string, reader io.Reader, isPublic bool) error {
+	if s.ShouldEncrypt(filePath, isPublic) {
+		encrypted, err := s.keyring.NewEncryptReader(reader)
+		if err != nil {
+			return fmt.Errorf("加密文件失败: %w", err)
+		}
+		reader = encrypted
+	}
+	return s.FileStorage.UploadFile(ctx, filePath, reader, isPublic)
+}
+
+// GetDownloadURL 获取下载URL，需要加密的文件返回ErrDecryptionRequired
+func (s *EncryptedStorage) GetDownloadURL(ctx context.Context, filePath string, isPublic bool) (string, error) {
+	if s.ShouldEncrypt(filePath, isPublic) {
+		return "", ErrDecryptionRequired
+	}
+	return s.FileStorage.GetDownloadURL(ctx, filePath, isPublic)
+}
+
+// GetFile 读取文件，需要加密的文件按文件头判断是否加密，加密文件流式解密
+// 公开文件和其他用途的文件原样返回，即使内容恰好以加密文件头开头
+func (s *EncryptedStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	raw, err := s.FileStorage.GetFile(ctx, filePath, isPublic)
+	if err != nil || !s.ShouldEncrypt(filePath, isPublic) {
+		return raw, err
+	}
+
+	br := bufio.NewReader(raw)
+	if !isEncrypted(br) {
+		return readCloser{Reader: br, Closer: raw}, nil
+	}
+
+	reader, err := s.keyring.NewDecryptReader(readCloser{Reader: br, Closer: raw})
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Rewrap 使用当前主密钥重新加密数据密钥，配置用途下的明文文件（如客户端直传的文件）一并加密
+func (s *EncryptedStorage) Rewrap(ctx context.Context, filePath string, isPublic bool) (string, error) {
+	raw, err := s.FileStorage.GetFile(ctx, filePath, isPublic)
+	if err != nil {
+		return "", err
+	}
+	defer raw.Close()
+
+	var (
+		br      = bufio.NewReader(raw)
+		content io.Reader
+		action  string
+	)
+	switch {
+	case isEncrypted(br):
+		if content, err = s.keyring.Rewrap(br); err != nil {
+			return "", err
+		}
+		action = RewrapRewrapped
+	case s.ShouldEncrypt(filePath, isPublic):
+		if content, err = s.keyring.NewEncryptReader(br); err != nil {
+			return "", err
+		}
+		action = RewrapEncrypted
+	}
+	if content == nil {
+		return RewrapSkipped, nil
+	}
+
+	// 先写入临时文件，避免覆盖正在读取的文件
+	tmp, err := os.CreateTemp("", "rewrap-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	raw.Close()
+
+	if err := s.FileStorage.UploadFile(ctx, filePath, tmp, isPublic); err != nil {
+		return "", err
+	}
+	return action, nil
+}
+
+// Replicate 底层为复制存储时复制到备用存储
+func (s *EncryptedStorage) Replicate(ctx context.Context, filePath string, isPublic bool) error {
+	if replicator, ok := s.FileStorage.(Replicator); ok {
+		return replicator.Replicate(ctx, filePath, isPublic)
+	}
+	return nil
+}
+
+// GetUploadForm 获取底层存储的表单上传策略，直传的内容在确认上传后通过Rewrap加密
+func (s *EncryptedStorage) GetUploadForm(ctx context.Context, filePath string, isPublic bool, policy PostPolicy) (*UploadResponse, error) {
+	if uploader, ok := s.FileStorage.(PostUploader); ok {
+		return uploader.GetUploadForm(ctx, filePath, isPublic, policy)
+	}
+	return nil, ErrPostUploadUnsupported
+}
+
+// Close 关闭底层存储
+func (s *EncryptedStorage) Close() error {
+	if closer, ok := s.FileStorage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// isEncrypted 检查文件头是否为加密格式
+func isEncrypted(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(encryptionMagic))
+	return string(magic) == encryptionMagic
+}
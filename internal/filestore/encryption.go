@@ -0,0 +1,435 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/limitcool/starter/configs"
+)
+
+// 加密文件格式：
+//
+//	magic(4) | version(1) | keyIDLen(1) | keyID | wrapNonce(12) | wrappedKey(48) | noncePrefix(7) | chunkSize(4)
+//	chunk... 每块为 AES-256-GCM(dataKey, noncePrefix | counter(4) | last(1), plaintext) ，最后一块last为1
+const (
+	encryptionMagic       = "SENC"
+	encryptionVersion     = 1
+	encryptionChunkSize   = 64 * 1024
+	encryptionMaxChunk    = 16 * 1024 * 1024
+	encryptionKeySize     = 32
+	encryptionNonceSize   = 12
+	encryptionPrefixSize  = 7
+	encryptionWrappedSize = encryptionKeySize + 16
+)
+
+// ErrNotEncrypted 文件不是加密格式
+var ErrNotEncrypted = errors.New("文件未加密")
+
+// Keyring 主密钥环，使用当前主密钥加密数据密钥，保留旧主密钥用于解密和轮换
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewKeyring 从配置加载主密钥，密钥为base64编码的32字节，或从密钥文件读取（原始32字节或base64文本）
+func NewKeyring(config configs.EncryptionConfig) (*Keyring, error) {
+	if len(config.Keys) == 0 {
+		return nil, fmt.Errorf("未配置加密主密钥")
+	}
+
+	keyring := &Keyring{
+		active: config.ActiveKey,
+		keys:   make(map[string][]byte, len(config.Keys)),
+	}
+
+	for _, k := range config.Keys {
+		if k.ID == "" || len(k.ID) > 255 {
+			return nil, fmt.Errorf("主密钥ID无效: %q", k.ID)
+		}
+		if _, exists := keyring.keys[k.ID]; exists {
+			return nil, fmt.Errorf("主密钥ID重复: %s", k.ID)
+		}
+
+		key, err := loadMasterKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("加载主密钥 %s 失败: %w", k.ID, err)
+		}
+		keyring.keys[k.ID] = key
+	}
+
+	if keyring.active == "" {
+		keyring.active = config.Keys[0].ID
+	}
+	if _, exists := keyring.keys[keyring.active]; !exists {
+		return nil, fmt.Errorf("当前主密钥不存在: %s", keyring.active)
+	}
+
+	return keyring, nil
+}
+
+// ActiveKeyID 获取当前主密钥ID
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// loadMasterKey 读取主密钥
+func loadMasterKey(config configs.MasterKeyConfig) ([]byte, error) {
+	var raw []byte
+	switch {
+	case config.Key != "":
+		raw = []byte(config.Key)
+	case config.KeyFile != "":
+		data, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == encryptionKeySize {
+			return data, nil
+		}
+		raw = data
+	default:
+		return nil, fmt.Errorf("未配置密钥或密钥文件")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("密钥不是有效的base64编码: %w", err)
+	}
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("密钥长度必须为%d字节", encryptionKeySize)
+	}
+	return key, nil
+}
+
+// encryptionHeader 加密文件头
+type encryptionHeader struct {
+	keyID       string
+	wrapNonce   []byte
+	wrappedKey  []byte
+	noncePrefix []byte
+	chunkSize   uint32
+}
+
+// marshal 序列化文件头
+func (h *encryptionHeader) marshal() []byte {
+	buf := make([]byte, 0, 6+len(h.keyID)+encryptionNonceSize+encryptionWrappedSize+encryptionPrefixSize+4)
+	buf = append(buf, encryptionMagic...)
+	buf = append(buf, encryptionVersion, byte(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = append(buf, h.wrapNonce...)
+	buf = append(buf, h.wrappedKey...)
+	buf = append(buf, h.noncePrefix...)
+	return binary.BigEndian.AppendUint32(buf, h.chunkSize)
+}
+
+// wrapAAD 数据密钥的附加认证数据，绑定主密钥ID
+func (h *encryptionHeader) wrapAAD() []byte {
+	return append([]byte(encryptionMagic+h.keyID), encryptionVersion)
+}
+
+// readEncryptionHeader 读取文件头，不是加密格式时返回ErrNotEncrypted
+func readEncryptionHeader(r io.Reader) (*encryptionHeader, error) {
+	prefix := make([]byte, 6)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	if string(prefix[:4]) != encryptionMagic {
+		return nil, ErrNotEncrypted
+	}
+	if prefix[4] != encryptionVersion {
+		return nil, fmt.Errorf("不支持的加密格式版本: %d", prefix[4])
+	}
+
+	rest := make([]byte, int(prefix[5])+encryptionNonceSize+encryptionWrappedSize+encryptionPrefixSize+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("读取加密文件头失败: %w", err)
+	}
+
+	h := &encryptionHeader{}
+	h.keyID, rest = string(rest[:prefix[5]]), rest[prefix[5]:]
+	h.wrapNonce, rest = rest[:encryptionNonceSize], rest[encryptionNonceSize:]
+	h.wrappedKey, rest = rest[:encryptionWrappedSize], rest[encryptionWrappedSize:]
+	h.noncePrefix, rest = rest[:encryptionPrefixSize], rest[encryptionPrefixSize:]
+	h.chunkSize = binary.BigEndian.Uint32(rest)
+
+	if h.chunkSize == 0 || h.chunkSize > encryptionMaxChunk {
+		return nil, fmt.Errorf("加密分块大小无效: %d", h.chunkSize)
+	}
+	return h, nil
+}
+
+// newHeader 生成数据密钥并用当前主密钥加密
+func (k *Keyring) newHeader() (*encryptionHeader, []byte, error) {
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	h := &encryptionHeader{
+		noncePrefix: make([]byte, encryptionPrefixSize),
+		chunkSize:   encryptionChunkSize,
+	}
+	if _, err := rand.Read(h.noncePrefix); err != nil {
+		return nil, nil, err
+	}
+	if err := k.wrap(h, dataKey); err != nil {
+		return nil, nil, err
+	}
+	return h, dataKey, nil
+}
+
+// wrap 使用当前主密钥加密数据密钥
+func (k *Keyring) wrap(h *encryptionHeader, dataKey []byte) error {
+	aead, err := newGCM(k.keys[k.active])
+	if err != nil {
+		return err
+	}
+
+	h.keyID = k.active
+	h.wrapNonce = make([]byte, encryptionNonceSize)
+	if _, err := rand.Read(h.wrapNonce); err != nil {
+		return err
+	}
+	h.wrappedKey = aead.Seal(nil, h.wrapNonce, dataKey, h.wrapAAD())
+	return nil
+}
+
+// unwrap 解密数据密钥
+func (k *Keyring) unwrap(h *encryptionHeader) ([]byte, error) {
+	masterKey, exists := k.keys[h.keyID]
+	if !exists {
+		return nil, fmt.Errorf("主密钥不存在: %s", h.keyID)
+	}
+
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := aead.Open(nil, h.wrapNonce, h.wrappedKey, h.wrapAAD())
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %w", err)
+	}
+	return dataKey, nil
+}
+
+// newGCM 创建AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce 计算分块的nonce
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, encryptionNonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionPrefixSize:], counter)
+	if last {
+		nonce[encryptionNonceSize-1] = 1
+	}
+	return nonce
+}
+
+// encryptReader 流式加密，每次只缓存一个分块
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	plain   []byte
+	out     bytes.Buffer
+	counter uint32
+	done    bool
+}
+
+// NewEncryptReader 返回读取加密内容的Reader
+func (k *Keyring) NewEncryptReader(src io.Reader) (io.Reader, error) {
+	header, dataKey, err := k.newHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &encryptReader{
+		src:    bufio.NewReader(src),
+		aead:   aead,
+		header: header,
+		plain:  make([]byte, header.chunkSize),
+	}
+	r.out.Write(header.marshal())
+	return r, nil
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return r.out.Read(p)
+}
+
+// sealChunk 读取并加密下一个分块，预读一个字节判断是否为最后一块
+func (r *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	last := n < len(r.plain)
+	if !last {
+		if _, err := r.src.Peek(1); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			last = true
+		}
+	}
+
+	nonce := chunkNonce(r.header.noncePrefix, r.counter, last)
+	r.out.Write(r.aead.Seal(nil, nonce, r.plain[:n], nil))
+	r.counter++
+	r.done = last
+	return nil
+}
+
+// decryptReader 流式解密，每次只缓存一个分块
+type decryptReader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	sealed  []byte
+	out     []byte
+	counter uint32
+	done    bool
+}
+
+// NewDecryptReader 返回读取解密内容的Reader，src不是加密格式时返回ErrNotEncrypted
+func (k *Keyring) NewDecryptReader(src io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(src)
+	header, err := readEncryptionHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := k.unwrap(header)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &decryptReader{
+		src:    br,
+		aead:   aead,
+		header: header,
+		sealed: make([]byte, int(header.chunkSize)+aead.Overhead()),
+	}
+	if c, ok := src.(io.Closer); ok {
+		r.closer = c
+	}
+	return r, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.openChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// openChunk 读取并解密下一个分块，最后一块的标记防止文件被截断
+func (r *decryptReader) openChunk() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("加密文件被截断")
+		}
+		return err
+	}
+
+	last := n < len(r.sealed)
+	if !last {
+		if _, err := r.src.Peek(1); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			last = true
+		}
+	}
+
+	nonce := chunkNonce(r.header.noncePrefix, r.counter, last)
+	plain, err := r.aead.Open(r.sealed[:0], nonce, r.sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("解密文件失败: %w", err)
+	}
+
+	r.out = plain
+	r.counter++
+	r.done = last
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Rewrap 使用当前主密钥重新加密src的数据密钥，内容密文不变
+// 返回新的加密内容，数据密钥已使用当前主密钥时返回nil
+func (k *Keyring) Rewrap(src io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(src)
+	header, err := readEncryptionHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if header.keyID == k.active {
+		return nil, nil
+	}
+
+	dataKey, err := k.unwrap(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.wrap(header, dataKey); err != nil {
+		return nil, err
+	}
+
+	return io.MultiReader(bytes.NewReader(header.marshal()), br), nil
+}
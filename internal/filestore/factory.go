@@ -1,6 +1,7 @@
 package filestore
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/limitcool/starter/configs"
@@ -13,7 +14,51 @@ func NewFileStorage(config configs.Config) (FileStorage, error) {
 		return nil, fmt.Errorf("文件存储未启用")
 	}
 
-	switch config.Storage.Type {
+	storage, err := NewFileStorageByType(config, config.Storage.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if replication := config.Storage.Replication; replication.Enabled {
+		if replication.Secondary == config.Storage.Type {
+			return nil, fmt.Errorf("备用存储不能与主存储相同: %s", replication.Secondary)
+		}
+
+		secondary, err := NewFileStorageByType(config, replication.Secondary)
+		if err != nil {
+			return nil, fmt.Errorf("创建备用存储失败: %w", err)
+		}
+
+		if storage, err = NewReplicatedStorage(NewStorageManager(storage, secondary), replication); err != nil {
+			return nil, err
+		}
+	}
+
+	// 加密在复制之外，主存储和备用存储中保存的都是密文
+	return WithEncryption(config, storage)
+}
+
+// WithEncryption 启用加密时使用加密存储装饰存储实例，否则原样返回
+func WithEncryption(config configs.Config, storage FileStorage) (FileStorage, error) {
+	encryption := config.Storage.Encryption
+	if !encryption.Enabled {
+		return storage, nil
+	}
+
+	keyring, err := NewKeyring(encryption)
+	if err != nil {
+		return nil, err
+	}
+	pathManager, err := NewPathManagerFromConfig(config.Storage.PathConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedStorageWithPaths(storage, keyring, encryption.Usages, pathManager)
+}
+
+// NewFileStorageByType 按指定类型创建文件存储实例（用于在不同存储之间迁移）
+func NewFileStorageByType(config configs.Config, storageType types.StorageType) (FileStorage, error) {
+	switch storageType {
 	case types.StorageTypeLocal:
 		return NewLocalStorage(
 			config.Storage.Local.Path,
@@ -31,7 +76,7 @@ func NewFileStorage(config configs.Config) (FileStorage, error) {
 		return NewMinIOStorage(minioConfig)
 
 	default:
-		return nil, fmt.Errorf("不支持的存储类型: %s", config.Storage.Type)
+		return nil, fmt.Errorf("不支持的存储类型: %s", storageType)
 	}
 }
 
@@ -66,3 +111,56 @@ func (sm *StorageManager) GetSecondary() FileStorage {
 func (sm *StorageManager) HasSecondary() bool {
 	return sm.secondary != nil
 }
+
+// CopyFromSecondary 将文件从备用存储流式复制到主存储，返回复制内容的校验和
+func (sm *StorageManager) CopyFromSecondary(ctx context.Context, filePath string, isPublic bool) (*Checksum, error) {
+	if sm.secondary == nil {
+		return nil, fmt.Errorf("未配置备用存储")
+	}
+
+	reader, err := sm.secondary.GetFile(ctx, filePath, isPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	cr := NewChecksumReader(reader)
+	if err := sm.primary.UploadFile(ctx, filePath, cr, isPublic); err != nil {
+		return nil, err
+	}
+
+	return cr.Checksum(), nil
+}
+
+// CopyToSecondary 将文件从主存储流式复制到备用存储
+func (sm *StorageManager) CopyToSecondary(ctx context.Context, filePath string, isPublic bool) error {
+	if sm.secondary == nil {
+		return fmt.Errorf("未配置备用存储")
+	}
+
+	reader, err := sm.primary.GetFile(ctx, filePath, isPublic)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return sm.secondary.UploadFile(ctx, filePath, reader, isPublic)
+}
+
+// VerifyPrimary 读取主存储中的文件并校验SHA-256摘要
+func (sm *StorageManager) VerifyPrimary(ctx context.Context, filePath string, isPublic bool, sha256 string) error {
+	reader, err := sm.primary.GetFile(ctx, filePath, isPublic)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	checksum, err := ComputeChecksum(reader)
+	if err != nil {
+		return err
+	}
+	if checksum.SHA256 != sha256 {
+		return fmt.Errorf("校验和不匹配: 期望 %s, 实际 %s", sha256, checksum.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	jpegSOI      = []byte{0xFF, 0xD8}
+	pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+	errCorruptImage = errors.New("图片数据损坏")
+)
+
+// StripImageMetadata 移除图片中的EXIF/GPS/XMP等元数据
+// 只删除元数据段，像素数据保持不变（无损），JPEG保留EXIF中的方向标签，不支持的格式原样返回
+func StripImageMetadata(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNGMetadata(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebPMetadata(data)
+	default:
+		return data, nil
+	}
+}
+
+// stripJPEGMetadata 删除JPEG的APP1(EXIF/XMP)、APP13(IPTC)和COM段
+// 保留APP0(JFIF)、APP2(ICC)和APP14(Adobe)等影响显示效果的段，EXIF中的方向标签写回只包含该标签的EXIF段
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, jpegSOI...)
+
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, errCorruptImage
+		}
+		// 跳过填充字节
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, errCorruptImage
+		}
+		marker := data[pos]
+		pos++
+
+		// 无长度字段的独立标记
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, 0xFF, marker)
+			continue
+		}
+		if marker == 0xD9 {
+			out = append(out, 0xFF, marker)
+			return out, nil
+		}
+
+		if pos+2 > len(data) {
+			return nil, errCorruptImage
+		}
+		length := int(binary.BigEndian.Uint16(data[pos : pos+2]))
+		if length < 2 || pos+length > len(data) {
+			return nil, errCorruptImage
+		}
+		segment := data[pos : pos+length]
+		pos += length
+
+		// SOS之后是压缩数据，原样复制剩余内容
+		if marker == 0xDA {
+			out = append(out, 0xFF, marker)
+			out = append(out, segment...)
+			out = append(out, data[pos:]...)
+			return out, nil
+		}
+
+		if marker == 0xE1 || marker == 0xED || marker == 0xFE {
+			// 相机按拍摄方向记录的照片需要方向标签才能正确显示
+			if marker == 0xE1 {
+				if orientation := exifOrientation(segment[2:]); orientation > 1 {
+					out = append(out, orientationEXIF(orientation)...)
+				}
+			}
+			continue
+		}
+
+		out = append(out, 0xFF, marker)
+		out = append(out, segment...)
+	}
+
+	return out, nil
+}
+
+// exifHeader APP1段中EXIF数据的标识
+const exifHeader = "Exif\x00\x00"
+
+// exifOrientationTag EXIF中的方向标签
+const exifOrientationTag = 0x0112
+
+// jpegOrientation 获取JPEG的EXIF方向（1-8），没有方向标签时返回1
+func jpegOrientation(data []byte) int {
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		// SOS之后是压缩数据，EXIF只出现在之前
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		if marker == 0xE1 {
+			if orientation := exifOrientation(data[pos+4 : pos+2+length]); orientation > 1 {
+				return orientation
+			}
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation 从APP1段的内容中读取IFD0的方向标签，不是EXIF或没有方向标签时返回0
+func exifOrientation(payload []byte) int {
+	tiff, ok := bytes.CutPrefix(payload, []byte(exifHeader))
+	if !ok || len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// 方向为SHORT类型，值保存在条目的值字段中
+		if order.Uint16(tiff[entry:entry+2]) == exifOrientationTag {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+	return 0
+}
+
+// orientationEXIF 只包含方向标签的APP1段
+func orientationEXIF(orientation int) []byte {
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	segment = append(segment, exifHeader...)
+	segment = append(segment, 'M', 'M', 0, 42, 0, 0, 0, 8) // 大端TIFF头，IFD0紧随其后
+	segment = append(segment, 0, 1)                        // 1个条目
+	segment = binary.BigEndian.AppendUint16(segment, exifOrientationTag)
+	segment = append(segment, 0, 3, 0, 0, 0, 1) // SHORT类型，1个值
+	segment = append(segment, 0, byte(orientation), 0, 0)
+	segment = append(segment, 0, 0, 0, 0) // 没有下一个IFD
+	binary.BigEndian.PutUint16(segment[2:4], uint16(len(segment)-2))
+	return segment
+}
+
+// pngMetadataChunks 需要删除的PNG元数据块
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNGMetadata 删除PNG中的文本和EXIF块
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errCorruptImage
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length // 长度 + 类型 + 数据 + CRC
+		if length < 0 || end > len(data) {
+			return nil, errCorruptImage
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// stripWebPMetadata 删除WebP中的EXIF和XMP块，并清除VP8X头中的对应标志位
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errCorruptImage
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2 // 块大小为奇数时有一个填充字节
+		if size < 0 || end > len(data) {
+			return nil, errCorruptImage
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			// 丢弃元数据块
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF标志位和XMP标志位
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	// 更新RIFF头中的文件大小
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,351 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+
+	"github.com/limitcool/starter/configs"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册WebP解码器
+)
+
+// 缩放模式
+const (
+	ResizeModeFit  = "fit"  // 等比缩放，完整显示在目标尺寸内
+	ResizeModeFill = "fill" // 等比缩放后居中裁剪，填满目标尺寸
+)
+
+// 输出格式
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+	ImageFormatGIF  = "gif"
+	ImageFormatWebP = "webp"
+)
+
+// defaultMaxPixels 生成衍生图时默认允许的最大像素数
+const defaultMaxPixels = 40_000_000
+
+// ErrImageTooLarge 图片像素数超过限制，解码会占用过多内存
+var ErrImageTooLarge = errors.New("图片尺寸超过限制")
+
+// VariantSpec 衍生图规格
+type VariantSpec struct {
+	Name    string // 规格名称
+	Width   int    // 目标宽度
+	Height  int    // 目标高度
+	Mode    string // 缩放模式
+	Format  string // 输出格式，为空时保持原格式
+	Quality int    // JPEG输出质量
+}
+
+// defaultVariants 内置的衍生图规格
+var defaultVariants = map[FileUsage][]VariantSpec{
+	FileUsageAvatar: {
+		{Name: "small", Width: 64, Height: 64, Mode: ResizeModeFill},
+		{Name: "medium", Width: 128, Height: 128, Mode: ResizeModeFill},
+		{Name: "large", Width: 256, Height: 256, Mode: ResizeModeFill},
+	},
+	FileUsageProfile: {
+		{Name: "thumb", Width: 320, Height: 320, Mode: ResizeModeFit},
+	},
+	FileUsageBanner: {
+		{Name: "thumb", Width: 640, Height: 0, Mode: ResizeModeFit},
+	},
+	FileUsageCover: {
+		{Name: "thumb", Width: 480, Height: 270, Mode: ResizeModeFill},
+	},
+	FileUsageGallery: {
+		{Name: "thumb", Width: 320, Height: 320, Mode: ResizeModeFill},
+		{Name: "preview", Width: 1280, Height: 1280, Mode: ResizeModeFit},
+	},
+	FileUsagePost: {
+		{Name: "thumb", Width: 480, Height: 0, Mode: ResizeModeFit},
+	},
+}
+
+// imageExts 支持处理的图片扩展名
+var imageExts = map[string]string{
+	".jpg":  ImageFormatJPEG,
+	".jpeg": ImageFormatJPEG,
+	".png":  ImageFormatPNG,
+	".gif":  ImageFormatGIF,
+	".webp": ImageFormatWebP,
+}
+
+// ImageProcessor 图片处理器
+type ImageProcessor struct {
+	enabled          bool
+	generateOnUpload bool
+	stripMetadata    bool
+	maxPixels        int64
+	variants         map[FileUsage][]VariantSpec
+}
+
+// NewImageProcessor 创建图片处理器
+func NewImageProcessor(config configs.ImageConfig) *ImageProcessor {
+	p := &ImageProcessor{
+		enabled:          config.Enabled,
+		generateOnUpload: config.GenerateOnUpload,
+		stripMetadata:    config.StripMetadata,
+		maxPixels:        config.MaxPixels,
+		variants:         defaultVariants,
+	}
+	if p.maxPixels <= 0 {
+		p.maxPixels = defaultMaxPixels
+	}
+
+	// 使用配置中的规格覆盖内置规格
+	if len(config.Variants) > 0 {
+		p.variants = make(map[FileUsage][]VariantSpec, len(config.Variants))
+		for usage, variants := range config.Variants {
+			specs := make([]VariantSpec, 0, len(variants))
+			for _, v := range variants {
+				specs = append(specs, VariantSpec{
+					Name:    v.Name,
+					Width:   v.Width,
+					Height:  v.Height,
+					Mode:    v.Mode,
+					Format:  v.Format,
+					Quality: v.Quality,
+				})
+			}
+			p.variants[FileUsage(strings.ToLower(usage))] = specs
+		}
+	}
+
+	return p
+}
+
+// Enabled 是否启用图片处理
+func (p *ImageProcessor) Enabled() bool {
+	return p.enabled
+}
+
+// GenerateOnUpload 是否在上传时生成衍生图
+func (p *ImageProcessor) GenerateOnUpload() bool {
+	return p.enabled && p.generateOnUpload
+}
+
+// ShouldStripMetadata 是否需要移除元数据
+func (p *ImageProcessor) ShouldStripMetadata(ext string) bool {
+	return p.enabled && p.stripMetadata && IsImageExtension(ext)
+}
+
+// Variants 获取文件用途对应的衍生图规格
+func (p *ImageProcessor) Variants(usage FileUsage) []VariantSpec {
+	return p.variants[usage]
+}
+
+// Variant 获取指定名称的衍生图规格
+func (p *ImageProcessor) Variant(usage FileUsage, name string) (VariantSpec, bool) {
+	for _, spec := range p.variants[usage] {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return VariantSpec{}, false
+}
+
+// ProcessedImage 处理后的图片
+type ProcessedImage struct {
+	Data     []byte // 图片内容
+	Width    int    // 宽度
+	Height   int    // 高度
+	Format   string // 图片格式
+	MimeType string // MIME类型
+	Ext      string // 扩展名（包含点号）
+}
+
+// Resize 按规格生成衍生图，按JPEG的EXIF方向旋转，输出的衍生图不带方向标签
+// 解码前先读取图片尺寸，像素数超过限制时返回ErrImageTooLarge，避免很小的文件解码后占用大量内存
+func (p *ImageProcessor) Resize(data []byte, spec VariantSpec) (*ProcessedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > p.maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+
+	// 先缩放再旋转，旋转90度的方向按交换宽高后的规格缩放
+	orientation := 1
+	if format == ImageFormatJPEG {
+		orientation = jpegOrientation(data)
+	}
+	if orientation >= 5 {
+		spec.Width, spec.Height = spec.Height, spec.Width
+	}
+	dst := orientImage(resizeImage(src, spec), orientation)
+
+	// 确定输出格式，WebP和GIF没有纯Go编码器，统一转换
+	outFormat := strings.ToLower(spec.Format)
+	if outFormat == "jpg" {
+		outFormat = ImageFormatJPEG
+	}
+	if outFormat == "" {
+		outFormat = format
+	}
+	if outFormat != ImageFormatJPEG && outFormat != ImageFormatPNG {
+		outFormat = ImageFormatPNG
+	}
+
+	var buf bytes.Buffer
+	switch outFormat {
+	case ImageFormatJPEG:
+		quality := spec.Quality
+		if quality <= 0 || quality > 100 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("编码图片失败: %w", err)
+	}
+
+	bounds := dst.Bounds()
+	return &ProcessedImage{
+		Data:     buf.Bytes(),
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Format:   outFormat,
+		MimeType: "image/" + outFormat,
+		Ext:      formatExt(outFormat),
+	}, nil
+}
+
+// resizeImage 按规格缩放图片，不会放大原图
+func resizeImage(src image.Image, spec VariantSpec) image.Image {
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcW == 0 || srcH == 0 {
+		return src
+	}
+
+	targetW, targetH := spec.Width, spec.Height
+	switch {
+	case targetW <= 0 && targetH <= 0:
+		targetW, targetH = srcW, srcH
+	case targetW <= 0:
+		targetW = srcW * targetH / srcH
+	case targetH <= 0:
+		targetH = srcH * targetW / srcW
+	}
+
+	srcRect := src.Bounds()
+	var dstW, dstH int
+
+	if spec.Mode == ResizeModeFill && spec.Width > 0 && spec.Height > 0 {
+		// 计算居中裁剪区域，使其宽高比与目标一致
+		if srcW*targetH > srcH*targetW {
+			cropW := srcH * targetW / targetH
+			x0 := srcRect.Min.X + (srcW-cropW)/2
+			srcRect = image.Rect(x0, srcRect.Min.Y, x0+cropW, srcRect.Max.Y)
+		} else {
+			cropH := srcW * targetH / targetW
+			y0 := srcRect.Min.Y + (srcH-cropH)/2
+			srcRect = image.Rect(srcRect.Min.X, y0, srcRect.Max.X, y0+cropH)
+		}
+		dstW, dstH = targetW, targetH
+		if dstW > srcRect.Dx() {
+			dstW, dstH = srcRect.Dx(), srcRect.Dy()
+		}
+	} else {
+		// 等比缩放到目标尺寸之内
+		dstW, dstH = srcW, srcH
+		if dstW > targetW {
+			dstH = dstH * targetW / dstW
+			dstW = targetW
+		}
+		if dstH > targetH {
+			dstW = dstW * targetH / dstH
+			dstH = targetH
+		}
+	}
+
+	dstW = max(dstW, 1)
+	dstH = max(dstH, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Over, nil)
+	return dst
+}
+
+// orientImage 按EXIF方向旋转或翻转图片，使像素方向与显示方向一致
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转180度
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转90度
+				dx, dy = h-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转90度
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// IsImageExtension 判断扩展名是否为支持处理的图片
+func IsImageExtension(ext string) bool {
+	_, ok := imageExts[strings.ToLower(ext)]
+	return ok
+}
+
+// VariantPath 生成衍生图路径，与原文件存放在同一目录
+// 例如 content/gallery/2025/01/02/uuid.jpg -> content/gallery/2025/01/02/uuid_thumb.jpg
+func VariantPath(originalPath, name, ext string) string {
+	dir, file := path.Split(originalPath)
+	base := strings.TrimSuffix(file, path.Ext(file))
+	return fmt.Sprintf("%s%s_%s%s", dir, base, name, ext)
+}
+
+func formatExt(format string) string {
+	switch format {
+	case ImageFormatJPEG:
+		return ".jpg"
+	case ImageFormatGIF:
+		return ".gif"
+	case ImageFormatWebP:
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
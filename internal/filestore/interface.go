@@ -2,7 +2,9 @@ package filestore
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
 // FileStorage 文件存储接口
@@ -26,6 +28,11 @@ type FileStorage interface {
 	// isPublic: 是否公开文件
 	UploadFile(ctx context.Context, filePath string, reader io.Reader, isPublic bool) error
 
+	// GetFile 读取文件内容，调用方负责关闭返回的Reader
+	// filePath: 文件路径（不包含public/private前缀）
+	// isPublic: 是否公开文件
+	GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error)
+
 	// FileExists 检查文件是否存在
 	// filePath: 文件路径（不包含public/private前缀）
 	// isPublic: 是否公开文件
@@ -36,6 +43,11 @@ type FileStorage interface {
 	// isPublic: 是否公开文件
 	DeleteFile(ctx context.Context, filePath string, isPublic bool) error
 
+	// ListFiles 遍历存储中的文件
+	// isPublic: 是否公开文件
+	// fn: 对每个文件调用，返回错误时停止遍历并返回该错误
+	ListFiles(ctx context.Context, isPublic bool, fn func(info FileInfo) error) error
+
 	// GetStorageType 获取存储类型
 	GetStorageType() string
 
@@ -43,11 +55,38 @@ type FileStorage interface {
 	BuildFullPath(filePath string, isPublic bool) string
 }
 
+// PostUploader 支持浏览器表单POST直传的存储
+type PostUploader interface {
+	// GetUploadForm 获取表单上传的地址和表单字段
+	// filePath: 文件路径（不包含public/private前缀）
+	// isPublic: 是否公开文件
+	// policy: 上传策略，限制文件大小和类型
+	// returns: 上传地址和需与文件一起提交的表单字段, error
+	GetUploadForm(ctx context.Context, filePath string, isPublic bool, policy PostPolicy) (*UploadResponse, error)
+}
+
+// ErrPostUploadUnsupported 底层存储不支持表单POST直传
+var ErrPostUploadUnsupported = errors.New("存储不支持表单上传")
+
+// PostPolicy 表单上传策略
+type PostPolicy struct {
+	ContentType string        // 文件MIME类型，作为表单字段提交，并限制提交的类型以其媒体类型开头
+	MaxSize     int64         // 最大文件大小（字节），0表示不限制
+	Expires     time.Duration // 有效期，为0时使用默认的15分钟
+}
+
+// FileInfo 存储中的文件信息
+type FileInfo struct {
+	Path    string    // 文件路径（不包含public/private前缀）
+	Size    int64     // 文件大小（字节）
+	ModTime time.Time // 最后修改时间
+}
+
 // UploadResponse 上传响应
 type UploadResponse struct {
-	UploadURL string `json:"upload_url"`
-	Method    string `json:"method"`    // PUT 或 POST
-	Headers   map[string]string `json:"headers,omitempty"`
+	UploadURL string            `json:"upload_url"`
+	Method    string            `json:"method"`            // PUT 或 POST
+	Headers   map[string]string `json:"headers,omitempty"` // 表单上传时为需要提交的表单字段
 }
 
 // DownloadResponse 下载响应
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -65,6 +66,18 @@ func (l *LocalStorage) UploadFile(ctx context.Context, filePath string, reader i
 	return nil
 }
 
+// GetFile 读取本地文件内容
+func (l *LocalStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	fullPath := l.BuildFullPath(filePath, isPublic)
+	absolutePath := filepath.Join(l.basePath, fullPath)
+
+	file, err := os.Open(absolutePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	return file, nil
+}
+
 // FileExists 检查文件是否存在
 func (l *LocalStorage) FileExists(ctx context.Context, filePath string, isPublic bool) (bool, error) {
 	fullPath := l.BuildFullPath(filePath, isPublic)
@@ -87,6 +100,45 @@ func (l *LocalStorage) DeleteFile(ctx context.Context, filePath string, isPublic
 	return os.Remove(absolutePath)
 }
 
+// ListFiles 遍历本地存储中的文件
+func (l *LocalStorage) ListFiles(ctx context.Context, isPublic bool, fn func(info FileInfo) error) error {
+	root := filepath.Join(l.basePath, l.BuildFullPath("", isPublic))
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(FileInfo{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	})
+
+	// 目录不存在说明还没有文件
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 // GetStorageType 获取存储类型
 func (l *LocalStorage) GetStorageType() string {
 	return "local"
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"strings"
 	"time"
 
@@ -84,6 +85,55 @@ func (m *MinIOStorage) GetUploadURL(ctx context.Context, filePath string, conten
 	return req.URL, "PUT", nil
 }
 
+// GetUploadForm 生成表单POST上传的预签名策略
+// 策略限制对象键、文件大小范围和Content-Type前缀，客户端需将返回的字段与文件一起提交
+func (m *MinIOStorage) GetUploadForm(ctx context.Context, filePath string, isPublic bool, policy PostPolicy) (*UploadResponse, error) {
+	fullPath := m.BuildFullPath(filePath, isPublic)
+
+	var conditions []interface{}
+	if policy.MaxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", 0, policy.MaxSize})
+	}
+
+	fields := make(map[string]string)
+	if policy.ContentType != "" {
+		mediaType, _, err := mime.ParseMediaType(policy.ContentType)
+		if err != nil {
+			mediaType = policy.ContentType
+		}
+		conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", mediaType})
+		fields["Content-Type"] = policy.ContentType
+	}
+
+	expires := policy.Expires
+	if expires <= 0 {
+		expires = 15 * time.Minute // 默认15分钟有效期
+	}
+
+	// 生成PostObject预签名策略，未指定key条件时SDK限制为当前对象键
+	presigner := s3.NewPresignClient(m.client)
+	req, err := presigner.PresignPostObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(m.bucket),
+		Key:    aws.String(fullPath),
+	}, func(opts *s3.PresignPostOptions) {
+		opts.Expires = expires
+		opts.Conditions = conditions
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成表单上传策略失败: %w", err)
+	}
+
+	for k, v := range req.Values {
+		fields[k] = v
+	}
+
+	return &UploadResponse{
+		UploadURL: req.URL,
+		Method:    "POST",
+		Headers:   fields,
+	}, nil
+}
+
 // GetDownloadURL 获取下载URL
 func (m *MinIOStorage) GetDownloadURL(ctx context.Context, filePath string, isPublic bool) (string, error) {
 	fullPath := m.BuildFullPath(filePath, isPublic)
@@ -133,6 +183,20 @@ func (m *MinIOStorage) UploadFile(ctx context.Context, filePath string, reader i
 	return nil
 }
 
+// GetFile 读取MinIO中的文件内容
+func (m *MinIOStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	fullPath := m.BuildFullPath(filePath, isPublic)
+
+	output, err := m.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.bucket),
+		Key:    aws.String(fullPath),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("从MinIO读取文件失败: %w", err)
+	}
+	return output.Body, nil
+}
+
 // FileExists 检查文件是否存在
 func (m *MinIOStorage) FileExists(ctx context.Context, filePath string, isPublic bool) (bool, error) {
 	fullPath := m.BuildFullPath(filePath, isPublic)
@@ -161,6 +225,37 @@ func (m *MinIOStorage) DeleteFile(ctx context.Context, filePath string, isPublic
 	return err
 }
 
+// ListFiles 遍历MinIO中的文件
+func (m *MinIOStorage) ListFiles(ctx context.Context, isPublic bool, fn func(info FileInfo) error) error {
+	prefix := m.BuildFullPath("", isPublic)
+
+	paginator := s3.NewListObjectsV2Paginator(m.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(m.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("列出MinIO文件失败: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			info := FileInfo{
+				Path: strings.TrimPrefix(aws.ToString(obj.Key), prefix),
+				Size: aws.ToInt64(obj.Size),
+			}
+			if obj.LastModified != nil {
+				info.ModTime = *obj.LastModified
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // GetStorageType 获取存储类型
 func (m *MinIOStorage) GetStorageType() string {
 	return "minio"
@@ -2,10 +2,17 @@ package filestore
 
 import (
 	"fmt"
+	"mime"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/limitcool/starter/configs"
 	"github.com/limitcool/starter/internal/pkg/idgen"
 )
 
@@ -38,144 +45,221 @@ const (
 	FileUsageGeneral FileUsage = "general" // 通用文件
 )
 
+// 上传角色，用于限制允许上传某种用途文件的用户
+const (
+	RoleAdmin = "admin" // 管理员
+	RoleUser  = "user"  // 普通用户
+)
+
+// usageNamePattern 文件用途名称格式，与files.usage字段长度一致
+var usageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
 // PathManager 路径管理器
+// 规则来自配置，未配置时使用内置规则，运行时可以通过Reload替换
 type PathManager struct {
-	// 路径配置
-	pathConfig map[FileUsage]PathConfig
+	rules atomic.Pointer[pathRules]
 }
 
-// PathConfig 路径配置
-type PathConfig struct {
-	BaseDir     string   // 基础目录
-	UseDate     bool     // 是否使用日期分组
-	DateFormat  string   // 日期格式
-	MaxFileSize int64    // 最大文件大小 (字节)
-	AllowedExts []string // 允许的文件扩展名
+// pathRules 校验后的路径规则
+type pathRules struct {
+	usages   map[FileUsage]*PathRule
+	fallback *PathRule // 未配置用途使用的规则，为nil时拒绝
 }
 
-// NewPathManager 创建路径管理器
-func NewPathManager() *PathManager {
-	return &PathManager{
-		pathConfig: map[FileUsage]PathConfig{
-			// 用户相关 - 按用户ID分组
-			FileUsageAvatar: {
-				BaseDir:     "users/avatars",
-				UseDate:     false,
-				MaxFileSize: 5 * 1024 * 1024, // 5MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp"},
-			},
-			FileUsageProfile: {
-				BaseDir:     "users/profiles",
-				UseDate:     false,
-				MaxFileSize: 10 * 1024 * 1024, // 10MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp"},
-			},
-
-			// 内容相关 - 按日期分组
-			FileUsageBanner: {
-				BaseDir:     "content/banners",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 20 * 1024 * 1024, // 20MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp", ".svg"},
-			},
-			FileUsageCover: {
-				BaseDir:     "content/covers",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 15 * 1024 * 1024, // 15MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp"},
-			},
-			FileUsageGallery: {
-				BaseDir:     "content/gallery",
-				UseDate:     true,
-				DateFormat:  "2006/01/02",
-				MaxFileSize: 10 * 1024 * 1024, // 10MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp"},
-			},
-			FileUsagePost: {
-				BaseDir:     "content/posts",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 10 * 1024 * 1024, // 10MB
-				AllowedExts: []string{".jpg", ".jpeg", ".png", ".webp", ".gif"},
-			},
-
-			// 文档相关 - 按年月分组
-			FileUsageDocument: {
-				BaseDir:     "documents/general",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 50 * 1024 * 1024, // 50MB
-				AllowedExts: []string{".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".txt"},
-			},
-			FileUsageReport: {
-				BaseDir:     "documents/reports",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 100 * 1024 * 1024, // 100MB
-				AllowedExts: []string{".pdf", ".doc", ".docx", ".xls", ".xlsx"},
-			},
-			FileUsageContract: {
-				BaseDir:     "documents/contracts",
-				UseDate:     true,
-				DateFormat:  "2006",
-				MaxFileSize: 50 * 1024 * 1024, // 50MB
-				AllowedExts: []string{".pdf", ".doc", ".docx"},
-			},
-
-			// 媒体相关 - 按年月分组
-			FileUsageVideo: {
-				BaseDir:     "media/videos",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 500 * 1024 * 1024, // 500MB
-				AllowedExts: []string{".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm"},
-			},
-			FileUsageAudio: {
-				BaseDir:     "media/audio",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 100 * 1024 * 1024, // 100MB
-				AllowedExts: []string{".mp3", ".wav", ".flac", ".aac", ".ogg"},
-			},
-
-			// 系统相关
-			FileUsageTemp: {
-				BaseDir:     "system/temp",
-				UseDate:     true,
-				DateFormat:  "2006/01/02",
-				MaxFileSize: 100 * 1024 * 1024, // 100MB
-				AllowedExts: []string{},        // 允许所有类型
-			},
-			FileUsageBackup: {
-				BaseDir:     "system/backups",
-				UseDate:     true,
-				DateFormat:  "2006/01",
-				MaxFileSize: 1024 * 1024 * 1024, // 1GB
-				AllowedExts: []string{".zip", ".tar", ".gz", ".sql"},
-			},
-			FileUsageGeneral: {
-				BaseDir:     "general",
-				UseDate:     true,
-				DateFormat:  "2006/01/02",
-				MaxFileSize: 50 * 1024 * 1024, // 50MB
-				AllowedExts: []string{},       // 允许所有类型
-			},
+// PathRule 文件用途的路径规则
+type PathRule struct {
+	Usage       FileUsage // 文件用途
+	BaseDir     string    // 基础目录
+	DateLayout  string    // 日期分组格式，为空时不按日期分组
+	UserDir     bool      // 是否按上传者分组
+	MaxFileSize int64     // 最大文件大小 (字节)，0表示不限制
+	AllowedExts []string  // 允许的文件扩展名
+	MimeTypes   []string  // 允许的MIME类型
+	Public      bool      // 默认是否公开
+	Roles       []string  // 允许上传的角色
+	Versioned   bool      // 是否启用版本管理
+	MaxVersions int       // 保留的历史版本数，0表示不限制
+}
+
+// DefaultPathRules 内置的文件用途规则
+func DefaultPathRules() map[string]configs.UsageRule {
+	images := []string{".jpg", ".jpeg", ".png", ".webp"}
+	documents := []string{".pdf", ".doc", ".docx", ".xls", ".xlsx"}
+
+	return map[string]configs.UsageRule{
+		// 用户相关 - 按用户ID分组
+		string(FileUsageAvatar): {
+			BaseDir:     "users/avatars",
+			UserDir:     true,
+			MaxFileSize: 5 * 1024 * 1024, // 5MB
+			AllowedExts: images,
+		},
+		string(FileUsageProfile): {
+			BaseDir:     "users/profiles",
+			UserDir:     true,
+			MaxFileSize: 10 * 1024 * 1024, // 10MB
+			AllowedExts: images,
+		},
+
+		// 内容相关 - 按日期分组
+		string(FileUsageBanner): {
+			BaseDir:     "content/banners",
+			DateLayout:  "2006/01",
+			MaxFileSize: 20 * 1024 * 1024, // 20MB
+			AllowedExts: append(slices.Clone(images), ".svg"),
+		},
+		string(FileUsageCover): {
+			BaseDir:     "content/covers",
+			DateLayout:  "2006/01",
+			MaxFileSize: 15 * 1024 * 1024, // 15MB
+			AllowedExts: images,
+		},
+		string(FileUsageGallery): {
+			BaseDir:     "content/gallery",
+			DateLayout:  "2006/01/02",
+			MaxFileSize: 10 * 1024 * 1024, // 10MB
+			AllowedExts: images,
+		},
+		string(FileUsagePost): {
+			BaseDir:     "content/posts",
+			DateLayout:  "2006/01",
+			MaxFileSize: 10 * 1024 * 1024, // 10MB
+			AllowedExts: append(slices.Clone(images), ".gif"),
+		},
+
+		// 文档相关 - 按年月分组，启用版本管理
+		string(FileUsageDocument): {
+			BaseDir:     "documents/general",
+			DateLayout:  "2006/01",
+			MaxFileSize: 50 * 1024 * 1024, // 50MB
+			AllowedExts: append(slices.Clone(documents), ".ppt", ".pptx", ".txt"),
+			Versioned:   true,
+			MaxVersions: 20,
+		},
+		string(FileUsageReport): {
+			BaseDir:     "documents/reports",
+			DateLayout:  "2006/01",
+			MaxFileSize: 100 * 1024 * 1024, // 100MB
+			AllowedExts: documents,
+			Versioned:   true,
+			MaxVersions: 20,
+		},
+		string(FileUsageContract): {
+			BaseDir:     "documents/contracts",
+			DateLayout:  "2006",
+			MaxFileSize: 50 * 1024 * 1024, // 50MB
+			AllowedExts: []string{".pdf", ".doc", ".docx"},
+			Versioned:   true,
+			MaxVersions: 20,
+		},
+
+		// 媒体相关 - 按年月分组
+		string(FileUsageVideo): {
+			BaseDir:     "media/videos",
+			DateLayout:  "2006/01",
+			MaxFileSize: 500 * 1024 * 1024, // 500MB
+			AllowedExts: []string{".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm"},
+		},
+		string(FileUsageAudio): {
+			BaseDir:     "media/audio",
+			DateLayout:  "2006/01",
+			MaxFileSize: 100 * 1024 * 1024, // 100MB
+			AllowedExts: []string{".mp3", ".wav", ".flac", ".aac", ".ogg"},
+		},
+
+		// 系统相关
+		string(FileUsageTemp): {
+			BaseDir:     "system/temp",
+			DateLayout:  "2006/01/02",
+			MaxFileSize: 100 * 1024 * 1024, // 100MB，允许所有类型
+		},
+		string(FileUsageBackup): {
+			BaseDir:     "system/backups",
+			DateLayout:  "2006/01",
+			MaxFileSize: 1024 * 1024 * 1024, // 1GB
+			AllowedExts: []string{".zip", ".tar", ".gz", ".sql"},
+		},
+		string(FileUsageGeneral): {
+			BaseDir:     "general",
+			DateLayout:  "2006/01/02",
+			MaxFileSize: 50 * 1024 * 1024, // 50MB，允许所有类型
 		},
 	}
 }
 
+// NewPathManager 使用内置规则创建路径管理器
+func NewPathManager() *PathManager {
+	pm, err := NewPathManagerFromConfig(configs.PathConfig{})
+	if err != nil {
+		panic(fmt.Sprintf("内置路径规则无效: %v", err))
+	}
+	return pm
+}
+
+// NewPathManagerFromConfig 根据配置创建路径管理器，规则无效时返回错误
+func NewPathManagerFromConfig(config configs.PathConfig) (*PathManager, error) {
+	rules, err := compilePathRules(config)
+	if err != nil {
+		return nil, err
+	}
+
+	pm := &PathManager{}
+	pm.rules.Store(rules)
+	return pm, nil
+}
+
+// Reload 校验并替换路径规则，规则无效时保留原规则
+// 已上传文件的路径不会随规则变化，因此不允许修改已有用途的基础目录
+func (pm *PathManager) Reload(config configs.PathConfig) error {
+	rules, err := compilePathRules(config)
+	if err != nil {
+		return err
+	}
+
+	current := pm.rules.Load()
+	for usage, rule := range rules.usages {
+		if old, exists := current.usages[usage]; exists && old.BaseDir != rule.BaseDir {
+			return fmt.Errorf("文件用途 %s 的基础目录不能在运行时修改: %s -> %s", usage, old.BaseDir, rule.BaseDir)
+		}
+	}
+
+	pm.rules.Store(rules)
+	return nil
+}
+
+// Rule 获取文件用途的规则，未配置的用途使用默认规则
+func (pm *PathManager) Rule(usage FileUsage) (*PathRule, error) {
+	rules := pm.rules.Load()
+	if rule, exists := rules.usages[usage]; exists {
+		return rule, nil
+	}
+	if rules.fallback != nil {
+		return rules.fallback, nil
+	}
+	return nil, fmt.Errorf("不支持的文件用途: %s", usage)
+}
+
+// Usages 获取已配置的文件用途，按名称排序
+func (pm *PathManager) Usages() []FileUsage {
+	rules := pm.rules.Load()
+	usages := make([]FileUsage, 0, len(rules.usages))
+	for usage := range rules.usages {
+		usages = append(usages, usage)
+	}
+	slices.Sort(usages)
+	return usages
+}
+
 // GenerateFilePath 生成文件路径
 func (pm *PathManager) GenerateFilePath(usage FileUsage, originalName string, userID ...int64) (string, string, error) {
-	config, exists := pm.pathConfig[usage]
-	if !exists {
-		config = pm.pathConfig[FileUsageGeneral] // 默认使用通用配置
+	rule, err := pm.Rule(usage)
+	if err != nil {
+		return "", "", err
 	}
 
 	// 验证文件扩展名
 	ext := strings.ToLower(filepath.Ext(originalName))
-	if len(config.AllowedExts) > 0 && !pm.isExtensionAllowed(ext, config.AllowedExts) {
+	if !rule.extensionAllowed(ext) {
 		return "", "", fmt.Errorf("不支持的文件类型: %s", ext)
 	}
 
@@ -184,56 +268,74 @@ func (pm *PathManager) GenerateFilePath(usage FileUsage, originalName string, us
 	filename := fmt.Sprintf("%s%s", fileID, ext)
 
 	// 构建路径
-	var pathParts []string
-	pathParts = append(pathParts, config.BaseDir)
+	pathParts := []string{rule.BaseDir}
 
 	// 添加日期路径
-	if config.UseDate {
-		datePath := time.Now().Format(config.DateFormat)
-		pathParts = append(pathParts, datePath)
+	if rule.DateLayout != "" {
+		pathParts = append(pathParts, time.Now().Format(rule.DateLayout))
 	}
 
-	// 对于用户相关文件，添加用户ID路径
-	if pm.isUserRelated(usage) && len(userID) > 0 {
-		userPath := fmt.Sprintf("user_%d", userID[0])
-		pathParts = append(pathParts, userPath)
+	// 按上传者分组时添加用户ID路径
+	if rule.UserDir && len(userID) > 0 {
+		pathParts = append(pathParts, fmt.Sprintf("user_%d", userID[0]))
 	}
 
-	// 组合完整路径
-	filePath := filepath.Join(pathParts...)
-	filePath = filepath.Join(filePath, filename)
-
-	// 转换为Unix风格路径（用于URL）
-	filePath = strings.ReplaceAll(filePath, "\\", "/")
-
-	return filePath, fileID, nil
+	// 使用Unix风格路径（用于URL）
+	pathParts = append(pathParts, filename)
+	return path.Join(pathParts...), fileID, nil
 }
 
-// ValidateFile 验证文件
-func (pm *PathManager) ValidateFile(usage FileUsage, filename string, size int64) error {
-	config, exists := pm.pathConfig[usage]
-	if !exists {
-		config = pm.pathConfig[FileUsageGeneral]
+// ValidateFile 验证文件，contentType或size为空时跳过对应的检查
+func (pm *PathManager) ValidateFile(usage FileUsage, filename, contentType string, size int64) error {
+	rule, err := pm.Rule(usage)
+	if err != nil {
+		return err
 	}
 
 	// 验证文件大小
-	if config.MaxFileSize > 0 && size > config.MaxFileSize {
-		return fmt.Errorf("文件大小超过限制: %d bytes (最大: %d bytes)", size, config.MaxFileSize)
+	if rule.MaxFileSize > 0 && size > rule.MaxFileSize {
+		return fmt.Errorf("文件大小超过限制: %d bytes (最大: %d bytes)", size, rule.MaxFileSize)
 	}
 
 	// 验证文件扩展名
 	ext := strings.ToLower(filepath.Ext(filename))
-	if len(config.AllowedExts) > 0 && !pm.isExtensionAllowed(ext, config.AllowedExts) {
+	if !rule.extensionAllowed(ext) {
 		return fmt.Errorf("不支持的文件类型: %s", ext)
 	}
 
+	// 验证MIME类型
+	if contentType != "" && !rule.mimeTypeAllowed(contentType) {
+		return fmt.Errorf("不支持的MIME类型: %s", contentType)
+	}
+
 	return nil
 }
 
-// GetUsageFromString 从字符串获取文件用途
+// CheckRole 检查角色是否允许上传该用途的文件
+func (pm *PathManager) CheckRole(usage FileUsage, role string) error {
+	rule, err := pm.Rule(usage)
+	if err != nil {
+		return err
+	}
+	if len(rule.Roles) > 0 && !slices.Contains(rule.Roles, role) {
+		return fmt.Errorf("当前角色不允许上传 %s 文件", usage)
+	}
+	return nil
+}
+
+// IsPublic 获取文件是否公开，未指定时使用用途的默认可见性
+func (pm *PathManager) IsPublic(usage FileUsage, requested *bool) bool {
+	if requested != nil {
+		return *requested
+	}
+	rule, err := pm.Rule(usage)
+	return err == nil && rule.Public
+}
+
+// GetUsageFromString 从字符串获取文件用途，未配置的用途返回通用文件
 func (pm *PathManager) GetUsageFromString(usageStr string) FileUsage {
 	usage := FileUsage(usageStr)
-	if _, exists := pm.pathConfig[usage]; exists {
+	if _, exists := pm.rules.Load().usages[usage]; exists {
 		return usage
 	}
 	return FileUsageGeneral
@@ -241,33 +343,225 @@ func (pm *PathManager) GetUsageFromString(usageStr string) FileUsage {
 
 // GetAllowedExtensions 获取允许的扩展名
 func (pm *PathManager) GetAllowedExtensions(usage FileUsage) []string {
-	if config, exists := pm.pathConfig[usage]; exists {
-		return config.AllowedExts
+	if rule, exists := pm.rules.Load().usages[usage]; exists {
+		return rule.AllowedExts
 	}
 	return []string{}
 }
 
+// GetBaseDir 获取文件用途的基础目录
+func (pm *PathManager) GetBaseDir(usage FileUsage) (string, bool) {
+	rule, exists := pm.rules.Load().usages[usage]
+	if !exists {
+		return "", false
+	}
+	return rule.BaseDir, true
+}
+
 // GetMaxFileSize 获取最大文件大小
 func (pm *PathManager) GetMaxFileSize(usage FileUsage) int64 {
-	if config, exists := pm.pathConfig[usage]; exists {
-		return config.MaxFileSize
+	if rule, err := pm.Rule(usage); err == nil {
+		return rule.MaxFileSize
+	}
+	return 0
+}
+
+// GetMaxVersions 获取保留的历史版本数，0表示不限制
+func (pm *PathManager) GetMaxVersions(usage FileUsage) int {
+	if rule, err := pm.Rule(usage); err == nil {
+		return rule.MaxVersions
 	}
-	return 50 * 1024 * 1024 // 默认50MB
+	return 0
+}
+
+// extensionAllowed 扩展名是否允许，未配置时允许所有类型
+func (r *PathRule) extensionAllowed(ext string) bool {
+	return len(r.AllowedExts) == 0 || slices.Contains(r.AllowedExts, ext)
 }
 
-// 辅助方法
-func (pm *PathManager) isExtensionAllowed(ext string, allowedExts []string) bool {
-	if len(allowedExts) == 0 {
-		return true // 允许所有类型
+// mimeTypeAllowed MIME类型是否允许，支持 image/* 通配
+func (r *PathRule) mimeTypeAllowed(contentType string) bool {
+	if len(r.MimeTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
 	}
-	for _, allowed := range allowedExts {
-		if ext == allowed {
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, allowed := range r.MimeTypes {
+		if allowed == mediaType || allowed == major+"/*" {
 			return true
 		}
 	}
 	return false
 }
 
-func (pm *PathManager) isUserRelated(usage FileUsage) bool {
-	return usage == FileUsageAvatar || usage == FileUsageProfile
+// compilePathRules 校验配置并生成路径规则，未配置用途时使用内置规则
+func compilePathRules(config configs.PathConfig) (*pathRules, error) {
+	usages := config.Usages
+	if len(usages) == 0 {
+		usages = DefaultPathRules()
+	}
+
+	rules := &pathRules{usages: make(map[FileUsage]*PathRule, len(usages))}
+	for name, usageRule := range usages {
+		rule, err := compilePathRule(name, usageRule)
+		if err != nil {
+			return nil, fmt.Errorf("文件用途 %s 配置无效: %w", name, err)
+		}
+		rules.usages[rule.Usage] = rule
+	}
+
+	if err := checkBaseDirs(rules.usages); err != nil {
+		return nil, err
+	}
+
+	if !config.Strict {
+		fallback := FileUsage(config.Default)
+		if fallback == "" {
+			fallback = FileUsageGeneral
+		}
+		rule, exists := rules.usages[fallback]
+		if !exists {
+			return nil, fmt.Errorf("默认文件用途 %s 未配置", fallback)
+		}
+		rules.fallback = rule
+	}
+
+	return rules, nil
+}
+
+// compilePathRule 校验并规范化单个用途的规则
+func compilePathRule(name string, config configs.UsageRule) (*PathRule, error) {
+	if !usageNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("名称只能包含小写字母、数字、下划线和连字符")
+	}
+
+	baseDir := strings.Trim(config.BaseDir, "/")
+	if baseDir == "" || path.Clean(baseDir) != baseDir || strings.Contains(baseDir, `\`) ||
+		slices.Contains(strings.Split(baseDir, "/"), "..") {
+		return nil, fmt.Errorf("无效的基础目录: %q", config.BaseDir)
+	}
+	if isUnder(baseDir, TrashDir) {
+		return nil, fmt.Errorf("基础目录不能位于回收站目录 %s 下", TrashDir)
+	}
+
+	if err := checkDateLayout(config.DateLayout); err != nil {
+		return nil, err
+	}
+	if config.MaxFileSize < 0 {
+		return nil, fmt.Errorf("最大文件大小不能为负数")
+	}
+	if config.MaxVersions < 0 {
+		return nil, fmt.Errorf("保留的历史版本数不能为负数")
+	}
+
+	exts := make([]string, 0, len(config.AllowedExts))
+	for _, ext := range config.AllowedExts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) < 2 || strings.ContainsAny(ext[1:], `./\`) {
+			return nil, fmt.Errorf("无效的扩展名: %q", ext)
+		}
+		exts = append(exts, ext)
+	}
+
+	mimeTypes := make([]string, 0, len(config.MimeTypes))
+	for _, mimeType := range config.MimeTypes {
+		mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+		major, minor, ok := strings.Cut(mimeType, "/")
+		if !ok || major == "" || major == "*" || minor == "" || strings.ContainsAny(minor, "/;") {
+			return nil, fmt.Errorf("无效的MIME类型: %q", mimeType)
+		}
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+
+	roles := make([]string, 0, len(config.Roles))
+	for _, role := range config.Roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role != RoleAdmin && role != RoleUser {
+			return nil, fmt.Errorf("未知的角色: %q", role)
+		}
+		roles = append(roles, role)
+	}
+
+	return &PathRule{
+		Usage:       FileUsage(name),
+		BaseDir:     baseDir,
+		DateLayout:  config.DateLayout,
+		UserDir:     config.UserDir,
+		MaxFileSize: config.MaxFileSize,
+		AllowedExts: exts,
+		MimeTypes:   mimeTypes,
+		Public:      config.Public,
+		Roles:       roles,
+		Versioned:   config.Versioned,
+		MaxVersions: config.MaxVersions,
+	}, nil
+}
+
+// checkDateLayout 日期格式必须包含日期字段，且格式化结果是安全的相对路径
+func checkDateLayout(layout string) error {
+	if layout == "" {
+		return nil
+	}
+
+	// 使用与参考时间不同的日期，格式化结果与格式相同说明不包含日期字段
+	sample := time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC).Format(layout)
+	if sample == layout {
+		return fmt.Errorf("日期格式 %q 不包含日期字段", layout)
+	}
+	if path.Clean(sample) != sample || strings.HasPrefix(sample, "/") || strings.ContainsAny(sample, `\: `) ||
+		slices.Contains(strings.Split(sample, "/"), "..") {
+		return fmt.Errorf("日期格式 %q 生成的路径无效: %s", layout, sample)
+	}
+	return nil
+}
+
+// checkBaseDirs 不同用途的基础目录不能相同或嵌套，避免按目录识别用途时混淆
+func checkBaseDirs(usages map[FileUsage]*PathRule) error {
+	rules := make([]*PathRule, 0, len(usages))
+	for _, rule := range usages {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].BaseDir < rules[j].BaseDir })
+
+	for i := 1; i < len(rules); i++ {
+		for _, prev := range rules[:i] {
+			if isUnder(rules[i].BaseDir, prev.BaseDir) {
+				return fmt.Errorf("文件用途 %s 和 %s 的基础目录重叠: %s, %s",
+					prev.Usage, rules[i].Usage, prev.BaseDir, rules[i].BaseDir)
+			}
+		}
+	}
+	return nil
+}
+
+// isUnder 目录是否为parent或位于parent下
+func isUnder(dir, parent string) bool {
+	return dir == parent || strings.HasPrefix(dir, parent+"/")
+}
+
+// TrashDir 回收站目录，回收站中的文件统一存放在私有目录下
+const TrashDir = "trash"
+
+// TrashPath 生成文件在回收站中的存储路径
+// 路径包含文件ID以区分共享同一存储对象的文件，并保留原路径以便按用途识别（如加密）
+func TrashPath(fileID, filePath string) string {
+	return TrashDir + "/" + fileID + "/" + strings.TrimLeft(filePath, "/")
+}
+
+// OriginalPath 获取回收站路径对应的原存储路径，非回收站路径原样返回
+func OriginalPath(filePath string) string {
+	rest, ok := strings.CutPrefix(filePath, TrashDir+"/")
+	if !ok {
+		return filePath
+	}
+	if _, original, ok := strings.Cut(rest, "/"); ok {
+		return original
+	}
+	return filePath
 }
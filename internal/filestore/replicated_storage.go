@@ -0,0 +1,472 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// 复制模式
+const (
+	ReplicationModeMirror   = "mirror"   // 写入主存储后同步或异步写入备用存储
+	ReplicationModeFailover = "failover" // 主存储失败或文件不存在时从备用存储读取
+)
+
+// replicationOp 复制任务类型
+type replicationOp int
+
+const (
+	replicationCopy   replicationOp = iota // 复制到备用存储
+	replicationDelete                      // 从备用存储删除
+)
+
+// replicationTask 备用存储复制任务
+type replicationTask struct {
+	op       replicationOp
+	path     string
+	isPublic bool
+	attempts int
+}
+
+// BackendHealth 存储后端健康状态
+type BackendHealth struct {
+	Name                string    // primary 或 secondary
+	StorageType         string    // 存储类型
+	Healthy             bool      // 是否健康
+	ConsecutiveFailures int       // 连续失败次数
+	LastError           string    // 最近一次错误
+	LastErrorAt         time.Time // 最近一次失败时间
+	LastSuccessAt       time.Time // 最近一次成功时间
+}
+
+// backendState 存储后端健康状态跟踪
+type backendState struct {
+	mu        sync.Mutex
+	name      string
+	storage   FileStorage
+	threshold int
+	failures  int
+	lastErr   string
+	lastErrAt time.Time
+	lastOKAt  time.Time
+}
+
+// success 记录一次成功调用
+func (b *backendState) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold {
+		logger.Info("Storage backend recovered", "backend", b.name, "type", b.storage.GetStorageType())
+	}
+	b.failures = 0
+	b.lastOKAt = time.Now()
+}
+
+// failure 记录一次失败调用
+func (b *backendState) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastErr = err.Error()
+	b.lastErrAt = time.Now()
+	if b.failures == b.threshold {
+		logger.Warn("Storage backend marked unhealthy", "backend", b.name, "type", b.storage.GetStorageType(), "error", err)
+	}
+}
+
+// available 健康或距上次失败已超过探测间隔时可以尝试调用
+func (b *backendState) available(probeInterval time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < b.threshold || time.Since(b.lastErrAt) >= probeInterval
+}
+
+// snapshot 获取健康状态快照
+func (b *backendState) snapshot() BackendHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BackendHealth{
+		Name:                b.name,
+		StorageType:         b.storage.GetStorageType(),
+		Healthy:             b.failures < b.threshold,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+		LastErrorAt:         b.lastErrAt,
+		LastSuccessAt:       b.lastOKAt,
+	}
+}
+
+// ReplicatedStorage 基于StorageManager的复制存储
+// 记录始终以主存储为准：上传URL、路径和存储类型都来自主存储，备用存储用于镜像备份或故障时读取
+type ReplicatedStorage struct {
+	manager   *StorageManager
+	config    configs.ReplicationConfig
+	primary   *backendState
+	secondary *backendState
+
+	queue     chan replicationTask
+	pending   atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewReplicatedStorage 创建复制存储，manager必须配置备用存储
+func NewReplicatedStorage(manager *StorageManager, config configs.ReplicationConfig) (*ReplicatedStorage, error) {
+	if !manager.HasSecondary() {
+		return nil, fmt.Errorf("复制存储需要配置备用存储")
+	}
+
+	switch config.Mode {
+	case "":
+		config.Mode = ReplicationModeMirror
+	case ReplicationModeMirror, ReplicationModeFailover:
+	default:
+		return nil, fmt.Errorf("不支持的复制模式: %s", config.Mode)
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 10 * time.Second
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 3
+	}
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = 30 * time.Second
+	}
+
+	s := &ReplicatedStorage{
+		manager: manager,
+		config:  config,
+		primary: &backendState{
+			name:      "primary",
+			storage:   manager.GetPrimary(),
+			threshold: config.FailureThreshold,
+		},
+		secondary: &backendState{
+			name:      "secondary",
+			storage:   manager.GetSecondary(),
+			threshold: config.FailureThreshold,
+		},
+		queue: make(chan replicationTask, config.QueueSize),
+		done:  make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.worker()
+
+	return s, nil
+}
+
+// Mode 获取复制模式
+func (s *ReplicatedStorage) Mode() string {
+	return s.config.Mode
+}
+
+// Health 获取主存储和备用存储的健康状态
+func (s *ReplicatedStorage) Health() []BackendHealth {
+	return []BackendHealth{s.primary.snapshot(), s.secondary.snapshot()}
+}
+
+// PendingReplications 获取尚未完成的复制任务数（包括等待重试的任务）
+func (s *ReplicatedStorage) PendingReplications() int64 {
+	return s.pending.Load()
+}
+
+// Close 停止复制任务，队列中未完成的任务会被丢弃，由存储迁移或对账补齐
+func (s *ReplicatedStorage) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// GetUploadURL 获取主存储的上传URL，客户端直传的文件在确认上传后通过Replicate复制
+func (s *ReplicatedStorage) GetUploadURL(ctx context.Context, filePath string, contentType string, isPublic bool) (string, string, error) {
+	url, method, err := s.primary.storage.GetUploadURL(ctx, filePath, contentType, isPublic)
+	s.observe(s.primary, err)
+	return url, method, err
+}
+
+// GetUploadForm 获取主存储的表单上传策略，客户端直传的文件在确认上传后通过Replicate复制
+func (s *ReplicatedStorage) GetUploadForm(ctx context.Context, filePath string, isPublic bool, policy PostPolicy) (*UploadResponse, error) {
+	uploader, ok := s.primary.storage.(PostUploader)
+	if !ok {
+		return nil, ErrPostUploadUnsupported
+	}
+	resp, err := uploader.GetUploadForm(ctx, filePath, isPublic, policy)
+	s.observe(s.primary, err)
+	return resp, err
+}
+
+// GetDownloadURL 获取下载URL，故障转移模式下主存储中不存在时返回备用存储的URL
+func (s *ReplicatedStorage) GetDownloadURL(ctx context.Context, filePath string, isPublic bool) (string, error) {
+	if s.config.Mode == ReplicationModeFailover {
+		inPrimary := false
+		if s.primary.available(s.config.ProbeInterval) {
+			inPrimary, _ = s.exists(ctx, s.primary, filePath, isPublic)
+		}
+		if !inPrimary {
+			if exists, _ := s.exists(ctx, s.secondary, filePath, isPublic); exists {
+				url, err := s.secondary.storage.GetDownloadURL(ctx, filePath, isPublic)
+				s.observe(s.secondary, err)
+				if err == nil {
+					return url, nil
+				}
+			}
+		}
+	}
+
+	url, err := s.primary.storage.GetDownloadURL(ctx, filePath, isPublic)
+	s.observe(s.primary, err)
+	return url, err
+}
+
+// UploadFile 上传到主存储，镜像模式下同时复制到备用存储
+// 主存储写入成功即返回成功，备用存储写入失败时进入重试队列
+func (s *ReplicatedStorage) UploadFile(ctx context.Context, filePath string, reader io.Reader, isPublic bool) error {
+	err := s.primary.storage.UploadFile(ctx, filePath, reader, isPublic)
+	s.observe(s.primary, err)
+	if err != nil {
+		return err
+	}
+
+	return s.Replicate(ctx, filePath, isPublic)
+}
+
+// Replicate 将主存储中的文件复制到备用存储，仅镜像模式有效
+func (s *ReplicatedStorage) Replicate(ctx context.Context, filePath string, isPublic bool) error {
+	if s.config.Mode != ReplicationModeMirror {
+		return nil
+	}
+
+	s.dispatch(ctx, replicationTask{op: replicationCopy, path: filePath, isPublic: isPublic})
+	return nil
+}
+
+// GetFile 读取文件，故障转移模式下主存储失败或文件不存在时从备用存储读取
+func (s *ReplicatedStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	if s.config.Mode != ReplicationModeFailover {
+		reader, err := s.primary.storage.GetFile(ctx, filePath, isPublic)
+		s.observeRead(ctx, s.primary, filePath, isPublic, err)
+		return reader, err
+	}
+
+	var primaryErr error
+	if s.primary.available(s.config.ProbeInterval) {
+		reader, err := s.primary.storage.GetFile(ctx, filePath, isPublic)
+		s.observeRead(ctx, s.primary, filePath, isPublic, err)
+		if err == nil {
+			return reader, nil
+		}
+		primaryErr = err
+	}
+
+	reader, err := s.secondary.storage.GetFile(ctx, filePath, isPublic)
+	s.observeRead(ctx, s.secondary, filePath, isPublic, err)
+	if err != nil {
+		if primaryErr != nil {
+			return nil, primaryErr
+		}
+		return nil, err
+	}
+
+	logger.WarnContext(ctx, "Reading file from secondary storage", "path", filePath, "public", isPublic, "primary_error", primaryErr)
+	return reader, nil
+}
+
+// FileExists 检查文件是否存在，故障转移模式下同时检查备用存储
+func (s *ReplicatedStorage) FileExists(ctx context.Context, filePath string, isPublic bool) (bool, error) {
+	if s.config.Mode != ReplicationModeFailover {
+		return s.exists(ctx, s.primary, filePath, isPublic)
+	}
+
+	var primaryErr error
+	if s.primary.available(s.config.ProbeInterval) {
+		exists, err := s.exists(ctx, s.primary, filePath, isPublic)
+		if err == nil && exists {
+			return true, nil
+		}
+		primaryErr = err
+	}
+
+	exists, err := s.exists(ctx, s.secondary, filePath, isPublic)
+	if err != nil {
+		if primaryErr != nil {
+			return false, primaryErr
+		}
+		return false, err
+	}
+	return exists, nil
+}
+
+// DeleteFile 从主存储删除文件，并删除备用存储中的副本，避免故障转移时读到已删除的文件
+func (s *ReplicatedStorage) DeleteFile(ctx context.Context, filePath string, isPublic bool) error {
+	err := s.primary.storage.DeleteFile(ctx, filePath, isPublic)
+	if err != nil {
+		// 文件只存在于备用存储时主存储删除会失败，不视为错误
+		if exists, existsErr := s.primary.storage.FileExists(ctx, filePath, isPublic); existsErr != nil || exists {
+			s.observe(s.primary, err)
+			return err
+		}
+	}
+	s.observe(s.primary, nil)
+
+	s.dispatch(ctx, replicationTask{op: replicationDelete, path: filePath, isPublic: isPublic})
+	return nil
+}
+
+// ListFiles 遍历主存储中的文件
+func (s *ReplicatedStorage) ListFiles(ctx context.Context, isPublic bool, fn func(info FileInfo) error) error {
+	return s.primary.storage.ListFiles(ctx, isPublic, fn)
+}
+
+// GetStorageType 获取主存储的存储类型
+func (s *ReplicatedStorage) GetStorageType() string {
+	return s.primary.storage.GetStorageType()
+}
+
+// BuildFullPath 使用主存储构建完整路径
+func (s *ReplicatedStorage) BuildFullPath(filePath string, isPublic bool) string {
+	return s.primary.storage.BuildFullPath(filePath, isPublic)
+}
+
+// dispatch 执行备用存储任务，异步模式下直接进入队列，同步模式下失败时进入队列重试
+func (s *ReplicatedStorage) dispatch(ctx context.Context, task replicationTask) {
+	if s.config.Async {
+		s.enqueue(task)
+		return
+	}
+
+	if err := s.execute(ctx, task); err != nil {
+		logger.WarnContext(ctx, "Secondary storage replication failed, queued for retry",
+			"path", task.path, "public", task.isPublic, "error", err)
+		task.attempts++
+		s.retry(task)
+	}
+}
+
+// enqueue 新任务进入队列，队列已满时丢弃
+func (s *ReplicatedStorage) enqueue(task replicationTask) {
+	s.pending.Add(1)
+	if !s.push(task) {
+		s.pending.Add(-1)
+	}
+}
+
+// retry 按重试间隔将任务重新放入队列，超过最大重试次数时放弃
+func (s *ReplicatedStorage) retry(task replicationTask) {
+	if task.attempts > s.config.MaxRetries {
+		logger.Error("Secondary storage replication abandoned",
+			"path", task.path, "public", task.isPublic, "attempts", task.attempts)
+		return
+	}
+
+	s.pending.Add(1)
+	time.AfterFunc(s.config.RetryInterval, func() {
+		if !s.push(task) {
+			s.pending.Add(-1)
+		}
+	})
+}
+
+// push 放入队列，队列已满或已关闭时返回false
+func (s *ReplicatedStorage) push(task replicationTask) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.queue <- task:
+		return true
+	default:
+		logger.Error("Replication queue is full, task dropped", "path", task.path, "public", task.isPublic)
+		return false
+	}
+}
+
+// worker 处理复制队列
+func (s *ReplicatedStorage) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case task := <-s.queue:
+			ctx := context.Background()
+			if err := s.execute(ctx, task); err != nil {
+				task.attempts++
+				logger.WarnContext(ctx, "Secondary storage replication failed",
+					"path", task.path, "public", task.isPublic, "attempts", task.attempts, "error", err)
+				s.retry(task)
+			}
+			s.pending.Add(-1)
+		}
+	}
+}
+
+// execute 在备用存储上执行任务
+func (s *ReplicatedStorage) execute(ctx context.Context, task replicationTask) error {
+	var err error
+	switch task.op {
+	case replicationCopy:
+		err = s.manager.CopyToSecondary(ctx, task.path, task.isPublic)
+	case replicationDelete:
+		var exists bool
+		exists, err = s.secondary.storage.FileExists(ctx, task.path, task.isPublic)
+		if err == nil && exists {
+			err = s.secondary.storage.DeleteFile(ctx, task.path, task.isPublic)
+		}
+	}
+
+	s.observe(s.secondary, err)
+	return err
+}
+
+// exists 检查文件是否存在并记录健康状态
+func (s *ReplicatedStorage) exists(ctx context.Context, backend *backendState, filePath string, isPublic bool) (bool, error) {
+	exists, err := backend.storage.FileExists(ctx, filePath, isPublic)
+	s.observe(backend, err)
+	return exists, err
+}
+
+// observe 记录调用结果
+func (s *ReplicatedStorage) observe(backend *backendState, err error) {
+	if err != nil {
+		backend.failure(err)
+	} else {
+		backend.success()
+	}
+}
+
+// observeRead 记录读取结果，文件不存在不视为存储故障
+func (s *ReplicatedStorage) observeRead(ctx context.Context, backend *backendState, filePath string, isPublic bool, err error) {
+	if err == nil {
+		backend.success()
+		return
+	}
+
+	if exists, existsErr := backend.storage.FileExists(ctx, filePath, isPublic); existsErr == nil && !exists {
+		backend.success()
+		return
+	}
+	backend.failure(err)
+}
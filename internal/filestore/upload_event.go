@@ -0,0 +1,61 @@
+package filestore
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// S3Event S3兼容存储的事件通知，MinIO webhook和AWS S3事件通知均使用该格式
+type S3Event struct {
+	Records []S3EventRecord `json:"Records"`
+}
+
+// S3EventRecord 事件通知中的单条记录
+type S3EventRecord struct {
+	EventName string        `json:"eventName"` // 事件名称，如 s3:ObjectCreated:Post（AWS不带s3:前缀）
+	S3        S3EventEntity `json:"s3"`
+}
+
+// S3EventEntity 事件涉及的桶和对象
+type S3EventEntity struct {
+	Bucket S3EventBucket `json:"bucket"`
+	Object S3EventObject `json:"object"`
+}
+
+// S3EventBucket 事件涉及的桶
+type S3EventBucket struct {
+	Name string `json:"name"`
+}
+
+// S3EventObject 事件涉及的对象
+type S3EventObject struct {
+	Key  string `json:"key"`  // URL编码的对象键
+	Size int64  `json:"size"` // 对象大小（字节）
+}
+
+// ObjectCreated 是否为对象创建事件
+func (r *S3EventRecord) ObjectCreated() bool {
+	return strings.HasPrefix(strings.TrimPrefix(r.EventName, "s3:"), "ObjectCreated:")
+}
+
+// Object 解析事件中的对象键，返回文件路径（不包含public/private前缀）和是否公开
+func (r *S3EventRecord) Object() (string, bool, error) {
+	key, err := url.QueryUnescape(r.S3.Object.Key)
+	if err != nil {
+		return "", false, fmt.Errorf("解析对象键失败: %w", err)
+	}
+	return SplitFullPath(key)
+}
+
+// SplitFullPath 拆分包含public/private前缀的完整路径，BuildFullPath的逆操作
+func SplitFullPath(fullPath string) (string, bool, error) {
+	fullPath = strings.TrimLeft(fullPath, "/")
+	if filePath, ok := strings.CutPrefix(fullPath, "public/"); ok && filePath != "" {
+		return filePath, true, nil
+	}
+	if filePath, ok := strings.CutPrefix(fullPath, "private/"); ok && filePath != "" {
+		return filePath, false, nil
+	}
+	return "", false, fmt.Errorf("无效的存储路径: %s", fullPath)
+}
@@ -36,8 +36,8 @@ func (h *AdminHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
 	admin := authenticated.Group("/admin", middleware.AdminCheck())
 	{
 
-		// 系统设置
-		admin.GET("/settings", h.GetSystemSettings)
+		// 系统设置，来自配置文件，所有管理员共享缓存
+		admin.GET("/settings", h.app.GetResponseCache().Middleware(middleware.CacheShared()), h.GetSystemSettings)
 	}
 }
 
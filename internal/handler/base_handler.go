@@ -4,6 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/limitcool/starter/configs"
 	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/pkg/bloom"
 	"github.com/limitcool/starter/internal/pkg/cache"
 	"github.com/limitcool/starter/internal/pkg/logger"
 	"gorm.io/gorm"
@@ -17,7 +19,10 @@ type AppContext interface {
 	GetConfig() *configs.Config
 	GetDB() *gorm.DB
 	GetCache() cache.Cache
+	GetResponseCache() *middleware.ResponseCache
 	GetStorage() filestore.FileStorage
+	GetPathManager() *filestore.PathManager
+	GetUserFilter() bloom.Filter // 用户ID布隆过滤器，未启用时返回nil
 }
 
 // BaseHandler 基础处理器，包含所有Handler的公共字段和方法
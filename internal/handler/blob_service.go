@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// BlobService 文件内容去重服务
+// 在同一存储类型和可见范围内按SHA-256去重，多个文件记录共享同一个存储对象
+type BlobService struct {
+	db      *gorm.DB
+	storage filestore.FileStorage
+}
+
+// NewBlobService 创建文件内容去重服务
+func NewBlobService(db *gorm.DB, storage filestore.FileStorage) *BlobService {
+	return &BlobService{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Store 写入文件内容并计算校验和，已存在相同内容时直接引用已有对象
+// 返回实际使用的存储路径和校验和
+func (s *BlobService) Store(ctx context.Context, filePath string, reader io.Reader, isPublic bool) (string, *filestore.Checksum, error) {
+	// 可重复读取的内容先计算摘要，命中时无需再次写入
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		checksum, err := filestore.ComputeChecksum(seeker)
+		if err != nil {
+			return "", nil, fmt.Errorf("计算文件校验和失败: %w", err)
+		}
+
+		blob, err := s.acquire(ctx, checksum.SHA256, isPublic)
+		if err != nil && !errspec.ErrRecordNotExist.Is(err) {
+			return "", nil, err
+		}
+		if blob != nil {
+			logger.InfoContext(ctx, "文件内容已存在，引用已有对象", "sha256", checksum.SHA256, "path", blob.Path)
+			return blob.Path, checksum, nil
+		}
+
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return "", nil, fmt.Errorf("重置文件读取位置失败: %w", err)
+		}
+		reader = seeker
+	}
+
+	// 边上传边计算摘要
+	cr := filestore.NewChecksumReader(reader)
+	if err := s.storage.UploadFile(ctx, filePath, cr, isPublic); err != nil {
+		return "", nil, err
+	}
+
+	checksum := cr.Checksum()
+	path, err := s.register(ctx, filePath, checksum, isPublic)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, checksum, nil
+}
+
+// Register 为已写入存储的文件（预签名URL直传）计算校验和并登记内容对象
+// 已存在相同内容时删除新写入的对象，并将文件指向已有对象
+func (s *BlobService) Register(ctx context.Context, file *model.File) (*filestore.Checksum, error) {
+	checksum, err := s.Checksum(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := s.register(ctx, file.Path, checksum, file.IsPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Path = path
+	file.SHA256 = checksum.SHA256
+	file.MD5 = checksum.MD5
+	file.Size = checksum.Size
+	return checksum, nil
+}
+
+// Checksum 读取存储中的文件内容并计算校验和
+func (s *BlobService) Checksum(ctx context.Context, file *model.File) (*filestore.Checksum, error) {
+	reader, err := s.storage.GetFile(ctx, file.Path, file.IsPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	checksum, err := filestore.ComputeChecksum(reader)
+	if err != nil {
+		return nil, fmt.Errorf("计算文件校验和失败: %w", err)
+	}
+	return checksum, nil
+}
+
+// Release 释放文件对内容对象的引用，引用数归零时删除存储中的对象
+func (s *BlobService) Release(ctx context.Context, file *model.File) error {
+	// 未记录校验和的历史文件独占存储对象
+	if file.SHA256 == "" {
+		return s.storage.DeleteFile(ctx, file.Path, file.IsPublic)
+	}
+
+	repo := model.NewFileBlobRepo(s.db)
+	blob, err := repo.GetByChecksum(ctx, file.SHA256, file.IsPublic, file.StorageType)
+	if err != nil {
+		if errspec.ErrRecordNotExist.Is(err) {
+			return s.storage.DeleteFile(ctx, file.Path, file.IsPublic)
+		}
+		return err
+	}
+
+	refs, err := repo.DecrRef(ctx, blob.ID)
+	if err != nil {
+		return fmt.Errorf("更新引用计数失败: %w", err)
+	}
+	if refs > 0 {
+		logger.InfoContext(ctx, "内容对象仍被引用，保留存储文件", "sha256", blob.SHA256, "ref_count", refs)
+		return nil
+	}
+
+	// 仅在引用数仍为0时删除，避免与并发上传的引用冲突
+	// 物理删除记录，避免软删除的记录占用唯一索引导致相同内容无法再次登记
+	result := s.db.WithContext(ctx).Unscoped().Where("id = ? AND ref_count = 0", blob.ID).Delete(&model.FileBlob{})
+	if result.Error != nil {
+		return fmt.Errorf("删除内容对象记录失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return s.storage.DeleteFile(ctx, blob.Path, blob.IsPublic)
+}
+
+// Verify 校验客户端提供的SHA-256摘要
+func (s *BlobService) Verify(ctx context.Context, expected string, checksum *filestore.Checksum) error {
+	if expected == "" || strings.EqualFold(expected, checksum.SHA256) {
+		return nil
+	}
+	return errspec.ErrFileChecksumMismatch.New(ctx)
+}
+
+// register 登记新写入的对象，已存在相同内容时改为引用已有对象并删除新对象
+func (s *BlobService) register(ctx context.Context, filePath string, checksum *filestore.Checksum, isPublic bool) (string, error) {
+	blob, err := s.acquire(ctx, checksum.SHA256, isPublic)
+	if err != nil && !errspec.ErrRecordNotExist.Is(err) {
+		return "", err
+	}
+
+	if blob == nil {
+		blob = &model.FileBlob{
+			SHA256:      checksum.SHA256,
+			IsPublic:    isPublic,
+			StorageType: s.storage.GetStorageType(),
+			MD5:         checksum.MD5,
+			Path:        filePath,
+			Size:        checksum.Size,
+			RefCount:    1,
+		}
+		err := s.db.WithContext(ctx).Create(blob).Error
+		if err == nil {
+			return filePath, nil
+		}
+
+		// 唯一索引冲突说明并发写入了相同内容，改为引用已有对象
+		existing, acquireErr := s.acquire(ctx, checksum.SHA256, isPublic)
+		if acquireErr != nil {
+			return "", fmt.Errorf("登记内容对象失败: %w", err)
+		}
+		blob = existing
+	}
+
+	if blob.Path != filePath {
+		if err := s.storage.DeleteFile(ctx, filePath, isPublic); err != nil {
+			logger.WarnContext(ctx, "删除重复文件失败", "path", filePath, "error", err)
+		}
+	}
+
+	logger.InfoContext(ctx, "文件内容已存在，引用已有对象", "sha256", checksum.SHA256, "path", blob.Path)
+	return blob.Path, nil
+}
+
+// acquire 查找相同内容的对象并增加引用计数，不存在时返回ErrRecordNotExist
+func (s *BlobService) acquire(ctx context.Context, sha256 string, isPublic bool) (*model.FileBlob, error) {
+	repo := model.NewFileBlobRepo(s.db)
+	blob, err := repo.GetByChecksum(ctx, sha256, isPublic, s.storage.GetStorageType())
+	if err != nil {
+		return nil, err
+	}
+
+	// 对象可能在查询后被并发删除，此时IncrRef返回ErrRecordNotExist
+	if err := repo.IncrRef(ctx, blob.ID); err != nil {
+		return nil, err
+	}
+
+	blob.RefCount++
+	return blob, nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// FileArchiveHandler 文件批量打包下载处理器
+type FileArchiveHandler struct {
+	app     AppContext
+	service *FileArchiveService
+	helper  *HandlerHelper
+}
+
+var _ RouterInitializer = (*FileArchiveHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewFileArchiveHandler 创建文件批量打包下载处理器
+func NewFileArchiveHandler(app AppContext) *FileArchiveHandler {
+	return &FileArchiveHandler{
+		app:     app,
+		service: NewFileArchiveService(app.GetDB(), app.GetStorage()),
+		helper:  NewHandlerHelper(),
+	}
+}
+
+func (h *FileArchiveHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
+	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
+
+	authenticated.POST("/user/files/archive", h.DownloadArchive)
+	authenticated.POST("/admin/files/archive", middleware.AdminCheck(), h.AdminDownloadArchive)
+}
+
+// DownloadArchive 将当前用户的多个文件打包为ZIP下载
+func (h *FileArchiveHandler) DownloadArchive(ctx *gin.Context) {
+	var req dto.FileArchiveRequest
+	if !h.helper.BindJSON(ctx, &req, "DownloadArchive") {
+		return
+	}
+
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	h.download(ctx, userID, &req)
+}
+
+// AdminDownloadArchive 将任意用户的多个文件打包为ZIP下载（管理员），可按user_id过滤
+func (h *FileArchiveHandler) AdminDownloadArchive(ctx *gin.Context) {
+	var req dto.FileArchiveRequest
+	if !h.helper.BindJSON(ctx, &req, "AdminDownloadArchive") {
+		return
+	}
+
+	h.download(ctx, req.UserID, &req)
+}
+
+// download 校验文件后以流的方式返回ZIP，userID为0时不限制上传者
+// 响应头发出后无法再返回错误响应，写入失败时停止写入，客户端会得到缺少目录的不完整压缩包
+func (h *FileArchiveHandler) download(ctx *gin.Context, userID int64, req *dto.FileArchiveRequest) {
+	reqCtx := ctx.Request.Context()
+
+	files, err := h.service.Resolve(reqCtx, userID, req)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "DownloadArchive", "user_id", userID)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveFilename(req.Name)}))
+	ctx.Status(http.StatusOK)
+
+	if err := h.service.Write(reqCtx, ctx.Writer, files); err != nil {
+		logger.ErrorContext(reqCtx, "写入压缩包失败", "user_id", userID, "files", len(files), "error", err)
+		ctx.Abort()
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "DownloadArchive", "user_id", userID, "files", len(files))
+}
+
+// archiveFilename 生成压缩包文件名，未指定时使用当前时间
+func archiveFilename(name string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "files-" + time.Now().Format("20060102150405")
+	}
+	if !strings.EqualFold(path.Ext(name), ".zip") {
+		name += ".zip"
+	}
+	return name
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"gorm.io/gorm"
+)
+
+// ArchiveMaxFiles 单个压缩包最多包含的文件数
+const ArchiveMaxFiles = 1000
+
+// FileArchiveService 文件批量打包下载服务
+// 逐个读取存储中的文件写入ZIP，不在内存或磁盘中缓存整个压缩包
+type FileArchiveService struct {
+	db      *gorm.DB
+	storage filestore.FileStorage
+}
+
+// NewFileArchiveService 创建文件批量打包下载服务
+func NewFileArchiveService(db *gorm.DB, storage filestore.FileStorage) *FileArchiveService {
+	return &FileArchiveService{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Resolve 查询要打包的文件，userID不为0时只能打包该用户的文件
+// 指定了file_ids时每个文件都必须存在且有权访问，否则返回ErrFileNotFound
+func (s *FileArchiveService) Resolve(ctx context.Context, userID int64, req *dto.FileArchiveRequest) ([]model.File, error) {
+	ids := uniqueStrings(req.FileIDs)
+	filter := &model.FileFilter{
+		UserID: userID,
+		IDs:    ids,
+		Tag:    strings.TrimSpace(req.Tag),
+		Usage:  req.Usage,
+	}
+	if len(filter.IDs) == 0 && filter.Tag == "" && filter.Usage == "" {
+		return nil, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{"file_ids"})
+	}
+
+	// 多查询一条用于判断是否超过限制
+	files, err := model.NewFileRepo(s.db).FindByFilter(ctx, filter, ArchiveMaxFiles+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > ArchiveMaxFiles {
+		return nil, errspec.ErrFileArchiveTooMany.New(ctx)
+	}
+
+	if len(ids) > 0 {
+		byID := make(map[string]model.File, len(files))
+		for _, file := range files {
+			byID[file.ID] = file
+		}
+
+		// 只按文件ID打包时要求全部文件可访问，并按请求顺序排列
+		if filter.Tag == "" && filter.Usage == "" {
+			ordered := make([]model.File, 0, len(ids))
+			for _, id := range ids {
+				file, ok := byID[id]
+				if !ok {
+					return nil, errspec.ErrFileNotFound.New(ctx)
+				}
+				ordered = append(ordered, file)
+			}
+			files = ordered
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errspec.ErrFileArchiveEmpty.New(ctx)
+	}
+	return files, nil
+}
+
+// Write 将文件依次写入ZIP，文件大小或数量超过ZIP格式限制时自动使用ZIP64
+// 写入过程中出错时压缩包不完整，调用方需要中断响应
+func (s *FileArchiveService) Write(ctx context.Context, w io.Writer, files []model.File) error {
+	zw := zip.NewWriter(w)
+	names := ArchiveEntryNames(files)
+
+	for i := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.writeEntry(ctx, zw, &files[i], names[i]); err != nil {
+			return fmt.Errorf("写入文件 %s 失败: %w", files[i].ID, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeEntry 读取存储中的文件写入压缩包，加密文件由存储解密后写入
+func (s *FileArchiveService) writeEntry(ctx context.Context, zw *zip.Writer, file *model.File, name string) error {
+	reader, err := s.storage.GetFile(ctx, file.Path, file.IsPublic)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   archiveMethod(file.MimeType),
+		Modified: file.UploadedAt,
+	}
+	if header.Modified.IsZero() {
+		header.Modified = file.CreatedAt
+	}
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, reader)
+	return err
+}
+
+// ArchiveEntryNames 按原始文件名生成压缩包内的文件名
+// 去除路径部分，重名（不区分大小写）时在扩展名前追加序号，如 report (1).pdf
+func ArchiveEntryNames(files []model.File) []string {
+	names := make([]string, len(files))
+	used := make(map[string]bool, len(files))
+
+	for i := range files {
+		name := path.Base(strings.ReplaceAll(files[i].OriginalName, `\`, "/"))
+		if name == "" || name == "." || name == ".." || name == "/" {
+			name = files[i].ID
+		}
+
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		candidate := name
+		for n := 1; used[strings.ToLower(candidate)]; n++ {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+
+		used[strings.ToLower(candidate)] = true
+		names[i] = candidate
+	}
+	return names
+}
+
+// archiveMethod 已压缩格式直接存储，其他文件使用Deflate压缩
+func archiveMethod(mimeType string) uint16 {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml" && mimeType != "image/bmp",
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"):
+		return zip.Store
+	}
+	switch mimeType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/vnd.rar", "application/x-bzip2", "application/x-xz",
+		"application/zstd":
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// uniqueStrings 去除空字符串和重复项，保持原顺序
+func uniqueStrings(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
@@ -1,10 +1,19 @@
 package handler
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/configs"
 	"github.com/limitcool/starter/internal/api/response"
 	"github.com/limitcool/starter/internal/dto"
 	"github.com/limitcool/starter/internal/errspec"
@@ -12,16 +21,27 @@ import (
 	"github.com/limitcool/starter/internal/middleware"
 	"github.com/limitcool/starter/internal/model"
 	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/limitcool/starter/internal/pkg/scanner"
 	"github.com/spf13/cast"
 	"gorm.io/gorm"
 )
 
 // FileHandler 文件处理器（基于接口）
 type FileHandler struct {
-	app         AppContext
-	db          *gorm.DB
-	storage     filestore.FileStorage
-	pathManager *filestore.PathManager
+	app            AppContext
+	db             *gorm.DB
+	storage        filestore.FileStorage
+	pathManager    *filestore.PathManager
+	imageService   *ImageService
+	blobService    *BlobService
+	quotaService   *QuotaService
+	trashService   *TrashService
+	versionService *FileVersionService
+	uploadService  *UploadService
+	scanService    *ScanService
+	eventService   *UploadEventService
+	helper         *HandlerHelper
+	contentPath    string // 通过应用服务器下载文件内容的路由前缀，注册路由时设置，如/api/v1/files
 }
 
 var _ RouterInitializer = (*FileHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
@@ -29,24 +49,52 @@ var _ RouterInitializer = (*FileHandler)(nil) // 用于接口断言，_ 变量
 // NewFileHandler 创建文件处理器
 func NewFileHandler(app AppContext) *FileHandler {
 	return &FileHandler{
-		app:         app,
-		db:          app.GetDB(),
-		storage:     app.GetStorage(),
-		pathManager: filestore.NewPathManager(),
+		app:            app,
+		db:             app.GetDB(),
+		storage:        app.GetStorage(),
+		pathManager:    app.GetPathManager(),
+		imageService:   NewImageService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		blobService:    NewBlobService(app.GetDB(), app.GetStorage()),
+		quotaService:   NewQuotaService(app.GetDB(), app.GetConfig()),
+		trashService:   NewTrashService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		versionService: NewFileVersionService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		uploadService:  NewUploadService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		scanService:    NewScanService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		eventService:   NewUploadEventService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		helper:         NewHandlerHelper(),
 	}
 }
 
 func (h *FileHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
 
-	// 公开文件访问
+	// 公开文件访问，文件信息随文件记录的更新和删除失效
+	responseCache := h.app.GetResponseCache()
 	publicFiles := root.Group("/public")
 	{
-		publicFiles.GET("/files/:id", h.GetFileInfo)
+		publicFiles.GET("/files/:id", responseCache.Middleware(middleware.CacheTags(fileCacheTags)), h.GetFileInfo)
+		publicFiles.GET("/files/:id/variants/:name", h.GetPublicFileVariant)
+	}
+
+	// 对象存储事件回调，使用回调令牌认证
+	if h.app.GetConfig().Storage.UploadEvent.Enabled {
+		g.POST("/storage/events", h.HandleStorageEvent)
 	}
 
 	// 需要认证的路由
 	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
 
+	// 文件访问（所有者或管理员）
+	userFiles := authenticated.Group("/files")
+	h.contentPath = userFiles.BasePath()
+	{
+		userFiles.GET("/:id/content", h.DownloadFile)
+		userFiles.GET("/:id/variants/:name", h.GetFileVariant)
+		userFiles.GET("/:id/variants/:name/content", h.DownloadFileVariant)
+	}
+
+	// 当前用户存储用量
+	authenticated.GET("/user/storage", h.GetStorageUsage)
+
 	// 管理员路由 - 使用简化的管理员检查中间件
 	admin := authenticated.Group("/admin", middleware.AdminCheck())
 	{
@@ -58,6 +106,14 @@ func (h *FileHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
 			files.GET("/:id/download", h.GetDownloadURL)
 			files.DELETE("/:id", h.DeleteFile)
 		}
+
+		// 用户存储配额管理
+		storage := admin.Group("/users/:id/storage")
+		{
+			storage.GET("", h.GetUserStorageUsage)
+			storage.PUT("/quota", h.SetUserStorageQuota)
+			storage.DELETE("/quota", h.DeleteUserStorageQuota)
+		}
 	}
 
 	// 文件上传接口（统一支持本地和MinIO存储，需要认证但不需要管理员权限）
@@ -67,6 +123,13 @@ func (h *FileHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
 	}
 }
 
+// fileCacheTags 文件信息响应的缓存标签，文件记录通过GORM更新或删除后失效
+// 没有主键条件的批量更新（存储迁移、对账）失效整张表的标签
+func fileCacheTags(c *gin.Context) []string {
+	table := model.File{}.TableName()
+	return []string{model.CacheTag(table, c.Param("id")), model.TableCacheTag(table)}
+}
+
 // GetUploadURL 获取上传URL
 func (h *FileHandler) GetUploadURL(c *gin.Context) {
 	var req dto.FileUploadRequest
@@ -85,15 +148,18 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 		return
 	}
 
-	// 获取文件用途
-	usage := h.pathManager.GetUsageFromString(req.Usage)
+	// 按文件用途规则预验证文件（如果提供了大小）和上传权限
+	usage := filestore.FileUsage(req.Usage)
+	if err := h.checkUpload(c, usage, req.Filename, req.ContentType, req.Size); err != nil {
+		response.Error(c, err)
+		return
+	}
+	isPublic := h.pathManager.IsPublic(usage, req.IsPublic)
 
-	// 预验证文件（如果提供了大小）
-	if req.Size > 0 {
-		if err := h.pathManager.ValidateFile(usage, req.Filename, req.Size); err != nil {
-			response.Error(c, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()}))
-			return
-		}
+	// 预检查存储配额，确认上传时按实际大小占用
+	if err := h.quotaService.Check(ctx, cast.ToInt64(userID), req.Usage, req.Size); err != nil {
+		response.Error(c, err)
+		return
 	}
 
 	// 生成智能文件路径
@@ -103,11 +169,10 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 		return
 	}
 
-	// 获取上传URL
-	uploadURL, method, err := h.storage.GetUploadURL(c.Request.Context(), filePath, req.ContentType, req.IsPublic)
+	// 获取上传URL，表单上传时同时返回需要提交的表单字段
+	upload, err := h.uploadTarget(ctx, req.Method, usage, filePath, req.ContentType, isPublic)
 	if err != nil {
-		logger.ErrorContext(c.Request.Context(), "获取上传URL失败", "error", err)
-		response.Error(c, errspec.ErrGetUploadURL.New(ctx))
+		response.Error(c, err)
 		return
 	}
 
@@ -122,8 +187,9 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 		Usage:        req.Usage,
 		StorageType:  h.storage.GetStorageType(),
 		UploadedBy:   cast.ToInt64(userID),
-		IsPublic:     req.IsPublic,
-		Status:       0, // 待上传
+		IsPublic:     isPublic,
+		Status:       model.FileStatusPending,
+		Version:      1,
 	}
 
 	if err := h.db.Create(fileRecord).Error; err != nil {
@@ -134,8 +200,9 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 
 	response.Success(c, &dto.FileUploadResponse{
 		FileID:      fileRecord.ID,
-		UploadURL:   uploadURL,
-		Method:      method,
+		UploadURL:   upload.UploadURL,
+		Method:      upload.Method,
+		Headers:     upload.Headers,
 		ExpiresIn:   15, // 分钟
 		StorageType: h.storage.GetStorageType(),
 		Usage:       req.Usage,
@@ -146,6 +213,28 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 	})
 }
 
+// HandleStorageEvent 接收对象存储的事件通知，自动确认客户端直传的文件
+// 使用共享令牌认证，对应MinIO webhook的auth_token或S3事件转发服务配置的令牌
+func (h *FileHandler) HandleStorageEvent(ctx *gin.Context) {
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	expected := h.app.GetConfig().Storage.UploadEvent.Token
+	if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		response.Error(ctx, errspec.ErrUnauthorized.New(ctx))
+		return
+	}
+
+	var event filestore.S3Event
+	if err := ctx.ShouldBindJSON(&event); err != nil {
+		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()}))
+		return
+	}
+
+	result := h.eventService.Handle(ctx.Request.Context(), &event)
+	logger.InfoContext(ctx.Request.Context(), "处理存储事件完成",
+		"confirmed", result.Confirmed, "skipped", result.Skipped, "failed", result.Failed)
+	response.Success(ctx, result)
+}
+
 // ConfirmUpload 确认上传完成
 func (h *FileHandler) ConfirmUpload(ctx *gin.Context) {
 	var req dto.FileConfirmRequest
@@ -162,6 +251,20 @@ func (h *FileHandler) ConfirmUpload(ctx *gin.Context) {
 		return
 	}
 
+	// 未通过扫描的文件内容已删除，隔离中的文件等待扫描完成，确认中的文件等待其他请求处理完成
+	switch fileRecord.Status {
+	case model.FileStatusRejected:
+		response.Error(ctx, errspec.ErrFileRejected.New(ctx))
+		return
+	case model.FileStatusQuarantined:
+		response.Success(ctx, fileRecord)
+		return
+	}
+	if h.uploadService.Confirming(&fileRecord) {
+		response.Success(ctx, fileRecord)
+		return
+	}
+
 	// 检查文件是否存在
 	exists, err := h.storage.FileExists(ctx.Request.Context(), fileRecord.Path, fileRecord.IsPublic)
 	if err != nil {
@@ -175,25 +278,52 @@ func (h *FileHandler) ConfirmUpload(ctx *gin.Context) {
 		return
 	}
 
-	// 生成下载URL
-	downloadURL, err := h.storage.GetDownloadURL(ctx.Request.Context(), fileRecord.Path, fileRecord.IsPublic)
-	if err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "生成下载URL失败", "error", err)
-		response.Error(ctx, errspec.ErrFileGenerateDownloadURL.New(ctx))
+	// 首次确认时检查存储配额
+	pending := fileRecord.Status != model.FileStatusActive
+	if pending {
+		if err := h.quotaService.Check(ctx.Request.Context(), fileRecord.UploadedBy, fileRecord.Usage, req.Size); err != nil {
+			response.Error(ctx, err)
+			return
+		}
+	}
+
+	// 校验客户端提供的摘要
+	if req.SHA256 != "" {
+		checksum, err := h.blobService.Checksum(ctx.Request.Context(), &fileRecord)
+		if err != nil {
+			logger.ErrorContext(ctx.Request.Context(), "计算文件校验和失败", "error", err)
+			response.Error(ctx, errspec.ErrFileVerify.New(ctx))
+			return
+		}
+		if err := h.blobService.Verify(ctx, req.SHA256, checksum); err != nil {
+			response.Error(ctx, err)
+			return
+		}
+	}
+
+	// 启用扫描时首次确认的文件进入隔离状态，扫描通过后由后台任务完成上传
+	if pending && h.scanService.Enabled() {
+		if err := h.scanService.Quarantine(ctx.Request.Context(), &fileRecord); err != nil {
+			logger.ErrorContext(ctx.Request.Context(), "更新文件记录失败", "error", err)
+			response.Error(ctx, err)
+			return
+		}
+		response.Success(ctx, fileRecord)
 		return
 	}
 
-	// 更新文件记录
-	fileRecord.Size = req.Size
-	fileRecord.URL = downloadURL
-	fileRecord.Status = 1 // 已完成
-	fileRecord.UploadedAt = time.Now()
+	if err := h.uploadService.Complete(ctx.Request.Context(), &fileRecord, pending); err != nil {
+		response.Error(ctx, err)
+		return
+	}
 
-	if err := h.db.Save(&fileRecord).Error; err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "更新文件记录失败", "error", err)
-		response.Error(ctx, errspec.ErrFileUpdateRecord.New(ctx))
+	downloadURL, err := h.fileDownloadURL(ctx.Request.Context(), &fileRecord)
+	if err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "生成下载URL失败", "error", err)
+		response.Error(ctx, errspec.ErrFileGenerateDownloadURL.New(ctx))
 		return
 	}
+	fileRecord.URL = downloadURL
 
 	response.Success(ctx, fileRecord)
 }
@@ -230,7 +360,7 @@ func (h *FileHandler) GetDownloadURL(ctx *gin.Context) {
 	}
 
 	// 生成新的下载URL
-	downloadURL, err := h.storage.GetDownloadURL(ctx.Request.Context(), fileRecord.Path, fileRecord.IsPublic)
+	downloadURL, err := h.fileDownloadURL(ctx.Request.Context(), &fileRecord)
 	if err != nil {
 		logger.ErrorContext(ctx.Request.Context(), "生成下载URL失败", "error", err)
 		response.Error(ctx, errspec.ErrFileGenerateDownloadURL.New(ctx))
@@ -244,6 +374,42 @@ func (h *FileHandler) GetDownloadURL(ctx *gin.Context) {
 		IsPublic:    fileRecord.IsPublic,
 		Size:        fileRecord.Size,
 		StorageType: fileRecord.StorageType,
+		SHA256:      fileRecord.SHA256,
+		MD5:         fileRecord.MD5,
+	})
+}
+
+// DownloadFile 通过应用服务器下载文件内容（所有者或管理员），加密文件在此解密
+func (h *FileHandler) DownloadFile(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	fileRecord, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	if !fileRecord.IsPublic && !h.helper.CheckPermission(ctx, userID, fileRecord.UploadedBy, "DownloadFile") {
+		return
+	}
+
+	reader, err := h.storage.GetFile(ctx.Request.Context(), fileRecord.Path, fileRecord.IsPublic)
+	if err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "读取文件失败", "file_id", fileRecord.ID, "error", err)
+		response.Error(ctx, errspec.ErrFileDownload.New(ctx))
+		return
+	}
+	defer reader.Close()
+
+	contentType := fileRecord.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx.DataFromReader(http.StatusOK, fileRecord.Size, contentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileRecord.OriginalName}),
 	})
 }
 
@@ -252,8 +418,10 @@ func (h *FileHandler) UploadFile(ctx *gin.Context) {
 	var req struct {
 		Filename    string `form:"filename" binding:"required"`
 		ContentType string `form:"content_type"`
-		IsPublic    bool   `form:"is_public"`
+		IsPublic    *bool  `form:"is_public"`                // 是否公开（可选，默认使用文件用途的配置）
 		Usage       string `form:"usage" binding:"required"` // avatar, banner, document, etc.
+		SHA256      string `form:"sha256"`                   // 客户端计算的SHA-256摘要（可选，用于完整性校验）
+		Replaces    string `form:"replaces"`                 // 要替换的文件ID（可选，上传为该文件的新版本）
 	}
 
 	if err := ctx.ShouldBind(&req); err != nil {
@@ -283,14 +451,31 @@ func (h *FileHandler) UploadFile(ctx *gin.Context) {
 		}
 	}
 
-	// 获取文件用途
-	usage := h.pathManager.GetUsageFromString(req.Usage)
-
-	// 验证文件
-	if err := h.pathManager.ValidateFile(usage, req.Filename, file.Size); err != nil {
-		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()}))
+	// 按文件用途规则验证文件和上传权限
+	usage := filestore.FileUsage(req.Usage)
+	if err := h.checkUpload(ctx, usage, req.Filename, req.ContentType, file.Size); err != nil {
+		response.Error(ctx, err)
 		return
 	}
+	isPublic := h.pathManager.IsPublic(usage, req.IsPublic)
+
+	// 替换已有文件时上传为新版本，可见性沿用原文件
+	var target *model.File
+	if req.Replaces != "" {
+		if target, err = h.replaceTarget(ctx, cast.ToInt64(userID), req.Replaces, usage); err != nil {
+			response.Error(ctx, err)
+			return
+		}
+		isPublic = target.IsPublic
+	}
+
+	// 检查存储配额，替换文件时在更新记录时按新旧版本的大小检查
+	if target == nil {
+		if err := h.quotaService.Check(ctx.Request.Context(), cast.ToInt64(userID), req.Usage, file.Size); err != nil {
+			response.Error(ctx, err)
+			return
+		}
+	}
 
 	// 生成智能文件路径
 	filePath, _, err := h.pathManager.GenerateFilePath(usage, req.Filename, cast.ToInt64(userID))
@@ -307,52 +492,125 @@ func (h *FileHandler) UploadFile(ctx *gin.Context) {
 	}
 	defer src.Close()
 
+	// 校验客户端提供的摘要
+	if req.SHA256 != "" {
+		checksum, err := filestore.ComputeChecksum(src)
+		if err != nil {
+			response.Error(ctx, errspec.ErrOpenUploadFile.New(ctx).Wrap(err))
+			return
+		}
+		if err := h.blobService.Verify(ctx, req.SHA256, checksum); err != nil {
+			response.Error(ctx, err)
+			return
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			response.Error(ctx, errspec.ErrOpenUploadFile.New(ctx).Wrap(err))
+			return
+		}
+	}
+
+	// 写入存储前扫描文件内容
+	err = h.scanService.Scan(ctx.Request.Context(), &scanner.Object{
+		Name: req.Filename,
+		Size: file.Size,
+		Open: func() (io.ReadCloser, error) { return file.Open() },
+	})
+	if err != nil {
+		logger.WarnContext(ctx.Request.Context(), "上传文件扫描未通过", "filename", req.Filename, "user_id", userID, "error", err)
+		response.Error(ctx, err)
+		return
+	}
+
+	// 移除图片中的EXIF/GPS等元数据
+	reader, err := h.imageService.SanitizeUpload(ctx.Request.Context(), usage, req.Filename, src)
+	if errspec.ErrFileTooLarge.Is(err) {
+		response.Error(ctx, err)
+		return
+	}
+	if err != nil {
+		response.Error(ctx, errspec.ErrOpenUploadFile.New(ctx).Wrap(err))
+		return
+	}
+
+	// 上传文件到存储，相同内容已存在时直接引用已有对象
+	filePath, checksum, err := h.blobService.Store(ctx.Request.Context(), filePath, reader, isPublic)
+	if err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "文件上传失败", "error", err)
+		response.Error(ctx, errspec.ErrFileUpdate.New(ctx))
+		return
+	}
+
 	// 创建文件记录
 	ext := filepath.Ext(req.Filename)
 	fileRecord := &model.File{
 		Name:         filepath.Base(filePath),
 		OriginalName: req.Filename,
 		Path:         filePath,
-		Size:         file.Size,
+		Size:         checksum.Size,
 		MimeType:     req.ContentType,
 		Extension:    ext,
 		Usage:        req.Usage,
 		StorageType:  h.storage.GetStorageType(),
 		UploadedBy:   cast.ToInt64(userID),
-		IsPublic:     req.IsPublic,
-		Status:       1, // 已完成
+		IsPublic:     isPublic,
+		Status:       model.FileStatusActive,
+		Version:      1,
 		UploadedAt:   time.Now(),
+		SHA256:       checksum.SHA256,
+		MD5:          checksum.MD5,
 	}
 
-	// 上传文件到存储
-	if err := h.storage.UploadFile(ctx.Request.Context(), filePath, src, req.IsPublic); err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "文件上传失败", "error", err)
-		response.Error(ctx, errspec.ErrFileUpdate.New(ctx))
+	// 替换已有文件时保存为新版本
+	if target != nil {
+		if err := h.versionService.Replace(ctx.Request.Context(), target, fileRecord, h.pathManager.GetMaxVersions(usage)); err != nil {
+			logger.ErrorContext(ctx.Request.Context(), "上传文件新版本失败", "file_id", target.ID, "error", err)
+			response.Error(ctx, err)
+			return
+		}
+		h.respondUploaded(ctx, target)
 		return
 	}
 
-	// 生成下载URL
-	downloadURL, err := h.storage.GetDownloadURL(ctx.Request.Context(), filePath, req.IsPublic)
+	// 保存文件记录到数据库并占用存储配额
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.quotaService.Consume(ctx.Request.Context(), tx, fileRecord.UploadedBy, fileRecord.Usage, fileRecord.Size); err != nil {
+			return err
+		}
+		return tx.Create(fileRecord).Error
+	})
 	if err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "生成下载URL失败", "error", err)
-		// 不返回错误，继续保存记录
-	} else {
-		fileRecord.URL = downloadURL
-	}
-
-	// 保存文件记录到数据库
-	if err := h.db.Create(fileRecord).Error; err != nil {
+		if err := h.blobService.Release(ctx.Request.Context(), fileRecord); err != nil {
+			logger.WarnContext(ctx.Request.Context(), "释放文件内容失败", "path", fileRecord.Path, "error", err)
+		}
+		if errspec.ErrStorageQuotaExceeded.Is(err) {
+			response.Error(ctx, err)
+			return
+		}
 		logger.ErrorContext(ctx.Request.Context(), "创建文件记录失败", "error", err)
 		response.Error(ctx, errspec.ErrFileCreate.New(ctx))
 		return
 	}
 
+	h.generateVariants(ctx, fileRecord)
+
 	logger.InfoContext(ctx.Request.Context(), "文件上传成功",
 		"file_id", fileRecord.ID,
 		"filename", req.Filename,
 		"storage_type", h.storage.GetStorageType(),
 		"user_id", userID)
 
+	h.respondUploaded(ctx, fileRecord)
+}
+
+// respondUploaded 返回上传完成的文件信息，文件记录已保存，加密文件返回解密下载的地址
+func (h *FileHandler) respondUploaded(ctx *gin.Context, fileRecord *model.File) {
+	// 生成下载URL失败时不返回错误，客户端可以之后重新获取
+	downloadURL, err := h.fileDownloadURL(ctx.Request.Context(), fileRecord)
+	if err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "生成下载URL失败", "file_id", fileRecord.ID, "error", err)
+	}
+	fileRecord.URL = downloadURL
+
 	response.Success(ctx, &dto.FileUploadCompleteResponse{
 		FileID:      fileRecord.ID,
 		Filename:    fileRecord.OriginalName,
@@ -361,9 +619,32 @@ func (h *FileHandler) UploadFile(ctx *gin.Context) {
 		StorageType: fileRecord.StorageType,
 		IsPublic:    fileRecord.IsPublic,
 		Usage:       fileRecord.Usage,
+		SHA256:      fileRecord.SHA256,
+		MD5:         fileRecord.MD5,
+		Version:     fileRecord.Version,
 	})
 }
 
+// fileDownloadURL 获取文件的下载URL
+func (h *FileHandler) fileDownloadURL(ctx context.Context, file *model.File) (string, error) {
+	return h.downloadURL(ctx, file.Path, file.IsPublic, "/"+file.ID+"/content")
+}
+
+// variantDownloadURL 获取衍生图的下载URL
+func (h *FileHandler) variantDownloadURL(ctx context.Context, file *model.File, variant *model.FileVariant) (string, error) {
+	return h.downloadURL(ctx, variant.Path, variant.IsPublic, "/"+file.ID+"/variants/"+url.PathEscape(variant.Name)+"/content")
+}
+
+// downloadURL 获取存储对象的下载URL
+// 加密对象的存储URL只能下载到密文，改为返回通过应用服务器解密下载的地址（所有者或管理员），contentRoute为文件路由下的路径
+func (h *FileHandler) downloadURL(ctx context.Context, filePath string, isPublic bool, contentRoute string) (string, error) {
+	downloadURL, err := h.storage.GetDownloadURL(ctx, filePath, isPublic)
+	if errors.Is(err, filestore.ErrDecryptionRequired) {
+		return h.contentPath + contentRoute, nil
+	}
+	return downloadURL, err
+}
+
 // DeleteFile 删除文件
 func (h *FileHandler) DeleteFile(ctx *gin.Context) {
 	fileID := ctx.Param("id")
@@ -378,19 +659,305 @@ func (h *FileHandler) DeleteFile(ctx *gin.Context) {
 		return
 	}
 
-	// 删除存储中的文件
-	if err := h.storage.DeleteFile(ctx.Request.Context(), fileRecord.Path, fileRecord.IsPublic); err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "删除存储文件失败", "error", err)
-		response.Error(ctx, errspec.ErrFileDelete.New(ctx))
+	// 启用回收站时移入回收站，permanent=true时永久删除
+	remove := h.trashService.Remove
+	if ctx.Query("permanent") == "true" {
+		remove = h.trashService.Delete
+	}
+	if err := remove(ctx.Request.Context(), &fileRecord); err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "删除文件失败", "file_id", fileRecord.ID, "error", err)
+		response.Error(ctx, err)
+		return
+	}
+
+	response.Success(ctx, &dto.DeleteResponse{Message: "删除成功"})
+}
+
+// GetPublicFileVariant 获取公开文件的衍生图
+func (h *FileHandler) GetPublicFileVariant(ctx *gin.Context) {
+	fileRecord, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	// 私有文件不通过公开接口暴露
+	if !fileRecord.IsPublic {
+		response.Error(ctx, errspec.ErrFileNotFound.New(ctx))
+		return
+	}
+
+	h.respondVariant(ctx, fileRecord)
+}
+
+// GetFileVariant 获取文件衍生图（所有者或管理员）
+func (h *FileHandler) GetFileVariant(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	fileRecord, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	if !fileRecord.IsPublic && !h.helper.CheckPermission(ctx, userID, fileRecord.UploadedBy, "GetFileVariant") {
+		return
+	}
+
+	h.respondVariant(ctx, fileRecord)
+}
+
+// DownloadFileVariant 通过应用服务器下载衍生图内容（所有者或管理员），加密的衍生图解密后传输
+func (h *FileHandler) DownloadFileVariant(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	fileRecord, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	if !fileRecord.IsPublic && !h.helper.CheckPermission(ctx, userID, fileRecord.UploadedBy, "DownloadFileVariant") {
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	variant, err := h.imageService.GetOrCreateVariant(reqCtx, fileRecord, ctx.Param("name"))
+	if err != nil {
+		logger.WarnContext(reqCtx, "获取文件衍生图失败", "file_id", fileRecord.ID, "variant", ctx.Param("name"), "error", err)
+		response.Error(ctx, err)
+		return
+	}
+
+	reader, err := h.storage.GetFile(reqCtx, variant.Path, variant.IsPublic)
+	if err != nil {
+		logger.ErrorContext(reqCtx, "读取衍生图失败", "file_id", fileRecord.ID, "variant", variant.Name, "error", err)
+		response.Error(ctx, errspec.ErrFileDownload.New(ctx))
+		return
+	}
+	defer reader.Close()
+
+	ctx.DataFromReader(http.StatusOK, variant.Size, variant.MimeType, reader, nil)
+}
+
+// GetStorageUsage 获取当前用户的存储用量
+func (h *FileHandler) GetStorageUsage(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotaService.Usage(ctx.Request.Context(), userID)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "GetStorageUsage", "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, usage)
+}
+
+// GetUserStorageUsage 获取指定用户的存储用量（管理员）
+func (h *FileHandler) GetUserStorageUsage(ctx *gin.Context) {
+	userID, ok := h.findUserID(ctx)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotaService.Usage(ctx.Request.Context(), userID)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "GetUserStorageUsage", "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, usage)
+}
+
+// SetUserStorageQuota 为指定用户单独设置存储配额（管理员）
+func (h *FileHandler) SetUserStorageQuota(ctx *gin.Context) {
+	userID, ok := h.findUserID(ctx)
+	if !ok {
+		return
+	}
+
+	var req dto.StorageQuotaRequest
+	if !h.helper.BindJSON(ctx, &req, "SetUserStorageQuota") {
+		return
+	}
+
+	limit := configs.QuotaLimit{MaxBytes: req.MaxBytes, MaxFiles: req.MaxFiles}
+	if err := h.quotaService.SetOverride(ctx.Request.Context(), userID, req.Usage, limit); err != nil {
+		h.helper.HandleDBError(ctx, err, "SetUserStorageQuota", "user_id", userID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "SetUserStorageQuota", "user_id", userID, "usage", req.Usage)
+
+	usage, err := h.quotaService.Usage(ctx.Request.Context(), userID)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "SetUserStorageQuota", "user_id", userID)
 		return
 	}
 
-	// 删除数据库记录
-	if err := h.db.Delete(&fileRecord).Error; err != nil {
-		logger.ErrorContext(ctx.Request.Context(), "删除文件记录失败", "error", err)
-		response.Error(ctx, errspec.ErrFileDelete.New(ctx))
+	response.Success(ctx, usage)
+}
+
+// DeleteUserStorageQuota 删除指定用户的单独存储配额（管理员）
+func (h *FileHandler) DeleteUserStorageQuota(ctx *gin.Context) {
+	userID, ok := h.findUserID(ctx)
+	if !ok {
 		return
 	}
 
+	usageName := ctx.Query("usage")
+	if err := h.quotaService.DeleteOverride(ctx.Request.Context(), userID, usageName); err != nil {
+		h.helper.HandleDBError(ctx, err, "DeleteUserStorageQuota", "user_id", userID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "DeleteUserStorageQuota", "user_id", userID, "usage", usageName)
 	response.Success(ctx, &dto.DeleteResponse{Message: "删除成功"})
 }
+
+// findUserID 根据路由参数获取并校验用户ID
+func (h *FileHandler) findUserID(ctx *gin.Context) (int64, bool) {
+	userID := cast.ToInt64(ctx.Param("id"))
+	if userID == 0 {
+		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{"id"}))
+		return 0, false
+	}
+
+	if _, err := model.NewUserRepo(h.db).GetByID(ctx.Request.Context(), userID); err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "findUserID", "user_id", userID)
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// findFile 根据路由参数查询文件记录
+func (h *FileHandler) findFile(ctx *gin.Context) (*model.File, bool) {
+	fileID := ctx.Param("id")
+	if fileID == "" {
+		response.Error(ctx, errspec.ErrFileIDEmpty.New(ctx))
+		return nil, false
+	}
+
+	var fileRecord model.File
+	if err := h.db.Where("id = ? AND status = ?", fileID, model.FileStatusActive).First(&fileRecord).Error; err != nil {
+		response.Error(ctx, errspec.ErrFileNotFound.New(ctx))
+		return nil, false
+	}
+
+	return &fileRecord, true
+}
+
+// respondVariant 获取（必要时生成）衍生图并返回下载信息
+func (h *FileHandler) respondVariant(ctx *gin.Context, fileRecord *model.File) {
+	reqCtx := ctx.Request.Context()
+	name := ctx.Param("name")
+
+	variant, err := h.imageService.GetOrCreateVariant(reqCtx, fileRecord, name)
+	if err != nil {
+		logger.WarnContext(reqCtx, "获取文件衍生图失败", "file_id", fileRecord.ID, "variant", name, "error", err)
+		response.Error(ctx, err)
+		return
+	}
+
+	downloadURL, err := h.variantDownloadURL(reqCtx, fileRecord, variant)
+	if err != nil {
+		logger.ErrorContext(reqCtx, "生成下载URL失败", "error", err)
+		response.Error(ctx, errspec.ErrFileGenerateDownloadURL.New(ctx))
+		return
+	}
+
+	response.Success(ctx, &dto.FileVariantResponse{
+		FileID:      fileRecord.ID,
+		Name:        variant.Name,
+		DownloadURL: downloadURL,
+		Width:       variant.Width,
+		Height:      variant.Height,
+		Size:        variant.Size,
+		MimeType:    variant.MimeType,
+	})
+}
+
+// generateVariants 上传完成后按配置生成衍生图，失败时仅记录日志（可在首次请求时重新生成）
+func (h *FileHandler) generateVariants(ctx *gin.Context, fileRecord *model.File) {
+	if !h.imageService.GenerateOnUpload(fileRecord) {
+		return
+	}
+
+	if err := h.imageService.GenerateVariants(ctx.Request.Context(), fileRecord); err != nil {
+		logger.WarnContext(ctx.Request.Context(), "生成文件衍生图失败", "file_id", fileRecord.ID, "error", err)
+	}
+}
+
+// checkUpload 按文件用途规则检查文件大小、类型和当前用户的角色
+func (h *FileHandler) checkUpload(ctx *gin.Context, usage filestore.FileUsage, filename, contentType string, size int64) error {
+	if err := h.pathManager.ValidateFile(usage, filename, contentType, size); err != nil {
+		return errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()})
+	}
+	if err := h.pathManager.CheckRole(usage, h.helper.GetRole(ctx)); err != nil {
+		logger.WarnContext(ctx.Request.Context(), "上传角色不允许", "usage", usage, "error", err)
+		return errspec.ErrForbidden.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// uploadTarget 获取客户端直传的上传地址，method为POST时按文件用途的大小限制生成表单上传策略
+func (h *FileHandler) uploadTarget(ctx context.Context, method string, usage filestore.FileUsage, filePath, contentType string, isPublic bool) (*filestore.UploadResponse, error) {
+	if method != http.MethodPost {
+		uploadURL, method, err := h.storage.GetUploadURL(ctx, filePath, contentType, isPublic)
+		if err != nil {
+			logger.ErrorContext(ctx, "获取上传URL失败", "error", err)
+			return nil, errspec.ErrGetUploadURL.New(ctx)
+		}
+		return &filestore.UploadResponse{UploadURL: uploadURL, Method: method}, nil
+	}
+
+	uploader, ok := h.storage.(filestore.PostUploader)
+	if !ok {
+		return nil, errspec.ErrUploadMethodUnsupported.New(ctx)
+	}
+	upload, err := uploader.GetUploadForm(ctx, filePath, isPublic, filestore.PostPolicy{
+		ContentType: contentType,
+		MaxSize:     h.pathManager.GetMaxFileSize(usage),
+	})
+	if errors.Is(err, filestore.ErrPostUploadUnsupported) {
+		return nil, errspec.ErrUploadMethodUnsupported.New(ctx)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "获取表单上传策略失败", "error", err)
+		return nil, errspec.ErrGetUploadURL.New(ctx)
+	}
+	return upload, nil
+}
+
+// replaceTarget 获取要替换的文件，只能替换自己的文件，且文件用途相同并启用了版本管理
+func (h *FileHandler) replaceTarget(ctx *gin.Context, userID int64, fileID string, usage filestore.FileUsage) (*model.File, error) {
+	rule, err := h.pathManager.Rule(usage)
+	if err != nil {
+		return nil, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()})
+	}
+	if !rule.Versioned {
+		return nil, errspec.ErrFileVersioningDisabled.New(ctx)
+	}
+
+	var target model.File
+	err = h.db.WithContext(ctx.Request.Context()).
+		Where("id = ? AND uploaded_by = ? AND status = ?", fileID, userID, model.FileStatusActive).
+		First(&target).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errspec.ErrFileNotFound.New(ctx)
+		}
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	if target.Usage != string(usage) {
+		return nil, errspec.ErrFileVersionUsage.New(ctx)
+	}
+	return &target, nil
+}
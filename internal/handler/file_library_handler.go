@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+)
+
+// FileLibraryHandler 用户文件库处理器
+type FileLibraryHandler struct {
+	app     AppContext
+	service *FileLibraryService
+	helper  *HandlerHelper
+}
+
+var _ RouterInitializer = (*FileLibraryHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewFileLibraryHandler 创建用户文件库处理器
+func NewFileLibraryHandler(app AppContext) *FileLibraryHandler {
+	return &FileLibraryHandler{
+		app:     app,
+		service: NewFileLibraryService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		helper:  NewHandlerHelper(),
+	}
+}
+
+func (h *FileLibraryHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
+	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
+
+	// 当前用户的文件库
+	files := authenticated.Group("/user/files")
+	{
+		files.GET("", h.ListFiles)
+		files.GET("/tags", h.ListTags)
+		files.GET("/:id", h.GetFile)
+		files.PUT("/:id/name", h.RenameFile)
+		files.PUT("/:id/visibility", h.SetVisibility)
+		files.PUT("/:id/tags", h.SetTags)
+	}
+}
+
+// ListFiles 分页获取当前用户的文件，支持按用途、类型、时间范围、文件名和标签过滤
+func (h *FileLibraryHandler) ListFiles(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	var req dto.FileListRequest
+	if !h.helper.BindQuery(ctx, &req, "ListFiles") {
+		return
+	}
+	req.Normalize()
+
+	items, total, err := h.service.List(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "ListFiles", "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, response.NewPageResult(items, total, req.Page, req.PageSize))
+}
+
+// ListTags 获取当前用户的标签及文件数
+func (h *FileLibraryHandler) ListTags(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	tags, err := h.service.ListTags(ctx.Request.Context(), userID)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "ListTags", "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, tags)
+}
+
+// GetFile 获取当前用户的文件详情
+func (h *FileLibraryHandler) GetFile(ctx *gin.Context) {
+	userID, file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	h.respondItem(ctx, userID, file)
+}
+
+// RenameFile 修改文件的原始文件名
+func (h *FileLibraryHandler) RenameFile(ctx *gin.Context) {
+	var req dto.FileRenameRequest
+	if !h.helper.BindJSON(ctx, &req, "RenameFile") {
+		return
+	}
+
+	userID, file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Rename(ctx.Request.Context(), file, req.Name); err != nil {
+		h.helper.HandleDBError(ctx, err, "RenameFile", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "RenameFile", "file_id", file.ID, "name", file.OriginalName)
+	h.respondItem(ctx, userID, file)
+}
+
+// SetVisibility 修改文件可见性，存储对象在公开和私有目录之间移动
+func (h *FileLibraryHandler) SetVisibility(ctx *gin.Context) {
+	var req dto.FileVisibilityRequest
+	if !h.helper.BindJSON(ctx, &req, "SetVisibility") {
+		return
+	}
+
+	userID, file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.service.SetVisibility(ctx.Request.Context(), file, *req.IsPublic); err != nil {
+		h.helper.HandleDBError(ctx, err, "SetVisibility", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "SetVisibility", "file_id", file.ID, "is_public", file.IsPublic)
+	h.respondItem(ctx, userID, file)
+}
+
+// SetTags 替换文件标签
+func (h *FileLibraryHandler) SetTags(ctx *gin.Context) {
+	var req dto.FileTagsRequest
+	if !h.helper.BindJSON(ctx, &req, "SetTags") {
+		return
+	}
+
+	userID, file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	tags, err := h.service.SetTags(ctx.Request.Context(), userID, file, req.Tags)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "SetTags", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "SetTags", "file_id", file.ID, "tags", tags)
+	h.respondItem(ctx, userID, file)
+}
+
+// findFile 查询当前用户的文件，不属于当前用户的文件视为不存在
+func (h *FileLibraryHandler) findFile(ctx *gin.Context) (int64, *model.File, bool) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return 0, nil, false
+	}
+
+	fileID := ctx.Param("id")
+	if fileID == "" {
+		response.Error(ctx, errspec.ErrFileIDEmpty.New(ctx))
+		return 0, nil, false
+	}
+
+	file, err := h.service.Get(ctx.Request.Context(), userID, fileID)
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "findFile", "file_id", fileID, "user_id", userID)
+		return 0, nil, false
+	}
+
+	return userID, file, true
+}
+
+// respondItem 返回文件详情（含标签）
+func (h *FileLibraryHandler) respondItem(ctx *gin.Context, userID int64, file *model.File) {
+	item, err := h.service.Item(ctx.Request.Context(), file)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "GetFile", "file_id", file.ID, "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, item)
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// FileLibraryService 用户文件库服务，提供文件列表、重命名、可见性和标签管理
+type FileLibraryService struct {
+	db           *gorm.DB
+	storage      filestore.FileStorage
+	blobService  *BlobService
+	imageService *ImageService
+}
+
+// NewFileLibraryService 创建用户文件库服务
+func NewFileLibraryService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *FileLibraryService {
+	return &FileLibraryService{
+		db:           db,
+		storage:      storage,
+		blobService:  NewBlobService(db, storage),
+		imageService: NewImageService(db, storage, config),
+	}
+}
+
+// List 按条件分页获取用户的文件及其标签
+func (s *FileLibraryService) List(ctx context.Context, userID int64, req *dto.FileListRequest) ([]dto.FileItem, int64, error) {
+	filter := &model.FileFilter{
+		UserID:   userID,
+		Usage:    req.Usage,
+		Type:     req.Type,
+		Keyword:  strings.TrimSpace(req.Keyword),
+		Tag:      strings.TrimSpace(req.Tag),
+		IsPublic: req.IsPublic,
+		SortBy:   req.SortBy,
+		SortDesc: req.SortDesc,
+	}
+
+	var err error
+	if filter.StartTime, err = parseTime(ctx, req.StartTime, "start_time"); err != nil {
+		return nil, 0, err
+	}
+	if filter.EndTime, err = parseTime(ctx, req.EndTime, "end_time"); err != nil {
+		return nil, 0, err
+	}
+
+	files, total, err := model.NewFileRepo(s.db).ListByFilter(ctx, req.Page, req.PageSize, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, len(files))
+	for i := range files {
+		ids[i] = files[i].ID
+	}
+	tags, err := model.NewTagRepo(s.db).ListByFiles(ctx, ids)
+	if err != nil {
+		return nil, 0, errspec.ErrQueryUserFileList.New(ctx).Wrap(err)
+	}
+
+	items := make([]dto.FileItem, len(files))
+	for i := range files {
+		items[i] = toFileItem(&files[i], tags[files[i].ID])
+	}
+	return items, total, nil
+}
+
+// Get 获取用户的单个文件，文件不存在或不属于该用户时返回ErrFileNotFound
+func (s *FileLibraryService) Get(ctx context.Context, userID int64, fileID string) (*model.File, error) {
+	var file model.File
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND uploaded_by = ? AND status = ?", fileID, userID, model.FileStatusActive).
+		First(&file).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errspec.ErrFileNotFound.New(ctx)
+		}
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	return &file, nil
+}
+
+// Item 获取文件及其标签
+func (s *FileLibraryService) Item(ctx context.Context, file *model.File) (*dto.FileItem, error) {
+	tags, err := model.NewTagRepo(s.db).ListByFiles(ctx, []string{file.ID})
+	if err != nil {
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+
+	item := toFileItem(file, tags[file.ID])
+	return &item, nil
+}
+
+// Rename 修改文件的原始文件名，存储路径不变
+func (s *FileLibraryService) Rename(ctx context.Context, file *model.File, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return errspec.ErrFileNameInvalid.New(ctx)
+	}
+
+	if err := s.db.WithContext(ctx).Model(file).Update("original_name", name).Error; err != nil {
+		return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+	file.OriginalName = name
+	return nil
+}
+
+// SetVisibility 修改文件可见性，将存储对象移动到公开或私有目录
+// 内容按可见范围去重，移动后释放原对象的引用，衍生图在下次访问时重新生成
+func (s *FileLibraryService) SetVisibility(ctx context.Context, file *model.File, isPublic bool) error {
+	if file.IsPublic == isPublic {
+		return nil
+	}
+
+	reader, err := s.storage.GetFile(ctx, file.Path, file.IsPublic)
+	if err != nil {
+		return errspec.ErrFileVisibilityUpdate.New(ctx).Wrap(err)
+	}
+	newPath, checksum, err := s.blobService.Store(ctx, file.Path, reader, isPublic)
+	reader.Close()
+	if err != nil {
+		return errspec.ErrFileVisibilityUpdate.New(ctx).Wrap(err)
+	}
+
+	old := *file
+	moved := *file
+	moved.Path = newPath
+	moved.IsPublic = isPublic
+	moved.StorageType = s.storage.GetStorageType()
+	moved.SHA256 = checksum.SHA256
+	moved.MD5 = checksum.MD5
+
+	err = s.db.WithContext(ctx).Model(file).Updates(map[string]any{
+		"path":         moved.Path,
+		"is_public":    moved.IsPublic,
+		"storage_type": moved.StorageType,
+		"sha256":       moved.SHA256,
+		"md5":          moved.MD5,
+	}).Error
+	if err != nil {
+		if releaseErr := s.blobService.Release(ctx, &moved); releaseErr != nil {
+			logger.WarnContext(ctx, "释放新存储对象失败", "file_id", file.ID, "path", moved.Path, "error", releaseErr)
+		}
+		return errspec.ErrFileVisibilityUpdate.New(ctx).Wrap(err)
+	}
+	*file = moved
+
+	if err := s.imageService.DeleteVariants(ctx, &old); err != nil {
+		logger.WarnContext(ctx, "删除文件衍生图失败", "file_id", old.ID, "error", err)
+	}
+	if err := s.blobService.Release(ctx, &old); err != nil {
+		logger.WarnContext(ctx, "释放原存储对象失败", "file_id", old.ID, "path", old.Path, "error", err)
+	}
+
+	return nil
+}
+
+// SetTags 替换文件标签，去除首尾空白、空标签和重复标签
+func (s *FileLibraryService) SetTags(ctx context.Context, userID int64, file *model.File, tags []string) ([]string, error) {
+	names := NormalizeTags(tags)
+	if err := model.NewTagRepo(s.db).SetFileTags(ctx, userID, file.ID, names); err != nil {
+		return nil, errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+	return names, nil
+}
+
+// ListTags 获取用户的标签及文件数
+func (s *FileLibraryService) ListTags(ctx context.Context, userID int64) ([]model.TagCount, error) {
+	tags, err := model.NewTagRepo(s.db).ListByUser(ctx, userID)
+	if err != nil {
+		return nil, errspec.ErrDatabaseQuery.New(ctx).Wrap(err)
+	}
+	return tags, nil
+}
+
+// NormalizeTags 规范化标签列表：去除首尾空白，忽略空标签和重复标签，保持原有顺序
+func NormalizeTags(tags []string) []string {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		names = append(names, tag)
+	}
+	return names
+}
+
+// parseTime 解析RFC3339格式的时间参数，为空时返回nil
+func parseTime(ctx context.Context, value, param string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{param})
+	}
+	return &t, nil
+}
+
+// toFileItem 转换为文件列表项
+func toFileItem(file *model.File, tags []string) dto.FileItem {
+	if tags == nil {
+		tags = []string{}
+	}
+	return dto.FileItem{
+		ID:           file.ID,
+		OriginalName: file.OriginalName,
+		Usage:        file.Usage,
+		Size:         file.Size,
+		MimeType:     file.MimeType,
+		Extension:    file.Extension,
+		IsPublic:     file.IsPublic,
+		StorageType:  file.StorageType,
+		SHA256:       file.SHA256,
+		Tags:         tags,
+		UploadedAt:   file.UploadedAt,
+		CreatedAt:    file.CreatedAt,
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/spf13/cast"
+)
+
+// SharePasswordHeader 分享密码请求头，也可以通过password查询参数传递
+const SharePasswordHeader = "X-Share-Password"
+
+// FileShareHandler 文件分享链接处理器
+type FileShareHandler struct {
+	app     AppContext
+	library *FileLibraryService
+	service *FileShareService
+	helper  *HandlerHelper
+}
+
+var _ RouterInitializer = (*FileShareHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewFileShareHandler 创建文件分享链接处理器
+func NewFileShareHandler(app AppContext) *FileShareHandler {
+	return &FileShareHandler{
+		app:     app,
+		library: NewFileLibraryService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		service: NewFileShareService(app.GetDB(), app.GetStorage(), shareFailureCache(app), app.GetConfig()),
+		helper:  NewHandlerHelper(),
+	}
+}
+
+// shareFailureCache 统计分享密码错误次数的缓存
+// 未启用Redis时使用进程内缓存，多实例部署时各实例分别计数
+func shareFailureCache(app AppContext) cache.Cache {
+	if c := app.GetCache(); c != nil {
+		return c
+	}
+	return cache.NewMemoryCache()
+}
+
+func (h *FileShareHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
+	// 公开的分享链接访问，设置了邮箱白名单的链接需要携带登录token
+	root.GET("/s/:token", middleware.OptionalJWTAuth(h.app.GetConfig()), h.OpenShare)
+	root.POST("/s/:token", middleware.OptionalJWTAuth(h.app.GetConfig()), h.OpenShare)
+
+	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
+	{
+		authenticated.POST("/user/files/:id/shares", h.CreateShare)
+		authenticated.GET("/user/files/:id/shares", h.ListFileShares)
+		authenticated.GET("/user/shares", h.ListShares)
+		authenticated.DELETE("/user/shares/:id", h.RevokeShare)
+	}
+}
+
+// CreateShare 为当前用户的文件创建分享链接
+func (h *FileShareHandler) CreateShare(ctx *gin.Context) {
+	var req dto.FileShareRequest
+	if !h.helper.BindJSON(ctx, &req, "CreateShare") {
+		return
+	}
+
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	file, err := h.library.Get(ctx.Request.Context(), userID, ctx.Param("id"))
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "CreateShare", "file_id", ctx.Param("id"), "user_id", userID)
+		return
+	}
+
+	share, err := h.service.Create(ctx.Request.Context(), userID, file, &req)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "CreateShare", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "CreateShare", "file_id", file.ID, "share_id", share.ID)
+	response.Success(ctx, ToFileShareResponse(share))
+}
+
+// ListFileShares 获取当前用户为指定文件创建的分享链接
+func (h *FileShareHandler) ListFileShares(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	file, err := h.library.Get(ctx.Request.Context(), userID, ctx.Param("id"))
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "ListFileShares", "file_id", ctx.Param("id"), "user_id", userID)
+		return
+	}
+
+	h.respondList(ctx, userID, file.ID)
+}
+
+// ListShares 获取当前用户创建的全部分享链接
+func (h *FileShareHandler) ListShares(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	h.respondList(ctx, userID, "")
+}
+
+// RevokeShare 撤销当前用户的分享链接
+func (h *FileShareHandler) RevokeShare(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	shareID := cast.ToUint(ctx.Param("id"))
+	if shareID == 0 {
+		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{"id"}))
+		return
+	}
+
+	if err := h.service.Revoke(ctx.Request.Context(), userID, shareID); err != nil {
+		h.helper.HandleDBError(ctx, err, "RevokeShare", "share_id", shareID, "user_id", userID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "RevokeShare", "share_id", shareID, "user_id", userID)
+	response.Success(ctx, &dto.DeleteResponse{Message: "撤销成功"})
+}
+
+// OpenShare 校验分享链接后下载文件
+// 存储可以直接提供下载时重定向到下载URL，否则由应用服务器传输文件内容
+func (h *FileShareHandler) OpenShare(ctx *gin.Context) {
+	reqCtx := ctx.Request.Context()
+	token := ctx.Param("token")
+
+	// 密码只从请求头或POST表单读取，不接受查询参数，避免出现在访问日志和浏览器历史中
+	password := ctx.GetHeader(SharePasswordHeader)
+	if password == "" && ctx.Request.Method == http.MethodPost {
+		password = ctx.PostForm("password")
+	}
+
+	file, err := h.service.Open(reqCtx, token, ShareAccess{
+		Password: password,
+		UserID:   middleware.GetUserIDInt64(ctx),
+		IP:       ctx.ClientIP(),
+	})
+	if err != nil {
+		logger.WarnContext(reqCtx, "分享链接访问失败", "client_ip", ctx.ClientIP(), "error", err)
+		response.Error(ctx, err)
+		return
+	}
+
+	downloadURL, err := h.service.RedirectURL(reqCtx, file)
+	if err != nil {
+		logger.ErrorContext(reqCtx, "生成下载URL失败", "file_id", file.ID, "error", err)
+		response.Error(ctx, errspec.ErrFileGenerateDownloadURL.New(ctx))
+		return
+	}
+	if downloadURL != "" {
+		ctx.Redirect(http.StatusFound, downloadURL)
+		return
+	}
+
+	reader, err := h.app.GetStorage().GetFile(reqCtx, file.Path, file.IsPublic)
+	if err != nil {
+		logger.ErrorContext(reqCtx, "读取文件失败", "file_id", file.ID, "error", err)
+		response.Error(ctx, errspec.ErrFileDownload.New(ctx))
+		return
+	}
+	defer reader.Close()
+
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx.DataFromReader(http.StatusOK, file.Size, contentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.OriginalName}),
+	})
+}
+
+// respondList 返回分享链接列表
+func (h *FileShareHandler) respondList(ctx *gin.Context, userID int64, fileID string) {
+	shares, err := h.service.List(ctx.Request.Context(), userID, fileID)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "ListShares", "user_id", userID, "file_id", fileID)
+		return
+	}
+
+	response.Success(ctx, shares)
+}
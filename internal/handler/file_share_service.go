@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/crypto"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/limitcool/starter/internal/pkg/types"
+	"gorm.io/gorm"
+)
+
+// 分享链接状态
+const (
+	ShareStatusActive    = "active"    // 有效
+	ShareStatusExpired   = "expired"   // 已过期
+	ShareStatusExhausted = "exhausted" // 下载次数已用尽
+	ShareStatusRevoked   = "revoked"   // 已撤销
+)
+
+// shareTokenBytes 访问令牌的随机字节数
+const shareTokenBytes = 24
+
+// defaultShareLockout 未配置时统计分享密码错误次数的时间窗口
+const defaultShareLockout = 15 * time.Minute
+
+// ShareAccess 分享链接的访问者信息
+type ShareAccess struct {
+	Password string // 访问密码
+	UserID   int64  // 已登录访问者的用户ID，匿名访问为0
+	IP       string // 访问者IP，用于统计密码错误次数
+}
+
+// FileShareService 文件分享链接服务
+type FileShareService struct {
+	db       *gorm.DB
+	storage  filestore.FileStorage
+	failures cache.Cache // 分享密码错误次数
+	config   configs.ShareConfig
+}
+
+// NewFileShareService 创建文件分享链接服务，failures用于统计分享密码错误次数
+func NewFileShareService(db *gorm.DB, storage filestore.FileStorage, failures cache.Cache, config *configs.Config) *FileShareService {
+	shareConfig := config.Storage.Share
+	if shareConfig.LockoutDuration <= 0 {
+		shareConfig.LockoutDuration = defaultShareLockout
+	}
+	return &FileShareService{
+		db:       db,
+		storage:  storage,
+		failures: failures,
+		config:   shareConfig,
+	}
+}
+
+// Create 为文件创建分享链接
+func (s *FileShareService) Create(ctx context.Context, userID int64, file *model.File, req *dto.FileShareRequest) (*model.FileShare, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{"expires_at"})
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, errspec.ErrDatabaseInsert.New(ctx).Wrap(err)
+	}
+
+	share := &model.FileShare{
+		FileID:        file.ID,
+		UserID:        userID,
+		Token:         token,
+		ExpiresAt:     req.ExpiresAt,
+		MaxDownloads:  req.MaxDownloads,
+		AllowedEmails: normalizeEmails(req.AllowedEmails),
+	}
+	if req.Password != "" {
+		if share.PasswordHash, err = crypto.HashPasswordWithContext(ctx, req.Password); err != nil {
+			return nil, errspec.ErrDatabaseInsert.New(ctx).Wrap(err)
+		}
+	}
+
+	if err := model.NewFileShareRepo(s.db).Create(ctx, share); err != nil {
+		return nil, errspec.ErrDatabaseInsert.New(ctx).Wrap(err)
+	}
+	return share, nil
+}
+
+// List 获取用户创建的分享链接，fileID不为空时只返回该文件的分享链接
+func (s *FileShareService) List(ctx context.Context, userID int64, fileID string) ([]dto.FileShareResponse, error) {
+	shares, err := model.NewFileShareRepo(s.db).ListByUser(ctx, userID, fileID)
+	if err != nil {
+		return nil, errspec.ErrDatabaseQuery.New(ctx).Wrap(err)
+	}
+
+	items := make([]dto.FileShareResponse, len(shares))
+	for i := range shares {
+		items[i] = *ToFileShareResponse(&shares[i])
+	}
+	return items, nil
+}
+
+// Revoke 撤销用户的分享链接
+func (s *FileShareService) Revoke(ctx context.Context, userID int64, id uint) error {
+	err := model.NewFileShareRepo(s.db).Revoke(ctx, userID, id)
+	if err != nil && !errspec.ErrShareNotFound.Is(err) {
+		return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+	return err
+}
+
+// Open 校验分享链接并占用一次下载次数，返回分享的文件
+// 依次检查链接是否存在、是否过期、文件是否存在、邮箱白名单、访问密码和下载次数
+func (s *FileShareService) Open(ctx context.Context, token string, access ShareAccess) (*model.File, error) {
+	repo := model.NewFileShareRepo(s.db)
+	share, err := repo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.IncrAccess(ctx, share.ID); err != nil {
+		logger.WarnContext(ctx, "更新分享链接访问次数失败", "share_id", share.ID, "error", err)
+	}
+
+	if share.Expired(time.Now()) {
+		return nil, errspec.ErrShareExpired.New(ctx)
+	}
+	if share.Exhausted() {
+		return nil, errspec.ErrShareLimitReached.New(ctx)
+	}
+
+	var file model.File
+	if err := s.db.WithContext(ctx).Where("id = ? AND status = ?", share.FileID, model.FileStatusActive).First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errspec.ErrShareNotFound.New(ctx)
+		}
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+
+	if err := s.checkEmail(ctx, share, access.UserID); err != nil {
+		return nil, err
+	}
+
+	if share.PasswordHash != "" {
+		if err := s.checkPassword(ctx, share, access); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := repo.IncrDownload(ctx, share.ID); err != nil {
+		if errspec.ErrShareLimitReached.Is(err) {
+			return nil, err
+		}
+		return nil, errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+
+	return &file, nil
+}
+
+// RedirectURL 获取可直接重定向的下载URL
+// 本地存储没有对外提供文件访问，加密文件需要解密，这两种情况返回空字符串，由应用服务器传输文件内容
+func (s *FileShareService) RedirectURL(ctx context.Context, file *model.File) (string, error) {
+	if s.storage.GetStorageType() == string(types.StorageTypeLocal) {
+		return "", nil
+	}
+	downloadURL, err := s.storage.GetDownloadURL(ctx, file.Path, file.IsPublic)
+	if errors.Is(err, filestore.ErrDecryptionRequired) {
+		return "", nil
+	}
+	return downloadURL, err
+}
+
+// passwordCounter 分享密码错误次数的计数
+type passwordCounter struct {
+	key   string
+	limit int
+	count int64 // 本次访问占用后的次数
+}
+
+// checkPassword 校验分享密码，按链接和访问者IP统计错误次数，任一超过限制后在锁定期间直接拒绝
+// 校验前先自增计数占用一次尝试，按自增后的值判断是否锁定，并发请求不会超过限制；
+// 锁定拒绝和密码正确时归还占用的次数，只有密码错误计入。计数失败时只记录日志，不影响访问
+func (s *FileShareService) checkPassword(ctx context.Context, share *model.FileShare, access ShareAccess) error {
+	tokenKey := "share:password_failures:token:" + share.Token
+	counters := []passwordCounter{{key: tokenKey, limit: s.config.MaxPasswordFailures}}
+	if access.IP != "" {
+		counters = append(counters, passwordCounter{key: "share:password_failures:ip:" + access.IP, limit: s.config.MaxIPFailures})
+	}
+
+	var (
+		reserved []passwordCounter
+		locked   bool
+	)
+	for _, c := range counters {
+		if c.limit <= 0 {
+			continue
+		}
+		count, err := s.failures.Incr(ctx, c.key, 1)
+		if err == nil && count == 1 {
+			// 首次错误时开始计时
+			err = s.failures.Expire(ctx, c.key, s.config.LockoutDuration)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "记录分享密码错误次数失败", "key", c.key, "error", err)
+			if count == 0 {
+				continue
+			}
+		}
+		c.count = count
+		reserved = append(reserved, c)
+		locked = locked || count > int64(c.limit)
+	}
+
+	if locked {
+		s.releaseAttempts(ctx, reserved, "")
+		logger.WarnContext(ctx, "分享密码错误次数过多", "share_id", share.ID, "client_ip", access.IP)
+		return errspec.ErrSharePasswordLocked.New(ctx)
+	}
+
+	if crypto.CheckPasswordWithContext(ctx, share.PasswordHash, access.Password) {
+		// 密码正确后重新统计该链接的错误次数，IP的错误次数继续累计
+		s.releaseAttempts(ctx, reserved, tokenKey)
+		return nil
+	}
+
+	for _, c := range reserved {
+		if c.count == int64(c.limit) {
+			// 达到限制时从此刻起锁定
+			if err := s.failures.Expire(ctx, c.key, s.config.LockoutDuration); err != nil {
+				logger.WarnContext(ctx, "记录分享密码错误次数失败", "key", c.key, "error", err)
+			}
+		}
+	}
+	return errspec.ErrSharePasswordInvalid.New(ctx)
+}
+
+// releaseAttempts 归还占用的尝试次数，resetKey的计数直接清除
+func (s *FileShareService) releaseAttempts(ctx context.Context, reserved []passwordCounter, resetKey string) {
+	for _, c := range reserved {
+		var err error
+		if c.key == resetKey {
+			err = s.failures.Delete(ctx, c.key)
+		} else {
+			_, err = s.failures.Decr(ctx, c.key, 1)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "归还分享密码尝试次数失败", "key", c.key, "error", err)
+		}
+	}
+}
+
+// checkEmail 设置了邮箱白名单时，访问者必须登录且邮箱在白名单中
+func (s *FileShareService) checkEmail(ctx context.Context, share *model.FileShare, userID int64) error {
+	if len(share.AllowedEmails) == 0 {
+		return nil
+	}
+	if userID == 0 {
+		return errspec.ErrUserNotLogin.New(ctx)
+	}
+
+	user, err := model.NewUserRepo(s.db).GetByID(ctx, userID)
+	if err != nil {
+		return errspec.ErrShareForbidden.New(ctx)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	for _, allowed := range share.AllowedEmails {
+		if email != "" && email == allowed {
+			return nil
+		}
+	}
+	return errspec.ErrShareForbidden.New(ctx)
+}
+
+// ToFileShareResponse 转换为分享链接响应
+func ToFileShareResponse(share *model.FileShare) *dto.FileShareResponse {
+	emails := share.AllowedEmails
+	if emails == nil {
+		emails = []string{}
+	}
+	return &dto.FileShareResponse{
+		ID:             share.ID,
+		FileID:         share.FileID,
+		Token:          share.Token,
+		URL:            "/s/" + share.Token,
+		HasPassword:    share.PasswordHash != "",
+		ExpiresAt:      share.ExpiresAt,
+		MaxDownloads:   share.MaxDownloads,
+		DownloadCount:  share.DownloadCount,
+		AccessCount:    share.AccessCount,
+		LastAccessedAt: share.LastAccessedAt,
+		AllowedEmails:  emails,
+		Status:         shareStatus(share, time.Now()),
+		CreatedAt:      share.CreatedAt,
+	}
+}
+
+// shareStatus 计算分享链接状态
+func shareStatus(share *model.FileShare, now time.Time) string {
+	switch {
+	case share.RevokedAt != nil:
+		return ShareStatusRevoked
+	case share.Expired(now):
+		return ShareStatusExpired
+	case share.Exhausted():
+		return ShareStatusExhausted
+	default:
+		return ShareStatusActive
+	}
+}
+
+// newShareToken 生成URL安全的随机访问令牌
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// normalizeEmails 邮箱转为小写并去重
+func normalizeEmails(emails []string) []string {
+	if len(emails) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(emails))
+	seen := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		result = append(result, email)
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// FileVersionHandler 文件版本处理器
+type FileVersionHandler struct {
+	app         AppContext
+	storage     filestore.FileStorage
+	pathManager *filestore.PathManager
+	library     *FileLibraryService
+	service     *FileVersionService
+	helper      *HandlerHelper
+}
+
+var _ RouterInitializer = (*FileVersionHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewFileVersionHandler 创建文件版本处理器
+func NewFileVersionHandler(app AppContext) *FileVersionHandler {
+	return &FileVersionHandler{
+		app:         app,
+		storage:     app.GetStorage(),
+		pathManager: app.GetPathManager(),
+		library:     NewFileLibraryService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		service:     NewFileVersionService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		helper:      NewHandlerHelper(),
+	}
+}
+
+func (h *FileVersionHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
+	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
+
+	// 当前用户文件的版本
+	versions := authenticated.Group("/user/files/:id/versions")
+	{
+		versions.GET("", h.ListVersions)
+		versions.GET("/:version/content", h.DownloadVersion)
+		versions.POST("/:version/restore", h.RestoreVersion)
+	}
+}
+
+// ListVersions 获取文件的全部版本，最新版本在前
+func (h *FileVersionHandler) ListVersions(ctx *gin.Context) {
+	file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+
+	items, err := h.service.List(ctx.Request.Context(), file)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "ListVersions", "file_id", file.ID)
+		return
+	}
+
+	response.Success(ctx, items)
+}
+
+// DownloadVersion 下载文件的指定版本
+func (h *FileVersionHandler) DownloadVersion(ctx *gin.Context) {
+	file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+	version, ok := h.parseVersion(ctx)
+	if !ok {
+		return
+	}
+
+	v, err := h.service.Get(ctx.Request.Context(), file, version)
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "DownloadVersion", "file_id", file.ID, "version", version)
+		return
+	}
+
+	reader, err := h.storage.GetFile(ctx.Request.Context(), v.Path, v.IsPublic)
+	if err != nil {
+		logger.ErrorContext(ctx.Request.Context(), "读取文件版本失败", "file_id", file.ID, "version", version, "error", err)
+		response.Error(ctx, errspec.ErrFileDownload.New(ctx))
+		return
+	}
+	defer reader.Close()
+
+	contentType := v.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx.DataFromReader(http.StatusOK, v.Size, contentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": v.OriginalName}),
+	})
+}
+
+// RestoreVersion 将历史版本恢复为最新版本，当前内容保存为新的历史版本
+func (h *FileVersionHandler) RestoreVersion(ctx *gin.Context) {
+	file, ok := h.findFile(ctx)
+	if !ok {
+		return
+	}
+	version, ok := h.parseVersion(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Restore(ctx.Request.Context(), file, version, h.pathManager.GetMaxVersions(filestore.FileUsage(file.Usage))); err != nil {
+		h.helper.HandleDBError(ctx, err, "RestoreVersion", "file_id", file.ID, "version", version)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "RestoreVersion", "file_id", file.ID, "restored", version, "version", file.Version)
+	h.ListVersions(ctx)
+}
+
+// findFile 获取当前用户的文件
+func (h *FileVersionHandler) findFile(ctx *gin.Context) (*model.File, bool) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	file, err := h.library.Get(ctx.Request.Context(), userID, ctx.Param("id"))
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "findFile", "file_id", ctx.Param("id"), "user_id", userID)
+		return nil, false
+	}
+	return file, true
+}
+
+// parseVersion 解析路径中的版本号
+func (h *FileVersionHandler) parseVersion(ctx *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version < 1 {
+		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{"version"}))
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/idgen"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// FileVersionService 文件版本服务
+// 文件记录始终保存最新版本的内容，替换或恢复版本时将当前内容保存为历史版本并引用原存储对象，
+// 超过保留数量的历史版本在替换后删除。存储配额只按最新版本计算
+type FileVersionService struct {
+	db           *gorm.DB
+	storage      filestore.FileStorage
+	blobService  *BlobService
+	imageService *ImageService
+	quotaService *QuotaService
+}
+
+// NewFileVersionService 创建文件版本服务
+func NewFileVersionService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *FileVersionService {
+	return &FileVersionService{
+		db:           db,
+		storage:      storage,
+		blobService:  NewBlobService(db, storage),
+		imageService: NewImageService(db, storage, config),
+		quotaService: NewQuotaService(db, config),
+	}
+}
+
+// Replace 使用新内容替换文件，当前内容保存为历史版本，keep为保留的历史版本数（0表示不限制）
+// next的存储对象引用由文件接管，替换失败时释放
+func (s *FileVersionService) Replace(ctx context.Context, file *model.File, next *model.File, keep int) error {
+	previous := *file
+	if previous.Version < 1 {
+		previous.Version = 1
+	}
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 并发替换同一文件时版本号唯一索引冲突，只有一个请求成功
+		if err := tx.Create(newFileVersion(&previous)).Error; err != nil {
+			return err
+		}
+
+		// 配额按最新版本计算，文件数不变
+		if err := s.quotaService.Release(ctx, tx, previous.UploadedBy, previous.Usage, previous.Size); err != nil {
+			return err
+		}
+		if err := s.quotaService.Consume(ctx, tx, previous.UploadedBy, previous.Usage, next.Size); err != nil {
+			return err
+		}
+
+		return tx.Model(file).Updates(map[string]any{
+			"name":          next.Name,
+			"original_name": next.OriginalName,
+			"path":          next.Path,
+			"size":          next.Size,
+			"mime_type":     next.MimeType,
+			"extension":     next.Extension,
+			"storage_type":  next.StorageType,
+			"sha256":        next.SHA256,
+			"md5":           next.MD5,
+			"uploaded_at":   now,
+			"version":       previous.Version + 1,
+		}).Error
+	})
+	if err != nil {
+		*file = previous
+		if releaseErr := s.blobService.Release(ctx, next); releaseErr != nil {
+			logger.WarnContext(ctx, "释放新版本内容失败", "file_id", file.ID, "path", next.Path, "error", releaseErr)
+		}
+		if errspec.ErrStorageQuotaExceeded.Is(err) {
+			return err
+		}
+		return errspec.ErrFileVersionCreate.New(ctx).Wrap(err)
+	}
+
+	file.UploadedAt = now
+	file.Version = previous.Version + 1
+	logger.InfoContext(ctx, "文件已更新到新版本", "file_id", file.ID, "version", file.Version)
+
+	// 衍生图按最新版本重新生成
+	if err := s.imageService.DeleteVariants(ctx, &previous); err != nil {
+		logger.WarnContext(ctx, "删除旧版本衍生图失败", "file_id", file.ID, "error", err)
+	}
+	if s.imageService.GenerateOnUpload(file) {
+		if err := s.imageService.GenerateVariants(ctx, file); err != nil {
+			logger.WarnContext(ctx, "生成文件衍生图失败", "file_id", file.ID, "error", err)
+		}
+	}
+
+	s.prune(ctx, file.ID, keep)
+	return nil
+}
+
+// Restore 将历史版本恢复为最新版本，当前内容保存为新的历史版本
+func (s *FileVersionService) Restore(ctx context.Context, file *model.File, version int, keep int) error {
+	if version == file.Version {
+		return nil
+	}
+
+	v, err := model.NewFileVersionRepo(s.db).GetByFileAndVersion(ctx, file.ID, version)
+	if err != nil {
+		return err
+	}
+
+	reader, err := s.storage.GetFile(ctx, v.Path, v.IsPublic)
+	if err != nil {
+		return errspec.ErrFileRestore.New(ctx).Wrap(err)
+	}
+	defer reader.Close()
+
+	// 写入文件当前的可见范围，相同内容已存在时直接引用已有对象
+	target := path.Join(path.Dir(file.Path), idgen.GenerateUUID()+v.Extension)
+	storedPath, checksum, err := s.blobService.Store(ctx, target, reader, file.IsPublic)
+	if err != nil {
+		return errspec.ErrFileRestore.New(ctx).Wrap(err)
+	}
+
+	return s.Replace(ctx, file, &model.File{
+		Name:         path.Base(storedPath),
+		OriginalName: v.OriginalName,
+		Path:         storedPath,
+		Size:         checksum.Size,
+		MimeType:     v.MimeType,
+		Extension:    v.Extension,
+		StorageType:  s.storage.GetStorageType(),
+		IsPublic:     file.IsPublic,
+		SHA256:       checksum.SHA256,
+		MD5:          checksum.MD5,
+	}, keep)
+}
+
+// Get 获取文件的指定版本，版本号为当前版本时返回最新内容
+func (s *FileVersionService) Get(ctx context.Context, file *model.File, version int) (*model.FileVersion, error) {
+	if version == file.Version {
+		return newFileVersion(file), nil
+	}
+	return model.NewFileVersionRepo(s.db).GetByFileAndVersion(ctx, file.ID, version)
+}
+
+// List 获取文件的全部版本，最新版本在前
+func (s *FileVersionService) List(ctx context.Context, file *model.File) ([]dto.FileVersionItem, error) {
+	versions, err := model.NewFileVersionRepo(s.db).ListByFile(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]dto.FileVersionItem, 0, len(versions)+1)
+	items = append(items, toFileVersionItem(newFileVersion(file), true))
+	for i := range versions {
+		items = append(items, toFileVersionItem(&versions[i], false))
+	}
+	return items, nil
+}
+
+// DeleteAll 删除文件的全部历史版本，永久删除文件时调用
+func (s *FileVersionService) DeleteAll(ctx context.Context, fileID string) error {
+	versions, err := model.NewFileVersionRepo(s.db).ListByFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	for i := range versions {
+		if err := s.remove(ctx, &versions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune 删除超过保留数量的历史版本，失败时只记录日志
+func (s *FileVersionService) prune(ctx context.Context, fileID string, keep int) {
+	if keep <= 0 {
+		return
+	}
+
+	versions, err := model.NewFileVersionRepo(s.db).ListOutdated(ctx, fileID, keep)
+	if err != nil {
+		logger.WarnContext(ctx, "查询过期的文件版本失败", "file_id", fileID, "error", err)
+		return
+	}
+	for i := range versions {
+		if err := s.remove(ctx, &versions[i]); err != nil {
+			logger.WarnContext(ctx, "删除过期的文件版本失败", "file_id", fileID, "version", versions[i].Version, "error", err)
+		}
+	}
+}
+
+// remove 释放历史版本引用的存储对象并删除记录
+func (s *FileVersionService) remove(ctx context.Context, version *model.FileVersion) error {
+	err := s.blobService.Release(ctx, &model.File{
+		Path:        version.Path,
+		IsPublic:    version.IsPublic,
+		StorageType: version.StorageType,
+		SHA256:      version.SHA256,
+	})
+	if err != nil {
+		return err
+	}
+	return model.NewFileVersionRepo(s.db).Remove(ctx, version)
+}
+
+// newFileVersion 根据文件记录的当前内容生成版本记录
+func newFileVersion(file *model.File) *model.FileVersion {
+	return &model.FileVersion{
+		FileID:       file.ID,
+		Version:      file.Version,
+		OriginalName: file.OriginalName,
+		Path:         file.Path,
+		Size:         file.Size,
+		MimeType:     file.MimeType,
+		Extension:    file.Extension,
+		StorageType:  file.StorageType,
+		IsPublic:     file.IsPublic,
+		SHA256:       file.SHA256,
+		MD5:          file.MD5,
+		UploadedBy:   file.UploadedBy,
+		UploadedAt:   file.UploadedAt,
+	}
+}
+
+// toFileVersionItem 转换为版本列表项
+func toFileVersionItem(version *model.FileVersion, latest bool) dto.FileVersionItem {
+	return dto.FileVersionItem{
+		Version:      version.Version,
+		OriginalName: version.OriginalName,
+		Size:         version.Size,
+		MimeType:     version.MimeType,
+		SHA256:       version.SHA256,
+		UploadedBy:   version.UploadedBy,
+		UploadedAt:   version.UploadedAt,
+		Latest:       latest,
+	}
+}
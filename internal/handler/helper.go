@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/limitcool/starter/internal/api/response"
 	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
 	"github.com/limitcool/starter/internal/pkg/logger"
 	"github.com/spf13/cast"
 )
@@ -30,6 +31,14 @@ func (h *HandlerHelper) GetUserID(ctx *gin.Context) (int64, bool) {
 	return cast.ToInt64(userID), true
 }
 
+// GetRole 获取当前用户的角色（admin或user）
+func (h *HandlerHelper) GetRole(ctx *gin.Context) string {
+	if isAdmin, exists := ctx.Get("is_admin"); exists && cast.ToBool(isAdmin) {
+		return filestore.RoleAdmin
+	}
+	return filestore.RoleUser
+}
+
 // BindJSON 绑定JSON参数，如果失败则返回错误响应
 func (h *HandlerHelper) BindJSON(ctx *gin.Context, req interface{}, operation string) bool {
 	reqCtx := ctx.Request.Context()
@@ -45,6 +54,21 @@ func (h *HandlerHelper) BindJSON(ctx *gin.Context, req interface{}, operation st
 	return true
 }
 
+// BindQuery 绑定查询参数，如果失败则返回错误响应
+func (h *HandlerHelper) BindQuery(ctx *gin.Context, req interface{}, operation string) bool {
+	reqCtx := ctx.Request.Context()
+
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		logger.WarnContext(reqCtx, operation+" request validation failed",
+			"error", err,
+			"client_ip", ctx.ClientIP())
+		response.Error(ctx, errspec.ErrInvalidParams.New(ctx, struct{ Params string }{err.Error()}))
+		return false
+	}
+
+	return true
+}
+
 // HandleDBError 处理数据库错误，统一日志记录和错误响应
 func (h *HandlerHelper) HandleDBError(ctx *gin.Context, err error, operation string, fields ...interface{}) {
 	reqCtx := ctx.Request.Context()
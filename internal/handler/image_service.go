@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// ImageService 图片衍生图服务
+type ImageService struct {
+	db        *gorm.DB
+	storage   filestore.FileStorage
+	processor *filestore.ImageProcessor
+	paths     *filestore.PathManager // 读取图片时按文件用途的大小限制
+}
+
+// NewImageService 创建图片衍生图服务
+// 路径规则在应用启动时已校验，无效时使用内置规则
+func NewImageService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *ImageService {
+	paths, err := filestore.NewPathManagerFromConfig(config.Storage.PathConfig)
+	if err != nil {
+		paths = filestore.NewPathManager()
+	}
+
+	return &ImageService{
+		db:        db,
+		storage:   storage,
+		processor: filestore.NewImageProcessor(config.Storage.Image),
+		paths:     paths,
+	}
+}
+
+// SanitizeUpload 移除上传图片中的元数据，非图片文件原样返回
+// 内容超过文件用途的大小限制时返回ErrFileTooLarge
+func (s *ImageService) SanitizeUpload(ctx context.Context, usage filestore.FileUsage, filename string, reader io.Reader) (io.Reader, error) {
+	if !s.processor.ShouldStripMetadata(filepath.Ext(filename)) {
+		return reader, nil
+	}
+
+	data, err := s.readLimited(ctx, usage, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped, err := filestore.StripImageMetadata(data)
+	if err != nil {
+		// 无法解析的图片保留原始内容，避免影响上传
+		logger.WarnContext(ctx, "移除图片元数据失败", "filename", filename, "error", err)
+		return bytes.NewReader(data), nil
+	}
+
+	return bytes.NewReader(stripped), nil
+}
+
+// SanitizeStored 移除已存储图片中的元数据（用于预签名URL直传的文件）
+func (s *ImageService) SanitizeStored(ctx context.Context, file *model.File) error {
+	if !s.processor.ShouldStripMetadata(file.Extension) {
+		return nil
+	}
+
+	data, err := s.readFile(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	stripped, err := filestore.StripImageMetadata(data)
+	if err != nil {
+		logger.WarnContext(ctx, "移除图片元数据失败", "file_id", file.ID, "error", err)
+		return nil
+	}
+
+	// 内容未变化时无需重新写入
+	if len(stripped) == len(data) {
+		return nil
+	}
+
+	if err := s.storage.UploadFile(ctx, file.Path, bytes.NewReader(stripped), file.IsPublic); err != nil {
+		return fmt.Errorf("写入处理后的图片失败: %w", err)
+	}
+
+	return nil
+}
+
+// GenerateOnUpload 是否需要在上传时生成衍生图
+func (s *ImageService) GenerateOnUpload(file *model.File) bool {
+	return s.processor.GenerateOnUpload() &&
+		filestore.IsImageExtension(file.Extension) &&
+		len(s.processor.Variants(filestore.FileUsage(file.Usage))) > 0
+}
+
+// GenerateVariants 生成文件用途对应的全部衍生图
+func (s *ImageService) GenerateVariants(ctx context.Context, file *model.File) error {
+	specs := s.processor.Variants(filestore.FileUsage(file.Usage))
+	if len(specs) == 0 {
+		return nil
+	}
+
+	data, err := s.readFile(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if _, err := s.createVariant(ctx, file, spec, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetOrCreateVariant 获取衍生图，不存在时按规格生成
+func (s *ImageService) GetOrCreateVariant(ctx context.Context, file *model.File, name string) (*model.FileVariant, error) {
+	if !s.processor.Enabled() {
+		return nil, errspec.ErrFileVariantNotFound.New(ctx)
+	}
+
+	spec, ok := s.processor.Variant(filestore.FileUsage(file.Usage), name)
+	if !ok {
+		return nil, errspec.ErrFileVariantNotFound.New(ctx)
+	}
+
+	if !filestore.IsImageExtension(file.Extension) {
+		return nil, errspec.ErrFileNotImage.New(ctx)
+	}
+
+	repo := model.NewFileVariantRepo(s.db)
+	variant, err := repo.GetByFileAndName(ctx, file.ID, name)
+	if err == nil {
+		return variant, nil
+	}
+	if !errspec.ErrRecordNotExist.Is(err) {
+		return nil, errspec.ErrQueryFileVariant.New(ctx).Wrap(err)
+	}
+
+	data, err := s.readFile(ctx, file)
+	if errspec.ErrFileTooLarge.Is(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errspec.ErrFileVariantGenerate.New(ctx).Wrap(err)
+	}
+
+	variant, err = s.createVariant(ctx, file, spec, data)
+	if errors.Is(err, filestore.ErrImageTooLarge) {
+		return nil, errspec.ErrFileImageTooLarge.New(ctx).Wrap(err)
+	}
+	if err != nil {
+		return nil, errspec.ErrFileVariantGenerate.New(ctx).Wrap(err)
+	}
+
+	return variant, nil
+}
+
+// DeleteVariants 删除文件的全部衍生图（存储和记录）
+func (s *ImageService) DeleteVariants(ctx context.Context, file *model.File) error {
+	repo := model.NewFileVariantRepo(s.db)
+	variants, err := repo.ListByFile(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range variants {
+		// 内容去重后多个文件共享同一原图，衍生图路径也相同，仍被引用时保留
+		var refs int64
+		if err := s.db.WithContext(ctx).Model(&model.FileVariant{}).
+			Where("path = ? AND file_id <> ?", v.Path, file.ID).
+			Count(&refs).Error; err != nil || refs > 0 {
+			continue
+		}
+
+		if err := s.storage.DeleteFile(ctx, v.Path, v.IsPublic); err != nil {
+			logger.WarnContext(ctx, "删除衍生图文件失败", "file_id", file.ID, "variant", v.Name, "error", err)
+		}
+	}
+
+	return repo.DeleteByFile(ctx, file.ID)
+}
+
+// createVariant 生成单个衍生图并保存记录
+func (s *ImageService) createVariant(ctx context.Context, file *model.File, spec filestore.VariantSpec, data []byte) (*model.FileVariant, error) {
+	processed, err := s.processor.Resize(data, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	variantPath := filestore.VariantPath(file.Path, spec.Name, processed.Ext)
+	if err := s.storage.UploadFile(ctx, variantPath, bytes.NewReader(processed.Data), file.IsPublic); err != nil {
+		return nil, fmt.Errorf("上传衍生图失败: %w", err)
+	}
+
+	variant := &model.FileVariant{
+		FileID:      file.ID,
+		Name:        spec.Name,
+		Path:        variantPath,
+		Width:       processed.Width,
+		Height:      processed.Height,
+		Size:        int64(len(processed.Data)),
+		MimeType:    processed.MimeType,
+		StorageType: s.storage.GetStorageType(),
+		IsPublic:    file.IsPublic,
+	}
+
+	// 按文件ID和规格名称更新或创建记录，并发生成时以最后一次为准
+	err = s.db.WithContext(ctx).
+		Where("file_id = ? AND name = ?", file.ID, spec.Name).
+		Assign(*variant).
+		FirstOrCreate(variant).Error
+	if err != nil {
+		return nil, fmt.Errorf("保存衍生图记录失败: %w", err)
+	}
+
+	logger.InfoContext(ctx, "衍生图生成成功",
+		"file_id", file.ID,
+		"variant", spec.Name,
+		"width", processed.Width,
+		"height", processed.Height)
+
+	return variant, nil
+}
+
+// readFile 读取原始文件内容，超过文件用途的大小限制时返回ErrFileTooLarge
+func (s *ImageService) readFile(ctx context.Context, file *model.File) ([]byte, error) {
+	reader, err := s.storage.GetFile(ctx, file.Path, file.IsPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return s.readLimited(ctx, filestore.FileUsage(file.Usage), reader)
+}
+
+// readLimited 读取图片内容，最多读取文件用途的大小限制加一个字节，超过限制时不解码，返回ErrFileTooLarge
+func (s *ImageService) readLimited(ctx context.Context, usage filestore.FileUsage, reader io.Reader) ([]byte, error) {
+	maxSize := s.paths.GetMaxFileSize(usage)
+	if maxSize > 0 {
+		reader = io.LimitReader(reader, maxSize+1)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片失败: %w", err)
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, errspec.ErrFileTooLarge.New(ctx)
+	}
+	return data, nil
+}
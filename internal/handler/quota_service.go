@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"context"
+	"sort"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/model"
+	"gorm.io/gorm"
+)
+
+// 配额角色
+const (
+	QuotaRoleAdmin = "admin" // 管理员
+	QuotaRoleUser  = "user"  // 普通用户
+)
+
+// QuotaService 存储配额服务
+// 用量统计始终记录，仅在启用配额时限制上传
+type QuotaService struct {
+	db     *gorm.DB
+	config configs.QuotaConfig
+}
+
+// NewQuotaService 创建存储配额服务
+func NewQuotaService(db *gorm.DB, config *configs.Config) *QuotaService {
+	return &QuotaService{
+		db:     db,
+		config: config.Storage.Quota,
+	}
+}
+
+// Limits 获取用户的总配额和指定用途的配额
+func (s *QuotaService) Limits(ctx context.Context, userID int64, usage string) (total, perUsage configs.QuotaLimit, err error) {
+	return s.limits(ctx, s.db, userID, usage)
+}
+
+// limits 使用指定连接（可为事务）获取配额
+func (s *QuotaService) limits(ctx context.Context, db *gorm.DB, userID int64, usage string) (total, perUsage configs.QuotaLimit, err error) {
+	overrides, err := model.NewStorageQuotaRepo(db).ListByUser(ctx, userID)
+	if err != nil {
+		return total, perUsage, err
+	}
+
+	role, err := s.role(ctx, db, userID)
+	if err != nil {
+		return total, perUsage, err
+	}
+
+	total, perUsage = s.resolve(role, usage, overrides)
+	return total, perUsage, nil
+}
+
+// Check 检查上传指定大小的文件后是否超出配额，不占用配额
+func (s *QuotaService) Check(ctx context.Context, userID int64, usage string, size int64) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	total, perUsage, err := s.Limits(ctx, userID, usage)
+	if err != nil {
+		return err
+	}
+
+	usages, err := model.NewStorageUsageRepo(s.db).ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range usages {
+		limit := perUsage
+		if u.FileUsage == model.StorageUsageTotal {
+			limit = total
+		} else if u.FileUsage != usage {
+			continue
+		}
+
+		if exceeds(limit, u.Bytes+size, u.Files+1) {
+			return errspec.ErrStorageQuotaExceeded.New(ctx)
+		}
+	}
+
+	// 尚无用量记录时仅需检查单个文件是否超出限制
+	if exceeds(total, size, 1) || exceeds(perUsage, size, 1) {
+		return errspec.ErrStorageQuotaExceeded.New(ctx)
+	}
+
+	return nil
+}
+
+// Consume 在事务中占用配额，超出时返回ErrStorageQuotaExceeded
+// 汇总和用途记录使用条件更新，并发上传时不会超出配额
+func (s *QuotaService) Consume(ctx context.Context, tx *gorm.DB, userID int64, usage string, size int64) error {
+	var total, perUsage configs.QuotaLimit
+	if s.config.Enabled {
+		var err error
+		if total, perUsage, err = s.limits(ctx, tx, userID, usage); err != nil {
+			return err
+		}
+	}
+
+	repo := model.NewStorageUsageRepo(tx)
+	for _, item := range []struct {
+		usage string
+		limit configs.QuotaLimit
+	}{
+		{model.StorageUsageTotal, total},
+		{usage, perUsage},
+	} {
+		ok, err := repo.Add(ctx, userID, item.usage, size, item.limit.MaxBytes, item.limit.MaxFiles)
+		if err != nil {
+			return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+		}
+		if !ok {
+			return errspec.ErrStorageQuotaExceeded.New(ctx)
+		}
+	}
+
+	return nil
+}
+
+// Release 在事务中释放文件占用的配额
+func (s *QuotaService) Release(ctx context.Context, tx *gorm.DB, userID int64, usage string, size int64) error {
+	repo := model.NewStorageUsageRepo(tx)
+	for _, u := range []string{model.StorageUsageTotal, usage} {
+		if err := repo.Subtract(ctx, userID, u, size); err != nil {
+			return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+		}
+	}
+	return nil
+}
+
+// Usage 获取用户的存储用量及配额
+func (s *QuotaService) Usage(ctx context.Context, userID int64) (*dto.StorageUsageResponse, error) {
+	usages, err := model.NewStorageUsageRepo(s.db).ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := model.NewStorageQuotaRepo(s.db).ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.role(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]model.StorageUsage, len(usages))
+	for _, u := range usages {
+		used[u.FileUsage] = u
+	}
+
+	overridden := make(map[string]bool, len(overrides))
+	for _, q := range overrides {
+		overridden[q.FileUsage] = true
+	}
+
+	// 汇总已有用量、单独配额和配置中的全部用途
+	names := make(map[string]bool)
+	for name := range used {
+		names[name] = true
+	}
+	for name := range overridden {
+		names[name] = true
+	}
+	for name := range s.config.Usages {
+		names[name] = true
+	}
+	delete(names, model.StorageUsageTotal)
+
+	total, _ := s.resolve(role, "", overrides)
+
+	resp := &dto.StorageUsageResponse{
+		UserID:  userID,
+		Enabled: s.config.Enabled,
+		Role:    role,
+		Total: dto.StorageUsageItem{
+			UsedBytes:  used[model.StorageUsageTotal].Bytes,
+			UsedFiles:  used[model.StorageUsageTotal].Files,
+			MaxBytes:   total.MaxBytes,
+			MaxFiles:   total.MaxFiles,
+			Overridden: overridden[model.StorageUsageTotal],
+		},
+		Usages: make([]dto.StorageUsageItem, 0, len(names)),
+	}
+
+	for name := range names {
+		_, perUsage := s.resolve(role, name, overrides)
+		resp.Usages = append(resp.Usages, dto.StorageUsageItem{
+			Usage:      name,
+			UsedBytes:  used[name].Bytes,
+			UsedFiles:  used[name].Files,
+			MaxBytes:   perUsage.MaxBytes,
+			MaxFiles:   perUsage.MaxFiles,
+			Overridden: overridden[name],
+		})
+	}
+
+	sort.Slice(resp.Usages, func(i, j int) bool {
+		return resp.Usages[i].Usage < resp.Usages[j].Usage
+	})
+
+	return resp, nil
+}
+
+// SetOverride 为用户单独设置配额，usage为空表示总配额
+func (s *QuotaService) SetOverride(ctx context.Context, userID int64, usage string, limit configs.QuotaLimit) error {
+	if usage == "" {
+		usage = model.StorageUsageTotal
+	}
+
+	err := model.NewStorageQuotaRepo(s.db).Upsert(ctx, &model.StorageQuota{
+		UserID:    userID,
+		FileUsage: usage,
+		MaxBytes:  limit.MaxBytes,
+		MaxFiles:  limit.MaxFiles,
+	})
+	if err != nil {
+		return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// DeleteOverride 删除用户的单独配额，恢复使用配置中的配额
+func (s *QuotaService) DeleteOverride(ctx context.Context, userID int64, usage string) error {
+	if usage == "" {
+		usage = model.StorageUsageTotal
+	}
+
+	if err := model.NewStorageQuotaRepo(s.db).DeleteByUserAndUsage(ctx, userID, usage); err != nil {
+		return errspec.ErrDatabaseDelete.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// resolve 按优先级计算配额：单独设置 > 角色/用途配置 > 默认配额
+func (s *QuotaService) resolve(role, usage string, overrides []model.StorageQuota) (total, perUsage configs.QuotaLimit) {
+	total = s.config.Default
+	if limit, ok := s.config.Roles[role]; ok {
+		total = limit
+	}
+	perUsage = s.config.Usages[usage]
+
+	for _, q := range overrides {
+		limit := configs.QuotaLimit{MaxBytes: q.MaxBytes, MaxFiles: q.MaxFiles}
+		switch q.FileUsage {
+		case model.StorageUsageTotal:
+			total = limit
+		case usage:
+			perUsage = limit
+		}
+	}
+
+	return total, perUsage
+}
+
+// role 获取用户对应的配额角色
+func (s *QuotaService) role(ctx context.Context, db *gorm.DB, userID int64) (string, error) {
+	var user model.User
+	err := db.WithContext(ctx).Select("is_admin").Where("id = ?", userID).Limit(1).Find(&user).Error
+	if err != nil {
+		return "", errspec.ErrQueryUser.New(ctx).Wrap(err)
+	}
+
+	if user.IsAdmin {
+		return QuotaRoleAdmin, nil
+	}
+	return QuotaRoleUser, nil
+}
+
+// exceeds 判断用量是否超出限制，限制为0表示不限制
+func exceeds(limit configs.QuotaLimit, bytes, files int64) bool {
+	return (limit.MaxBytes > 0 && bytes > limit.MaxBytes) ||
+		(limit.MaxFiles > 0 && files > limit.MaxFiles)
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// ReconcileItem 对账发现的问题项
+type ReconcileItem struct {
+	FileID   string // 文件ID，孤立文件为空
+	Path     string // 存储路径（不包含public/private前缀）
+	IsPublic bool   // 是否公开文件
+	Size     int64  // 文件大小（字节）
+	Removed  bool   // 是否已清理
+}
+
+// ReconcileReport 对账报告
+type ReconcileReport struct {
+	DryRun         bool            // 是否仅生成报告
+	StartedAt      time.Time       // 开始时间
+	FinishedAt     time.Time       // 结束时间
+	ExpiredPending []ReconcileItem // 过期的待上传记录
+	OrphanBlobs    []ReconcileItem // 存储中没有记录的孤立文件
+	MissingBlobs   []ReconcileItem // 存储中文件已丢失的记录
+	Errors         []string        // 处理过程中的错误
+}
+
+// LogSummary 输出对账报告摘要
+func (r *ReconcileReport) LogSummary(ctx context.Context) {
+	logger.InfoContext(ctx, "存储对账完成",
+		"dry_run", r.DryRun,
+		"duration", r.FinishedAt.Sub(r.StartedAt),
+		"expired_pending", len(r.ExpiredPending),
+		"orphan_blobs", len(r.OrphanBlobs),
+		"missing_blobs", len(r.MissingBlobs),
+		"errors", len(r.Errors))
+}
+
+// addError 记录处理错误
+func (r *ReconcileReport) addError(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// ReconcileService 存储对账服务
+// 清理过期的待上传记录，发现存储中的孤立文件和内容丢失的记录
+type ReconcileService struct {
+	db          *gorm.DB
+	storage     filestore.FileStorage
+	blobService *BlobService
+	config      configs.ReconcileConfig
+}
+
+// NewReconcileService 创建存储对账服务
+func NewReconcileService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *ReconcileService {
+	reconcileConfig := config.Storage.Reconcile
+
+	// 未配置时使用保守的默认值，避免误删正在上传的文件
+	if reconcileConfig.Interval <= 0 {
+		reconcileConfig.Interval = 6 * time.Hour
+	}
+	if reconcileConfig.PendingTTL <= 0 {
+		reconcileConfig.PendingTTL = 24 * time.Hour
+	}
+	if reconcileConfig.OrphanMinAge <= 0 {
+		reconcileConfig.OrphanMinAge = 24 * time.Hour
+	}
+
+	return &ReconcileService{
+		db:          db,
+		storage:     storage,
+		blobService: NewBlobService(db, storage),
+		config:      reconcileConfig,
+	}
+}
+
+// Start 按配置的间隔定期执行对账，直到ctx取消
+func (s *ReconcileService) Start(ctx context.Context) {
+	logger.InfoContext(ctx, "存储对账任务已启动", "interval", s.config.Interval, "dry_run", s.config.DryRun)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoContext(ctx, "存储对账任务已停止")
+			return
+		case <-ticker.C:
+			report, err := s.Run(ctx, s.config.DryRun)
+			if err != nil {
+				logger.ErrorContext(ctx, "存储对账失败", "error", err)
+				continue
+			}
+			report.LogSummary(ctx)
+		}
+	}
+}
+
+// Run 执行一次对账，dryRun为true时仅生成报告
+func (s *ReconcileService) Run(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+	}
+
+	if err := s.expirePending(ctx, report); err != nil {
+		return nil, err
+	}
+
+	for _, isPublic := range []bool{true, false} {
+		if err := s.reconcileScope(ctx, isPublic, report); err != nil {
+			return nil, err
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// expirePending 删除超过有效期仍未确认的待上传记录及已上传的内容，未通过扫描的记录一并删除
+func (s *ReconcileService) expirePending(ctx context.Context, report *ReconcileReport) error {
+	deadline := time.Now().Add(-s.config.PendingTTL)
+	var files []model.File
+
+	return s.db.WithContext(ctx).
+		Where("status IN ? AND created_at < ?", []int{model.FileStatusPending, model.FileStatusRejected}, deadline).
+		FindInBatches(&files, 100, func(tx *gorm.DB, batch int) error {
+			for i := range files {
+				file := &files[i]
+				item := ReconcileItem{
+					FileID:   file.ID,
+					Path:     file.Path,
+					IsPublic: file.IsPublic,
+					Size:     file.Size,
+				}
+
+				if !report.DryRun {
+					if err := s.removePending(ctx, file); err != nil {
+						report.addError("清理待上传记录 %s 失败: %v", file.ID, err)
+					} else {
+						item.Removed = true
+					}
+				}
+
+				report.ExpiredPending = append(report.ExpiredPending, item)
+			}
+			return nil
+		}).Error
+}
+
+// removePending 删除待上传记录，客户端已上传的内容一并删除
+func (s *ReconcileService) removePending(ctx context.Context, file *model.File) error {
+	if file.SHA256 != "" {
+		if err := s.blobService.Release(ctx, file); err != nil {
+			return err
+		}
+	} else {
+		exists, err := s.storage.FileExists(ctx, file.Path, file.IsPublic)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := s.storage.DeleteFile(ctx, file.Path, file.IsPublic); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.db.WithContext(ctx).Delete(file).Error
+}
+
+// reconcileScope 对比存储中的文件和数据库记录
+func (s *ReconcileService) reconcileScope(ctx context.Context, isPublic bool, report *ReconcileReport) error {
+	referenced, err := s.referencedPaths(ctx, isPublic)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]bool)
+	minModTime := time.Now().Add(-s.config.OrphanMinAge)
+
+	err = s.storage.ListFiles(ctx, isPublic, func(info filestore.FileInfo) error {
+		stored[info.Path] = true
+
+		// 最近写入的文件可能属于正在进行的上传，暂不视为孤立文件
+		if referenced[info.Path] || info.ModTime.After(minModTime) {
+			return nil
+		}
+
+		item := ReconcileItem{
+			Path:     info.Path,
+			IsPublic: isPublic,
+			Size:     info.Size,
+		}
+
+		if !report.DryRun && s.config.DeleteOrphans {
+			if err := s.storage.DeleteFile(ctx, info.Path, isPublic); err != nil {
+				report.addError("删除孤立文件 %s 失败: %v", info.Path, err)
+			} else {
+				item.Removed = true
+			}
+		}
+
+		report.OrphanBlobs = append(report.OrphanBlobs, item)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("遍历存储文件失败: %w", err)
+	}
+
+	// 已完成上传的记录在存储中应有对应文件
+	var files []model.File
+	err = s.db.WithContext(ctx).
+		Select("id", "path", "size", "is_public").
+		Where("status = ? AND is_public = ? AND storage_type = ?", model.FileStatusActive, isPublic, s.storage.GetStorageType()).
+		Find(&files).Error
+	if err != nil {
+		return fmt.Errorf("查询文件记录失败: %w", err)
+	}
+
+	for _, f := range files {
+		if stored[f.Path] {
+			continue
+		}
+		report.MissingBlobs = append(report.MissingBlobs, ReconcileItem{
+			FileID:   f.ID,
+			Path:     f.Path,
+			IsPublic: f.IsPublic,
+			Size:     f.Size,
+		})
+	}
+
+	return nil
+}
+
+// referencedPaths 获取数据库中引用的全部存储路径
+func (s *ReconcileService) referencedPaths(ctx context.Context, isPublic bool) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	storageType := s.storage.GetStorageType()
+
+	for _, m := range []any{&model.File{}, &model.FileVariant{}, &model.FileBlob{}, &model.FileVersion{}} {
+		var paths []string
+		err := s.db.WithContext(ctx).Model(m).
+			Where("is_public = ? AND storage_type = ?", isPublic, storageType).
+			Pluck("path", &paths).Error
+		if err != nil {
+			return nil, fmt.Errorf("查询引用路径失败: %w", err)
+		}
+		for _, p := range paths {
+			referenced[p] = true
+		}
+	}
+
+	// 回收站中的文件都保存在私有目录下
+	if !isPublic {
+		var paths []string
+		err := s.db.WithContext(ctx).Unscoped().Model(&model.File{}).
+			Where("trash_path <> '' AND storage_type = ?", storageType).
+			Pluck("trash_path", &paths).Error
+		if err != nil {
+			return nil, fmt.Errorf("查询回收站路径失败: %w", err)
+		}
+		for _, p := range paths {
+			referenced[p] = true
+		}
+	}
+
+	return referenced, nil
+}
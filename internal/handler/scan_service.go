@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/limitcool/starter/internal/pkg/scanner"
+	"gorm.io/gorm"
+)
+
+// scanBatch 每批扫描的隔离文件数
+const scanBatch = 20
+
+// ScanService 上传文件扫描服务
+// 通过服务器上传的文件在写入存储前同步扫描；客户端直传的文件确认后进入隔离状态，
+// 由后台任务扫描，通过后完成上传，未通过时删除存储中的内容并标记为未通过扫描
+type ScanService struct {
+	db            *gorm.DB
+	storage       filestore.FileStorage
+	scanner       scanner.Scanner
+	err           error // 扫描器配置错误，扫描时返回失败，避免未经扫描的文件通过
+	uploadService *UploadService
+	config        configs.ScanConfig
+}
+
+// NewScanService 创建上传文件扫描服务
+func NewScanService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *ScanService {
+	scanConfig := config.Storage.Scan
+
+	if scanConfig.Interval <= 0 {
+		scanConfig.Interval = 5 * time.Second
+	}
+	if scanConfig.Timeout <= 0 {
+		scanConfig.Timeout = 10 * time.Minute
+	}
+
+	s := &ScanService{
+		db:            db,
+		storage:       storage,
+		uploadService: NewUploadService(db, storage, config),
+		config:        scanConfig,
+	}
+	if scanConfig.Enabled {
+		s.scanner, s.err = NewScanner(scanConfig)
+	}
+	return s
+}
+
+// NewScanner 按配置创建扫描器，依次执行规则检查和ClamAV扫描
+func NewScanner(config configs.ScanConfig) (scanner.Scanner, error) {
+	rules, err := scanner.NewRuleScanner(config.Rules.MaxArchiveDepth, config.Rules.ForbiddenNames)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := scanner.Chain{rules}
+	if config.ClamAV.Enabled {
+		if config.ClamAV.Address == "" {
+			return nil, fmt.Errorf("ClamAV地址不能为空")
+		}
+		chain = append(chain, scanner.NewClamdScanner(config.ClamAV.Network, config.ClamAV.Address, config.ClamAV.Timeout))
+	}
+	return chain, nil
+}
+
+// Enabled 是否启用扫描
+func (s *ScanService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// Err 扫描器配置错误
+func (s *ScanService) Err() error {
+	return s.err
+}
+
+// Scan 扫描文件内容，未启用时直接通过
+// 未通过时返回ErrFileRejected，扫描器不可用时返回ErrFileScan
+func (s *ScanService) Scan(ctx context.Context, obj *scanner.Object) error {
+	if !s.config.Enabled {
+		return nil
+	}
+	if s.err != nil {
+		return errspec.ErrFileScan.New(ctx).Wrap(s.err)
+	}
+
+	result, err := s.scanner.Scan(ctx, obj)
+	if err != nil {
+		return errspec.ErrFileScan.New(ctx).Wrap(err)
+	}
+	if !result.Clean {
+		logger.WarnContext(ctx, "文件未通过扫描", "name", obj.Name, "scanner", result.Scanner, "threat", result.Threat)
+		return errspec.ErrFileRejected.New(ctx).Wrap(result.Err())
+	}
+	return nil
+}
+
+// Quarantine 将客户端直传的文件标记为隔离中，等待后台任务扫描
+func (s *ScanService) Quarantine(ctx context.Context, file *model.File) error {
+	err := s.db.WithContext(ctx).Model(file).Updates(map[string]any{
+		"status":      model.FileStatusQuarantined,
+		"scan_result": "",
+		"scanned_at":  nil,
+	}).Error
+	if err != nil {
+		return errspec.ErrFileUpdateRecord.New(ctx).Wrap(err)
+	}
+
+	file.Status = model.FileStatusQuarantined
+	file.ScanResult = ""
+	file.ScannedAt = nil
+	return nil
+}
+
+// ScanFile 扫描隔离中的文件，通过后完成上传，未通过时删除存储中的内容
+// 文件已被其他实例认领时直接返回
+func (s *ScanService) ScanFile(ctx context.Context, file *model.File) error {
+	staleBefore := time.Now().Add(-s.config.Timeout)
+	claimed, err := model.NewFileRepo(s.db).ClaimScan(ctx, file, staleBefore)
+	if err != nil || !claimed {
+		return err
+	}
+
+	err = s.Scan(ctx, &scanner.Object{
+		Name: file.OriginalName,
+		Size: file.Size,
+		Open: func() (io.ReadCloser, error) {
+			return s.storage.GetFile(ctx, file.Path, file.IsPublic)
+		},
+	})
+	switch {
+	case errspec.ErrFileRejected.Is(err):
+		return s.reject(ctx, file, err)
+	case err != nil:
+		// 扫描器暂时不可用，超过Timeout后重新扫描
+		return err
+	}
+
+	err = s.uploadService.Complete(ctx, file, true)
+	if errspec.ErrStorageQuotaExceeded.Is(err) {
+		// 配额已被其他上传占满，退回待上传状态，客户端重新确认时返回配额错误
+		if updateErr := s.db.WithContext(ctx).Model(&model.File{}).Where("id = ?", file.ID).
+			Update("status", model.FileStatusPending).Error; updateErr != nil {
+			return errspec.ErrFileUpdateRecord.New(ctx).Wrap(updateErr)
+		}
+	}
+	return err
+}
+
+// reject 标记文件未通过扫描并删除存储中的内容，保留记录供客户端查询原因
+func (s *ScanService) reject(ctx context.Context, file *model.File, cause error) error {
+	threat := cause.Error()
+	var infected *scanner.InfectedError
+	if errors.As(cause, &infected) {
+		threat = infected.Error()
+	}
+	if len(threat) > 255 {
+		threat = threat[:255]
+	}
+
+	if err := s.storage.DeleteFile(ctx, file.Path, file.IsPublic); err != nil {
+		logger.WarnContext(ctx, "删除未通过扫描的文件失败", "file_id", file.ID, "path", file.Path, "error", err)
+	}
+
+	now := time.Now()
+	err := s.db.WithContext(ctx).Model(file).Updates(map[string]any{
+		"status":      model.FileStatusRejected,
+		"scan_result": threat,
+		"scanned_at":  now,
+	}).Error
+	if err != nil {
+		return errspec.ErrFileUpdateRecord.New(ctx).Wrap(err)
+	}
+
+	file.Status = model.FileStatusRejected
+	file.ScanResult = threat
+	file.ScannedAt = &now
+	return nil
+}
+
+// ScanPending 扫描全部隔离中的文件，返回处理的文件数
+func (s *ScanService) ScanPending(ctx context.Context) (int, error) {
+	repo := model.NewFileRepo(s.db)
+	scanned := 0
+
+	for {
+		files, err := repo.ListQuarantined(ctx, time.Now().Add(-s.config.Timeout), scanBatch)
+		if err != nil {
+			return scanned, fmt.Errorf("查询隔离中的文件失败: %w", err)
+		}
+
+		// 认领后扫描失败的文件要等Timeout后才会再次被查询到，不会在本轮重复处理
+		for i := range files {
+			if err := s.ScanFile(ctx, &files[i]); err != nil {
+				logger.WarnContext(ctx, "扫描文件失败", "file_id", files[i].ID, "error", err)
+				continue
+			}
+			scanned++
+		}
+
+		if len(files) < scanBatch || ctx.Err() != nil {
+			return scanned, ctx.Err()
+		}
+	}
+}
+
+// Start 按配置的间隔扫描隔离中的文件，直到ctx取消
+func (s *ScanService) Start(ctx context.Context) {
+	logger.InfoContext(ctx, "文件扫描任务已启动", "interval", s.config.Interval)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoContext(ctx, "文件扫描任务已停止")
+			return
+		case <-ticker.C:
+			scanned, err := s.ScanPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.ErrorContext(ctx, "扫描隔离文件失败", "error", err)
+				continue
+			}
+			if scanned > 0 {
+				logger.InfoContext(ctx, "隔离文件扫描完成", "scanned", scanned)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// StorageMigrateOptions 存储迁移选项
+type StorageMigrateOptions struct {
+	Concurrency  int  // 并发迁移的文件数
+	Verify       bool // 写入后读取目标文件校验摘要
+	DeleteSource bool // 迁移完成后删除源文件
+}
+
+// StorageMigrateReport 存储迁移报告
+type StorageMigrateReport struct {
+	Source        string   // 源存储类型
+	Target        string   // 目标存储类型
+	Total         int      // 待迁移的存储对象数
+	Migrated      int      // 本次迁移成功数
+	Failed        int      // 失败数
+	Bytes         int64    // 本次迁移的字节数
+	SourceDeleted int      // 已删除的源文件数
+	Errors        []string // 错误信息
+}
+
+// storageObject 待迁移的存储对象，去重后多个文件记录可能共享同一对象
+type storageObject struct {
+	Path     string
+	IsPublic bool
+	SHA256   string
+}
+
+// StorageMigrateService 存储迁移服务
+// 基于StorageManager，将备用存储（源）中的文件流式复制到主存储（目标）
+type StorageMigrateService struct {
+	db      *gorm.DB
+	manager *filestore.StorageManager
+}
+
+// NewStorageMigrateService 创建存储迁移服务
+func NewStorageMigrateService(db *gorm.DB, source, target filestore.FileStorage) *StorageMigrateService {
+	return &StorageMigrateService{
+		db:      db,
+		manager: filestore.NewStorageManager(target, source),
+	}
+}
+
+// Run 执行迁移，进度记录在storage_migration表中，中断后重新执行会从未完成的对象继续
+func (s *StorageMigrateService) Run(ctx context.Context, opts StorageMigrateOptions) (*StorageMigrateReport, error) {
+	source := s.manager.GetSecondary().GetStorageType()
+	target := s.manager.GetPrimary().GetStorageType()
+	if source == target {
+		return nil, fmt.Errorf("源存储和目标存储相同: %s", source)
+	}
+
+	objects, err := s.listObjects(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StorageMigrateReport{
+		Source: source,
+		Target: target,
+		Total:  len(objects),
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan storageObject)
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range jobs {
+				size, err := s.migrateObject(ctx, source, target, obj, opts.Verify)
+
+				mu.Lock()
+				if err != nil {
+					report.Failed++
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Path, err))
+				} else {
+					report.Migrated++
+					report.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, obj := range objects {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- obj:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	// 包括之前中断时已迁移但未删除的源文件
+	if opts.DeleteSource {
+		s.deleteSources(ctx, source, target, report)
+	}
+
+	return report, nil
+}
+
+// migrateObject 迁移单个存储对象并更新引用它的记录，返回迁移的字节数
+func (s *StorageMigrateService) migrateObject(ctx context.Context, source, target string, obj storageObject, verify bool) (int64, error) {
+	repo := model.NewStorageMigrationRepo(s.db)
+	item, err := repo.GetOrCreate(ctx, source, target, obj.Path, obj.IsPublic)
+	if err != nil {
+		return 0, fmt.Errorf("记录迁移进度失败: %w", err)
+	}
+
+	checksum, err := s.copyObject(ctx, obj, verify)
+	if err != nil {
+		s.markFailed(ctx, item, err)
+		return 0, err
+	}
+
+	// 更新引用该对象的全部记录，与迁移进度在同一事务中提交
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range []any{&model.File{}, &model.FileVariant{}, &model.FileBlob{}, &model.FileVersion{}} {
+			err := tx.Model(m).
+				Where("path = ? AND is_public = ? AND storage_type = ?", obj.Path, obj.IsPublic, source).
+				Update("storage_type", target).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// 回收站中的文件
+		if !obj.IsPublic {
+			err := tx.Unscoped().Model(&model.File{}).
+				Where("trash_path = ? AND storage_type = ?", obj.Path, source).
+				Update("storage_type", target).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(item).Updates(map[string]any{
+			"status": model.StorageMigrationDone,
+			"sha256": checksum.SHA256,
+			"size":   checksum.Size,
+			"error":  "",
+		}).Error
+	})
+	if err != nil {
+		err = fmt.Errorf("更新文件记录失败: %w", err)
+		s.markFailed(ctx, item, err)
+		return 0, err
+	}
+
+	logger.InfoContext(ctx, "文件迁移成功", "path", obj.Path, "public", obj.IsPublic, "size", checksum.Size)
+	return checksum.Size, nil
+}
+
+// copyObject 复制文件并校验摘要
+func (s *StorageMigrateService) copyObject(ctx context.Context, obj storageObject, verify bool) (*filestore.Checksum, error) {
+	checksum, err := s.manager.CopyFromSecondary(ctx, obj.Path, obj.IsPublic)
+	if err != nil {
+		return nil, fmt.Errorf("复制文件失败: %w", err)
+	}
+
+	// 源文件内容与上传时记录的摘要不一致，说明源文件已损坏
+	if obj.SHA256 != "" && obj.SHA256 != checksum.SHA256 {
+		return nil, fmt.Errorf("源文件校验和不匹配: 期望 %s, 实际 %s", obj.SHA256, checksum.SHA256)
+	}
+
+	if verify {
+		if err := s.manager.VerifyPrimary(ctx, obj.Path, obj.IsPublic, checksum.SHA256); err != nil {
+			return nil, fmt.Errorf("校验目标文件失败: %w", err)
+		}
+	}
+
+	return checksum, nil
+}
+
+// markFailed 记录迁移失败
+func (s *StorageMigrateService) markFailed(ctx context.Context, item *model.StorageMigration, cause error) {
+	msg := cause.Error()
+	if len(msg) > 1000 {
+		msg = msg[:1000]
+	}
+
+	err := s.db.WithContext(ctx).Model(item).Updates(map[string]any{
+		"status": model.StorageMigrationFailed,
+		"error":  msg,
+	}).Error
+	if err != nil {
+		logger.WarnContext(ctx, "记录迁移失败状态失败", "path", item.Path, "error", err)
+	}
+}
+
+// deleteSources 删除已迁移完成的源文件
+func (s *StorageMigrateService) deleteSources(ctx context.Context, source, target string, report *StorageMigrateReport) {
+	repo := model.NewStorageMigrationRepo(s.db)
+	items, err := repo.ListPendingSourceDeletion(ctx, source, target)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("查询待删除的源文件失败: %v", err))
+		return
+	}
+
+	storage := s.manager.GetSecondary()
+	for i := range items {
+		item := &items[i]
+
+		exists, err := storage.FileExists(ctx, item.Path, item.IsPublic)
+		if err == nil && exists {
+			err = storage.DeleteFile(ctx, item.Path, item.IsPublic)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("删除源文件 %s 失败: %v", item.Path, err))
+			continue
+		}
+
+		if err := s.db.WithContext(ctx).Model(item).Update("source_deleted", true).Error; err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("更新迁移进度 %s 失败: %v", item.Path, err))
+			continue
+		}
+		report.SourceDeleted++
+	}
+}
+
+// listObjects 获取源存储中被文件、衍生图和历史版本记录引用的全部存储对象
+func (s *StorageMigrateService) listObjects(ctx context.Context, source string) ([]storageObject, error) {
+	var files []model.File
+	err := s.db.WithContext(ctx).
+		Select("path", "is_public", "sha256").
+		Where("storage_type = ?", source).
+		Find(&files).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询文件记录失败: %w", err)
+	}
+
+	var trashed []model.File
+	err = s.db.WithContext(ctx).Unscoped().
+		Select("trash_path", "sha256").
+		Where("trash_path <> '' AND storage_type = ?", source).
+		Find(&trashed).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询回收站文件记录失败: %w", err)
+	}
+
+	var variants []model.FileVariant
+	err = s.db.WithContext(ctx).
+		Select("path", "is_public").
+		Where("storage_type = ?", source).
+		Find(&variants).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询衍生图记录失败: %w", err)
+	}
+
+	var versions []model.FileVersion
+	err = s.db.WithContext(ctx).
+		Select("path", "is_public", "sha256").
+		Where("storage_type = ?", source).
+		Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询文件版本记录失败: %w", err)
+	}
+
+	seen := make(map[storageObject]bool)
+	objects := make([]storageObject, 0, len(files)+len(trashed)+len(variants)+len(versions))
+	add := func(obj storageObject) {
+		key := storageObject{Path: obj.Path, IsPublic: obj.IsPublic}
+		if obj.Path == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		objects = append(objects, obj)
+	}
+
+	for _, f := range files {
+		add(storageObject{Path: f.Path, IsPublic: f.IsPublic, SHA256: f.SHA256})
+	}
+	for _, f := range trashed {
+		add(storageObject{Path: f.TrashPath, IsPublic: false, SHA256: f.SHA256})
+	}
+	for _, v := range variants {
+		add(storageObject{Path: v.Path, IsPublic: v.IsPublic})
+	}
+	for _, v := range versions {
+		add(storageObject{Path: v.Path, IsPublic: v.IsPublic, SHA256: v.SHA256})
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/spf13/cast"
+)
+
+// TrashHandler 文件回收站处理器
+type TrashHandler struct {
+	app     AppContext
+	library *FileLibraryService
+	service *TrashService
+	helper  *HandlerHelper
+}
+
+var _ RouterInitializer = (*TrashHandler)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewTrashHandler 创建文件回收站处理器
+func NewTrashHandler(app AppContext) *TrashHandler {
+	return &TrashHandler{
+		app:     app,
+		library: NewFileLibraryService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		service: NewTrashService(app.GetDB(), app.GetStorage(), app.GetConfig()),
+		helper:  NewHandlerHelper(),
+	}
+}
+
+func (h *TrashHandler) InitRouters(g *gin.RouterGroup, root *gin.Engine) {
+	authenticated := g.Group("", middleware.JWTAuth(h.app.GetConfig()))
+
+	// 当前用户删除文件及回收站
+	authenticated.DELETE("/user/files/:id", h.DeleteFile)
+	trash := authenticated.Group("/user/trash")
+	{
+		trash.GET("", h.ListTrash)
+		trash.POST("/:id/restore", h.RestoreFile)
+		trash.DELETE("/:id", h.PurgeFile)
+	}
+
+	// 管理员回收站
+	admin := authenticated.Group("/admin/trash", middleware.AdminCheck())
+	{
+		admin.GET("", h.AdminListTrash)
+		admin.POST("/:id/restore", h.AdminRestoreFile)
+		admin.DELETE("/:id", h.AdminPurgeFile)
+	}
+}
+
+// DeleteFile 删除当前用户的文件，启用回收站时移入回收站
+func (h *TrashHandler) DeleteFile(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	file, err := h.library.Get(ctx.Request.Context(), userID, ctx.Param("id"))
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "DeleteFile", "file_id", ctx.Param("id"), "user_id", userID)
+		return
+	}
+
+	if err := h.service.Remove(ctx.Request.Context(), file); err != nil {
+		h.helper.HandleDBError(ctx, err, "DeleteFile", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "DeleteFile", "file_id", file.ID, "trash", h.service.Enabled())
+	response.Success(ctx, &dto.DeleteResponse{Message: "删除成功"})
+}
+
+// ListTrash 分页获取当前用户回收站中的文件
+func (h *TrashHandler) ListTrash(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	h.respondList(ctx, userID)
+}
+
+// RestoreFile 从回收站恢复当前用户的文件
+func (h *TrashHandler) RestoreFile(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	h.restore(ctx, userID)
+}
+
+// PurgeFile 永久删除当前用户回收站中的文件
+func (h *TrashHandler) PurgeFile(ctx *gin.Context) {
+	userID, ok := h.helper.GetUserID(ctx)
+	if !ok {
+		return
+	}
+
+	h.purge(ctx, userID)
+}
+
+// AdminListTrash 分页获取回收站中的文件（管理员），可按user_id过滤
+func (h *TrashHandler) AdminListTrash(ctx *gin.Context) {
+	h.respondList(ctx, cast.ToInt64(ctx.Query("user_id")))
+}
+
+// AdminRestoreFile 从回收站恢复任意用户的文件（管理员）
+func (h *TrashHandler) AdminRestoreFile(ctx *gin.Context) {
+	h.restore(ctx, 0)
+}
+
+// AdminPurgeFile 永久删除回收站中任意用户的文件（管理员）
+func (h *TrashHandler) AdminPurgeFile(ctx *gin.Context) {
+	h.purge(ctx, 0)
+}
+
+// respondList 返回回收站文件列表，userID为0时返回全部用户的文件
+func (h *TrashHandler) respondList(ctx *gin.Context, userID int64) {
+	var req dto.PageRequest
+	if !h.helper.BindQuery(ctx, &req, "ListTrash") {
+		return
+	}
+	req.Normalize()
+
+	items, total, err := h.service.List(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "ListTrash", "user_id", userID)
+		return
+	}
+
+	response.Success(ctx, response.NewPageResult(items, total, req.Page, req.PageSize))
+}
+
+// restore 恢复回收站中的文件，userID为0时不限制上传者
+func (h *TrashHandler) restore(ctx *gin.Context, userID int64) {
+	file, ok := h.findTrashed(ctx, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Restore(ctx.Request.Context(), file); err != nil {
+		h.helper.HandleDBError(ctx, err, "RestoreFile", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "RestoreFile", "file_id", file.ID, "user_id", file.UploadedBy)
+
+	item, err := h.library.Item(ctx.Request.Context(), file)
+	if err != nil {
+		h.helper.HandleDBError(ctx, err, "RestoreFile", "file_id", file.ID)
+		return
+	}
+	response.Success(ctx, item)
+}
+
+// purge 永久删除回收站中的文件，userID为0时不限制上传者
+func (h *TrashHandler) purge(ctx *gin.Context, userID int64) {
+	file, ok := h.findTrashed(ctx, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Purge(ctx.Request.Context(), file); err != nil {
+		h.helper.HandleDBError(ctx, err, "PurgeFile", "file_id", file.ID)
+		return
+	}
+
+	h.helper.LogSuccess(ctx, "PurgeFile", "file_id", file.ID, "user_id", file.UploadedBy)
+	response.Success(ctx, &dto.DeleteResponse{Message: "删除成功"})
+}
+
+// findTrashed 根据路由参数查询回收站中的文件
+func (h *TrashHandler) findTrashed(ctx *gin.Context, userID int64) (*model.File, bool) {
+	fileID := ctx.Param("id")
+	if fileID == "" {
+		response.Error(ctx, errspec.ErrFileIDEmpty.New(ctx))
+		return nil, false
+	}
+
+	file, err := model.NewFileRepo(h.app.GetDB()).GetTrashed(ctx.Request.Context(), fileID, userID)
+	if err != nil {
+		h.helper.HandleNotFoundError(ctx, err, "findTrashed", "file_id", fileID, "user_id", userID)
+		return nil, false
+	}
+
+	return file, true
+}
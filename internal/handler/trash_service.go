@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// trashPurgeBatch 每批清理的过期文件数
+const trashPurgeBatch = 100
+
+// TrashService 文件回收站服务
+// 删除的文件复制到私有目录下的回收站路径并释放原存储对象的引用，记录软删除，超过保留时间后永久删除
+type TrashService struct {
+	db             *gorm.DB
+	storage        filestore.FileStorage
+	blobService    *BlobService
+	imageService   *ImageService
+	quotaService   *QuotaService
+	versionService *FileVersionService
+	config         configs.TrashConfig
+}
+
+// NewTrashService 创建文件回收站服务
+func NewTrashService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *TrashService {
+	trashConfig := config.Storage.Trash
+
+	if trashConfig.Retention <= 0 {
+		trashConfig.Retention = 30 * 24 * time.Hour
+	}
+	if trashConfig.PurgeInterval <= 0 {
+		trashConfig.PurgeInterval = time.Hour
+	}
+
+	return &TrashService{
+		db:             db,
+		storage:        storage,
+		blobService:    NewBlobService(db, storage),
+		imageService:   NewImageService(db, storage, config),
+		quotaService:   NewQuotaService(db, config),
+		versionService: NewFileVersionService(db, storage, config),
+		config:         trashConfig,
+	}
+}
+
+// Enabled 是否启用回收站
+func (s *TrashService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// Remove 删除文件，启用回收站时移入回收站，否则永久删除
+func (s *TrashService) Remove(ctx context.Context, file *model.File) error {
+	if s.config.Enabled {
+		return s.Trash(ctx, file)
+	}
+	return s.Delete(ctx, file)
+}
+
+// Trash 将文件移入回收站，未完成上传的文件直接永久删除
+func (s *TrashService) Trash(ctx context.Context, file *model.File) error {
+	if file.Status != model.FileStatusActive {
+		return s.Delete(ctx, file)
+	}
+
+	original := *file
+	trashPath := filestore.TrashPath(file.ID, file.Path)
+	if err := s.copy(ctx, file.Path, file.IsPublic, trashPath, false); err != nil {
+		return errspec.ErrFileTrash.New(ctx).Wrap(err)
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(file).Updates(map[string]any{
+			"status":       model.FileStatusDeleted,
+			"trash_path":   trashPath,
+			"storage_type": s.storage.GetStorageType(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(file).Error; err != nil {
+			return err
+		}
+		return s.quotaService.Release(ctx, tx, original.UploadedBy, original.Usage, original.Size)
+	})
+	if err != nil {
+		*file = original
+		if delErr := s.storage.DeleteFile(ctx, trashPath, false); delErr != nil {
+			logger.WarnContext(ctx, "删除回收站文件失败", "file_id", file.ID, "path", trashPath, "error", delErr)
+		}
+		return errspec.ErrFileTrash.New(ctx).Wrap(err)
+	}
+
+	// 回收站中已保留副本，原存储对象和衍生图的清理失败只记录日志
+	if err := s.imageService.DeleteVariants(ctx, &original); err != nil {
+		logger.WarnContext(ctx, "删除文件衍生图失败", "file_id", file.ID, "error", err)
+	}
+	if err := s.blobService.Release(ctx, &original); err != nil {
+		logger.WarnContext(ctx, "释放原存储对象失败", "file_id", file.ID, "path", file.Path, "error", err)
+	}
+
+	file.Status = model.FileStatusDeleted
+	file.TrashPath = trashPath
+	file.StorageType = s.storage.GetStorageType()
+	return nil
+}
+
+// Delete 永久删除文件：删除衍生图和历史版本、释放存储对象并删除记录
+func (s *TrashService) Delete(ctx context.Context, file *model.File) error {
+	if err := s.imageService.DeleteVariants(ctx, file); err != nil {
+		logger.WarnContext(ctx, "删除文件衍生图失败", "file_id", file.ID, "error", err)
+	}
+	if err := s.versionService.DeleteAll(ctx, file.ID); err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+
+	// 释放存储中的文件，仍被其他文件引用时保留
+	if err := s.blobService.Release(ctx, file); err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+
+	// 删除数据库记录并释放已占用的存储配额
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(file).Error; err != nil {
+			return err
+		}
+		if file.Status != model.FileStatusActive {
+			return nil
+		}
+		return s.quotaService.Release(ctx, tx, file.UploadedBy, file.Usage, file.Size)
+	})
+	if err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// Restore 从回收站恢复文件到原路径，恢复时重新占用存储配额
+func (s *TrashService) Restore(ctx context.Context, file *model.File) error {
+	// 更新记录时gorm会回写file的字段，提前保存回收站路径
+	trashPath := file.TrashPath
+	reader, err := s.storage.GetFile(ctx, trashPath, false)
+	if err != nil {
+		return errspec.ErrFileRestore.New(ctx).Wrap(err)
+	}
+	newPath, checksum, err := s.blobService.Store(ctx, file.Path, reader, file.IsPublic)
+	reader.Close()
+	if err != nil {
+		return errspec.ErrFileRestore.New(ctx).Wrap(err)
+	}
+
+	restored := *file
+	restored.Path = newPath
+	restored.StorageType = s.storage.GetStorageType()
+	restored.SHA256 = checksum.SHA256
+	restored.MD5 = checksum.MD5
+	restored.Status = model.FileStatusActive
+	restored.TrashPath = ""
+	restored.DeletedAt = gorm.DeletedAt{}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.quotaService.Consume(ctx, tx, file.UploadedBy, file.Usage, file.Size); err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(file).Updates(map[string]any{
+			"path":         restored.Path,
+			"storage_type": restored.StorageType,
+			"sha256":       restored.SHA256,
+			"md5":          restored.MD5,
+			"status":       restored.Status,
+			"trash_path":   "",
+			"deleted_at":   nil,
+		}).Error
+	})
+	if err != nil {
+		if releaseErr := s.blobService.Release(ctx, &restored); releaseErr != nil {
+			logger.WarnContext(ctx, "释放恢复的存储对象失败", "file_id", file.ID, "path", restored.Path, "error", releaseErr)
+		}
+		if errspec.ErrStorageQuotaExceeded.Is(err) {
+			return err
+		}
+		return errspec.ErrFileRestore.New(ctx).Wrap(err)
+	}
+
+	if err := s.storage.DeleteFile(ctx, trashPath, false); err != nil {
+		logger.WarnContext(ctx, "删除回收站文件失败", "file_id", file.ID, "path", trashPath, "error", err)
+	}
+
+	*file = restored
+	return nil
+}
+
+// Purge 永久删除回收站中的文件及其历史版本
+func (s *TrashService) Purge(ctx context.Context, file *model.File) error {
+	if err := s.versionService.DeleteAll(ctx, file.ID); err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+
+	// 回收站中的文件已不存在时只删除记录
+	exists, err := s.storage.FileExists(ctx, file.TrashPath, false)
+	if err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+	if exists {
+		if err := s.storage.DeleteFile(ctx, file.TrashPath, false); err != nil {
+			return errspec.ErrFileDelete.New(ctx).Wrap(err)
+		}
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := model.NewTagRepo(tx).SetFileTags(ctx, file.UploadedBy, file.ID, nil); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(file).Error
+	})
+	if err != nil {
+		return errspec.ErrFileDelete.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// PurgeExpired 永久删除超过保留时间的文件，返回删除的文件数
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	repo := model.NewFileRepo(s.db)
+	before := time.Now().Add(-s.config.Retention)
+
+	purged := 0
+	for {
+		files, err := repo.ListExpiredTrash(ctx, before, trashPurgeBatch)
+		if err != nil {
+			return purged, fmt.Errorf("查询过期的回收站文件失败: %w", err)
+		}
+
+		failed := 0
+		for i := range files {
+			if err := s.Purge(ctx, &files[i]); err != nil {
+				logger.WarnContext(ctx, "清理回收站文件失败", "file_id", files[i].ID, "error", err)
+				failed++
+				continue
+			}
+			purged++
+		}
+
+		// 本批全部失败时停止，避免反复处理同一批文件
+		if len(files) < trashPurgeBatch || failed == len(files) {
+			return purged, nil
+		}
+	}
+}
+
+// Start 按配置的间隔定期清理回收站，直到ctx取消
+func (s *TrashService) Start(ctx context.Context) {
+	logger.InfoContext(ctx, "回收站清理任务已启动", "interval", s.config.PurgeInterval, "retention", s.config.Retention)
+
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoContext(ctx, "回收站清理任务已停止")
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeExpired(ctx)
+			if err != nil {
+				logger.ErrorContext(ctx, "清理回收站失败", "error", err)
+				continue
+			}
+			if purged > 0 {
+				logger.InfoContext(ctx, "回收站清理完成", "purged", purged)
+			}
+		}
+	}
+}
+
+// List 分页获取回收站中的文件，userID为0时返回全部用户的文件
+func (s *TrashService) List(ctx context.Context, userID int64, req *dto.PageRequest) ([]dto.TrashItem, int64, error) {
+	files, total, err := model.NewFileRepo(s.db).ListTrash(ctx, req.Page, req.PageSize, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]dto.TrashItem, len(files))
+	for i := range files {
+		items[i] = s.toTrashItem(&files[i])
+	}
+	return items, total, nil
+}
+
+// toTrashItem 转换为回收站列表项
+func (s *TrashService) toTrashItem(file *model.File) dto.TrashItem {
+	deletedAt := file.DeletedAt.Time
+	return dto.TrashItem{
+		ID:           file.ID,
+		OriginalName: file.OriginalName,
+		Usage:        file.Usage,
+		Size:         file.Size,
+		MimeType:     file.MimeType,
+		IsPublic:     file.IsPublic,
+		UploadedBy:   file.UploadedBy,
+		DeletedAt:    deletedAt,
+		PurgeAt:      deletedAt.Add(s.config.Retention),
+	}
+}
+
+// copy 复制存储中的文件，加密存储会先解密再按目标路径决定是否加密
+func (s *TrashService) copy(ctx context.Context, srcPath string, srcPublic bool, dstPath string, dstPublic bool) error {
+	reader, err := s.storage.GetFile(ctx, srcPath, srcPublic)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return s.storage.UploadFile(ctx, dstPath, reader, dstPublic)
+}
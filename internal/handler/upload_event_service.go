@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// UploadEventResult 存储事件处理结果
+type UploadEventResult struct {
+	Confirmed int `json:"confirmed"` // 自动确认的文件数（包括进入隔离等待扫描的文件）
+	Skipped   int `json:"skipped"`   // 忽略的记录数（非创建事件、其他桶或没有待上传记录的对象）
+	Failed    int `json:"failed"`    // 处理失败的记录数，文件保持待上传状态，客户端仍可手动确认
+}
+
+// UploadEventService 处理对象存储的事件通知，客户端直传完成后自动确认上传
+type UploadEventService struct {
+	db            *gorm.DB
+	storage       filestore.FileStorage
+	bucket        string
+	quotaService  *QuotaService
+	uploadService *UploadService
+	scanService   *ScanService
+}
+
+// NewUploadEventService 创建存储事件处理服务
+func NewUploadEventService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *UploadEventService {
+	return &UploadEventService{
+		db:            db,
+		storage:       storage,
+		bucket:        config.Storage.S3.Bucket,
+		quotaService:  NewQuotaService(db, config),
+		uploadService: NewUploadService(db, storage, config),
+		scanService:   NewScanService(db, storage, config),
+	}
+}
+
+// Handle 处理事件通知中的全部记录，单条记录失败时记录日志并继续处理
+func (s *UploadEventService) Handle(ctx context.Context, event *filestore.S3Event) UploadEventResult {
+	var result UploadEventResult
+	for i := range event.Records {
+		record := &event.Records[i]
+		confirmed, err := s.confirm(ctx, record)
+		switch {
+		case err != nil:
+			logger.WarnContext(ctx, "处理存储事件失败",
+				"event", record.EventName, "key", record.S3.Object.Key, "error", err)
+			result.Failed++
+		case confirmed:
+			result.Confirmed++
+		default:
+			result.Skipped++
+		}
+	}
+	return result
+}
+
+// confirm 确认对象创建事件对应的待上传文件，与确认上传接口的首次确认流程一致
+func (s *UploadEventService) confirm(ctx context.Context, record *filestore.S3EventRecord) (bool, error) {
+	if !record.ObjectCreated() {
+		return false, nil
+	}
+	if s.bucket != "" && record.S3.Bucket.Name != "" && record.S3.Bucket.Name != s.bucket {
+		return false, nil
+	}
+
+	filePath, isPublic, err := record.Object()
+	if err != nil {
+		return false, err
+	}
+
+	// 只处理待上传的记录，已确认或通过服务器上传的文件忽略
+	var file model.File
+	err = s.db.WithContext(ctx).
+		Where("path = ? AND is_public = ? AND storage_type = ? AND status = ?",
+			filePath, isPublic, s.storage.GetStorageType(), model.FileStatusPending).
+		First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// 按对象的实际大小检查存储配额
+	if err := s.quotaService.Check(ctx, file.UploadedBy, file.Usage, record.S3.Object.Size); err != nil {
+		return false, err
+	}
+
+	if s.scanService.Enabled() {
+		if err := s.scanService.Quarantine(ctx, &file); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := s.uploadService.Complete(ctx, &file, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
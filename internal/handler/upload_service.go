@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// errUploadCompleted 文件已被并发的确认请求完成
+var errUploadCompleted = errors.New("文件已完成上传")
+
+// confirmTimeout 确认中的文件超过该时长仍未完成时视为处理中断，可以重新认领
+const confirmTimeout = 10 * time.Minute
+
+// UploadService 客户端直传文件的上传完成处理，确认上传和异步扫描通过后共用
+type UploadService struct {
+	db           *gorm.DB
+	storage      filestore.FileStorage
+	imageService *ImageService
+	blobService  *BlobService
+	quotaService *QuotaService
+}
+
+// NewUploadService 创建上传完成处理服务
+func NewUploadService(db *gorm.DB, storage filestore.FileStorage, config *configs.Config) *UploadService {
+	return &UploadService{
+		db:           db,
+		storage:      storage,
+		imageService: NewImageService(db, storage, config),
+		blobService:  NewBlobService(db, storage),
+		quotaService: NewQuotaService(db, config),
+	}
+}
+
+// Complete 完成上传：移除图片元数据、按用途加密、登记内容并将文件标记为正常
+// pending为true时先认领文件再处理内容，并占用存储配额；已登记过内容的文件不重复处理
+func (s *UploadService) Complete(ctx context.Context, file *model.File, pending bool) error {
+	repo := model.NewFileRepo(s.db)
+	status := file.Status
+	if pending {
+		// 确认接口和存储事件回调可能同时确认同一文件，只有认领成功的一方处理内容
+		claimed, err := repo.ClaimConfirm(ctx, file, time.Now().Add(-confirmTimeout))
+		if err != nil {
+			logger.ErrorContext(ctx, "认领待确认文件失败", "file_id", file.ID, "error", err)
+			return errspec.ErrFileUpdateRecord.New(ctx)
+		}
+		if !claimed {
+			return s.reload(ctx, file)
+		}
+	}
+
+	err := s.complete(ctx, file, pending)
+	if err == errUploadCompleted {
+		return s.reload(ctx, file)
+	}
+	if err != nil {
+		// 恢复认领前的状态，客户端或后台任务可以重新确认
+		if pending {
+			if releaseErr := repo.ReleaseConfirm(ctx, file, status); releaseErr != nil {
+				logger.WarnContext(ctx, "恢复文件状态失败", "file_id", file.ID, "error", releaseErr)
+			}
+		}
+		file.Status = status
+		return err
+	}
+	return nil
+}
+
+// Confirming 文件是否正在被其他请求确认，认领超时的文件视为处理中断，可以重新确认
+func (s *UploadService) Confirming(file *model.File) bool {
+	return file.Status == model.FileStatusConfirming && file.UpdatedAt.After(time.Now().Add(-confirmTimeout))
+}
+
+// reload 文件已被其他请求完成或正在确认，返回最新的文件记录
+func (s *UploadService) reload(ctx context.Context, file *model.File) error {
+	if err := s.db.WithContext(ctx).First(file, "id = ?", file.ID).Error; err != nil {
+		return errspec.ErrFileNotFound.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// complete 处理已认领文件的内容并保存记录
+func (s *UploadService) complete(ctx context.Context, file *model.File, pending bool) error {
+	unregistered := file.SHA256 == ""
+	if unregistered {
+		// 移除直传图片中的元数据
+		if err := s.imageService.SanitizeStored(ctx, file); err != nil {
+			if errspec.ErrFileTooLarge.Is(err) {
+				return err
+			}
+			logger.ErrorContext(ctx, "处理图片元数据失败", "error", err)
+			return errspec.ErrFileVerify.New(ctx)
+		}
+
+		// 直传到对象存储的内容未经过加密，按文件用途加密
+		if encrypted, ok := s.storage.(*filestore.EncryptedStorage); ok {
+			if _, err := encrypted.Rewrap(ctx, file.Path, file.IsPublic); err != nil {
+				logger.ErrorContext(ctx, "加密文件失败", "error", err)
+				return errspec.ErrFileVerify.New(ctx)
+			}
+		}
+
+		// 计算校验和并去重，相同内容已存在时文件将指向已有对象
+		if _, err := s.blobService.Register(ctx, file); err != nil {
+			logger.ErrorContext(ctx, "登记文件内容失败", "error", err)
+			return errspec.ErrFileVerify.New(ctx)
+		}
+	}
+
+	// 更新文件记录，首次确认时占用存储配额
+	file.Status = model.FileStatusActive
+	file.UploadedAt = time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if pending {
+			// 认领超时后其他请求可能已完成同一文件，只有一次生效
+			finished, err := model.NewFileRepo(tx).FinishConfirm(ctx, file)
+			if err != nil {
+				return err
+			}
+			if !finished {
+				return errUploadCompleted
+			}
+			if err := s.quotaService.Consume(ctx, tx, file.UploadedBy, file.Usage, file.Size); err != nil {
+				return err
+			}
+		}
+		return tx.Save(file).Error
+	})
+	if err != nil {
+		// 记录未保存，释放本次登记的内容引用
+		if unregistered {
+			if err := s.blobService.Release(ctx, file); err != nil {
+				logger.WarnContext(ctx, "释放文件内容失败", "path", file.Path, "error", err)
+			}
+		}
+		if err == errUploadCompleted || errspec.ErrStorageQuotaExceeded.Is(err) {
+			return err
+		}
+		logger.ErrorContext(ctx, "更新文件记录失败", "error", err)
+		return errspec.ErrFileUpdateRecord.New(ctx)
+	}
+
+	// 客户端直传的内容未经过UploadFile，需要单独复制到备用存储
+	if replicator, ok := s.storage.(filestore.Replicator); ok && unregistered {
+		if err := replicator.Replicate(ctx, file.Path, file.IsPublic); err != nil {
+			logger.WarnContext(ctx, "复制文件到备用存储失败", "path", file.Path, "error", err)
+		}
+	}
+
+	// 按配置生成衍生图，失败时仅记录日志（可在首次请求时重新生成）
+	if s.imageService.GenerateOnUpload(file) {
+		if err := s.imageService.GenerateVariants(ctx, file); err != nil {
+			logger.WarnContext(ctx, "生成文件衍生图失败", "file_id", file.ID, "error", err)
+		}
+	}
+
+	return nil
+}
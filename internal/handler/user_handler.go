@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -243,6 +244,15 @@ func (h *UserHandler) UserRegister(ctx *gin.Context) {
 		return
 	}
 
+	// 新用户加入布隆过滤器，失败时等待下一次重建
+	if filter := h.app.GetUserFilter(); filter != nil {
+		if err := filter.Add(reqCtx, strconv.FormatInt(user.ID, 10)); err != nil {
+			logger.WarnContext(reqCtx, "UserRegister failed to add user to bloom filter",
+				"error", err,
+				"user_id", user.ID)
+		}
+	}
+
 	// 隐藏密码等敏感信息
 	user.Password = ""
 
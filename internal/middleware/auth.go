@@ -10,6 +10,8 @@ import (
 	"github.com/limitcool/starter/internal/errspec"
 	"github.com/limitcool/starter/internal/pkg/jwt"
 	"github.com/limitcool/starter/internal/pkg/logger"
+
+	gojwt "github.com/golang-jwt/jwt/v4"
 )
 
 // 上下文键类型
@@ -51,30 +53,60 @@ func JWTAuth(config *configs.Config) gin.HandlerFunc {
 			return
 		}
 
-		// 将claims存入请求上下文
-		ctx = context.WithValue(ctx, TokenKey, claims)
+		setClaims(c, claims, token)
+
+		// 继续处理该请求
+		c.Next()
+	}
+}
 
-		// 将用户ID存入请求上下文
-		if userId, exists := (*claims)["user_id"]; exists {
-			c.Set("user_id", userId)
-			ctx = context.WithValue(ctx, "user_id", userId)
+// OptionalJWTAuth 可选的JWT认证中间件
+// 携带有效token时与JWTAuth一样写入用户信息，未携带或token无效时按匿名请求继续处理
+func OptionalJWTAuth(config *configs.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			c.Next()
+			return
 		}
-		if isAdmin, exists := (*claims)["is_admin"]; exists {
-			c.Set("is_admin", isAdmin)
-			ctx = context.WithValue(ctx, "is_admin", isAdmin)
+
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		claims, err := jwt.ParseTokenWithContext(c.Request.Context(), token, config.JwtAuth.AccessSecret)
+		if err != nil {
+			logger.WarnContext(c.Request.Context(), "Optional authentication token parse failed", "error", err)
+			c.Next()
+			return
 		}
-		// 将token存入请求上下文
-		c.Set("token", token)
-		ctx = context.WithValue(ctx, "token", token)
 
-		// 更新请求上下文
-		c.Request = c.Request.WithContext(ctx)
+		setClaims(c, claims, token)
+		c.Next()
+	}
+}
 
-		// 添加用户信息到上下文
-		// TODO: 在此处获取用户/系统用户信息并添加到上下文中
-		// 这里需要调用 userService 或 sysUserService 来获取用户信息
+// setClaims 将token中的用户信息写入gin上下文和请求上下文
+func setClaims(c *gin.Context, claims *gojwt.MapClaims, token string) {
+	ctx := c.Request.Context()
 
-		// 继续处理该请求
-		c.Next()
+	// 将claims存入请求上下文
+	ctx = context.WithValue(ctx, TokenKey, claims)
+
+	// 将用户ID存入请求上下文
+	if userId, exists := (*claims)["user_id"]; exists {
+		c.Set("user_id", userId)
+		ctx = context.WithValue(ctx, "user_id", userId)
+	}
+	if isAdmin, exists := (*claims)["is_admin"]; exists {
+		c.Set("is_admin", isAdmin)
+		ctx = context.WithValue(ctx, "is_admin", isAdmin)
 	}
+	// 将token存入请求上下文
+	c.Set("token", token)
+	ctx = context.WithValue(ctx, "token", token)
+
+	// 更新请求上下文
+	c.Request = c.Request.WithContext(ctx)
+
+	// 添加用户信息到上下文
+	// TODO: 在此处获取用户/系统用户信息并添加到上下文中
+	// 这里需要调用 userService 或 sysUserService 来获取用户信息
 }
@@ -0,0 +1,346 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// ResponseCacheOptions 响应缓存选项
+type ResponseCacheOptions struct {
+	TTL    time.Duration // 服务端缓存的过期时间
+	MaxAge time.Duration // 客户端缓存时间，0表示客户端每次使用ETag重新验证
+}
+
+// ResponseCache 缓存成功的response.Result响应，支持ETag和Last-Modified条件请求
+// 缓存键由路由、路由参数、查询参数、认证范围和Accept-Language组成
+// 只缓存状态码200且code为0的JSON响应，命中时按当前请求重新生成request_id和timestamp
+type ResponseCache struct {
+	cache  cache.Cache
+	ttl    time.Duration
+	maxAge time.Duration
+}
+
+// NewResponseCache 创建响应缓存，响应保存在c的http命名空间中
+func NewResponseCache(c cache.Cache, opts ResponseCacheOptions) *ResponseCache {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	return &ResponseCache{
+		cache:  c.Namespace("http"),
+		ttl:    opts.TTL,
+		maxAge: opts.MaxAge,
+	}
+}
+
+// RouteTag 路由的标签，每个缓存的响应都带有所在路由的标签
+func RouteTag(path string) string {
+	return "http:route:" + path
+}
+
+// Purge 失效带有这些标签的响应
+func (rc *ResponseCache) Purge(ctx context.Context, tags ...string) error {
+	if rc == nil || len(tags) == 0 {
+		return nil
+	}
+	return rc.cache.InvalidateTags(ctx, tags...)
+}
+
+// CacheOption 单个路由的缓存选项
+type CacheOption func(*cacheRoute)
+
+// cacheRoute 单个路由的缓存设置
+type cacheRoute struct {
+	ttl    time.Duration
+	tags   func(c *gin.Context) []string
+	shared bool
+}
+
+// CacheTTL 设置路由的服务端缓存过期时间
+func CacheTTL(ttl time.Duration) CacheOption {
+	return func(r *cacheRoute) {
+		r.ttl = ttl
+	}
+}
+
+// CacheTags 设置响应的标签，用于Purge或随实体的修改失效
+func CacheTags(tags func(c *gin.Context) []string) CacheOption {
+	return func(r *cacheRoute) {
+		r.tags = tags
+	}
+}
+
+// CacheShared 响应与当前用户无关，认证用户之间共享缓存
+// 中间件需要放在权限检查之后，否则未通过检查的用户也能读取缓存
+func CacheShared() CacheOption {
+	return func(r *cacheRoute) {
+		r.shared = true
+	}
+}
+
+// Middleware 创建路由的响应缓存中间件，rc为nil（未启用）时直接执行后续处理
+// 只用于返回response.Result的GET路由，需要放在认证中间件之后
+func (rc *ResponseCache) Middleware(opts ...CacheOption) gin.HandlerFunc {
+	if rc == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	route := cacheRoute{ttl: rc.ttl}
+	for _, opt := range opts {
+		opt(&route)
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		directives := parseCacheControl(c.GetHeader("Cache-Control"))
+		if directives.noStore {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := rc.key(c, route)
+
+		if !directives.noCache && c.GetHeader("Pragma") != "no-cache" {
+			if entry, ok := rc.load(ctx, key); ok {
+				rc.serve(c, entry, "HIT")
+				c.Abort()
+				return
+			}
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		entry, ok := cachedResponseOf(w)
+		if !ok {
+			w.flush()
+			return
+		}
+
+		tags := []string{RouteTag(c.FullPath())}
+		if route.tags != nil {
+			tags = append(tags, route.tags(c)...)
+		}
+		if value, err := json.Marshal(entry); err == nil {
+			if err := rc.cache.SetWithTags(ctx, key, value, route.ttl, tags...); err != nil {
+				logger.WarnContext(ctx, "Failed to cache response", "path", c.FullPath(), "error", err)
+			}
+		}
+
+		rc.serve(c, entry, "MISS")
+	}
+}
+
+// cachedResponse 缓存的响应
+type cachedResponse struct {
+	Message      string          `json:"message"`
+	Data         json.RawMessage `json:"data"`
+	ETag         string          `json:"etag"`
+	LastModified int64           `json:"last_modified"`
+}
+
+// cachedResponseOf 从处理器的输出中提取可缓存的响应
+func cachedResponseOf(w *bufferedWriter) (*cachedResponse, bool) {
+	if w.status != http.StatusOK || parseCacheControl(w.Header().Get("Cache-Control")).noStore {
+		return nil, false
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return nil, false
+	}
+
+	var result response.Result[json.RawMessage]
+	if err := json.Unmarshal(w.body.Bytes(), &result); err != nil || result.Code != 0 {
+		return nil, false
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(result.Message))
+	sum.Write([]byte{0})
+	sum.Write(result.Data)
+	return &cachedResponse{
+		Message:      result.Message,
+		Data:         result.Data,
+		ETag:         `W/"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`,
+		LastModified: time.Now().Unix(),
+	}, true
+}
+
+// key 缓存键
+func (rc *ResponseCache) key(c *gin.Context, route cacheRoute) string {
+	var b strings.Builder
+	b.WriteString(c.FullPath())
+	for _, param := range c.Params {
+		b.WriteString("\x00" + param.Key + "=" + param.Value)
+	}
+	b.WriteString("\x00" + c.Request.URL.Query().Encode())
+	b.WriteString("\x00" + authScope(c, route.shared))
+	b.WriteString("\x00" + strings.ToLower(strings.TrimSpace(c.GetHeader("Accept-Language"))))
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// authScope 认证范围，未认证的请求共享public，认证用户按用户ID区分
+func authScope(c *gin.Context, shared bool) string {
+	userID := GetUserIDString(c)
+	switch {
+	case userID == "" && c.GetHeader("Authorization") == "":
+		return "public"
+	case shared:
+		return "shared"
+	default:
+		return "user:" + userID
+	}
+}
+
+// load 读取缓存的响应，读取失败时视为未命中
+func (rc *ResponseCache) load(ctx context.Context, key string) (*cachedResponse, bool) {
+	value, err := rc.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			logger.WarnContext(ctx, "Failed to read cached response", "error", err)
+		}
+		return nil, false
+	}
+
+	var entry cachedResponse
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// serve 输出响应，条件请求匹配时返回304
+func (rc *ResponseCache) serve(c *gin.Context, entry *cachedResponse, status string) {
+	header := c.Writer.Header()
+	header.Set("ETag", entry.ETag)
+	header.Set("Last-Modified", time.Unix(entry.LastModified, 0).UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", rc.cacheControl(c))
+	header.Set("Vary", "Accept-Language, Authorization")
+	header.Set("X-Cache", status)
+
+	if notModified(c.Request, entry) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	response.Success(c, entry.Data, entry.Message)
+}
+
+// cacheControl 响应的Cache-Control，认证用户的响应只允许客户端缓存
+func (rc *ResponseCache) cacheControl(c *gin.Context) string {
+	visibility := "public"
+	if authScope(c, false) != "public" {
+		visibility = "private"
+	}
+	if rc.maxAge <= 0 {
+		return visibility + ", no-cache"
+	}
+	return visibility + ", max-age=" + strconv.FormatInt(int64(rc.maxAge/time.Second), 10)
+}
+
+// notModified 判断条件请求是否匹配，If-None-Match优先于If-Modified-Since
+func notModified(r *http.Request, entry *cachedResponse) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(entry.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" {
+		t, err := http.ParseTime(since)
+		return err == nil && entry.LastModified <= t.Unix()
+	}
+	return false
+}
+
+// cacheControlDirectives 请求的Cache-Control指令
+type cacheControlDirectives struct {
+	noCache bool // 不使用缓存的响应，重新生成后更新缓存
+	noStore bool // 既不读取也不写入缓存
+}
+
+// parseCacheControl 解析Cache-Control，max-age=0视为no-cache
+func parseCacheControl(value string) cacheControlDirectives {
+	var d cacheControlDirectives
+	for _, directive := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "max-age=0":
+			d.noCache = true
+		case "no-store":
+			d.noStore = true
+		}
+	}
+	return d
+}
+
+// bufferedWriter 缓冲处理器的输出，处理器返回后再决定是否缓存和输出
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// Flush 缓冲期间不向客户端输出
+func (w *bufferedWriter) Flush() {}
+
+// flush 原样输出处理器的响应
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.ResponseWriter.Write(w.body.Bytes())
+}
@@ -121,4 +121,158 @@ func RegisterMigrations(migrator *Migrator) {
 			return tx.Where("username = ? AND is_admin = ?", username, true).Delete(&model.User{}).Error
 		},
 	})
+
+	// 添加文件衍生图表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180000",
+		Name:    "create_file_variant_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.FileVariant{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("file_variant")
+		},
+	})
+
+	// 添加文件校验和及内容去重表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180001",
+		Name:    "add_file_checksum_and_blob_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.File{}, &model.FileBlob{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("file_blob"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&model.File{}, "SHA256"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&model.File{}, "MD5")
+		},
+	})
+
+	// 添加存储配额表迁移，并按已有文件初始化用量
+	migrator.Register(&MigrationEntry{
+		Version: "202610180002",
+		Name:    "create_storage_quota_tables",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&model.StorageUsage{}, &model.StorageQuota{}); err != nil {
+				return err
+			}
+
+			var files []model.File
+			if err := tx.Select("uploaded_by", "usage", "size").Where("status = ?", model.FileStatusActive).Find(&files).Error; err != nil {
+				return fmt.Errorf("查询已有文件失败: %w", err)
+			}
+
+			usages := make(map[int64]map[string]*model.StorageUsage)
+			add := func(userID int64, usage string, size int64) {
+				if usages[userID] == nil {
+					usages[userID] = make(map[string]*model.StorageUsage)
+				}
+				u, ok := usages[userID][usage]
+				if !ok {
+					u = &model.StorageUsage{UserID: userID, FileUsage: usage}
+					usages[userID][usage] = u
+				}
+				u.Bytes += size
+				u.Files++
+			}
+			for _, f := range files {
+				add(f.UploadedBy, model.StorageUsageTotal, f.Size)
+				add(f.UploadedBy, f.Usage, f.Size)
+			}
+
+			for _, byUsage := range usages {
+				for _, u := range byUsage {
+					if err := tx.Create(u).Error; err != nil {
+						return fmt.Errorf("初始化存储用量失败: %w", err)
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("storage_quota", "storage_usage")
+		},
+	})
+
+	// 添加存储迁移进度表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180003",
+		Name:    "create_storage_migration_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.StorageMigration{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("storage_migration")
+		},
+	})
+
+	// 添加文件标签表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180004",
+		Name:    "create_file_tag_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.Tag{}, &model.FileTag{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("file_tag", "tag")
+		},
+	})
+
+	// 添加文件分享链接表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180005",
+		Name:    "create_file_share_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.FileShare{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("file_share")
+		},
+	})
+
+	// 添加文件回收站路径迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180006",
+		Name:    "add_file_trash_path",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.File{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&model.File{}, "TrashPath")
+		},
+	})
+
+	// 添加文件扫描结果迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180007",
+		Name:    "add_file_scan_result",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.File{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&model.File{}, "ScanResult"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&model.File{}, "ScannedAt")
+		},
+	})
+
+	// 添加文件版本表迁移
+	migrator.Register(&MigrationEntry{
+		Version: "202610180008",
+		Name:    "create_file_version_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.File{}, &model.FileVersion{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("file_version"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&model.File{}, "Version")
+		},
+	})
 }
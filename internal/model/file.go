@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/pkg/options"
 	"gorm.io/gorm"
 )
 
@@ -27,25 +28,41 @@ const (
 	FileUsageGeneral = "general" // 通用
 )
 
+// 文件状态
+const (
+	FileStatusDeleted     = -1 // 已删除（在回收站中）
+	FileStatusPending     = 0  // 待上传
+	FileStatusActive      = 1  // 正常
+	FileStatusQuarantined = 2  // 隔离中，等待扫描
+	FileStatusRejected    = 3  // 未通过扫描
+	FileStatusConfirming  = 4  // 确认中，正在处理客户端直传的内容
+)
+
 // File 文件模型
 type File struct {
 	UUIDModel
 
-	Name           string    `json:"name" gorm:"size:255;comment:文件名称"`
-	OriginalName   string    `json:"original_name" gorm:"size:255;comment:原始文件名"`
-	Path           string    `json:"path" gorm:"size:500;comment:存储路径"`
-	URL            string    `json:"url" gorm:"-"` // 计算字段，不存储到数据库
-	Type           string    `json:"type" gorm:"size:50;comment:文件类型"`
-	Usage          string    `json:"usage" gorm:"size:50;default:'general';comment:文件用途"`
-	Size           int64     `json:"size" gorm:"comment:文件大小(字节)"`
-	MimeType       string    `json:"mime_type" gorm:"size:100;comment:MIME类型"`
-	Extension      string    `json:"extension" gorm:"size:20;comment:扩展名"`
-	StorageType    string    `json:"storage_type" gorm:"size:20;comment:存储类型(local/s3/oss)"`
-	UploadedBy     int64     `json:"uploaded_by" gorm:"type:bigint;comment:上传者ID"`
-	UploadedByType uint8     `json:"uploaded_by_type" gorm:"size:20;default:1;comment:上传者类型(1:系统用户,2:普通用户)"`
-	UploadedAt     time.Time `json:"uploaded_at" gorm:"comment:上传时间"`
-	Status         int       `json:"status" gorm:"comment:状态(1:正常,0:禁用,-1:删除)"`
-	IsPublic       bool      `json:"is_public" gorm:"default:false;comment:是否公开访问"`
+	Name           string     `json:"name" gorm:"size:255;comment:文件名称"`
+	OriginalName   string     `json:"original_name" gorm:"size:255;comment:原始文件名"`
+	Path           string     `json:"path" gorm:"size:500;comment:存储路径"`
+	URL            string     `json:"url" gorm:"-"` // 计算字段，不存储到数据库
+	Type           string     `json:"type" gorm:"size:50;comment:文件类型"`
+	Usage          string     `json:"usage" gorm:"size:50;default:'general';comment:文件用途"`
+	Size           int64      `json:"size" gorm:"comment:文件大小(字节)"`
+	MimeType       string     `json:"mime_type" gorm:"size:100;comment:MIME类型"`
+	Extension      string     `json:"extension" gorm:"size:20;comment:扩展名"`
+	StorageType    string     `json:"storage_type" gorm:"size:20;comment:存储类型(local/s3/oss)"`
+	UploadedBy     int64      `json:"uploaded_by" gorm:"type:bigint;comment:上传者ID"`
+	UploadedByType uint8      `json:"uploaded_by_type" gorm:"size:20;default:1;comment:上传者类型(1:系统用户,2:普通用户)"`
+	UploadedAt     time.Time  `json:"uploaded_at" gorm:"comment:上传时间"`
+	Status         int        `json:"status" gorm:"comment:状态(1:正常,0:禁用,-1:删除,2:隔离中,3:未通过扫描,4:确认中)"`
+	IsPublic       bool       `json:"is_public" gorm:"default:false;comment:是否公开访问"`
+	SHA256         string     `json:"sha256" gorm:"size:64;index;comment:SHA-256摘要"`
+	MD5            string     `json:"md5" gorm:"size:32;comment:MD5摘要"`
+	TrashPath      string     `json:"-" gorm:"size:500;comment:回收站中的存储路径"`
+	ScanResult     string     `json:"scan_result,omitempty" gorm:"size:255;comment:扫描结果(未通过时为威胁描述)"`
+	ScannedAt      *time.Time `json:"scanned_at,omitempty" gorm:"comment:扫描时间"`
+	Version        int        `json:"version" gorm:"default:1;comment:当前版本号"`
 }
 
 func (File) TableName() string {
@@ -204,3 +221,267 @@ func (r *FileRepo) ListFiles(ctx context.Context, page, pageSize int, fileType,
 
 	return files, total, nil
 }
+
+// ListTrash 分页获取回收站中的文件，userID为0时返回全部用户的文件
+func (r *FileRepo) ListTrash(ctx context.Context, page, pageSize int, userID int64) ([]File, int64, error) {
+	query := r.DB.WithContext(ctx).Unscoped().Model(&File{}).Where("deleted_at IS NOT NULL AND trash_path <> ''")
+	if userID != 0 {
+		query = query.Where("uploaded_by = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errspec.ErrQueryFileTotal.New(ctx).Wrap(err)
+	}
+
+	var files []File
+	err := query.Order("deleted_at DESC").Order("id").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&files).Error
+	if err != nil {
+		return nil, 0, errspec.ErrQueryFileList.New(ctx).Wrap(err)
+	}
+
+	return files, total, nil
+}
+
+// GetTrashed 获取回收站中的文件，userID为0时不限制上传者，不存在时返回ErrFileNotFound
+func (r *FileRepo) GetTrashed(ctx context.Context, id string, userID int64) (*File, error) {
+	query := r.DB.WithContext(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL AND trash_path <> ''", id)
+	if userID != 0 {
+		query = query.Where("uploaded_by = ?", userID)
+	}
+
+	var file File
+	if err := query.First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errspec.ErrFileNotFound.New(ctx)
+		}
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	return &file, nil
+}
+
+// ListExpiredTrash 获取在回收站中超过保留时间的文件
+func (r *FileRepo) ListExpiredTrash(ctx context.Context, before time.Time, limit int) ([]File, error) {
+	var files []File
+	err := r.DB.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ? AND trash_path <> ''", before).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&files).Error
+	return files, err
+}
+
+// 文件列表允许的排序字段
+var fileSortFields = map[string]bool{
+	"created_at":    true,
+	"uploaded_at":   true,
+	"size":          true,
+	"original_name": true,
+}
+
+// 文档类文件的MIME类型前缀
+var documentMimePrefixes = []string{"text/", "application/pdf", "application/msword", "application/vnd."}
+
+// FileFilter 文件列表过滤条件
+type FileFilter struct {
+	UserID    int64      // 上传者ID
+	IDs       []string   // 文件ID列表
+	Usage     string     // 文件用途
+	Type      string     // 文件类型（image/document/video/audio/other），按MIME类型匹配
+	Keyword   string     // 原始文件名关键字
+	Tag       string     // 标签名称
+	IsPublic  *bool      // 是否公开
+	StartTime *time.Time // 上传时间起
+	EndTime   *time.Time // 上传时间止
+	SortBy    string     // 排序字段
+	SortDesc  bool       // 是否降序
+}
+
+// ListByFilter 按条件分页获取用户的有效文件列表
+func (r *FileRepo) ListByFilter(ctx context.Context, page, pageSize int, filter *FileFilter) ([]File, int64, error) {
+	opts := r.filterOptions(filter)
+
+	total, err := r.Count(ctx, opts)
+	if err != nil {
+		return nil, 0, errspec.ErrQueryUserFileTotal.New(ctx).Wrap(err)
+	}
+
+	// 排序只用于列表查询，计数查询不排序
+	sortBy := "created_at"
+	if fileSortFields[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	direction := "asc"
+	if filter.SortDesc {
+		direction = "desc"
+	}
+	opts.Opts = append(opts.Opts, options.WithOrder(sortBy, direction), options.WithOrder("id", direction))
+
+	files, err := r.List(ctx, page, pageSize, opts)
+	if err != nil {
+		return nil, 0, errspec.ErrQueryUserFileList.New(ctx).Wrap(err)
+	}
+
+	for i := range files {
+		if files[i].Path != "" {
+			files[i].URL = r.fileUtil.BuildFileURL(files[i].Path)
+		}
+	}
+
+	return files, total, nil
+}
+
+// FindByFilter 按条件获取有效文件，最多返回limit条，按上传时间升序
+func (r *FileRepo) FindByFilter(ctx context.Context, filter *FileFilter, limit int) ([]File, error) {
+	opts := r.filterOptions(filter)
+	opts.Opts = append(opts.Opts, options.WithOrder("created_at", "asc"), options.WithOrder("id", "asc"))
+
+	files, err := r.List(ctx, 1, limit, opts)
+	if err != nil {
+		return nil, errspec.ErrQueryUserFileList.New(ctx).Wrap(err)
+	}
+	return files, nil
+}
+
+// filterOptions 将过滤条件转换为查询选项，UserID为0时不限制上传者
+func (r *FileRepo) filterOptions(filter *FileFilter) *QueryOptions {
+	opts := &QueryOptions{
+		Condition: "status = ?",
+		Args:      []any{FileStatusActive},
+		Opts: []options.Option{
+			options.WithLike("original_name", filter.Keyword),
+			fileTypeOption(filter.Type),
+		},
+	}
+	if filter.UserID != 0 {
+		opts.Opts = append(opts.Opts, options.WithWhere("uploaded_by = ?", filter.UserID))
+	}
+	if len(filter.IDs) > 0 {
+		opts.Opts = append(opts.Opts, options.WithWhere("id IN ?", filter.IDs))
+	}
+	if filter.Usage != "" {
+		// usage为MySQL保留字，使用map条件由GORM负责转义
+		opts.Opts = append(opts.Opts, options.WithWhere(map[string]any{"usage": filter.Usage}))
+	}
+	if filter.Tag != "" {
+		// 标签按用户隔离，文件只会关联上传者自己的标签
+		tagQuery := r.DB.Table("file_tag").
+			Select("file_tag.file_id").
+			Joins("JOIN tag ON tag.id = file_tag.tag_id").
+			Where("tag.name = ?", filter.Tag)
+		if filter.UserID != 0 {
+			tagQuery = tagQuery.Where("tag.user_id = ?", filter.UserID)
+		}
+		opts.Opts = append(opts.Opts, options.WithWhere("id IN (?)", tagQuery))
+	}
+	if filter.IsPublic != nil {
+		opts.Opts = append(opts.Opts, options.WithWhere("is_public = ?", *filter.IsPublic))
+	}
+	if filter.StartTime != nil {
+		opts.Opts = append(opts.Opts, options.WithWhere("uploaded_at >= ?", *filter.StartTime))
+	}
+	if filter.EndTime != nil {
+		opts.Opts = append(opts.Opts, options.WithWhere("uploaded_at <= ?", *filter.EndTime))
+	}
+	return opts
+}
+
+// fileTypeOption 按文件类型生成MIME类型过滤条件
+func fileTypeOption(fileType string) options.Option {
+	return func(db *gorm.DB) *gorm.DB {
+		switch fileType {
+		case "":
+			return db
+		case FileTypeImage, FileTypeVideo, FileTypeAudio:
+			return db.Where("mime_type LIKE ?", fileType+"/%")
+		case FileTypeDocument:
+			return db.Where(documentMimeCondition(db))
+		case FileTypeOther:
+			return db.Not(documentMimeCondition(db)).
+				Where("mime_type NOT LIKE ? AND mime_type NOT LIKE ? AND mime_type NOT LIKE ?", "image/%", "video/%", "audio/%")
+		default:
+			// 未知类型不匹配任何文件
+			return db.Where("1 = 0")
+		}
+	}
+}
+
+// documentMimeCondition 文档类文件的MIME类型条件
+func documentMimeCondition(db *gorm.DB) *gorm.DB {
+	cond := db.Session(&gorm.Session{NewDB: true})
+	for i, prefix := range documentMimePrefixes {
+		if i == 0 {
+			cond = cond.Where("mime_type LIKE ?", prefix+"%")
+		} else {
+			cond = cond.Or("mime_type LIKE ?", prefix+"%")
+		}
+	}
+	return cond
+}
+
+// ListQuarantined 获取等待扫描的文件，扫描开始于staleBefore之前仍未完成的文件视为需要重新扫描
+func (r *FileRepo) ListQuarantined(ctx context.Context, staleBefore time.Time, limit int) ([]File, error) {
+	var files []File
+	err := r.DB.WithContext(ctx).
+		Where("status = ? AND (scanned_at IS NULL OR scanned_at < ?)", FileStatusQuarantined, staleBefore).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&files).Error
+	if err != nil {
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	return files, nil
+}
+
+// ClaimConfirm 认领待上传或隔离中的文件开始确认，认领时间早于staleBefore仍在确认中的文件可以重新认领
+// 文件已完成或正在被其他请求确认时返回false
+func (r *FileRepo) ClaimConfirm(ctx context.Context, file *File, staleBefore time.Time) (bool, error) {
+	result := r.DB.WithContext(ctx).Model(&File{}).
+		Where("id = ? AND (status IN ? OR (status = ? AND updated_at < ?))",
+			file.ID, []int{FileStatusPending, FileStatusQuarantined}, FileStatusConfirming, staleBefore).
+		Update("status", FileStatusConfirming)
+	if result.Error != nil {
+		return false, errspec.ErrDatabaseUpdate.New(ctx).Wrap(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FinishConfirm 将确认中的文件标记为正常，认领超时后已被其他请求完成时返回false
+func (r *FileRepo) FinishConfirm(ctx context.Context, file *File) (bool, error) {
+	result := r.DB.WithContext(ctx).Model(&File{}).
+		Where("id = ? AND status = ?", file.ID, FileStatusConfirming).
+		Update("status", FileStatusActive)
+	if result.Error != nil {
+		return false, errspec.ErrDatabaseUpdate.New(ctx).Wrap(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseConfirm 确认失败时将文件恢复为认领前的状态，以便重新确认
+func (r *FileRepo) ReleaseConfirm(ctx context.Context, file *File, status int) error {
+	err := r.DB.WithContext(ctx).Model(&File{}).
+		Where("id = ? AND status = ?", file.ID, FileStatusConfirming).
+		Update("status", status).Error
+	if err != nil {
+		return errspec.ErrDatabaseUpdate.New(ctx).Wrap(err)
+	}
+	return nil
+}
+
+// ClaimScan 标记文件开始扫描，文件已被其他实例认领时返回false
+func (r *FileRepo) ClaimScan(ctx context.Context, file *File, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+	result := r.DB.WithContext(ctx).Model(&File{}).
+		Where("id = ? AND status = ? AND (scanned_at IS NULL OR scanned_at < ?)", file.ID, FileStatusQuarantined, staleBefore).
+		Update("scanned_at", now)
+	if result.Error != nil {
+		return false, errspec.ErrDatabaseUpdate.New(ctx).Wrap(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	file.ScannedAt = &now
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"context"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+)
+
+// FileBlob 文件内容对象，相同内容的文件共享同一个存储对象
+// 在同一存储类型和可见范围内按SHA-256去重，RefCount记录引用该对象的文件数
+type FileBlob struct {
+	BaseModel
+
+	SHA256      string `json:"sha256" gorm:"size:64;not null;uniqueIndex:idx_file_blob_checksum;comment:SHA-256摘要"`
+	IsPublic    bool   `json:"is_public" gorm:"not null;default:false;uniqueIndex:idx_file_blob_checksum;comment:是否公开访问"`
+	StorageType string `json:"storage_type" gorm:"size:20;not null;uniqueIndex:idx_file_blob_checksum;comment:存储类型(local/s3/oss)"`
+	MD5         string `json:"md5" gorm:"size:32;comment:MD5摘要"`
+	Path        string `json:"path" gorm:"size:500;comment:存储路径"`
+	Size        int64  `json:"size" gorm:"comment:文件大小(字节)"`
+	RefCount    int    `json:"ref_count" gorm:"not null;default:0;comment:引用计数"`
+}
+
+func (FileBlob) TableName() string {
+	return "file_blob"
+}
+
+// FileBlobRepo 文件内容对象仓库
+type FileBlobRepo struct {
+	*GenericRepo[FileBlob]
+}
+
+// NewFileBlobRepo 创建文件内容对象仓库
+func NewFileBlobRepo(db *gorm.DB) *FileBlobRepo {
+	genericRepo := NewGenericRepo[FileBlob](db)
+	genericRepo.ErrorCode = errspec.ErrRecordNotExist.Code()
+
+	return &FileBlobRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// GetByChecksum 根据摘要和可见范围获取内容对象
+func (r *FileBlobRepo) GetByChecksum(ctx context.Context, sha256 string, isPublic bool, storageType string) (*FileBlob, error) {
+	return r.Get(ctx, nil, &QueryOptions{
+		Condition: "sha256 = ? AND is_public = ? AND storage_type = ?",
+		Args:      []any{sha256, isPublic, storageType},
+	})
+}
+
+// IncrRef 增加引用计数，对象不存在时返回ErrRecordNotExist
+func (r *FileBlobRepo) IncrRef(ctx context.Context, id uint) error {
+	result := r.DB.WithContext(ctx).Model(&FileBlob{}).Where("id = ?", id).
+		Update("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errspec.ErrRecordNotExist.New(ctx)
+	}
+	return nil
+}
+
+// DecrRef 减少引用计数，返回减少后的引用数
+func (r *FileBlobRepo) DecrRef(ctx context.Context, id uint) (int, error) {
+	db := r.DB.WithContext(ctx)
+	if err := db.Model(&FileBlob{}).Where("id = ? AND ref_count > 0", id).
+		Update("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+		return 0, err
+	}
+
+	var blob FileBlob
+	if err := db.Select("ref_count").First(&blob, id).Error; err != nil {
+		return 0, err
+	}
+	return blob.RefCount, nil
+}
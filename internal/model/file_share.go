@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+)
+
+// FileShare 文件分享链接
+type FileShare struct {
+	BaseModel
+
+	FileID         string     `json:"file_id" gorm:"type:varchar(36);not null;index;comment:文件ID"`
+	UserID         int64      `json:"user_id" gorm:"type:bigint;not null;index;comment:创建者ID"`
+	Token          string     `json:"token" gorm:"size:64;not null;uniqueIndex;comment:访问令牌"`
+	PasswordHash   string     `json:"-" gorm:"size:100;comment:访问密码哈希"`
+	ExpiresAt      *time.Time `json:"expires_at" gorm:"comment:过期时间"`
+	MaxDownloads   int        `json:"max_downloads" gorm:"default:0;comment:最大下载次数(0表示不限制)"`
+	DownloadCount  int        `json:"download_count" gorm:"default:0;comment:下载次数"`
+	AccessCount    int        `json:"access_count" gorm:"default:0;comment:访问次数"`
+	LastAccessedAt *time.Time `json:"last_accessed_at" gorm:"comment:最后访问时间"`
+	AllowedEmails  []string   `json:"allowed_emails" gorm:"type:text;serializer:json;comment:允许访问的邮箱"`
+	RevokedAt      *time.Time `json:"revoked_at" gorm:"comment:撤销时间"`
+}
+
+func (FileShare) TableName() string {
+	return "file_share"
+}
+
+// Expired 检查分享链接是否已过期
+func (s *FileShare) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// Exhausted 检查分享链接的下载次数是否已用尽
+func (s *FileShare) Exhausted() bool {
+	return s.MaxDownloads > 0 && s.DownloadCount >= s.MaxDownloads
+}
+
+// FileShareRepo 文件分享链接仓库
+type FileShareRepo struct {
+	*GenericRepo[FileShare]
+}
+
+// NewFileShareRepo 创建文件分享链接仓库
+func NewFileShareRepo(db *gorm.DB) *FileShareRepo {
+	genericRepo := NewGenericRepo[FileShare](db)
+	genericRepo.ErrorCode = errspec.ErrShareNotFound.Code()
+
+	return &FileShareRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// GetByToken 根据访问令牌获取未撤销的分享链接，不存在时返回ErrShareNotFound
+func (r *FileShareRepo) GetByToken(ctx context.Context, token string) (*FileShare, error) {
+	var share FileShare
+	err := r.DB.WithContext(ctx).Where("token = ? AND revoked_at IS NULL", token).First(&share).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errspec.ErrShareNotFound.New(ctx)
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+// ListByUser 获取用户创建的分享链接，fileID不为空时只返回该文件的分享链接
+func (r *FileShareRepo) ListByUser(ctx context.Context, userID int64, fileID string) ([]FileShare, error) {
+	query := r.DB.WithContext(ctx).Where("user_id = ?", userID)
+	if fileID != "" {
+		query = query.Where("file_id = ?", fileID)
+	}
+
+	var shares []FileShare
+	err := query.Order("id DESC").Find(&shares).Error
+	return shares, err
+}
+
+// Revoke 撤销用户的分享链接，不存在或已撤销时返回ErrShareNotFound
+func (r *FileShareRepo) Revoke(ctx context.Context, userID int64, id uint) error {
+	result := r.DB.WithContext(ctx).Model(&FileShare{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errspec.ErrShareNotFound.New(ctx)
+	}
+	return nil
+}
+
+// IncrAccess 增加访问次数并记录访问时间
+func (r *FileShareRepo) IncrAccess(ctx context.Context, id uint) error {
+	return r.DB.WithContext(ctx).Model(&FileShare{}).Where("id = ?", id).Updates(map[string]any{
+		"access_count":     gorm.Expr("access_count + 1"),
+		"last_accessed_at": time.Now(),
+	}).Error
+}
+
+// IncrDownload 在下载次数未用尽时增加下载次数，已用尽时返回ErrShareLimitReached
+// 条件更新保证并发下载时不会超出限制
+func (r *FileShareRepo) IncrDownload(ctx context.Context, id uint) error {
+	result := r.DB.WithContext(ctx).Model(&FileShare{}).
+		Where("id = ? AND (max_downloads = 0 OR download_count < max_downloads)", id).
+		Update("download_count", gorm.Expr("download_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errspec.ErrShareLimitReached.New(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag 用户文件标签，标签名称在用户范围内唯一
+type Tag struct {
+	BaseModel
+
+	UserID int64  `json:"user_id" gorm:"type:bigint;not null;uniqueIndex:idx_tag_user_name;comment:用户ID"`
+	Name   string `json:"name" gorm:"size:50;not null;uniqueIndex:idx_tag_user_name;comment:标签名称"`
+}
+
+func (Tag) TableName() string {
+	return "tag"
+}
+
+// FileTag 文件与标签的关联
+type FileTag struct {
+	FileID    string    `json:"file_id" gorm:"type:varchar(36);primaryKey;comment:文件ID"`
+	TagID     uint      `json:"tag_id" gorm:"primaryKey;index;comment:标签ID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (FileTag) TableName() string {
+	return "file_tag"
+}
+
+// TagCount 标签及使用该标签的文件数
+type TagCount struct {
+	Name  string `json:"name"`
+	Files int64  `json:"files"`
+}
+
+// TagRepo 文件标签仓库
+type TagRepo struct {
+	*GenericRepo[Tag]
+}
+
+// NewTagRepo 创建文件标签仓库
+func NewTagRepo(db *gorm.DB) *TagRepo {
+	genericRepo := NewGenericRepo[Tag](db)
+	genericRepo.ErrorCode = errspec.ErrRecordNotExist.Code()
+
+	return &TagRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// SetFileTags 替换文件的全部标签，并删除用户不再使用的标签
+func (r *TagRepo) SetFileTags(ctx context.Context, userID int64, fileID string, names []string) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tagIDs []uint
+		if len(names) > 0 {
+			tags := make([]Tag, len(names))
+			for i, name := range names {
+				tags[i] = Tag{UserID: userID, Name: name}
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+				return err
+			}
+
+			err := tx.Unscoped().Model(&Tag{}).
+				Where("user_id = ? AND name IN ?", userID, names).
+				Pluck("id", &tagIDs).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("file_id = ?", fileID).Delete(&FileTag{}).Error; err != nil {
+			return err
+		}
+
+		if len(tagIDs) > 0 {
+			links := make([]FileTag, len(tagIDs))
+			for i, id := range tagIDs {
+				links[i] = FileTag{FileID: fileID, TagID: id}
+			}
+			if err := tx.Create(&links).Error; err != nil {
+				return err
+			}
+		}
+
+		// 物理删除，避免软删除的记录占用唯一索引
+		return tx.Unscoped().
+			Where("user_id = ? AND id NOT IN (?)", userID, tx.Model(&FileTag{}).Select("tag_id")).
+			Delete(&Tag{}).Error
+	})
+}
+
+// ListByFiles 获取多个文件的标签，按文件ID分组
+func (r *TagRepo) ListByFiles(ctx context.Context, fileIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(fileIDs))
+	if len(fileIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		FileID string
+		Name   string
+	}
+	err := r.DB.WithContext(ctx).
+		Table("file_tag").
+		Select("file_tag.file_id, tag.name").
+		Joins("JOIN tag ON tag.id = file_tag.tag_id").
+		Where("file_tag.file_id IN ?", fileIDs).
+		Order("tag.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.FileID] = append(result[row.FileID], row.Name)
+	}
+	return result, nil
+}
+
+// ListByUser 获取用户的标签及使用该标签的有效文件数
+func (r *TagRepo) ListByUser(ctx context.Context, userID int64) ([]TagCount, error) {
+	var tags []TagCount
+	err := r.DB.WithContext(ctx).
+		Table("tag").
+		Select("tag.name, COUNT(file.id) AS files").
+		Joins("JOIN file_tag ON file_tag.tag_id = tag.id").
+		Joins("JOIN file ON file.id = file_tag.file_id AND file.deleted_at IS NULL AND file.status = ?", FileStatusActive).
+		Where("tag.user_id = ?", userID).
+		Group("tag.name").
+		Order("tag.name").
+		Scan(&tags).Error
+	return tags, err
+}
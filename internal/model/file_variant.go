@@ -0,0 +1,65 @@
+package model
+
+import (
+	"context"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+)
+
+// FileVariant 文件衍生图模型（缩略图、不同尺寸等）
+type FileVariant struct {
+	BaseModel
+
+	FileID      string `json:"file_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_file_variant_name;comment:原始文件ID"`
+	Name        string `json:"name" gorm:"size:50;not null;uniqueIndex:idx_file_variant_name;comment:规格名称"`
+	Path        string `json:"path" gorm:"size:500;comment:存储路径"`
+	URL         string `json:"url" gorm:"-"` // 计算字段，不存储到数据库
+	Width       int    `json:"width" gorm:"comment:宽度"`
+	Height      int    `json:"height" gorm:"comment:高度"`
+	Size        int64  `json:"size" gorm:"comment:文件大小(字节)"`
+	MimeType    string `json:"mime_type" gorm:"size:100;comment:MIME类型"`
+	StorageType string `json:"storage_type" gorm:"size:20;comment:存储类型(local/s3/oss)"`
+	IsPublic    bool   `json:"is_public" gorm:"default:false;comment:是否公开访问"`
+}
+
+func (FileVariant) TableName() string {
+	return "file_variant"
+}
+
+// FileVariantRepo 文件衍生图仓库
+type FileVariantRepo struct {
+	*GenericRepo[FileVariant]
+}
+
+// NewFileVariantRepo 创建文件衍生图仓库
+func NewFileVariantRepo(db *gorm.DB) *FileVariantRepo {
+	genericRepo := NewGenericRepo[FileVariant](db)
+	genericRepo.ErrorCode = errspec.ErrFileVariantNotFound.Code()
+
+	return &FileVariantRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// GetByFileAndName 根据文件ID和规格名称获取衍生图
+func (r *FileVariantRepo) GetByFileAndName(ctx context.Context, fileID, name string) (*FileVariant, error) {
+	return r.Get(ctx, nil, &QueryOptions{
+		Condition: "file_id = ? AND name = ?",
+		Args:      []any{fileID, name},
+	})
+}
+
+// ListByFile 获取文件的所有衍生图
+func (r *FileVariantRepo) ListByFile(ctx context.Context, fileID string) ([]FileVariant, error) {
+	var variants []FileVariant
+	if err := r.DB.WithContext(ctx).Where("file_id = ?", fileID).Find(&variants).Error; err != nil {
+		return nil, errspec.ErrQueryFileVariant.New(ctx).Wrap(err)
+	}
+	return variants, nil
+}
+
+// DeleteByFile 删除文件的所有衍生图记录
+func (r *FileVariantRepo) DeleteByFile(ctx context.Context, fileID string) error {
+	return r.DB.WithContext(ctx).Where("file_id = ?", fileID).Delete(&FileVariant{}).Error
+}
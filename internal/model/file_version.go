@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+)
+
+// FileVersion 文件的历史版本
+// 文件记录始终保存最新版本的内容，替换或恢复版本时将当前内容保存为历史版本
+type FileVersion struct {
+	BaseModel
+
+	FileID       string    `json:"file_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_file_version;comment:文件ID"`
+	Version      int       `json:"version" gorm:"not null;uniqueIndex:idx_file_version;comment:版本号"`
+	OriginalName string    `json:"original_name" gorm:"size:255;comment:原始文件名"`
+	Path         string    `json:"-" gorm:"size:500;comment:存储路径"`
+	Size         int64     `json:"size" gorm:"comment:文件大小(字节)"`
+	MimeType     string    `json:"mime_type" gorm:"size:100;comment:MIME类型"`
+	Extension    string    `json:"extension" gorm:"size:20;comment:扩展名"`
+	StorageType  string    `json:"storage_type" gorm:"size:20;comment:存储类型(local/s3/oss)"`
+	IsPublic     bool      `json:"is_public" gorm:"default:false;comment:是否公开访问"`
+	SHA256       string    `json:"sha256" gorm:"size:64;comment:SHA-256摘要"`
+	MD5          string    `json:"md5" gorm:"size:32;comment:MD5摘要"`
+	UploadedBy   int64     `json:"uploaded_by" gorm:"type:bigint;comment:上传者ID"`
+	UploadedAt   time.Time `json:"uploaded_at" gorm:"comment:上传时间"`
+}
+
+func (FileVersion) TableName() string {
+	return "file_version"
+}
+
+// FileVersionRepo 文件历史版本仓库
+type FileVersionRepo struct {
+	*GenericRepo[FileVersion]
+}
+
+// NewFileVersionRepo 创建文件历史版本仓库
+func NewFileVersionRepo(db *gorm.DB) *FileVersionRepo {
+	genericRepo := NewGenericRepo[FileVersion](db)
+	genericRepo.ErrorCode = errspec.ErrFileVersionNotFound.Code()
+
+	return &FileVersionRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// GetByFileAndVersion 根据文件ID和版本号获取历史版本
+func (r *FileVersionRepo) GetByFileAndVersion(ctx context.Context, fileID string, version int) (*FileVersion, error) {
+	return r.Get(ctx, nil, &QueryOptions{
+		Condition: "file_id = ? AND version = ?",
+		Args:      []any{fileID, version},
+	})
+}
+
+// ListByFile 获取文件的全部历史版本，按版本号从新到旧排序
+func (r *FileVersionRepo) ListByFile(ctx context.Context, fileID string) ([]FileVersion, error) {
+	var versions []FileVersion
+	err := r.DB.WithContext(ctx).Where("file_id = ?", fileID).Order("version DESC").Find(&versions).Error
+	if err != nil {
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	return versions, nil
+}
+
+// ListOutdated 获取超出保留数量的历史版本，keep为保留的最新历史版本数
+func (r *FileVersionRepo) ListOutdated(ctx context.Context, fileID string, keep int) ([]FileVersion, error) {
+	var versions []FileVersion
+	err := r.DB.WithContext(ctx).
+		Where("file_id = ?", fileID).
+		Order("version DESC").
+		Offset(keep).
+		Limit(-1).
+		Find(&versions).Error
+	if err != nil {
+		return nil, errspec.ErrQueryFile.New(ctx).Wrap(err)
+	}
+	return versions, nil
+}
+
+// Remove 物理删除历史版本记录，避免软删除的记录占用唯一索引
+func (r *FileVersionRepo) Remove(ctx context.Context, version *FileVersion) error {
+	return r.DB.WithContext(ctx).Unscoped().Delete(version).Error
+}
@@ -2,10 +2,12 @@ package model
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/limitcool/starter/internal/errspec"
 	"github.com/limitcool/starter/internal/pkg/options"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Entity 实体接口
@@ -34,9 +36,12 @@ type Repository[T Entity] interface {
 
 	// Get 根据ID或条件获取单个实体
 	// id: 实体ID，如果为nil，则使用condition和args
-	// opts: 查询选项，可以为nil
+	// opts: 查询选项，可以为nil；只按ID查询时可以使用查询缓存
 	Get(ctx context.Context, id any, opts *QueryOptions) (*T, error)
 
+	// GetByField 根据字段获取单个实体，字段为主键或唯一字段时可以使用查询缓存
+	GetByField(ctx context.Context, field string, value any) (*T, error)
+
 	// Update 更新实体
 	Update(ctx context.Context, entity *T) error
 
@@ -106,6 +111,13 @@ func (r *GenericRepo[T]) applyQueryOptions(query *gorm.DB, opts *QueryOptions) *
 
 // Get 根据ID或条件获取单个实体
 func (r *GenericRepo[T]) Get(ctx context.Context, id any, opts *QueryOptions) (*T, error) {
+	// 只按ID查询时使用查询缓存
+	if id != nil && opts == nil {
+		if entity, ok, err := r.cachedGet(ctx, id); ok {
+			return entity, r.wrapGetError(ctx, err)
+		}
+	}
+
 	var entity T
 
 	// 创建查询并应用选项
@@ -125,16 +137,44 @@ func (r *GenericRepo[T]) Get(ctx context.Context, id any, opts *QueryOptions) (*
 	}
 
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// 使用ErrorCode创建特定的错误
-			return nil, errspec.ErrRecordNotExist.New(ctx).Wrap(err)
-		}
+		return nil, r.wrapGetError(ctx, err)
+	}
+
+	return &entity, nil
+}
+
+// GetByField 根据字段获取单个实体，field为字段名或列名
+func (r *GenericRepo[T]) GetByField(ctx context.Context, field string, value any) (*T, error) {
+	var entity T
+	stmt := &gorm.Statement{DB: r.DB}
+	if err := stmt.Parse(&entity); err != nil {
 		return nil, err
 	}
+	f := stmt.Schema.LookUpField(field)
+	if f == nil || f.DBName == "" {
+		return nil, fmt.Errorf("model: %s has no field %s", stmt.Schema.Name, field)
+	}
+
+	if cached, ok, err := r.cachedGetByField(ctx, f, value); ok {
+		return cached, r.wrapGetError(ctx, err)
+	}
 
+	err := r.DB.WithContext(ctx).Where(clause.Eq{Column: clause.Column{Name: f.DBName}, Value: value}).First(&entity).Error
+	if err != nil {
+		return nil, r.wrapGetError(ctx, err)
+	}
 	return &entity, nil
 }
 
+// wrapGetError 将记录不存在转换为业务错误
+func (r *GenericRepo[T]) wrapGetError(ctx context.Context, err error) error {
+	if err == gorm.ErrRecordNotFound {
+		// 使用ErrorCode创建特定的错误
+		return errspec.ErrRecordNotExist.New(ctx).Wrap(err)
+	}
+	return err
+}
+
 // Update 更新实体
 func (r *GenericRepo[T]) Update(ctx context.Context, entity *T) error {
 	return r.DB.WithContext(ctx).Save(entity).Error
@@ -188,6 +228,7 @@ func (r *GenericRepo[T]) Count(ctx context.Context, opts *QueryOptions) (int64,
 }
 
 // Transaction 在事务中执行函数
+// 启用查询缓存时，事务中的更新和删除在提交后才失效缓存，回滚时不失效
 func (r *GenericRepo[T]) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
 	return r.DB.WithContext(ctx).Transaction(fn)
 }
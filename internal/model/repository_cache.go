@@ -0,0 +1,429 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// repoCachePluginName 查询缓存插件在gorm.Config.Plugins中的名称
+const repoCachePluginName = "repo_cache"
+
+// RepoCacheOptions 仓库查询缓存选项
+type RepoCacheOptions struct {
+	// DefaultTTL 未在Entities中配置的实体的过期时间，0表示只缓存Entities中的实体
+	DefaultTTL time.Duration
+
+	// Entities 按表名配置过期时间
+	Entities map[string]time.Duration
+}
+
+// RepoCache GORM插件，为GenericRepo按ID和唯一字段的查询提供读穿透缓存
+//
+// 缓存的实体带有标签 repo:{表名} 和 repo:{表名}:{主键}，更新和删除后由GORM回调失效：
+// 能确定主键时失效对应实体，否则失效整张表。事务中的查询不读写缓存，
+// 插件包装连接池，所有事务（包括直接使用db.Transaction和db.Begin开启的事务）都在提交后才失效缓存，回滚时不失效。
+// 实体以gob编码保存全部字段，包括json:"-"的字段，缓存是内部存储，不会作为响应返回。
+type RepoCache struct {
+	cache   cache.Cache
+	options RepoCacheOptions
+}
+
+// NewRepoCache 创建仓库查询缓存，通过db.Use注册后对该连接上的所有GenericRepo生效
+// 使用进程内缓存时失效只在当前实例生效，多实例部署应使用Redis缓存
+func NewRepoCache(c cache.Cache, opts RepoCacheOptions) *RepoCache {
+	return &RepoCache{
+		cache:   c,
+		options: opts,
+	}
+}
+
+// Name 实现gorm.Plugin
+func (p *RepoCache) Name() string {
+	return repoCachePluginName
+}
+
+// Initialize 实现gorm.Plugin，在所有更新和删除回调之后（包括默认事务提交之后）失效缓存
+// 连接池替换为cachePool，之后开启的事务记录待失效的标签，提交后失效
+func (p *RepoCache) Initialize(db *gorm.DB) error {
+	sqlDB, _ := db.DB()
+	pool := &cachePool{ConnPool: db.ConnPool, cache: p, db: sqlDB}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+
+	if err := db.Callback().Update().After("*").Register("repo_cache:invalidate", p.invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("*").Register("repo_cache:invalidate", p.invalidate)
+}
+
+// ttl 实体的过期时间，0表示不缓存
+func (p *RepoCache) ttl(table string) time.Duration {
+	if ttl, ok := p.options.Entities[table]; ok {
+		return ttl
+	}
+	return p.options.DefaultTTL
+}
+
+// invalidate 更新或删除后失效缓存的回调
+// 不缓存的实体同样失效，其他缓存可能带有实体的标签
+func (p *RepoCache) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	tags := changedTags(db.Statement)
+	if tx := cacheTxOf(db.Statement.ConnPool); tx != nil {
+		tx.add(tags...)
+		return
+	}
+	p.invalidateTags(db.Statement.Context, tags)
+}
+
+// invalidateTags 失效标签，失败时只记录日志，缓存最多在过期时间内返回旧值
+func (p *RepoCache) invalidateTags(ctx context.Context, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	if err := p.cache.InvalidateTags(ctx, tags...); err != nil {
+		logger.WarnContext(ctx, "Failed to invalidate repository cache", "tags", tags, "error", err)
+	}
+}
+
+// cachePool 包装数据库连接池，开启的事务使用cacheTx
+type cachePool struct {
+	gorm.ConnPool
+	cache *RepoCache
+	db    *sql.DB
+}
+
+// GetDBConn 实现gorm.GetDBConnector，使db.DB()返回原始连接
+func (c *cachePool) GetDBConn() (*sql.DB, error) {
+	return c.db, nil
+}
+
+// BeginTx 实现gorm.ConnPoolBeginner
+func (c *cachePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		tx  gorm.ConnPool
+		err error
+	)
+	switch beginner := c.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cacheTx{ConnPool: tx, cache: c.cache, db: c.db, ctx: context.WithoutCancel(ctx)}, nil
+}
+
+// cacheTx 事务连接，记录事务中更新和删除的实体，提交后失效
+// 嵌套事务（保存点）共享外层事务的记录，回滚到保存点时不移除，提交后多失效的实体只会重新加载
+type cacheTx struct {
+	gorm.ConnPool
+	cache *RepoCache
+	db    *sql.DB
+	ctx   context.Context
+
+	mu   sync.Mutex
+	tags []string
+}
+
+// add 记录提交后失效的标签
+func (t *cacheTx) add(tags ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tags = append(t.tags, tags...)
+}
+
+// take 取出记录的标签
+func (t *cacheTx) take() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tags := t.tags
+	t.tags = nil
+	return tags
+}
+
+// GetDBConn 实现gorm.GetDBConnector
+func (t *cacheTx) GetDBConn() (*sql.DB, error) {
+	return t.db, nil
+}
+
+// StmtContext 实现gorm.Tx，使预编译语句模式可以使用该事务
+func (t *cacheTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	return t.ConnPool.(gorm.Tx).StmtContext(ctx, stmt)
+}
+
+// Commit 提交事务，成功后失效事务中更新和删除的实体
+func (t *cacheTx) Commit() error {
+	if err := t.ConnPool.(gorm.TxCommitter).Commit(); err != nil {
+		t.take()
+		return err
+	}
+	t.cache.invalidateTags(t.ctx, t.take())
+	return nil
+}
+
+// Rollback 回滚事务，不失效缓存
+func (t *cacheTx) Rollback() error {
+	t.take()
+	return t.ConnPool.(gorm.TxCommitter).Rollback()
+}
+
+// cacheTxOf 语句所在的事务，不在事务中或事务不是在注册插件之后开启时返回nil
+func cacheTxOf(pool gorm.ConnPool) *cacheTx {
+	if prepared, ok := pool.(*gorm.PreparedStmtTX); ok {
+		pool = prepared.Tx
+	}
+	tx, _ := pool.(*cacheTx)
+	return tx
+}
+
+// repoCacheOf 连接上注册的查询缓存
+func repoCacheOf(db *gorm.DB) *RepoCache {
+	if plugin, ok := db.Config.Plugins[repoCachePluginName]; ok {
+		return plugin.(*RepoCache)
+	}
+	return nil
+}
+
+// inTransaction 是否在事务中
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// tableTag 整张表的标签
+func tableTag(table string) string {
+	return "repo:" + table
+}
+
+// entityTag 单个实体的标签
+func entityTag(table string, id any) string {
+	return fmt.Sprintf("repo:%s:%v", table, id)
+}
+
+// CacheTag 实体的缓存标签，实体通过GORM更新或删除后由RepoCache失效
+// 其他缓存（如HTTP响应缓存）带上该标签即可随实体失效，需要与RepoCache使用同一个缓存
+func CacheTag(table string, id any) string {
+	return entityTag(table, id)
+}
+
+// TableCacheTag 整张表的缓存标签，无法确定主键的批量更新和删除后由RepoCache失效
+// 带有CacheTag的其他缓存应同时带上该标签
+func TableCacheTag(table string) string {
+	return tableTag(table)
+}
+
+// changedTags 语句影响的实体的标签，无法确定主键时返回整张表的标签
+func changedTags(stmt *gorm.Statement) []string {
+	table := stmt.Schema.Table
+	ids, ok := statementIDs(stmt)
+	if !ok || len(ids) == 0 {
+		return []string{tableTag(table)}
+	}
+
+	tags := make([]string, len(ids))
+	for i, id := range ids {
+		tags[i] = entityTag(table, id)
+	}
+	return tags
+}
+
+// statementIDs 从模型的主键或WHERE中的主键条件确定语句影响的实体
+func statementIDs(stmt *gorm.Statement) ([]any, bool) {
+	field := primaryField(stmt.Schema)
+	if field == nil {
+		return nil, false
+	}
+
+	// 模型带有主键，如Save(&user)
+	var ids []any
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Struct:
+		if id, zero := field.ValueOf(stmt.Context, rv); !zero {
+			ids = append(ids, id)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			id, zero := field.ValueOf(stmt.Context, reflect.Indirect(rv.Index(i)))
+			if zero {
+				return nil, false
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	// WHERE中的主键条件，如Delete(&User{}, id)或Where("id = ?", id)
+	where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return ids, len(ids) > 0
+	}
+	for _, expr := range where.Exprs {
+		values, ok := primaryKeyValues(expr, field)
+		if !ok {
+			continue
+		}
+		// 模型的主键和WHERE条件同时存在时以WHERE为准，只影响两者的交集，失效两者的并集更保守
+		ids = append(ids, values...)
+	}
+	return ids, len(ids) > 0
+}
+
+// primaryKeyValues 主键条件中的值
+func primaryKeyValues(expr clause.Expression, field *schema.Field) ([]any, bool) {
+	isPrimary := func(column any) bool {
+		switch c := column.(type) {
+		case clause.Column:
+			return c.Name == clause.PrimaryKey || c.Name == field.DBName
+		case string:
+			return c == field.DBName
+		}
+		return false
+	}
+
+	switch e := expr.(type) {
+	case clause.Eq:
+		if isPrimary(e.Column) {
+			return []any{e.Value}, true
+		}
+	case clause.IN:
+		if isPrimary(e.Column) {
+			return e.Values, true
+		}
+	case clause.Expr:
+		sql := strings.NewReplacer("`", "", `"`, "", " ", "").Replace(e.SQL)
+		if len(e.Vars) == 1 && (sql == field.DBName+"=?" || sql == field.Schema.Table+"."+field.DBName+"=?") {
+			return []any{e.Vars[0]}, true
+		}
+	}
+	return nil, false
+}
+
+// primaryField 单一主键，联合主键不缓存
+func primaryField(s *schema.Schema) *schema.Field {
+	if s == nil || len(s.PrimaryFields) != 1 {
+		return nil
+	}
+	return s.PrimaryFields[0]
+}
+
+// cachedGet 按主键读取实体，未启用缓存、在事务中或实体未配置缓存时返回false
+func (r *GenericRepo[T]) cachedGet(ctx context.Context, id any) (*T, bool, error) {
+	p, s := r.cacheFor()
+	if p == nil {
+		return nil, false, nil
+	}
+
+	entity, err := r.loadByID(ctx, p, s, id)
+	return entity, true, err
+}
+
+// cacheFor 当前仓库可用的查询缓存和实体的模型信息
+func (r *GenericRepo[T]) cacheFor() (*RepoCache, *schema.Schema) {
+	p := repoCacheOf(r.DB)
+	if p == nil || inTransaction(r.DB) {
+		return nil, nil
+	}
+
+	var entity T
+	stmt := &gorm.Statement{DB: r.DB}
+	if err := stmt.Parse(&entity); err != nil || primaryField(stmt.Schema) == nil || p.ttl(stmt.Schema.Table) <= 0 {
+		return nil, nil
+	}
+	return p, stmt.Schema
+}
+
+// loadByID 通过缓存按主键读取实体，不缓存不存在的结果
+func (r *GenericRepo[T]) loadByID(ctx context.Context, p *RepoCache, s *schema.Schema, id any) (*T, error) {
+	key := fmt.Sprintf("repo:%s:id:%v", s.Table, id)
+	entities := cache.NewTypedCache[T](p.cache, cache.WithCodec(cache.GobCodec))
+
+	entity, err := entities.GetOrLoad(ctx, key, func(ctx context.Context) (T, error) {
+		var entity T
+		err := r.DB.WithContext(ctx).First(&entity, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return entity, cache.ErrNotFound
+		}
+		return entity, err
+	}, p.ttl(s.Table), cache.WithNilValueTTL(0), cache.WithTags(tableTag(s.Table), entityTag(s.Table, id)))
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// cachedGetByField 按唯一字段读取实体，缓存唯一字段到主键的映射，读取实体后校验字段值
+// 字段不是唯一字段时返回false
+func (r *GenericRepo[T]) cachedGetByField(ctx context.Context, field *schema.Field, value any) (*T, bool, error) {
+	p, s := r.cacheFor()
+	if p == nil || !(field.Unique || field.PrimaryKey) {
+		return nil, false, nil
+	}
+	if field.PrimaryKey {
+		entity, err := r.loadByID(ctx, p, s, value)
+		return entity, true, err
+	}
+
+	key := fmt.Sprintf("repo:%s:%s:%v", s.Table, field.DBName, value)
+	id, err := p.cache.GetOrLoad(ctx, key, func(ctx context.Context) ([]byte, error) {
+		var entity T
+		err := r.DB.WithContext(ctx).Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value}).First(&entity).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cache.ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, _ := primaryField(s).ValueOf(ctx, reflect.ValueOf(&entity).Elem())
+		return fmt.Append(nil, id), nil
+	}, p.ttl(s.Table), cache.WithNilValueTTL(0), cache.WithTags(tableTag(s.Table)))
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil, true, gorm.ErrRecordNotFound
+		}
+		return nil, true, err
+	}
+
+	// 按主键的类型读取实体，字段值已被修改或实体已删除时映射过期，删除后直接查询数据库
+	var target T
+	pk := primaryField(s)
+	if err := pk.Set(ctx, reflect.ValueOf(&target).Elem(), string(id)); err != nil {
+		return nil, true, err
+	}
+	typedID, _ := pk.ValueOf(ctx, reflect.ValueOf(&target).Elem())
+
+	entity, err := r.loadByID(ctx, p, s, typedID)
+	if err == nil {
+		current, _ := field.ValueOf(ctx, reflect.ValueOf(entity).Elem())
+		if fmt.Sprint(current) == fmt.Sprint(value) {
+			return entity, true, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, true, err
+	}
+	if err := p.cache.Delete(ctx, key); err != nil {
+		logger.WarnContext(ctx, "Failed to delete repository cache", "key", key, "error", err)
+	}
+	return nil, false, nil
+}
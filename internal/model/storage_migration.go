@@ -0,0 +1,82 @@
+package model
+
+import (
+	"context"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 存储迁移状态
+const (
+	StorageMigrationPending = "pending" // 待迁移
+	StorageMigrationDone    = "done"    // 已完成
+	StorageMigrationFailed  = "failed"  // 失败
+)
+
+// StorageMigration 存储迁移进度，每个存储对象一条记录，用于中断后继续迁移
+type StorageMigration struct {
+	BaseModel
+
+	Source        string `json:"source" gorm:"size:20;not null;uniqueIndex:idx_storage_migration_object;comment:源存储类型"`
+	Target        string `json:"target" gorm:"size:20;not null;uniqueIndex:idx_storage_migration_object;comment:目标存储类型"`
+	Path          string `json:"path" gorm:"size:500;not null;uniqueIndex:idx_storage_migration_object;comment:存储路径"`
+	IsPublic      bool   `json:"is_public" gorm:"not null;default:false;uniqueIndex:idx_storage_migration_object;comment:是否公开访问"`
+	Status        string `json:"status" gorm:"size:20;not null;default:'pending';index;comment:状态(pending/done/failed)"`
+	SHA256        string `json:"sha256" gorm:"size:64;comment:SHA-256摘要"`
+	Size          int64  `json:"size" gorm:"comment:文件大小(字节)"`
+	SourceDeleted bool   `json:"source_deleted" gorm:"not null;default:false;comment:是否已删除源文件"`
+	Error         string `json:"error" gorm:"size:1000;comment:错误信息"`
+}
+
+func (StorageMigration) TableName() string {
+	return "storage_migration"
+}
+
+// StorageMigrationRepo 存储迁移进度仓库
+type StorageMigrationRepo struct {
+	*GenericRepo[StorageMigration]
+}
+
+// NewStorageMigrationRepo 创建存储迁移进度仓库
+func NewStorageMigrationRepo(db *gorm.DB) *StorageMigrationRepo {
+	genericRepo := NewGenericRepo[StorageMigration](db)
+	genericRepo.ErrorCode = errspec.ErrRecordNotExist.Code()
+
+	return &StorageMigrationRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// GetOrCreate 获取存储对象的迁移进度，不存在时创建待迁移记录
+func (r *StorageMigrationRepo) GetOrCreate(ctx context.Context, source, target, path string, isPublic bool) (*StorageMigration, error) {
+	item := &StorageMigration{
+		Source:   source,
+		Target:   target,
+		Path:     path,
+		IsPublic: isPublic,
+		Status:   StorageMigrationPending,
+	}
+
+	db := r.DB.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(item).Error; err != nil {
+		return nil, err
+	}
+
+	err := db.Where("source = ? AND target = ? AND path = ? AND is_public = ?", source, target, path, isPublic).
+		First(item).Error
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ListPendingSourceDeletion 获取已完成迁移但尚未删除源文件的记录
+func (r *StorageMigrationRepo) ListPendingSourceDeletion(ctx context.Context, source, target string) ([]StorageMigration, error) {
+	var items []StorageMigration
+	err := r.DB.WithContext(ctx).
+		Where("source = ? AND target = ? AND status = ? AND source_deleted = ?", source, target, StorageMigrationDone, false).
+		Find(&items).Error
+	return items, err
+}
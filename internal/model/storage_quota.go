@@ -0,0 +1,140 @@
+package model
+
+import (
+	"context"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StorageUsageTotal 表示用户全部文件的汇总（不区分文件用途）
+const StorageUsageTotal = "*"
+
+// StorageUsage 用户存储用量，每个用户一条汇总记录及每个文件用途一条记录
+type StorageUsage struct {
+	BaseModel
+
+	UserID    int64  `json:"user_id" gorm:"type:bigint;not null;uniqueIndex:idx_storage_usage_user;comment:用户ID"`
+	FileUsage string `json:"file_usage" gorm:"size:50;not null;uniqueIndex:idx_storage_usage_user;comment:文件用途(*表示汇总)"`
+	Bytes     int64  `json:"bytes" gorm:"not null;default:0;comment:已用字节数"`
+	Files     int64  `json:"files" gorm:"not null;default:0;comment:文件数"`
+}
+
+func (StorageUsage) TableName() string {
+	return "storage_usage"
+}
+
+// StorageQuota 管理员为用户单独设置的存储配额，覆盖配置文件中的配额
+type StorageQuota struct {
+	BaseModel
+
+	UserID    int64  `json:"user_id" gorm:"type:bigint;not null;uniqueIndex:idx_storage_quota_user;comment:用户ID"`
+	FileUsage string `json:"file_usage" gorm:"size:50;not null;uniqueIndex:idx_storage_quota_user;comment:文件用途(*表示总配额)"`
+	MaxBytes  int64  `json:"max_bytes" gorm:"not null;default:0;comment:最大字节数(0表示不限制)"`
+	MaxFiles  int64  `json:"max_files" gorm:"not null;default:0;comment:最大文件数(0表示不限制)"`
+}
+
+func (StorageQuota) TableName() string {
+	return "storage_quota"
+}
+
+// StorageUsageRepo 存储用量仓库
+type StorageUsageRepo struct {
+	*GenericRepo[StorageUsage]
+}
+
+// NewStorageUsageRepo 创建存储用量仓库
+func NewStorageUsageRepo(db *gorm.DB) *StorageUsageRepo {
+	genericRepo := NewGenericRepo[StorageUsage](db)
+	genericRepo.ErrorCode = errspec.ErrRecordNotExist.Code()
+
+	return &StorageUsageRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// ListByUser 获取用户的全部用量记录
+func (r *StorageUsageRepo) ListByUser(ctx context.Context, userID int64) ([]StorageUsage, error) {
+	var usages []StorageUsage
+	if err := r.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&usages).Error; err != nil {
+		return nil, errspec.ErrQueryStorageUsage.New(ctx).Wrap(err)
+	}
+	return usages, nil
+}
+
+// Add 增加用量，maxBytes/maxFiles大于0时仅在增加后不超过限制才会更新
+// 返回是否更新成功，未更新说明超出限制
+func (r *StorageUsageRepo) Add(ctx context.Context, userID int64, usage string, bytes, maxBytes, maxFiles int64) (bool, error) {
+	db := r.DB.WithContext(ctx)
+
+	// 确保用量记录存在，并发创建时忽略冲突
+	record := &StorageUsage{UserID: userID, FileUsage: usage}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record).Error; err != nil {
+		return false, err
+	}
+
+	query := db.Model(&StorageUsage{}).Where("user_id = ? AND file_usage = ?", userID, usage)
+	if maxBytes > 0 {
+		query = query.Where("bytes + ? <= ?", bytes, maxBytes)
+	}
+	if maxFiles > 0 {
+		query = query.Where("files + 1 <= ?", maxFiles)
+	}
+
+	result := query.Updates(map[string]any{
+		"bytes": gorm.Expr("bytes + ?", bytes),
+		"files": gorm.Expr("files + 1"),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Subtract 减少用量，不会减到0以下
+func (r *StorageUsageRepo) Subtract(ctx context.Context, userID int64, usage string, bytes int64) error {
+	return r.DB.WithContext(ctx).Model(&StorageUsage{}).
+		Where("user_id = ? AND file_usage = ?", userID, usage).
+		Updates(map[string]any{
+			"bytes": gorm.Expr("CASE WHEN bytes > ? THEN bytes - ? ELSE 0 END", bytes, bytes),
+			"files": gorm.Expr("CASE WHEN files > 0 THEN files - 1 ELSE 0 END"),
+		}).Error
+}
+
+// StorageQuotaRepo 存储配额仓库
+type StorageQuotaRepo struct {
+	*GenericRepo[StorageQuota]
+}
+
+// NewStorageQuotaRepo 创建存储配额仓库
+func NewStorageQuotaRepo(db *gorm.DB) *StorageQuotaRepo {
+	genericRepo := NewGenericRepo[StorageQuota](db)
+	genericRepo.ErrorCode = errspec.ErrRecordNotExist.Code()
+
+	return &StorageQuotaRepo{
+		GenericRepo: genericRepo,
+	}
+}
+
+// ListByUser 获取用户的全部单独配额
+func (r *StorageQuotaRepo) ListByUser(ctx context.Context, userID int64) ([]StorageQuota, error) {
+	var quotas []StorageQuota
+	if err := r.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&quotas).Error; err != nil {
+		return nil, errspec.ErrQueryStorageUsage.New(ctx).Wrap(err)
+	}
+	return quotas, nil
+}
+
+// Upsert 创建或更新用户的单独配额
+func (r *StorageQuotaRepo) Upsert(ctx context.Context, quota *StorageQuota) error {
+	return r.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "file_usage"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_bytes", "max_files", "updated_at"}),
+	}).Create(quota).Error
+}
+
+// DeleteByUserAndUsage 删除用户的单独配额（物理删除，便于之后重新设置）
+func (r *StorageQuotaRepo) DeleteByUserAndUsage(ctx context.Context, userID int64, usage string) error {
+	return r.DB.WithContext(ctx).Unscoped().Where("user_id = ? AND file_usage = ?", userID, usage).Delete(&StorageQuota{}).Error
+}
@@ -96,10 +96,7 @@ func (r *UserRepo) GetUserWithAvatar(ctx context.Context, id int64) (*User, erro
 
 // GetByUsername 根据用户名获取用户
 func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*User, error) {
-	user, err := r.Get(ctx, nil, &QueryOptions{
-		Condition: "username = ?",
-		Args:      []any{username},
-	})
+	user, err := r.GetByField(ctx, "username", username)
 	if err != nil {
 		if errspec.ErrNotFound.Is(err) {
 			return nil, errspec.ErrNotFound.New(ctx)
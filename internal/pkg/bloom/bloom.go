@@ -0,0 +1,113 @@
+// Package bloom 布隆过滤器，用于在查询缓存和数据库之前排除一定不存在的元素
+//
+// 过滤器在第一次 Rebuild 完成之前视为未就绪，Test 对所有元素返回true，
+// 避免启动阶段的空过滤器把存在的数据误判为不存在。
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// Filter 布隆过滤器
+// Test返回false时元素一定没有添加过，返回true时元素可能存在（误判率由创建时的参数决定）
+type Filter interface {
+	// Add 添加元素，重建期间添加的元素同时写入新的过滤器
+	Add(ctx context.Context, items ...string) error
+
+	// Test 判断元素是否可能存在，未就绪时返回true
+	Test(ctx context.Context, item string) (bool, error)
+
+	// Rebuild 从数据源重建过滤器，完成后原子替换旧的过滤器，source为nil时重建为空过滤器
+	Rebuild(ctx context.Context, source Source) error
+
+	// Ready 是否已完成第一次重建
+	Ready(ctx context.Context) (bool, error)
+}
+
+// Source 数据源，遍历所有应加入过滤器的元素，通过add分批添加
+type Source func(ctx context.Context, add func(items ...string) error) error
+
+// Estimate 按预计元素数量和误判率计算位数组大小m和哈希函数个数k
+func Estimate(n uint64, p float64) (m uint64, k uint32) {
+	if n == 0 {
+		n = 1
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k = uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	return max(m, 1), max(k, 1)
+}
+
+// params 过滤器参数
+type params struct {
+	m uint64 // 位数
+	k uint32 // 哈希函数个数
+}
+
+// newParams 校验参数并计算过滤器大小
+func newParams(n uint64, p float64) (params, error) {
+	if p <= 0 || p >= 1 {
+		return params{}, fmt.Errorf("bloom: false positive rate must be in (0, 1), got %v", p)
+	}
+	m, k := Estimate(n, p)
+	return params{m: m, k: k}, nil
+}
+
+// locations 元素对应的k个位置，使用128位FNV-1a的两半做双重哈希，不同进程计算结果一致
+func (p params) locations(item string) []uint64 {
+	h := fnv.New128a()
+	h.Write([]byte(item))
+	var sum [16]byte
+	h.Sum(sum[:0])
+
+	var h1, h2 uint64
+	for i := range 8 {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	h2 |= 1
+
+	locs := make([]uint64, p.k)
+	for i := range locs {
+		locs[i] = (h1 + uint64(i)*h2) % p.m
+	}
+	return locs
+}
+
+// Schedule 立即重建一次过滤器，之后每隔interval重建，直到ctx取消
+// 重建失败只记录日志，过滤器保持之前的内容；interval为0时只在启动时重建
+func Schedule(ctx context.Context, f Filter, source Source, interval time.Duration) {
+	rebuild := func() {
+		start := time.Now()
+		if err := f.Rebuild(ctx, source); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				logger.ErrorContext(ctx, "Bloom filter rebuild failed", "error", err)
+			}
+			return
+		}
+		logger.InfoContext(ctx, "Bloom filter rebuilt", "elapsed", time.Since(start))
+	}
+
+	rebuild()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rebuild()
+		}
+	}
+}
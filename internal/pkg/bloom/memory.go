@@ -0,0 +1,124 @@
+package bloom
+
+import (
+	"context"
+	"sync"
+)
+
+// bitset 位数组
+type bitset []uint64
+
+func newBitset(m uint64) bitset {
+	return make(bitset, (m+63)/64)
+}
+
+func (b bitset) set(loc uint64) {
+	b[loc/64] |= 1 << (loc % 64)
+}
+
+func (b bitset) has(loc uint64) bool {
+	return b[loc/64]&(1<<(loc%64)) != 0
+}
+
+// MemoryFilter 进程内的布隆过滤器
+type MemoryFilter struct {
+	params
+	mu         sync.RWMutex
+	bits       bitset // 当前的过滤器，未就绪时为nil
+	rebuilding bitset // 重建中的过滤器
+	generation uint64 // 重建的序号，并发重建时以最后开始的为准
+}
+
+var _ Filter = (*MemoryFilter)(nil)
+
+// NewMemoryFilter 按预计元素数量n和误判率p创建进程内的布隆过滤器
+func NewMemoryFilter(n uint64, p float64) (*MemoryFilter, error) {
+	params, err := newParams(n, p)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryFilter{params: params}, nil
+}
+
+// Add 添加元素
+func (f *MemoryFilter) Add(ctx context.Context, items ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, item := range items {
+		for _, loc := range f.locations(item) {
+			if f.bits != nil {
+				f.bits.set(loc)
+			}
+			if f.rebuilding != nil {
+				f.rebuilding.set(loc)
+			}
+		}
+	}
+	return nil
+}
+
+// Test 判断元素是否可能存在
+func (f *MemoryFilter) Test(ctx context.Context, item string) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.bits == nil {
+		return true, nil
+	}
+	for _, loc := range f.locations(item) {
+		if !f.bits.has(loc) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Rebuild 从数据源重建过滤器
+func (f *MemoryFilter) Rebuild(ctx context.Context, source Source) error {
+	next := newBitset(f.m)
+	f.mu.Lock()
+	f.rebuilding = next
+	f.generation++
+	generation := f.generation
+	f.mu.Unlock()
+
+	add := func(items ...string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, item := range items {
+			for _, loc := range f.locations(item) {
+				next.set(loc)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if source != nil {
+		err = source(ctx, add)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.generation != generation {
+		return err
+	}
+	f.rebuilding = nil
+	if err != nil {
+		return err
+	}
+	f.bits = next
+	return nil
+}
+
+// Ready 是否已完成第一次重建
+func (f *MemoryFilter) Ready(ctx context.Context) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.bits != nil, nil
+}
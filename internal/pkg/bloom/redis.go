@@ -0,0 +1,147 @@
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// maxRedisBits Redis字符串的最大位数（512MB）
+const maxRedisBits = 1 << 32
+
+// addScript 只向已存在的位图写入，过滤器未就绪时不创建位图，重建期间同时写入新的位图
+var addScript = redis.NewScript(`
+local live = redis.call("exists", KEYS[1]) == 1
+local next = redis.call("exists", KEYS[2]) == 1
+for i = 1, #ARGV do
+	if live then redis.call("setbit", KEYS[1], ARGV[i], 1) end
+	if next then redis.call("setbit", KEYS[2], ARGV[i], 1) end
+end
+return 0
+`)
+
+// RedisFilter 基于Redis位图的布隆过滤器，多个实例共享
+// 位图保存在key，重建时先写入临时键再RENAME替换；两个键使用相同的哈希标签，集群模式下位于同一个槽
+type RedisFilter struct {
+	params
+	client     redis.UniversalClient
+	key        string
+	rebuildKey string
+}
+
+var _ Filter = (*RedisFilter)(nil)
+
+// NewRedisFilter 按预计元素数量n和误判率p创建Redis位图布隆过滤器
+// 同一个key的所有实例必须使用相同的n和p
+func NewRedisFilter(client redis.UniversalClient, key string, n uint64, p float64) (*RedisFilter, error) {
+	params, err := newParams(n, p)
+	if err != nil {
+		return nil, err
+	}
+	if params.m > maxRedisBits {
+		return nil, fmt.Errorf("bloom: filter needs %d bits, exceeds Redis limit %d", params.m, uint64(maxRedisBits))
+	}
+
+	return &RedisFilter{
+		params:     params,
+		client:     client,
+		key:        key,
+		rebuildKey: rebuildKey(key),
+	}, nil
+}
+
+// rebuildKey 重建使用的临时键，与key位于同一个集群槽
+// key没有哈希标签时以整个key作为标签，"{k}:rebuild"与"k"的槽相同
+func rebuildKey(key string) string {
+	if open := strings.IndexByte(key, '{'); open >= 0 && strings.IndexByte(key[open+1:], '}') > 0 {
+		return key + ":rebuild"
+	}
+	return "{" + key + "}:rebuild"
+}
+
+// Add 添加元素
+func (f *RedisFilter) Add(ctx context.Context, items ...string) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(items)*int(f.k))
+	for _, item := range items {
+		for _, loc := range f.locations(item) {
+			args = append(args, loc)
+		}
+	}
+	return addScript.Run(ctx, f.client, []string{f.key, f.rebuildKey}, args...).Err()
+}
+
+// Test 判断元素是否可能存在，位图不存在（未就绪）时返回true
+func (f *RedisFilter) Test(ctx context.Context, item string) (bool, error) {
+	pipe := f.client.Pipeline()
+	exists := pipe.Exists(ctx, f.key)
+	locs := f.locations(item)
+	bits := make([]*redis.IntCmd, len(locs))
+	for i, loc := range locs {
+		bits[i] = pipe.GetBit(ctx, f.key, int64(loc))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	if exists.Val() == 0 {
+		return true, nil
+	}
+	for _, bit := range bits {
+		if bit.Val() == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Rebuild 从数据源重建过滤器
+// 先创建完整大小的临时位图，之后Add同时写入临时位图，数据源写入完成后替换当前位图
+func (f *RedisFilter) Rebuild(ctx context.Context, source Source) error {
+	pipe := f.client.TxPipeline()
+	pipe.Del(ctx, f.rebuildKey)
+	pipe.SetBit(ctx, f.rebuildKey, int64(f.m-1), 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("bloom: create %s: %w", f.rebuildKey, err)
+	}
+
+	add := func(items ...string) error {
+		if len(items) == 0 {
+			return nil
+		}
+		pipe := f.client.Pipeline()
+		for _, item := range items {
+			for _, loc := range f.locations(item) {
+				pipe.SetBit(ctx, f.rebuildKey, int64(loc), 1)
+			}
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+
+	if source != nil {
+		if err := source(ctx, add); err != nil {
+			f.client.Del(context.WithoutCancel(ctx), f.rebuildKey)
+			return err
+		}
+	}
+
+	if err := f.client.Rename(ctx, f.rebuildKey, f.key).Err(); err != nil {
+		return fmt.Errorf("bloom: replace %s: %w", f.key, err)
+	}
+	return nil
+}
+
+// Ready 位图是否存在
+func (f *RedisFilter) Ready(ctx context.Context) (bool, error) {
+	n, err := f.client.Exists(ctx, f.key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
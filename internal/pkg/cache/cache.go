@@ -9,40 +9,53 @@ import (
 type Cache interface {
 	// Get 获取缓存
 	Get(ctx context.Context, key string) ([]byte, error)
-	
+
 	// Set 设置缓存
 	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
-	
+
 	// Delete 删除缓存
 	Delete(ctx context.Context, key string) error
-	
+
 	// Clear 清空缓存
 	Clear(ctx context.Context) error
-	
+
 	// GetMulti 批量获取缓存
 	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
-	
+
 	// SetMulti 批量设置缓存
 	SetMulti(ctx context.Context, items map[string][]byte, expiration time.Duration) error
-	
+
 	// DeleteMulti 批量删除缓存
 	DeleteMulti(ctx context.Context, keys []string) error
-	
+
 	// Incr 自增
 	Incr(ctx context.Context, key string, delta int64) (int64, error)
-	
+
 	// Decr 自减
 	Decr(ctx context.Context, key string, delta int64) (int64, error)
-	
+
 	// Exists 检查缓存是否存在
 	Exists(ctx context.Context, key string) (bool, error)
-	
+
 	// Expire 设置过期时间
 	Expire(ctx context.Context, key string, expiration time.Duration) error
-	
+
 	// TTL 获取过期时间
 	TTL(ctx context.Context, key string) (time.Duration, error)
-	
+
+	// GetOrLoad 获取缓存，未命中时调用loader加载并写入缓存
+	// 并发请求同一个键时只调用一次loader，过期策略见LoadOptions
+	GetOrLoad(ctx context.Context, key string, loader Loader, expiration time.Duration, opts ...LoadOption) ([]byte, error)
+
+	// SetWithTags 设置带标签的缓存，任一标签失效后读取时视为不存在
+	SetWithTags(ctx context.Context, key string, value []byte, expiration time.Duration, tags ...string) error
+
+	// InvalidateTags 失效带有这些标签的缓存，只递增标签版本，不扫描键
+	InvalidateTags(ctx context.Context, tags ...string) error
+
+	// Namespace 创建命名空间，键带有命名空间前缀，可以通过Clear独立清空
+	Namespace(name string) Cache
+
 	// Close 关闭缓存
 	Close() error
 }
@@ -51,28 +64,50 @@ type Cache interface {
 type Options struct {
 	// Expiration 默认过期时间
 	Expiration time.Duration
-	
-	// MaxEntries 最大缓存条目数
+
+	// MaxEntries 最大缓存条目数，0表示不限制，仅MemoryCache有效
 	MaxEntries int
-	
-	// OnEvicted 缓存淘汰回调函数
-	OnEvicted func(key string, value []byte)
+
+	// MaxBytes 最大占用字节数，0表示不限制，仅MemoryCache有效
+	MaxBytes int64
+
+	// Eviction 超出容量时的淘汰策略，仅MemoryCache有效
+	Eviction EvictionPolicy
+
+	// Shards 分片数，向上取2的幂，0表示使用默认值，仅MemoryCache有效
+	Shards int
+
+	// OnEvicted 条目被移除时的回调函数，reason为移除原因，仅MemoryCache有效
+	OnEvicted func(key string, value []byte, reason EvictionReason)
+
+	// TagTTL 标签版本的空闲过期时间，0表示使用默认值（24小时），仅MemoryCache有效
+	// 未过期的缓存值引用的标签不会被清除，没有过期时间的缓存值在标签被清除后视为失效
+	TagTTL time.Duration
+
+	// Codec TypedCache使用的编解码器
+	Codec Codec
+
+	// Load GetOrLoad的默认选项
+	Load LoadOptions
 }
 
 // DefaultOptions 默认缓存选项
 var DefaultOptions = Options{
 	Expiration: 5 * time.Minute,
 	MaxEntries: 10000,
+	Eviction:   EvictionLRU,
+	Codec:      JSONCodec,
+	Load:       DefaultLoadOptions,
 }
 
 // NewOptions 创建缓存选项
 func NewOptions(opts ...Option) Options {
 	options := DefaultOptions
-	
+
 	for _, opt := range opts {
 		opt(&options)
 	}
-	
+
 	return options
 }
 
@@ -93,9 +128,53 @@ func WithMaxEntries(maxEntries int) Option {
 	}
 }
 
-// WithOnEvicted 设置缓存淘汰回调函数
-func WithOnEvicted(onEvicted func(key string, value []byte)) Option {
+// WithMaxBytes 设置最大占用字节数
+func WithMaxBytes(maxBytes int64) Option {
+	return func(o *Options) {
+		o.MaxBytes = maxBytes
+	}
+}
+
+// WithEviction 设置淘汰策略
+func WithEviction(policy EvictionPolicy) Option {
+	return func(o *Options) {
+		o.Eviction = policy
+	}
+}
+
+// WithShards 设置分片数
+func WithShards(shards int) Option {
+	return func(o *Options) {
+		o.Shards = shards
+	}
+}
+
+// WithOnEvicted 设置条目被移除时的回调函数
+func WithOnEvicted(onEvicted func(key string, value []byte, reason EvictionReason)) Option {
 	return func(o *Options) {
 		o.OnEvicted = onEvicted
 	}
 }
+
+// WithTagTTL 设置标签版本的空闲过期时间
+func WithTagTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TagTTL = ttl
+	}
+}
+
+// WithCodec 设置TypedCache使用的编解码器
+func WithCodec(codec Codec) Option {
+	return func(o *Options) {
+		o.Codec = codec
+	}
+}
+
+// WithLoadOptions 设置GetOrLoad的默认选项，调用时传入的选项优先
+func WithLoadOptions(opts ...LoadOption) Option {
+	return func(o *Options) {
+		for _, opt := range opts {
+			opt(&o.Load)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ugorji/go/codec"
+)
+
+// Codec 缓存值的编解码器
+type Codec interface {
+	// Marshal 编码
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal 解码，v为指针
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec JSON编解码，可读性好，便于其他语言读取
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec gob编解码，只适用于Go程序之间，支持JSON无法表示的类型
+	GobCodec Codec = gobCodec{}
+
+	// MsgpackCodec MessagePack编解码，体积和速度优于JSON，字段名遵循codec和json标签
+	MsgpackCodec Codec = msgpackCodec{handle: &codec.MsgpackHandle{WriteExt: true}}
+)
+
+// jsonCodec JSON编解码
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec gob编解码
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// msgpackCodec MessagePack编解码
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	var data []byte
+	if err := codec.NewEncoderBytes(&data, c.handle).Encode(v); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
+
+// 压缩编解码的数据头
+const (
+	zstdHeaderRaw  byte = 0 // 未压缩
+	zstdHeaderZstd byte = 1 // zstd压缩
+)
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdDecoder     *zstd.Decoder
+	zstdInitErr     error
+	zstdInitOnce    sync.Once
+	errZstdTooShort = errors.New("cache: compressed value too short")
+)
+
+// zstdCodec 对编码结果进行zstd压缩
+type zstdCodec struct {
+	codec   Codec
+	minSize int
+}
+
+// NewZstdCodec 创建压缩编解码器，编码结果不小于minSize字节时使用zstd压缩
+// 数据首字节标记是否压缩，不能读取未压缩编解码器写入的值
+func NewZstdCodec(codec Codec, minSize int) Codec {
+	return zstdCodec{codec: codec, minSize: minSize}
+}
+
+func (c zstdCodec) Marshal(v any) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < c.minSize {
+		return append([]byte{zstdHeaderRaw}, data...), nil
+	}
+
+	encoder, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(data, []byte{zstdHeaderZstd}), nil
+}
+
+func (c zstdCodec) Unmarshal(data []byte, v any) error {
+	if len(data) == 0 {
+		return errZstdTooShort
+	}
+
+	switch data[0] {
+	case zstdHeaderRaw:
+		return c.codec.Unmarshal(data[1:], v)
+	case zstdHeaderZstd:
+		_, decoder, err := zstdCoders()
+		if err != nil {
+			return err
+		}
+		raw, err := decoder.DecodeAll(data[1:], nil)
+		if err != nil {
+			return fmt.Errorf("cache: decompress value: %w", err)
+		}
+		return c.codec.Unmarshal(raw, v)
+	default:
+		return fmt.Errorf("cache: unknown compression header %d", data[0])
+	}
+}
+
+// zstdCoders 获取共享的zstd编码器和解码器，EncodeAll和DecodeAll可以并发调用
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdInitOnce.Do(func() {
+		zstdEncoder, zstdInitErr = zstd.NewWriter(nil)
+		if zstdInitErr != nil {
+			return
+		}
+		zstdDecoder, zstdInitErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdEncoder, zstdDecoder, zstdInitErr
+}
@@ -44,12 +44,12 @@ func GetFactory() *Factory {
 
 // RedisOptions Redis缓存选项
 type RedisOptions struct {
-	Client    *redis.Client // Redis客户端
-	KeyPrefix string        // 键前缀
+	Client    redis.UniversalClient // Redis客户端
+	KeyPrefix string                // 键前缀
 }
 
 // WithRedisClient 设置Redis客户端
-func WithRedisClient(client *redis.Client) func(*RedisOptions) {
+func WithRedisClient(client redis.UniversalClient) func(*RedisOptions) {
 	return func(o *RedisOptions) {
 		o.Client = client
 	}
@@ -95,12 +95,12 @@ func (f *Factory) CreateWithContext(ctx context.Context, name string, cacheType
 }
 
 // CreateRedis 创建Redis缓存
-func (f *Factory) CreateRedis(name string, client *redis.Client, opts ...Option) (Cache, error) {
+func (f *Factory) CreateRedis(name string, client redis.UniversalClient, opts ...Option) (Cache, error) {
 	return f.CreateRedisWithContext(context.Background(), name, client, opts...)
 }
 
 // CreateRedisWithContext 使用上下文创建Redis缓存
-func (f *Factory) CreateRedisWithContext(ctx context.Context, name string, client *redis.Client, opts ...Option) (Cache, error) {
+func (f *Factory) CreateRedisWithContext(ctx context.Context, name string, client redis.UniversalClient, opts ...Option) (Cache, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -118,6 +118,26 @@ func (f *Factory) CreateRedisWithContext(ctx context.Context, name string, clien
 	return cache, nil
 }
 
+// Register 注册已创建的缓存，缓存由调用方关闭
+func (f *Factory) Register(name string, cache Cache) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.caches[name]; ok {
+		return fmt.Errorf("cache: cache %s already exists", name)
+	}
+	f.caches[name] = cache
+	return nil
+}
+
+// Unregister 移除通过Register注册的缓存，不关闭缓存
+func (f *Factory) Unregister(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.caches, name)
+}
+
 // Get 获取缓存
 func (f *Factory) Get(name string) (Cache, error) {
 	return f.GetWithContext(context.Background(), name)
@@ -0,0 +1,448 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// InvalidateMessage 缓存失效消息
+type InvalidateMessage struct {
+	Origin string   `json:"origin"`          // 发送消息的实例ID
+	Keys   []string `json:"keys,omitempty"`  // 失效的键
+	Clear  bool     `json:"clear,omitempty"` // 是否清空全部缓存
+}
+
+// Invalidator 在多个实例之间广播缓存失效消息
+type Invalidator interface {
+	// Publish 广播失效消息
+	Publish(ctx context.Context, msg InvalidateMessage) error
+
+	// Subscribe 订阅失效消息（包括本实例发送的消息），返回的函数用于取消订阅
+	Subscribe(handler func(msg InvalidateMessage)) (func() error, error)
+}
+
+// RedisInvalidator 基于Redis发布订阅的失效广播
+// 连接断开期间的消息会丢失，此时本地缓存最多在过期时间内返回旧值
+type RedisInvalidator struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// NewRedisInvalidator 创建Redis失效广播
+func NewRedisInvalidator(client redis.UniversalClient, channel string) *RedisInvalidator {
+	return &RedisInvalidator{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish 广播失效消息
+func (r *RedisInvalidator) Publish(ctx context.Context, msg InvalidateMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, data).Err()
+}
+
+// Subscribe 订阅失效消息，断线后由客户端自动重新订阅
+func (r *RedisInvalidator) Subscribe(handler func(msg InvalidateMessage)) (func() error, error) {
+	ctx := context.Background()
+	pubsub := r.client.Subscribe(ctx, r.channel)
+
+	// 等待订阅确认，确保返回后不会错过消息
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("cache: subscribe %s failed: %w", r.channel, err)
+	}
+
+	go func() {
+		for m := range pubsub.Channel() {
+			var msg InvalidateMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				logger.Warn("Invalid cache invalidation message", "channel", r.channel, "error", err)
+				continue
+			}
+			handler(msg)
+		}
+	}()
+
+	return pubsub.Close, nil
+}
+
+// LayeredOptions 两级缓存选项
+type LayeredOptions struct {
+	LocalTTL    time.Duration // 本地缓存过期时间，为0时使用1分钟
+	LocalSize   int           // 本地缓存最大条目数，0表示不限制
+	Invalidator Invalidator   // 失效广播，为nil时只在本实例内失效
+}
+
+// LayerStats 单层缓存的命中统计
+type LayerStats struct {
+	Hits   int64 `json:"hits"`   // 命中次数
+	Misses int64 `json:"misses"` // 未命中次数
+}
+
+// HitRate 命中率，没有访问时为0
+func (s LayerStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// LayeredStats 两级缓存的统计
+type LayeredStats struct {
+	L1            LayerStats `json:"l1"`            // 本地缓存
+	L2            LayerStats `json:"l2"`            // 远程缓存，仅统计本地未命中后的访问
+	Invalidations int64      `json:"invalidations"` // 收到其他实例的失效消息数
+}
+
+// LayeredCache 两级缓存：进程内的本地缓存（L1）和共享的远程缓存（L2）
+// 读取时依次查询L1和L2，L2命中后写入L1；写入和删除同时作用于两层，并广播给其他实例清除各自的L1
+// L1不感知L2中的剩余过期时间，键在L2中过期后L1最多在LocalTTL内返回旧值，LocalTTL应远小于业务的过期时间
+type LayeredCache struct {
+	local       *MemoryCache
+	remote      Cache
+	invalidator Invalidator
+	unsubscribe func() error
+	localTTL    time.Duration
+	id          string
+	loads       *loadGroup
+	tags        tagStore
+
+	// generation 在本地缓存失效时递增，读取L2期间发生失效时不回填L1，避免写入旧值
+	generation atomic.Uint64
+
+	l1Hits, l1Misses atomic.Int64
+	l2Hits, l2Misses atomic.Int64
+	invalidations    atomic.Int64
+}
+
+// NewLayeredCache 创建两级缓存，remote为共享的远程缓存
+func NewLayeredCache(remote Cache, opts LayeredOptions) (*LayeredCache, error) {
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = time.Minute
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &LayeredCache{
+		local:       NewMemoryCache(WithExpiration(opts.LocalTTL), WithMaxEntries(opts.LocalSize)),
+		remote:      remote,
+		invalidator: opts.Invalidator,
+		localTTL:    opts.LocalTTL,
+		id:          hex.EncodeToString(id),
+	}
+
+	// GetOrLoad沿用远程缓存的默认选项和分布式锁
+	if r, ok := remote.(loadable); ok {
+		g := r.loadGroup()
+		c.loads = newLoadGroup(g.expiration, g.options, g.locker)
+	} else {
+		c.loads = newLoadGroup(DefaultOptions.Expiration, DefaultOptions.Load, nil)
+	}
+
+	// 标签版本保存在远程缓存，所有实例共享
+	if r, ok := remote.(tagged); ok {
+		c.tags = r.tagStore()
+	} else {
+		c.tags = newMemoryTags(0)
+	}
+
+	if c.invalidator != nil {
+		unsubscribe, err := c.invalidator.Subscribe(c.onInvalidate)
+		if err != nil {
+			return nil, err
+		}
+		c.unsubscribe = unsubscribe
+	}
+
+	return c, nil
+}
+
+// Stats 获取各层的命中统计
+func (c *LayeredCache) Stats() LayeredStats {
+	return LayeredStats{
+		L1:            LayerStats{Hits: c.l1Hits.Load(), Misses: c.l1Misses.Load()},
+		L2:            LayerStats{Hits: c.l2Hits.Load(), Misses: c.l2Misses.Load()},
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+// Get 获取缓存，本地未命中时从远程缓存读取并写入本地
+// 本地缓存保存带标签的原始值，每次读取都按远程缓存中的标签版本校验
+func (c *LayeredCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, err := c.local.getRaw(ctx, key); err == nil {
+		c.l1Hits.Add(1)
+		return untagValue(ctx, c.tags, value)
+	}
+	c.l1Misses.Add(1)
+
+	generation := c.generation.Load()
+	value, err := c.remoteGet(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.l2Misses.Add(1)
+		}
+		return nil, err
+	}
+	c.l2Hits.Add(1)
+
+	result, err := untagValue(ctx, c.tags, value)
+	if err != nil {
+		return nil, err
+	}
+	c.fill(ctx, generation, map[string][]byte{key: value}, 0)
+	return result, nil
+}
+
+// Set 设置缓存，同时写入两层并通知其他实例
+func (c *LayeredCache) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	if err := c.remote.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, []string{key})
+	c.fill(ctx, c.generation.Load(), map[string][]byte{key: value}, expiration)
+	return nil
+}
+
+// Delete 删除缓存
+func (c *LayeredCache) Delete(ctx context.Context, key string) error {
+	if err := c.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	c.invalidate(ctx, []string{key})
+	return nil
+}
+
+// Clear 清空缓存
+func (c *LayeredCache) Clear(ctx context.Context) error {
+	if err := c.remote.Clear(ctx); err != nil {
+		return err
+	}
+
+	c.generation.Add(1)
+	c.local.Clear(ctx)
+	c.publish(ctx, InvalidateMessage{Clear: true})
+	return nil
+}
+
+// GetMulti 批量获取缓存，本地未命中的键从远程缓存读取
+func (c *LayeredCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	result, err := c.local.getMultiRaw(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	c.l1Hits.Add(int64(len(result)))
+
+	missing := make([]string, 0, len(keys)-len(result))
+	for _, key := range keys {
+		if _, ok := result[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return untagValues(ctx, c.tags, result)
+	}
+	c.l1Misses.Add(int64(len(missing)))
+
+	generation := c.generation.Load()
+	remote, err := c.remoteGetMulti(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	c.l2Hits.Add(int64(len(remote)))
+	c.l2Misses.Add(int64(len(missing) - len(remote)))
+
+	c.fill(ctx, generation, remote, 0)
+	for key, value := range remote {
+		result[key] = value
+	}
+	return untagValues(ctx, c.tags, result)
+}
+
+// SetMulti 批量设置缓存
+func (c *LayeredCache) SetMulti(ctx context.Context, items map[string][]byte, expiration time.Duration) error {
+	if err := c.remote.SetMulti(ctx, items, expiration); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	c.invalidate(ctx, keys)
+	c.fill(ctx, c.generation.Load(), items, expiration)
+	return nil
+}
+
+// DeleteMulti 批量删除缓存
+func (c *LayeredCache) DeleteMulti(ctx context.Context, keys []string) error {
+	if err := c.remote.DeleteMulti(ctx, keys); err != nil {
+		return err
+	}
+	c.invalidate(ctx, keys)
+	return nil
+}
+
+// Incr 自增，计数器只保存在远程缓存
+func (c *LayeredCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	value, err := c.remote.Incr(ctx, key, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.invalidate(ctx, []string{key})
+	return value, nil
+}
+
+// Decr 自减，计数器只保存在远程缓存
+func (c *LayeredCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	value, err := c.remote.Decr(ctx, key, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.invalidate(ctx, []string{key})
+	return value, nil
+}
+
+// Exists 检查缓存是否存在
+func (c *LayeredCache) Exists(ctx context.Context, key string) (bool, error) {
+	if found, err := c.local.Exists(ctx, key); err == nil && found {
+		return true, nil
+	}
+	return c.remote.Exists(ctx, key)
+}
+
+// Expire 设置过期时间，本地缓存中的副本直接清除
+func (c *LayeredCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	if err := c.remote.Expire(ctx, key, expiration); err != nil {
+		return err
+	}
+	c.invalidate(ctx, []string{key})
+	return nil
+}
+
+// TTL 获取远程缓存中的过期时间
+func (c *LayeredCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.remote.TTL(ctx, key)
+}
+
+// GetOrLoad 获取缓存，未命中时调用loader加载并写入两层，分布式锁与远程缓存相同
+func (c *LayeredCache) GetOrLoad(ctx context.Context, key string, loader Loader, expiration time.Duration, opts ...LoadOption) ([]byte, error) {
+	return c.loads.getOrLoad(ctx, c, key, loader, expiration, opts)
+}
+
+// SetWithTags 设置带标签的缓存，本地副本同样带有标签
+func (c *LayeredCache) SetWithTags(ctx context.Context, key string, value []byte, expiration time.Duration, tags ...string) error {
+	data, err := tagValue(ctx, c.tags, tags, value)
+	if err != nil {
+		return err
+	}
+	retainTags(c.tags, uniqueTags(tags), expiration)
+	return c.Set(ctx, key, data, expiration)
+}
+
+// InvalidateTags 失效带有这些标签的缓存，其他实例的本地副本在下次读取时校验失败
+func (c *LayeredCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return c.tags.bumpTags(ctx, uniqueTags(tags))
+}
+
+// Namespace 创建命名空间
+func (c *LayeredCache) Namespace(name string) Cache {
+	return newNamespace(c, name, name)
+}
+
+func (c *LayeredCache) tagStore() tagStore {
+	return c.tags
+}
+
+// remoteGet 从远程缓存读取原始值，保留标签以便本地副本校验
+func (c *LayeredCache) remoteGet(ctx context.Context, key string) ([]byte, error) {
+	if r, ok := c.remote.(rawGetter); ok {
+		return r.getRaw(ctx, key)
+	}
+	return c.remote.Get(ctx, key)
+}
+
+// remoteGetMulti 从远程缓存批量读取原始值
+func (c *LayeredCache) remoteGetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if r, ok := c.remote.(rawGetter); ok {
+		return r.getMultiRaw(ctx, keys)
+	}
+	return c.remote.GetMulti(ctx, keys)
+}
+
+// Close 取消订阅并关闭本地缓存，远程缓存由创建方关闭
+func (c *LayeredCache) Close() error {
+	var errs []error
+	if c.unsubscribe != nil {
+		errs = append(errs, c.unsubscribe())
+	}
+	errs = append(errs, c.local.Close())
+	return errors.Join(errs...)
+}
+
+// fill 将远程缓存中的值写入本地缓存，期间发生过失效时跳过，本地缓存已满时按LRU淘汰
+// 本地副本的过期时间不超过expiration，为0时使用本地缓存的过期时间
+func (c *LayeredCache) fill(ctx context.Context, generation uint64, items map[string][]byte, expiration time.Duration) {
+	if len(items) == 0 || c.generation.Load() != generation {
+		return
+	}
+	ttl := c.localTTL
+	if expiration > 0 && expiration < ttl {
+		ttl = expiration
+	}
+	c.local.SetMulti(ctx, items, ttl)
+}
+
+// invalidate 清除本地缓存中的键并通知其他实例
+func (c *LayeredCache) invalidate(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	c.generation.Add(1)
+	c.local.DeleteMulti(ctx, keys)
+	c.publish(ctx, InvalidateMessage{Keys: keys})
+}
+
+// publish 广播失效消息，失败时仅记录日志，其他实例的本地缓存在过期后恢复一致
+func (c *LayeredCache) publish(ctx context.Context, msg InvalidateMessage) {
+	if c.invalidator == nil {
+		return
+	}
+	msg.Origin = c.id
+	if err := c.invalidator.Publish(ctx, msg); err != nil {
+		logger.WarnContext(ctx, "Failed to publish cache invalidation", "keys", len(msg.Keys), "error", err)
+	}
+}
+
+// onInvalidate 处理其他实例的失效消息
+func (c *LayeredCache) onInvalidate(msg InvalidateMessage) {
+	if msg.Origin == c.id {
+		return
+	}
+	c.invalidations.Add(1)
+	c.generation.Add(1)
+
+	ctx := context.Background()
+	if msg.Clear {
+		c.local.Clear(ctx)
+		return
+	}
+	c.local.DeleteMulti(ctx, msg.Keys)
+}
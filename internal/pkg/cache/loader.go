@@ -0,0 +1,410 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+// Loader 加载缓存值的函数，数据不存在时返回ErrNotFound
+type Loader func(ctx context.Context) ([]byte, error)
+
+// LoadOptions GetOrLoad选项
+type LoadOptions struct {
+	// StaleTTL 过期后继续返回旧值的时长，期间在后台刷新，0表示过期后同步加载
+	StaleTTL time.Duration
+
+	// Beta 提前刷新系数（XFetch），越大越早在后台刷新，加载越慢的值越早刷新，0表示不提前刷新
+	Beta float64
+
+	// NilValueTTL loader返回ErrNotFound时缓存空值的时长，0表示不缓存空值
+	NilValueTTL time.Duration
+
+	// DistributedLock 是否使用分布式锁，只有一个实例调用loader，仅RedisCache有效
+	DistributedLock bool
+
+	// LockTimeout 分布式锁的过期时间，也是等待其他实例加载的最长时间，超时后直接调用loader
+	LockTimeout time.Duration
+
+	// Tags 加载的值带有的标签，在调用loader前读取标签版本，加载期间标签失效时写入的值随即失效
+	Tags []string
+
+	// Filter 判断数据是否可能存在（如布隆过滤器），缓存未命中时先检查，一定不存在时直接返回ErrNotFound，不调用loader
+	Filter MembershipFilter
+
+	// FilterItem 传给Filter的元素，为空时使用缓存键
+	FilterItem string
+}
+
+// MembershipFilter 判断元素是否可能存在，bloom.Filter实现了该接口
+type MembershipFilter interface {
+	// Test 返回false时元素一定不存在
+	Test(ctx context.Context, item string) (bool, error)
+}
+
+// DefaultLoadOptions 默认GetOrLoad选项
+var DefaultLoadOptions = LoadOptions{
+	Beta:            1,
+	DistributedLock: true,
+	LockTimeout:     5 * time.Second,
+}
+
+// LoadOption GetOrLoad选项函数
+type LoadOption func(*LoadOptions)
+
+// WithStaleTTL 设置过期后继续返回旧值的时长
+func WithStaleTTL(staleTTL time.Duration) LoadOption {
+	return func(o *LoadOptions) {
+		o.StaleTTL = staleTTL
+	}
+}
+
+// WithEarlyExpiration 设置提前刷新系数，0表示不提前刷新
+func WithEarlyExpiration(beta float64) LoadOption {
+	return func(o *LoadOptions) {
+		o.Beta = beta
+	}
+}
+
+// WithNilValueTTL 设置空值缓存时长，0表示不缓存空值
+func WithNilValueTTL(nilValueTTL time.Duration) LoadOption {
+	return func(o *LoadOptions) {
+		o.NilValueTTL = nilValueTTL
+	}
+}
+
+// WithDistributedLock 设置是否使用分布式锁
+func WithDistributedLock(enabled bool) LoadOption {
+	return func(o *LoadOptions) {
+		o.DistributedLock = enabled
+	}
+}
+
+// WithLockTimeout 设置分布式锁的过期时间
+func WithLockTimeout(timeout time.Duration) LoadOption {
+	return func(o *LoadOptions) {
+		o.LockTimeout = timeout
+	}
+}
+
+// WithTags 设置加载的值带有的标签
+func WithTags(tags ...string) LoadOption {
+	return func(o *LoadOptions) {
+		o.Tags = append(o.Tags, tags...)
+	}
+}
+
+// WithFilter 设置缓存未命中时检查的过滤器，item为传给过滤器的元素（如用户ID），为空时使用缓存键
+func WithFilter(filter MembershipFilter, item string) LoadOption {
+	return func(o *LoadOptions) {
+		o.Filter = filter
+		o.FilterItem = item
+	}
+}
+
+// locker 分布式锁，由共享的缓存实现
+type locker interface {
+	// tryLock 尝试获取锁，获取失败时返回false
+	tryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// loadable 支持GetOrLoad的缓存，两级缓存从远程缓存继承默认选项和分布式锁
+type loadable interface {
+	loadGroup() *loadGroup
+}
+
+// GetOrLoad写入的值带有数据头，记录逻辑过期时间和加载耗时
+// 格式：magic(3) | flags(1) | expireAt(8) | delta(8) | value
+const (
+	entryMagic     = "\xffGL"
+	entryHeaderLen = len(entryMagic) + 1 + 8 + 8
+	entryFlagNil   = 1
+)
+
+// entry GetOrLoad写入的缓存值
+type entry struct {
+	value    []byte
+	isNil    bool
+	expireAt int64         // 逻辑过期时间（UnixNano），0表示不过期
+	delta    time.Duration // 加载耗时
+}
+
+// encode 编码缓存值
+func (e entry) encode() []byte {
+	data := make([]byte, entryHeaderLen, entryHeaderLen+len(e.value))
+	copy(data, entryMagic)
+	if e.isNil {
+		data[len(entryMagic)] = entryFlagNil
+	}
+	binary.BigEndian.PutUint64(data[len(entryMagic)+1:], uint64(e.expireAt))
+	binary.BigEndian.PutUint64(data[len(entryMagic)+9:], uint64(e.delta))
+	return append(data, e.value...)
+}
+
+// decodeEntry 解码缓存值，不是GetOrLoad写入的值时返回false
+func decodeEntry(data []byte) (entry, bool) {
+	if len(data) < entryHeaderLen || string(data[:len(entryMagic)]) != entryMagic {
+		return entry{}, false
+	}
+	return entry{
+		value:    data[entryHeaderLen:],
+		isNil:    data[len(entryMagic)]&entryFlagNil != 0,
+		expireAt: int64(binary.BigEndian.Uint64(data[len(entryMagic)+1:])),
+		delta:    time.Duration(binary.BigEndian.Uint64(data[len(entryMagic)+9:])),
+	}, true
+}
+
+// fresh 是否未过期
+func (e entry) fresh(now time.Time) bool {
+	return e.expireAt == 0 || now.UnixNano() < e.expireAt
+}
+
+// servable 是否仍可返回，过期后在staleTTL内可以返回旧值
+func (e entry) servable(now time.Time, staleTTL time.Duration) bool {
+	return e.fresh(now) || now.UnixNano() < e.expireAt+int64(staleTTL)
+}
+
+// earlyExpired XFetch：按加载耗时和随机数判断是否提前刷新，越接近过期时间概率越大
+func (e entry) earlyExpired(now time.Time, beta float64) bool {
+	if beta <= 0 || e.expireAt == 0 || e.isNil {
+		return false
+	}
+	gap := -float64(e.delta) * beta * math.Log(1-rand.Float64())
+	return float64(now.UnixNano())+gap >= float64(e.expireAt)
+}
+
+// newerThan 是否在after之后写入，用于判断其他请求是否已经完成加载
+func (e entry) newerThan(after int64) bool {
+	return e.expireAt == 0 || e.expireAt > after
+}
+
+// result 返回缓存值，空值返回ErrNotFound
+func (e entry) result() ([]byte, error) {
+	if e.isNil {
+		return nil, ErrNotFound
+	}
+	return e.value, nil
+}
+
+// loadGroup 实现GetOrLoad：进程内合并并发加载，共享缓存使用分布式锁保证只有一个实例加载
+type loadGroup struct {
+	group      singleflight.Group
+	expiration time.Duration
+	options    LoadOptions
+	locker     locker
+}
+
+// newLoadGroup 创建加载组，locker为nil时只在进程内合并
+func newLoadGroup(expiration time.Duration, options LoadOptions, locker locker) *loadGroup {
+	return &loadGroup{
+		expiration: expiration,
+		options:    options,
+		locker:     locker,
+	}
+}
+
+// getOrLoad 获取缓存，未命中时加载
+// 值未过期时直接返回，按XFetch提前过期时在后台刷新；过期后在StaleTTL内返回旧值并在后台刷新
+func (g *loadGroup) getOrLoad(ctx context.Context, c Cache, key string, loader Loader, expiration time.Duration, opts []LoadOption) ([]byte, error) {
+	o := g.options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if expiration == 0 {
+		expiration = g.expiration
+	}
+
+	data, err := c.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		logger.WarnContext(ctx, "Failed to read cache, loading directly", "key", key, "error", err)
+		return loader(ctx)
+	}
+
+	var after int64
+	if err == nil {
+		e, ok := decodeEntry(data)
+		if !ok {
+			// 其他方式写入的值，视为未过期
+			return data, nil
+		}
+
+		now := time.Now()
+		if e.fresh(now) {
+			if e.earlyExpired(now, o.Beta) {
+				g.refresh(ctx, c, key, loader, expiration, o, e.expireAt)
+			}
+			return e.result()
+		}
+		if e.servable(now, o.StaleTTL) {
+			g.refresh(ctx, c, key, loader, expiration, o, e.expireAt)
+			return e.result()
+		}
+		after = e.expireAt
+	}
+
+	// 缓存中没有任何值时检查过滤器，过滤器出错时照常加载
+	if after == 0 && o.Filter != nil && !g.mayExist(ctx, key, o) {
+		return nil, ErrNotFound
+	}
+
+	v, err, _ := g.group.Do(key, func() (any, error) {
+		return g.load(ctx, c, key, loader, expiration, o, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// mayExist 按过滤器判断数据是否可能存在
+func (g *loadGroup) mayExist(ctx context.Context, key string, o LoadOptions) bool {
+	item := o.FilterItem
+	if item == "" {
+		item = key
+	}
+	ok, err := o.Filter.Test(ctx, item)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to test filter, loading directly", "key", key, "error", err)
+		return true
+	}
+	return ok
+}
+
+// refresh 在后台刷新，与同一个键的其他加载合并
+func (g *loadGroup) refresh(ctx context.Context, c Cache, key string, loader Loader, expiration time.Duration, o LoadOptions, after int64) {
+	ctx = context.WithoutCancel(ctx)
+	g.group.DoChan(key, func() (any, error) {
+		value, err := g.load(ctx, c, key, loader, expiration, o, after)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			logger.WarnContext(ctx, "Failed to refresh cache", "key", key, "error", err)
+		}
+		return value, err
+	})
+}
+
+// load 调用loader并写入缓存，after为调用方看到的旧值的过期时间
+// 获取分布式锁失败时等待其他实例写入比after新的值，超时后直接调用loader
+func (g *loadGroup) load(ctx context.Context, c Cache, key string, loader Loader, expiration time.Duration, o LoadOptions, after int64) ([]byte, error) {
+	if g.locker != nil && o.DistributedLock && o.LockTimeout > 0 {
+		unlock, ok, err := g.locker.tryLock(ctx, key, o.LockTimeout)
+		switch {
+		case err != nil:
+			logger.WarnContext(ctx, "Failed to acquire cache lock, loading directly", "key", key, "error", err)
+		case ok:
+			defer unlock()
+			// 获取锁后再次检查，其他实例可能刚刚完成加载
+			if e, ok := g.lookup(ctx, c, key); ok && e.fresh(time.Now()) && e.newerThan(after) {
+				return e.result()
+			}
+		default:
+			e, ok, err := g.wait(ctx, c, key, o.LockTimeout, after)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return e.result()
+			}
+			logger.WarnContext(ctx, "Timed out waiting for cache load, loading directly", "key", key)
+		}
+	}
+
+	// 在加载前读取标签版本，加载期间失效标签时写入的值视为已失效
+	tags := uniqueTags(o.Tags)
+	var versions []uint64
+	if len(tags) > 0 {
+		t, ok := c.(tagged)
+		if !ok {
+			return nil, fmt.Errorf("cache: %T does not support tags", c)
+		}
+		var err error
+		if versions, err = t.tagStore().tagVersions(ctx, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	value, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) {
+		g.storeNil(ctx, c, key, o, after)
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := entry{value: value, delta: time.Since(start)}
+	ttl := expiration
+	if expiration > 0 {
+		e.expireAt = time.Now().Add(expiration).UnixNano()
+		ttl = expiration + o.StaleTTL
+	}
+	data := e.encode()
+	if len(tags) > 0 {
+		data = encodeTagged(tags, versions, data)
+	}
+	if err := c.Set(ctx, key, data, ttl); err != nil {
+		logger.WarnContext(ctx, "Failed to write cache", "key", key, "error", err)
+	}
+	return value, nil
+}
+
+// storeNil 数据不存在时缓存空值，不缓存空值时删除旧值
+func (g *loadGroup) storeNil(ctx context.Context, c Cache, key string, o LoadOptions, after int64) {
+	var err error
+	switch {
+	case o.NilValueTTL > 0:
+		e := entry{isNil: true, expireAt: time.Now().Add(o.NilValueTTL).UnixNano()}
+		err = c.Set(ctx, key, e.encode(), o.NilValueTTL)
+	case after > 0:
+		err = c.Delete(ctx, key)
+	}
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to write cache", "key", key, "error", err)
+	}
+}
+
+// lookup 读取缓存值，其他方式写入的值视为不过期
+func (g *loadGroup) lookup(ctx context.Context, c Cache, key string) (entry, bool) {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		return entry{}, false
+	}
+	if e, ok := decodeEntry(data); ok {
+		return e, true
+	}
+	return entry{value: data}, true
+}
+
+// wait 等待其他实例写入比after新的值，超过timeout返回false
+func (g *loadGroup) wait(ctx context.Context, c Cache, key string, timeout time.Duration, after int64) (entry, bool, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := 10 * time.Millisecond
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return entry{}, false, ctx.Err()
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		if e, ok := g.lookup(ctx, c, key); ok && e.fresh(now) && e.newerThan(after) {
+			return e, true, nil
+		}
+		if !now.Before(deadline) {
+			return entry{}, false, nil
+		}
+
+		backoff = min(backoff*2, 200*time.Millisecond, deadline.Sub(now))
+		timer.Reset(backoff)
+	}
+}
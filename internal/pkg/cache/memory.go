@@ -3,10 +3,12 @@ package cache
 import (
 	"context"
 	"errors"
+	"hash/maphash"
+	"math/bits"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/patrickmn/go-cache"
 )
 
 var (
@@ -15,104 +17,192 @@ var (
 
 	// ErrKeyExists 缓存键已存在错误
 	ErrKeyExists = errors.New("cache: key already exists")
+
+	// errClosed 缓存已关闭
+	errClosed = errors.New("cache: cache is closed")
+)
+
+// 分片数的限制，容量较小时减少分片，避免按分片均分后每个分片过小
+const (
+	defaultShards       = 16
+	minEntriesPerShard  = 32
+	minBytesPerShard    = 1 << 20
+	defaultJanitorCycle = time.Minute
 )
 
 // MemoryCache 内存缓存
+// 按键的哈希分片，每个分片独立加锁，按MaxEntries和MaxBytes均分容量，超出时按淘汰策略移除条目
+// 淘汰在分片内进行，整体上是近似的LRU或W-TinyLFU
 type MemoryCache struct {
-	cache  *cache.Cache
-	mu     sync.RWMutex
-	closed bool
+	shards     []*shard
+	shift      uint
+	seed       maphash.Seed
+	policy     EvictionPolicy
+	expiration time.Duration
+	onEvicted  func(key string, value []byte, reason EvictionReason)
+	janitor    *janitor
+	loads      *loadGroup
+	tags       *memoryTags
+	closed     atomic.Bool
 }
 
 // NewMemoryCache 创建内存缓存
 func NewMemoryCache(opts ...Option) *MemoryCache {
 	options := NewOptions(opts...)
 
-	c := cache.New(options.Expiration, options.Expiration/2)
+	count := shardCount(options)
+	c := &MemoryCache{
+		shards:     make([]*shard, count),
+		shift:      uint(64 - bits.TrailingZeros(uint(count))),
+		seed:       maphash.MakeSeed(),
+		policy:     options.Eviction,
+		expiration: options.Expiration,
+		onEvicted:  options.OnEvicted,
+		loads:      newLoadGroup(options.Expiration, options.Load, nil),
+		tags:       newMemoryTags(options.TagTTL),
+	}
 
-	if options.OnEvicted != nil {
-		c.OnEvicted(func(key string, value interface{}) {
-			if value != nil {
-				options.OnEvicted(key, value.([]byte))
-			}
-		})
+	// 容量按分片均分，余数分给前面的分片
+	for i := range c.shards {
+		maxEntries := options.MaxEntries / count
+		if i < options.MaxEntries%count {
+			maxEntries++
+		}
+		c.shards[i] = newShard(options.Eviction, maxEntries, options.MaxBytes/int64(count))
+	}
+
+	// 定期清理过期条目，缓存未关闭就被回收时停止清理
+	interval := defaultJanitorCycle
+	if options.Expiration > 0 {
+		interval = max(options.Expiration/2, time.Second)
 	}
+	c.janitor = startJanitor(c.shards, c.onEvicted, interval)
+	runtime.AddCleanup(c, func(j *janitor) { j.stop() }, c.janitor)
 
-	return &MemoryCache{
-		cache: c,
+	return c
+}
+
+// shardCount 分片数，为2的幂
+func shardCount(options Options) int {
+	count := defaultShards
+	if options.Shards > 0 {
+		count = 1 << bits.Len(uint(options.Shards-1))
+	}
+	for count > 1 &&
+		((options.MaxEntries > 0 && options.MaxEntries/count < minEntriesPerShard) ||
+			(options.MaxBytes > 0 && options.MaxBytes/int64(count) < minBytesPerShard)) {
+		count /= 2
 	}
+	return count
 }
 
-// Get 获取缓存
+// shard 键所在的分片，使用哈希的高位，低位留给频率统计
+func (c *MemoryCache) shard(key string) (*shard, uint64) {
+	hash := maphash.String(c.seed, key)
+	if len(c.shards) == 1 {
+		return c.shards[0], hash
+	}
+	return c.shards[hash>>c.shift], hash
+}
+
+// expireAt 计算过期时间，expiration为0时使用默认过期时间，小于0或默认过期时间不大于0时不过期
+func (c *MemoryCache) expireAt(expiration time.Duration) int64 {
+	if expiration == 0 {
+		expiration = c.expiration
+	}
+	if expiration <= 0 {
+		return 0
+	}
+	return time.Now().Add(expiration).UnixNano()
+}
+
+// notify 回调被移除的条目
+func (c *MemoryCache) notify(removed []evicted) {
+	notifyEvicted(c.onEvicted, removed)
+}
+
+// Get 获取缓存，标签已失效的值视为不存在
 func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	data, err := c.getRaw(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return untagValue(ctx, c.tags, data)
+}
 
-	if c.closed {
-		return nil, errors.New("cache: cache is closed")
+// getRaw 获取未校验标签的原始值
+func (c *MemoryCache) getRaw(ctx context.Context, key string) ([]byte, error) {
+	if c.closed.Load() {
+		return nil, errClosed
 	}
 
-	value, found := c.cache.Get(key)
+	s, hash := c.shard(key)
+	value, found, removed := s.get(key, hash, time.Now().UnixNano())
+	c.notify(removed)
 	if !found {
 		return nil, ErrNotFound
 	}
 
-	return value.([]byte), nil
+	return value, nil
 }
 
-// Set 设置缓存
+// Set 设置缓存，expiration为0时使用默认过期时间，小于0时不过期
 func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
-	c.cache.Set(key, value, expiration)
+	s, hash := c.shard(key)
+	c.notify(s.set(key, hash, value, c.expireAt(expiration)))
 	return nil
 }
 
 // Delete 删除缓存
 func (c *MemoryCache) Delete(ctx context.Context, key string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
-	c.cache.Delete(key)
+	s, _ := c.shard(key)
+	c.notify(s.delete(key))
 	return nil
 }
 
-// Clear 清空缓存
+// Clear 清空缓存，不回调被清除的条目
 func (c *MemoryCache) Clear(ctx context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
-	c.cache.Flush()
+	for _, s := range c.shards {
+		s.clear(c.policy)
+	}
 	return nil
 }
 
-// GetMulti 批量获取缓存
+// GetMulti 批量获取缓存，标签已失效的键不包含在结果中
 func (c *MemoryCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	items, err := c.getMultiRaw(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return untagValues(ctx, c.tags, items)
+}
 
-	if c.closed {
-		return nil, errors.New("cache: cache is closed")
+// getMultiRaw 批量获取未校验标签的原始值
+func (c *MemoryCache) getMultiRaw(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if c.closed.Load() {
+		return nil, errClosed
 	}
 
+	now := time.Now().UnixNano()
 	result := make(map[string][]byte, len(keys))
 	for _, key := range keys {
-		value, found := c.cache.Get(key)
+		s, hash := c.shard(key)
+		value, found, removed := s.get(key, hash, now)
+		c.notify(removed)
 		if found {
-			result[key] = value.([]byte)
+			result[key] = value
 		}
 	}
 
@@ -121,15 +211,14 @@ func (c *MemoryCache) GetMulti(ctx context.Context, keys []string) (map[string][
 
 // SetMulti 批量设置缓存
 func (c *MemoryCache) SetMulti(ctx context.Context, items map[string][]byte, expiration time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
+	expireAt := c.expireAt(expiration)
 	for key, value := range items {
-		c.cache.Set(key, value, expiration)
+		s, hash := c.shard(key)
+		c.notify(s.set(key, hash, value, expireAt))
 	}
 
 	return nil
@@ -137,117 +226,200 @@ func (c *MemoryCache) SetMulti(ctx context.Context, items map[string][]byte, exp
 
 // DeleteMulti 批量删除缓存
 func (c *MemoryCache) DeleteMulti(ctx context.Context, keys []string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
 	for _, key := range keys {
-		c.cache.Delete(key)
+		s, _ := c.shard(key)
+		c.notify(s.delete(key))
 	}
 
 	return nil
 }
 
-// Incr 自增
+// Incr 自增，值以十进制字符串保存，与Redis一致；键不存在时从0开始并使用默认过期时间
 func (c *MemoryCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return 0, errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return 0, errClosed
 	}
 
-	value, err := c.cache.IncrementInt64(key, delta)
-	if err != nil {
-		return 0, errors.New("cache: increment failed: " + err.Error())
-	}
-
-	return value, nil
+	s, hash := c.shard(key)
+	value, removed, err := s.incr(key, hash, delta, time.Now().UnixNano(), c.expireAt(0))
+	c.notify(removed)
+	return value, err
 }
 
 // Decr 自减
 func (c *MemoryCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return 0, errors.New("cache: cache is closed")
-	}
-
-	value, err := c.cache.DecrementInt64(key, delta)
-	if err != nil {
-		return 0, errors.New("cache: decrement failed: " + err.Error())
-	}
-
-	return value, nil
+	return c.Incr(ctx, key, -delta)
 }
 
 // Exists 检查缓存是否存在
 func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.closed {
-		return false, errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return false, errClosed
 	}
 
-	_, found := c.cache.Get(key)
+	s, _ := c.shard(key)
+	_, found := s.peek(key, time.Now().UnixNano())
 	return found, nil
 }
 
 // Expire 设置过期时间
 func (c *MemoryCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return errClosed
 	}
 
-	item, found := c.cache.Items()[key]
-	if !found {
+	s, _ := c.shard(key)
+	now := time.Now()
+	if !s.update(key, now.UnixNano(), func(it *item) bool {
+		it.expireAt = now.Add(expiration).UnixNano()
+		return true
+	}) {
 		return ErrNotFound
 	}
-
-	item.Expiration = time.Now().Add(expiration).UnixNano()
 	return nil
 }
 
-// TTL 获取过期时间
+// TTL 获取过期时间，不过期时返回0
 func (c *MemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.closed {
-		return 0, errors.New("cache: cache is closed")
+	if c.closed.Load() {
+		return 0, errClosed
 	}
 
-	item, found := c.cache.Items()[key]
+	s, _ := c.shard(key)
+	it, found := s.peek(key, time.Now().UnixNano())
 	if !found {
 		return 0, ErrNotFound
 	}
 
-	if item.Expiration == 0 {
+	if it.expireAt == 0 {
 		return 0, nil
 	}
 
-	expiration := time.Unix(0, item.Expiration)
-	return expiration.Sub(time.Now()), nil
+	return time.Until(time.Unix(0, it.expireAt)), nil
+}
+
+// GetOrLoad 获取缓存，未命中时调用loader加载，并发请求在进程内合并
+func (c *MemoryCache) GetOrLoad(ctx context.Context, key string, loader Loader, expiration time.Duration, opts ...LoadOption) ([]byte, error) {
+	return c.loads.getOrLoad(ctx, c, key, loader, expiration, opts)
+}
+
+// loadGroup 返回GetOrLoad的加载组
+func (c *MemoryCache) loadGroup() *loadGroup {
+	return c.loads
+}
+
+// SetWithTags 设置带标签的缓存
+func (c *MemoryCache) SetWithTags(ctx context.Context, key string, value []byte, expiration time.Duration, tags ...string) error {
+	data, err := tagValue(ctx, c.tags, tags, value)
+	if err != nil {
+		return err
+	}
+	if expiration == 0 {
+		expiration = c.expiration
+	}
+	c.tags.retain(uniqueTags(tags), expiration)
+	return c.Set(ctx, key, data, expiration)
+}
+
+// InvalidateTags 失效带有这些标签的缓存，标签版本只保存在当前进程
+func (c *MemoryCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return c.tags.bumpTags(ctx, uniqueTags(tags))
+}
+
+// Namespace 创建命名空间
+func (c *MemoryCache) Namespace(name string) Cache {
+	return newNamespace(c, name, name)
+}
+
+func (c *MemoryCache) tagStore() tagStore {
+	return c.tags
+}
+
+// Len 获取缓存条目数（可能包含已过期但尚未清理的条目）
+func (c *MemoryCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.len()
+	}
+	return n
+}
+
+// Size 获取缓存占用的字节数（按键和值的长度加上每个条目的固定开销估算）
+func (c *MemoryCache) Size() int64 {
+	var n int64
+	for _, s := range c.shards {
+		n += s.size()
+	}
+	return n
+}
+
+// DeleteExpired 立即清理已过期的条目和空闲的标签版本
+func (c *MemoryCache) DeleteExpired() {
+	deleteExpired(c.shards, c.onEvicted)
+	deleteExpired(c.tags.shards, nil)
 }
 
 // Close 关闭缓存
 func (c *MemoryCache) Close() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.closed {
-		return errors.New("cache: cache is closed")
+	if !c.closed.CompareAndSwap(false, true) {
+		return errClosed
 	}
 
-	c.closed = true
-	c.cache.Flush()
+	c.janitor.stop()
+	c.tags.janitor.stop()
+	for _, s := range c.shards {
+		s.clear(c.policy)
+	}
 	return nil
 }
+
+// janitor 定期清理过期条目，不引用MemoryCache，使未关闭的缓存可以被回收
+type janitor struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// startJanitor 启动清理
+func startJanitor(shards []*shard, onEvicted func(key string, value []byte, reason EvictionReason), interval time.Duration) *janitor {
+	j := &janitor{done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleteExpired(shards, onEvicted)
+			case <-j.done:
+				return
+			}
+		}
+	}()
+	return j
+}
+
+// stop 停止清理
+func (j *janitor) stop() {
+	j.once.Do(func() { close(j.done) })
+}
+
+// deleteExpired 清理所有分片中过期的条目
+func deleteExpired(shards []*shard, onEvicted func(key string, value []byte, reason EvictionReason)) {
+	now := time.Now().UnixNano()
+	for _, s := range shards {
+		notifyEvicted(onEvicted, s.deleteExpired(now))
+	}
+}
+
+// notifyEvicted 回调被移除的条目，在释放分片锁之后调用，回调中可以访问缓存
+func notifyEvicted(onEvicted func(key string, value []byte, reason EvictionReason), removed []evicted) {
+	if onEvicted == nil {
+		return
+	}
+	for _, e := range removed {
+		onEvicted(e.key, e.value, e.reason)
+	}
+}
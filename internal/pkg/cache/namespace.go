@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NamespaceCache 命名空间缓存，键带有命名空间前缀，可以独立清空
+// 前缀中包含命名空间的版本，Clear只递增版本，旧的键不再被访问并在过期后清除
+// 每次操作都需要读取命名空间的版本，对Redis多一次往返
+type NamespaceCache struct {
+	parent Cache
+	name   string
+	tag    string // 记录命名空间版本的标签，包含上级命名空间，全局唯一
+	tags   tagStore
+}
+
+// newNamespace 在parent之上创建命名空间
+func newNamespace(parent Cache, name string, path string) *NamespaceCache {
+	var store tagStore
+	if t, ok := parent.(tagged); ok {
+		store = t.tagStore()
+	} else {
+		store = newMemoryTags(0)
+	}
+
+	return &NamespaceCache{
+		parent: parent,
+		name:   name,
+		tag:    "ns:" + path,
+		tags:   store,
+	}
+}
+
+// prefix 获取当前版本的键前缀
+func (c *NamespaceCache) prefix(ctx context.Context) (string, error) {
+	versions, err := c.tags.tagVersions(ctx, []string{c.tag})
+	if err != nil {
+		return "", err
+	}
+	return c.name + ":" + strconv.FormatUint(versions[0], 10) + ":", nil
+}
+
+// writePrefix 获取写入使用的键前缀，命名空间的版本至少保留到写入的值过期
+func (c *NamespaceCache) writePrefix(ctx context.Context, expiration time.Duration) (string, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	retainTags(c.tags, []string{c.tag}, expiration)
+	return prefix, nil
+}
+
+// Get 获取缓存
+func (c *NamespaceCache) Get(ctx context.Context, key string) ([]byte, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.parent.Get(ctx, prefix+key)
+}
+
+// Set 设置缓存
+func (c *NamespaceCache) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	prefix, err := c.writePrefix(ctx, expiration)
+	if err != nil {
+		return err
+	}
+	return c.parent.Set(ctx, prefix+key, value, expiration)
+}
+
+// Delete 删除缓存
+func (c *NamespaceCache) Delete(ctx context.Context, key string) error {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return c.parent.Delete(ctx, prefix+key)
+}
+
+// Clear 清空命名空间，只递增版本，不影响其他命名空间
+func (c *NamespaceCache) Clear(ctx context.Context) error {
+	return c.tags.bumpTags(ctx, []string{c.tag})
+}
+
+// GetMulti 批量获取缓存
+func (c *NamespaceCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := c.parent.GetMulti(ctx, prefixKeys(prefix, keys))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, len(items))
+	for key, value := range items {
+		result[strings.TrimPrefix(key, prefix)] = value
+	}
+	return result, nil
+}
+
+// SetMulti 批量设置缓存
+func (c *NamespaceCache) SetMulti(ctx context.Context, items map[string][]byte, expiration time.Duration) error {
+	prefix, err := c.writePrefix(ctx, expiration)
+	if err != nil {
+		return err
+	}
+
+	prefixed := make(map[string][]byte, len(items))
+	for key, value := range items {
+		prefixed[prefix+key] = value
+	}
+	return c.parent.SetMulti(ctx, prefixed, expiration)
+}
+
+// DeleteMulti 批量删除缓存
+func (c *NamespaceCache) DeleteMulti(ctx context.Context, keys []string) error {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return c.parent.DeleteMulti(ctx, prefixKeys(prefix, keys))
+}
+
+// Incr 自增
+func (c *NamespaceCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.parent.Incr(ctx, prefix+key, delta)
+}
+
+// Decr 自减
+func (c *NamespaceCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.parent.Decr(ctx, prefix+key, delta)
+}
+
+// Exists 检查缓存是否存在
+func (c *NamespaceCache) Exists(ctx context.Context, key string) (bool, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return c.parent.Exists(ctx, prefix+key)
+}
+
+// Expire 设置过期时间
+func (c *NamespaceCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	prefix, err := c.writePrefix(ctx, expiration)
+	if err != nil {
+		return err
+	}
+	return c.parent.Expire(ctx, prefix+key, expiration)
+}
+
+// TTL 获取过期时间
+func (c *NamespaceCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.parent.TTL(ctx, prefix+key)
+}
+
+// GetOrLoad 获取缓存，未命中时调用loader加载，由上级缓存合并加载
+func (c *NamespaceCache) GetOrLoad(ctx context.Context, key string, loader Loader, expiration time.Duration, opts ...LoadOption) ([]byte, error) {
+	prefix, err := c.writePrefix(ctx, expiration)
+	if err != nil {
+		return nil, err
+	}
+	return c.parent.GetOrLoad(ctx, prefix+key, loader, expiration, opts...)
+}
+
+// SetWithTags 设置带标签的缓存，标签不区分命名空间
+func (c *NamespaceCache) SetWithTags(ctx context.Context, key string, value []byte, expiration time.Duration, tags ...string) error {
+	prefix, err := c.writePrefix(ctx, expiration)
+	if err != nil {
+		return err
+	}
+	return c.parent.SetWithTags(ctx, prefix+key, value, expiration, tags...)
+}
+
+// InvalidateTags 失效标签，作用于所有命名空间中带有这些标签的值
+func (c *NamespaceCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return c.parent.InvalidateTags(ctx, tags...)
+}
+
+// Namespace 创建下级命名空间，随上级命名空间一起清空
+func (c *NamespaceCache) Namespace(name string) Cache {
+	return newNamespace(c, name, strings.TrimPrefix(c.tag, "ns:")+":"+name)
+}
+
+// Close 命名空间不持有资源，上级缓存由创建方关闭
+func (c *NamespaceCache) Close() error {
+	return nil
+}
+
+func (c *NamespaceCache) tagStore() tagStore {
+	return c.tags
+}
+
+// prefixKeys 为键添加前缀
+func prefixKeys(prefix string, keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+	}
+	return prefixed
+}
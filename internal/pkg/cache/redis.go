@@ -2,9 +2,10 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,20 +14,24 @@ import (
 
 // RedisCache Redis缓存实现
 type RedisCache struct {
-	client     *redis.Client
+	client     redis.UniversalClient
 	expiration time.Duration
 	keyPrefix  string // 键前缀，用于区分不同应用的缓存
+	loads      *loadGroup
 }
 
-// NewRedisCache 创建Redis缓存
-func NewRedisCache(client *redis.Client, opts ...Option) *RedisCache {
+// NewRedisCache 创建Redis缓存，client可以是单机、哨兵或集群客户端
+// 多键操作按键拆分到管道中执行，集群模式下不要求键位于同一个槽
+func NewRedisCache(client redis.UniversalClient, opts ...Option) *RedisCache {
 	options := NewOptions(opts...)
 
-	return &RedisCache{
+	c := &RedisCache{
 		client:     client,
 		expiration: options.Expiration,
 		keyPrefix:  "cache:", // 默认前缀
 	}
+	c.loads = newLoadGroup(options.Expiration, options.Load, c)
+	return c
 }
 
 // WithKeyPrefix 设置键前缀
@@ -42,8 +47,17 @@ func (c *RedisCache) prefixKey(key string) string {
 	return c.keyPrefix + key
 }
 
-// Get 获取缓存
+// Get 获取缓存，标签已失效的值视为不存在
 func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.getRaw(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return untagValue(ctx, c, data)
+}
+
+// getRaw 获取未校验标签的原始值
+func (c *RedisCache) getRaw(ctx context.Context, key string) ([]byte, error) {
 	prefixedKey := c.prefixKey(key)
 	val, err := c.client.Get(ctx, prefixedKey).Bytes()
 	if err != nil {
@@ -71,16 +85,26 @@ func (c *RedisCache) Delete(ctx context.Context, key string) error {
 }
 
 // Clear 清空缓存（谨慎使用）
+// 集群模式下分别扫描每个主节点
 func (c *RedisCache) Clear(ctx context.Context) error {
-	// 使用SCAN命令查找所有带前缀的键
-	iter := c.client.Scan(ctx, 0, c.keyPrefix+"*", 100).Iterator()
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.clearNode(ctx, node)
+		})
+	}
+	return c.clearNode(ctx, c.client)
+}
+
+// clearNode 使用SCAN命令查找节点上所有带前缀的键并批量删除
+func (c *RedisCache) clearNode(ctx context.Context, node redis.Cmdable) error {
+	iter := node.Scan(ctx, 0, c.keyPrefix+"*", 100).Iterator()
 	var keys []string
 
 	for iter.Next(ctx) {
 		keys = append(keys, iter.Val())
 		// 当积累了一定数量的键时，批量删除
 		if len(keys) >= 1000 {
-			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			if err := c.deleteKeys(ctx, keys); err != nil {
 				return err
 			}
 			keys = keys[:0] // 清空切片但保留容量
@@ -89,7 +113,7 @@ func (c *RedisCache) Clear(ctx context.Context) error {
 
 	// 删除剩余的键
 	if len(keys) > 0 {
-		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		if err := c.deleteKeys(ctx, keys); err != nil {
 			return err
 		}
 	}
@@ -101,8 +125,27 @@ func (c *RedisCache) Clear(ctx context.Context) error {
 	return nil
 }
 
-// GetMulti 批量获取缓存
+// deleteKeys 在管道中逐个删除已带前缀的键，避免集群模式下跨槽的多键命令
+func (c *RedisCache) deleteKeys(ctx context.Context, keys []string) error {
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetMulti 批量获取缓存，标签已失效的键不包含在结果中
 func (c *RedisCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	items, err := c.getMultiRaw(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return untagValues(ctx, c, items)
+}
+
+// getMultiRaw 批量获取未校验标签的原始值
+func (c *RedisCache) getMultiRaw(ctx context.Context, keys []string) (map[string][]byte, error) {
 	if len(keys) == 0 {
 		return make(map[string][]byte), nil
 	}
@@ -169,7 +212,7 @@ func (c *RedisCache) DeleteMulti(ctx context.Context, keys []string) error {
 		prefixedKeys[i] = c.prefixKey(key)
 	}
 
-	return c.client.Del(ctx, prefixedKeys...).Err()
+	return c.deleteKeys(ctx, prefixedKeys)
 }
 
 // Incr 自增
@@ -211,296 +254,113 @@ func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
 
-// 缓存预热相关方法
-
-// WarmUp 缓存预热
-// keys: 需要预热的键列表
-// loader: 加载数据的函数，接收键并返回对应的值
-func (c *RedisCache) WarmUp(ctx context.Context, keys []string, loader func(ctx context.Context, key string) (any, error)) error {
-	if len(keys) == 0 {
-		return nil
-	}
+// GetOrLoad 获取缓存，未命中时调用loader加载
+// 并发请求在进程内合并，多个实例之间通过分布式锁保证只有一个实例调用loader
+func (c *RedisCache) GetOrLoad(ctx context.Context, key string, loader Loader, expiration time.Duration, opts ...LoadOption) ([]byte, error) {
+	return c.loads.getOrLoad(ctx, c, key, loader, expiration, opts)
+}
 
-	logger.Info("Warming up cache", "count", len(keys))
+// loadGroup 返回GetOrLoad的加载组
+func (c *RedisCache) loadGroup() *loadGroup {
+	return c.loads
+}
 
-	// 检查哪些键需要加载
-	pipe := c.client.Pipeline()
-	existCmds := make([]*redis.IntCmd, len(keys))
-	for i, key := range keys {
-		prefixedKey := c.prefixKey(key)
-		existCmds[i] = pipe.Exists(ctx, prefixedKey)
-	}
-	_, err := pipe.Exec(ctx)
+// SetWithTags 设置带标签的缓存
+func (c *RedisCache) SetWithTags(ctx context.Context, key string, value []byte, expiration time.Duration, tags ...string) error {
+	data, err := tagValue(ctx, c, tags, value)
 	if err != nil {
-		return fmt.Errorf("failed to check existing keys: %w", err)
+		return err
 	}
+	return c.Set(ctx, key, data, expiration)
+}
 
-	// 加载缺失的键
-	var missingKeys []string
-	var missingIndexes []int
-	for i, cmd := range existCmds {
-		exists, err := cmd.Result()
-		if err != nil {
-			return err
-		}
-		if exists == 0 {
-			missingKeys = append(missingKeys, keys[i])
-			missingIndexes = append(missingIndexes, i)
-		}
-	}
+// InvalidateTags 失效带有这些标签的缓存，所有实例共享标签版本
+func (c *RedisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return c.bumpTags(ctx, uniqueTags(tags))
+}
 
-	if len(missingKeys) == 0 {
-		logger.Info("All cache keys already exist, no need to warm up")
-		return nil
-	}
+// Namespace 创建命名空间，多个实例共享命名空间的版本
+func (c *RedisCache) Namespace(name string) Cache {
+	return newNamespace(c, name, name)
+}
 
-	logger.Info("Loading missing cache keys", "count", len(missingKeys))
+func (c *RedisCache) tagStore() tagStore {
+	return c
+}
 
-	// 并发加载数据
-	type result struct {
-		key   string
-		value any
-		err   error
-		index int
-	}
+// tagKey 标签版本的键，不设置过期时间，避免版本丢失后旧值重新生效
+func (c *RedisCache) tagKey(tag string) string {
+	return c.prefixKey("tag:" + tag)
+}
 
-	// 使用工作池限制并发数
-	concurrency := 10
-	if len(missingKeys) < concurrency {
-		concurrency = len(missingKeys)
+// tagVersions 获取标签的当前版本
+func (c *RedisCache) tagVersions(ctx context.Context, tags []string) ([]uint64, error) {
+	if len(tags) == 0 {
+		return nil, nil
 	}
 
-	jobs := make(chan int, len(missingKeys))
-	results := make(chan result, len(missingKeys))
-
-	// 启动工作协程
-	for w := 0; w < concurrency; w++ {
-		go func() {
-			for idx := range jobs {
-				key := missingKeys[idx]
-				value, err := loader(ctx, key)
-				results <- result{
-					key:   key,
-					value: value,
-					err:   err,
-					index: missingIndexes[idx],
-				}
-			}
-		}()
+	// 使用管道而不是MGET，集群模式下标签的键可能位于不同的槽
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(tags))
+	for i, tag := range tags {
+		cmds[i] = pipe.Get(ctx, c.tagKey(tag))
 	}
-
-	// 发送工作
-	for i := range missingKeys {
-		jobs <- i
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
 	}
-	close(jobs)
-
-	// 收集结果
-	pipe = c.client.Pipeline()
-	setCmds := make([]*redis.StatusCmd, len(missingKeys))
-	for i := 0; i < len(missingKeys); i++ {
-		r := <-results
-		if r.err != nil {
-			logger.Error("Failed to load data for cache key", "key", r.key, "error", r.err)
-			continue
-		}
 
-		// 序列化值
-		data, err := json.Marshal(r.value)
-		if err != nil {
-			logger.Error("Failed to marshal data for cache key", "key", r.key, "error", err)
+	versions := make([]uint64, len(tags))
+	for i, cmd := range cmds {
+		s, err := cmd.Result()
+		if err == redis.Nil {
 			continue
 		}
-
-		prefixedKey := c.prefixKey(r.key)
-		setCmds[i] = pipe.Set(ctx, prefixedKey, data, c.expiration)
-	}
-
-	// 执行管道
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to set cache values: %w", err)
-	}
-
-	logger.Info("Cache warm up completed", "count", len(missingKeys))
-	return nil
-}
-
-// 缓存穿透保护
-
-// GetWithProtection 获取缓存，带穿透保护
-// key: 缓存键
-// loader: 加载数据的函数，当缓存未命中时调用
-// expiration: 缓存过期时间，为0时使用默认过期时间
-func (c *RedisCache) GetWithProtection(ctx context.Context, key string, loader func(ctx context.Context) (any, error), expiration time.Duration) (any, error) {
-	prefixedKey := c.prefixKey(key)
-
-	// 尝试从缓存获取
-	data, err := c.client.Get(ctx, prefixedKey).Bytes()
-	if err == nil {
-		// 缓存命中，解析数据
-		var result any
-		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, err
-		}
-		return result, nil
-	} else if err != redis.Nil {
-		// 发生了除了键不存在之外的错误
-		return nil, err
-	}
-
-	// 缓存未命中，使用分布式锁防止缓存穿透
-	lockKey := c.prefixKey("lock:" + key)
-	lockValue := fmt.Sprintf("%d", time.Now().UnixNano())
-
-	// 尝试获取锁，过期时间5秒
-	locked, err := c.client.SetNX(ctx, lockKey, lockValue, 5*time.Second).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	// 如果没有获取到锁，说明有其他请求正在加载数据
-	if !locked {
-		// 等待一段时间后重试
-		time.Sleep(100 * time.Millisecond)
-		return c.GetWithProtection(ctx, key, loader, expiration)
-	}
-
-	// 获取到锁，加载数据
-	defer c.client.Del(ctx, lockKey)
-
-	// 再次检查缓存，可能在获取锁的过程中已经有其他请求加载了数据
-	data, err = c.client.Get(ctx, prefixedKey).Bytes()
-	if err == nil {
-		// 缓存命中，解析数据
-		var result any
-		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, err
+		if versions[i], err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("cache: invalid version of tag %s: %w", tags[i], err)
 		}
-		return result, nil
-	} else if err != redis.Nil {
-		// 发生了除了键不存在之外的错误
-		return nil, err
-	}
-
-	// 加载数据
-	result, err := loader(ctx)
-	if err != nil {
-		return nil, err
 	}
-
-	// 序列化数据
-	data, err = json.Marshal(result)
-	if err != nil {
-		return nil, err
-	}
-
-	// 设置缓存
-	if expiration == 0 {
-		expiration = c.expiration
-	}
-	if err := c.client.Set(ctx, prefixedKey, data, expiration).Err(); err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return versions, nil
 }
 
-// GetWithBloomFilter 使用布隆过滤器防止缓存穿透
-// key: 缓存键
-// loader: 加载数据的函数，当缓存未命中时调用
-// bloomFilterKey: 布隆过滤器的键
-// expiration: 缓存过期时间，为0时使用默认过期时间
-func (c *RedisCache) GetWithBloomFilter(ctx context.Context, key string, loader func(ctx context.Context) (any, error), bloomFilterKey string, expiration time.Duration) (any, error) {
-	prefixedKey := c.prefixKey(key)
-
-	// 尝试从缓存获取
-	data, err := c.client.Get(ctx, prefixedKey).Bytes()
-	if err == nil {
-		// 缓存命中，解析数据
-		var result any
-		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, err
-		}
-		return result, nil
-	} else if err != redis.Nil {
-		// 发生了除了键不存在之外的错误
-		return nil, err
-	}
-
-	// 缓存未命中，检查布隆过滤器
-	// 注意：这里假设布隆过滤器已经在Redis中设置好了
-	// 实际使用时，需要先初始化布隆过滤器并添加所有有效的键
-	exists, err := c.client.Exists(ctx, bloomFilterKey).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	// 如果布隆过滤器不存在，直接加载数据
-	if exists == 0 {
-		// 布隆过滤器不存在，直接加载数据
-		return c.loadAndCache(ctx, key, loader, expiration)
-	}
-
-	// 检查键是否在布隆过滤器中
-	// 注意：这里使用了简化的实现，实际的布隆过滤器需要使用专门的库或Redis模块
-	// 例如RedisBloom模块: https://github.com/RedisBloom/RedisBloom
-	inFilter, err := c.client.SIsMember(ctx, bloomFilterKey, key).Result()
-	if err != nil {
-		return nil, err
+// bumpTags 递增标签版本
+func (c *RedisCache) bumpTags(ctx context.Context, tags []string) error {
+	if len(tags) == 0 {
+		return nil
 	}
 
-	// 如果键不在布隆过滤器中，说明数据不存在，返回空值
-	if !inFilter {
-		return nil, errors.New("key does not exist (filtered by bloom filter)")
+	pipe := c.client.Pipeline()
+	for _, tag := range tags {
+		pipe.Incr(ctx, c.tagKey(tag))
 	}
-
-	// 键在布隆过滤器中，加载数据
-	return c.loadAndCache(ctx, key, loader, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// loadAndCache 加载数据并缓存
-func (c *RedisCache) loadAndCache(ctx context.Context, key string, loader func(ctx context.Context) (any, error), expiration time.Duration) (any, error) {
-	// 加载数据
-	result, err := loader(ctx)
-	if err != nil {
-		return nil, err
-	}
+// unlockScript 只删除自己持有的锁，避免锁过期后误删其他实例的锁
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
 
-	// 序列化数据
-	data, err := json.Marshal(result)
-	if err != nil {
-		return nil, err
+// tryLock 尝试获取加载锁
+func (c *RedisCache) tryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, err
 	}
 
-	// 设置缓存
-	prefixedKey := c.prefixKey(key)
-	if expiration == 0 {
-		expiration = c.expiration
-	}
-	if err := c.client.Set(ctx, prefixedKey, data, expiration).Err(); err != nil {
-		return nil, err
+	lockKey := c.prefixKey("lock:" + key)
+	value := hex.EncodeToString(token)
+	ok, err := c.client.SetNX(ctx, lockKey, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
 	}
 
-	return result, nil
-}
-
-// SetNilValue 设置空值缓存，用于缓存穿透保护
-// 当查询结果为空时，缓存一个特殊的空值，避免频繁查询数据库
-func (c *RedisCache) SetNilValue(ctx context.Context, key string, expiration time.Duration) error {
-	if expiration == 0 {
-		// 空值缓存的过期时间通常比正常数据短
-		expiration = c.expiration / 10
-		if expiration < time.Second {
-			expiration = time.Second
+	return func() {
+		if err := unlockScript.Run(context.WithoutCancel(ctx), c.client, []string{lockKey}, value).Err(); err != nil {
+			logger.WarnContext(ctx, "Failed to release cache lock", "key", key, "error", err)
 		}
-	}
-
-	prefixedKey := c.prefixKey(key)
-	return c.client.Set(ctx, prefixedKey, "nil", expiration).Err()
-}
-
-// IsNilValue 检查是否为空值缓存
-func (c *RedisCache) IsNilValue(ctx context.Context, data []byte) bool {
-	return string(data) == "nil"
+	}, true, nil
 }
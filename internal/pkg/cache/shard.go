@@ -0,0 +1,329 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// EvictionPolicy 内存缓存的淘汰策略
+type EvictionPolicy string
+
+const (
+	// EvictionLRU 淘汰最近最少使用的条目
+	EvictionLRU EvictionPolicy = "lru"
+	// EvictionTinyLFU W-TinyLFU：新条目先进入窗口，按访问频率决定是否淘汰主区的条目，适合访问分布不均匀的场景
+	EvictionTinyLFU EvictionPolicy = "tinylfu"
+)
+
+// EvictionReason 条目被移除的原因
+type EvictionReason int
+
+const (
+	// EvictionExpired 过期
+	EvictionExpired EvictionReason = iota + 1
+	// EvictionCapacity 超出条目数或字节数限制被淘汰
+	EvictionCapacity
+	// EvictionDeleted 被删除
+	EvictionDeleted
+	// EvictionReplaced 被新值覆盖
+	EvictionReplaced
+)
+
+// String 返回原因名称
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionExpired:
+		return "expired"
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionDeleted:
+		return "deleted"
+	case EvictionReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// itemOverhead 每个条目除键和值之外的估算开销（字节）
+const itemOverhead = 64
+
+// item 内存缓存条目
+type item struct {
+	key      string
+	value    []byte
+	hash     uint64
+	expireAt int64 // UnixNano，0表示不过期
+	size     int64
+	elem     *list.Element
+	segment  uint8 // W-TinyLFU中所在的区域
+}
+
+// expired 是否已过期
+func (it *item) expired(now int64) bool {
+	return it.expireAt > 0 && now >= it.expireAt
+}
+
+// itemSize 条目占用的字节数
+func itemSize(key string, value []byte) int64 {
+	return int64(len(key) + len(value) + itemOverhead)
+}
+
+// evicted 被移除的条目，在释放锁之后回调
+type evicted struct {
+	key    string
+	value  []byte
+	reason EvictionReason
+}
+
+// policy 淘汰策略，由分片在持有锁时调用
+type policy interface {
+	// record 记录一次访问（包括未命中），用于统计频率
+	record(hash uint64)
+
+	// add 加入新条目，full表示分片已超出容量
+	add(it *item, full bool)
+
+	// access 条目被访问
+	access(it *item)
+
+	// remove 移除条目
+	remove(it *item)
+
+	// victim 返回下一个要淘汰的条目
+	victim() *item
+}
+
+// newPolicy 创建淘汰策略，maxEntries和maxBytes为分片的容量
+func newPolicy(name EvictionPolicy, maxEntries int, maxBytes int64) policy {
+	if name == EvictionTinyLFU {
+		return newTinyLFU(maxEntries, maxBytes)
+	}
+	return &lruPolicy{}
+}
+
+// lruPolicy 最近最少使用
+type lruPolicy struct {
+	list list.List
+}
+
+func (p *lruPolicy) record(hash uint64) {}
+
+func (p *lruPolicy) add(it *item, full bool) {
+	it.elem = p.list.PushFront(it)
+}
+
+func (p *lruPolicy) access(it *item) {
+	p.list.MoveToFront(it.elem)
+}
+
+func (p *lruPolicy) remove(it *item) {
+	p.list.Remove(it.elem)
+}
+
+func (p *lruPolicy) victim() *item {
+	if back := p.list.Back(); back != nil {
+		return back.Value.(*item)
+	}
+	return nil
+}
+
+// shard 内存缓存分片，每个分片独立加锁和淘汰
+type shard struct {
+	mu         sync.Mutex
+	items      map[string]*item
+	policy     policy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+}
+
+// newShard 创建分片，maxEntries和maxBytes为0表示不限制
+func newShard(name EvictionPolicy, maxEntries int, maxBytes int64) *shard {
+	return &shard{
+		items:      make(map[string]*item),
+		policy:     newPolicy(name, maxEntries, maxBytes),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// get 获取条目并记录访问，已过期的条目被移除
+func (s *shard) get(key string, hash uint64, now int64) ([]byte, bool, []evicted) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy.record(hash)
+	it, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if it.expired(now) {
+		s.removeItem(it)
+		return nil, false, []evicted{{it.key, it.value, EvictionExpired}}
+	}
+
+	s.policy.access(it)
+	return it.value, true, nil
+}
+
+// peek 获取条目，不记录访问
+func (s *shard) peek(key string, now int64) (*item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[key]
+	if !ok || it.expired(now) {
+		return nil, false
+	}
+	copied := *it
+	return &copied, true
+}
+
+// set 写入条目，超出容量时按策略淘汰，单个条目超过分片的字节数限制时不写入
+func (s *shard) set(key string, hash uint64, value []byte, expireAt int64) []evicted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy.record(hash)
+	return s.setLocked(key, hash, value, expireAt)
+}
+
+func (s *shard) setLocked(key string, hash uint64, value []byte, expireAt int64) []evicted {
+	var removed []evicted
+	size := itemSize(key, value)
+
+	if it, ok := s.items[key]; ok {
+		removed = append(removed, evicted{it.key, it.value, EvictionReplaced})
+		if s.maxBytes > 0 && size > s.maxBytes {
+			s.removeItem(it)
+			return append(removed, evicted{key, value, EvictionCapacity})
+		}
+		s.bytes += size - it.size
+		it.value, it.size, it.expireAt = value, size, expireAt
+		s.policy.access(it)
+	} else {
+		if s.maxBytes > 0 && size > s.maxBytes {
+			return append(removed, evicted{key, value, EvictionCapacity})
+		}
+		it := &item{key: key, value: value, hash: hash, expireAt: expireAt, size: size}
+		s.items[key] = it
+		s.bytes += size
+		s.policy.add(it, s.full())
+	}
+
+	for s.full() {
+		victim := s.policy.victim()
+		if victim == nil {
+			break
+		}
+		s.removeItem(victim)
+		removed = append(removed, evicted{victim.key, victim.value, EvictionCapacity})
+	}
+	return removed
+}
+
+// incr 将整数值加上delta，条目不存在时从0开始并使用expireAt
+func (s *shard) incr(key string, hash uint64, delta int64, now, expireAt int64) (int64, []evicted, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy.record(hash)
+	var current int64
+	if it, ok := s.items[key]; ok && !it.expired(now) {
+		n, err := strconv.ParseInt(string(it.value), 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("cache: value of %s is not an integer", key)
+		}
+		current, expireAt = n, it.expireAt
+	}
+
+	current += delta
+	removed := s.setLocked(key, hash, []byte(strconv.FormatInt(current, 10)), expireAt)
+	// 覆盖旧值不需要回调
+	if len(removed) > 0 && removed[0].key == key && removed[0].reason == EvictionReplaced {
+		removed = removed[1:]
+	}
+	return current, removed, nil
+}
+
+// update 在持有锁时修改未过期的条目，fn返回false时不修改
+func (s *shard) update(key string, now int64, fn func(it *item) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[key]
+	if !ok || it.expired(now) {
+		return false
+	}
+	return fn(it)
+}
+
+// delete 删除条目
+func (s *shard) delete(key string) []evicted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	s.removeItem(it)
+	return []evicted{{it.key, it.value, EvictionDeleted}}
+}
+
+// clear 清空分片
+func (s *shard) clear(name EvictionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = make(map[string]*item)
+	s.policy = newPolicy(name, s.maxEntries, s.maxBytes)
+	s.bytes = 0
+}
+
+// deleteExpired 移除已过期的条目
+func (s *shard) deleteExpired(now int64) []evicted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []evicted
+	for _, it := range s.items {
+		if it.expired(now) {
+			s.removeItem(it)
+			removed = append(removed, evicted{it.key, it.value, EvictionExpired})
+		}
+	}
+	return removed
+}
+
+// len 条目数
+func (s *shard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// size 占用的字节数
+func (s *shard) size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bytes
+}
+
+// full 是否超出容量
+func (s *shard) full() bool {
+	return (s.maxEntries > 0 && len(s.items) > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+// removeItem 移除条目
+func (s *shard) removeItem(it *item) {
+	delete(s.items, it.key)
+	s.bytes -= it.size
+	s.policy.remove(it)
+}
@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"math/bits"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// 带标签的值以数据头记录写入时各标签的版本，读取时版本不一致视为不存在
+// 格式：magic(3) | 标签数(uvarint) | 每个标签：长度(uvarint) 名称 版本(uvarint) | value
+const tagMagic = "\xffGT"
+
+// tagStore 标签版本存储，失效标签只需递增版本，不需要扫描键
+type tagStore interface {
+	// tagVersions 获取标签的当前版本，不存在的标签版本为0
+	tagVersions(ctx context.Context, tags []string) ([]uint64, error)
+
+	// bumpTags 递增标签版本
+	bumpTags(ctx context.Context, tags []string) error
+}
+
+// tagged 支持标签的缓存，两级缓存和命名空间共享底层缓存的标签版本
+type tagged interface {
+	tagStore() tagStore
+}
+
+// rawGetter 读取未校验标签的原始值，两级缓存使用原始值回填本地缓存
+type rawGetter interface {
+	getRaw(ctx context.Context, key string) ([]byte, error)
+	getMultiRaw(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// defaultTagTTL 进程内标签版本默认的空闲过期时间
+const defaultTagTTL = 24 * time.Hour
+
+// memoryTags 进程内的标签版本，保存在分片中，读取或失效时续期，空闲超过ttl且没有未过期的缓存值引用的标签被清除
+// 标签首次使用和每次失效时分配全局递增的新版本，被清除的标签再次使用时版本一定与之前不同，
+// 引用它的缓存值视为失效，不会因为版本重置而读到失效前的值
+type memoryTags struct {
+	shards  []*shard
+	shift   uint
+	seed    maphash.Seed
+	ttl     time.Duration
+	next    atomic.Uint64 // 最近分配的版本
+	janitor *janitor
+}
+
+// newMemoryTags 创建进程内的标签版本存储，ttl为0时使用默认值
+func newMemoryTags(ttl time.Duration) *memoryTags {
+	if ttl <= 0 {
+		ttl = defaultTagTTL
+	}
+	m := &memoryTags{
+		shards: make([]*shard, defaultShards),
+		shift:  uint(64 - bits.TrailingZeros(uint(defaultShards))),
+		seed:   maphash.MakeSeed(),
+		ttl:    ttl,
+	}
+	for i := range m.shards {
+		m.shards[i] = newShard(EvictionLRU, 0, 0)
+	}
+
+	// 定期清除空闲的标签，存储未使用后被回收时停止清理
+	m.janitor = startJanitor(m.shards, nil, min(defaultJanitorCycle, max(ttl/2, time.Second)))
+	runtime.AddCleanup(m, func(j *janitor) { j.stop() }, m.janitor)
+	return m
+}
+
+func (m *memoryTags) tagVersions(ctx context.Context, tags []string) ([]uint64, error) {
+	now := time.Now().UnixNano()
+	versions := make([]uint64, len(tags))
+	for i, tag := range tags {
+		versions[i] = m.version(tag, false, now)
+	}
+	return versions, nil
+}
+
+func (m *memoryTags) bumpTags(ctx context.Context, tags []string) error {
+	now := time.Now().UnixNano()
+	for _, tag := range tags {
+		m.version(tag, true, now)
+	}
+	return nil
+}
+
+// shard 标签所在的分片
+func (m *memoryTags) shard(tag string) (*shard, uint64) {
+	hash := maphash.String(m.seed, tag)
+	return m.shards[hash>>m.shift], hash
+}
+
+// version 获取标签的版本并续期，标签不存在或bump为true时分配新版本
+func (m *memoryTags) version(tag string, bump bool, now int64) uint64 {
+	s, hash := m.shard(tag)
+	expireAt := now + int64(m.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if it, ok := s.items[tag]; ok && !it.expired(now) && !bump {
+		it.expireAt = max(it.expireAt, expireAt)
+		version, _ := binary.Uvarint(it.value)
+		return version
+	}
+
+	version := m.next.Add(1)
+	if it, ok := s.items[tag]; ok && !it.expired(now) {
+		expireAt = max(it.expireAt, expireAt)
+	}
+	s.setLocked(tag, hash, binary.AppendUvarint(nil, version), expireAt)
+	return version
+}
+
+// retain 标签至少保留到expiration之后，引用它们的缓存值过期之前不会因为标签被清除而失效
+func (m *memoryTags) retain(tags []string, expiration time.Duration) {
+	if expiration <= 0 {
+		return
+	}
+	expireAt := time.Now().Add(expiration).UnixNano()
+	for _, tag := range tags {
+		s, _ := m.shard(tag)
+		s.mu.Lock()
+		if it, ok := s.items[tag]; ok && it.expireAt < expireAt {
+			it.expireAt = expireAt
+		}
+		s.mu.Unlock()
+	}
+}
+
+// retainTags 进程内的标签版本按缓存值的过期时间保留，其他存储的标签版本不会被清除
+// expiration为0时缓存值的过期时间未知，标签只按空闲时间保留
+func retainTags(store tagStore, tags []string, expiration time.Duration) {
+	if m, ok := store.(*memoryTags); ok {
+		m.retain(tags, expiration)
+	}
+}
+
+// tagValue 以标签的当前版本包装值
+func tagValue(ctx context.Context, store tagStore, tags []string, value []byte) ([]byte, error) {
+	tags = uniqueTags(tags)
+	if len(tags) == 0 {
+		return value, nil
+	}
+
+	versions, err := store.tagVersions(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+	return encodeTagged(tags, versions, value), nil
+}
+
+// untagValue 校验标签版本并返回原始值，标签已失效时返回ErrNotFound
+func untagValue(ctx context.Context, store tagStore, data []byte) ([]byte, error) {
+	tags, versions, value, ok := decodeTagged(data)
+	if !ok {
+		return data, nil
+	}
+
+	current, err := store.tagVersions(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(versions, current) {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// untagValues 批量校验标签版本，标签已失效的键不包含在结果中
+func untagValues(ctx context.Context, store tagStore, items map[string][]byte) (map[string][]byte, error) {
+	type taggedItem struct {
+		tags     []string
+		versions []uint64
+		value    []byte
+	}
+
+	// 合并所有标签，只查询一次版本
+	pending := make(map[string]taggedItem)
+	index := make(map[string]int)
+	var all []string
+	for key, data := range items {
+		tags, versions, value, ok := decodeTagged(data)
+		if !ok {
+			continue
+		}
+		pending[key] = taggedItem{tags: tags, versions: versions, value: value}
+		for _, tag := range tags {
+			if _, ok := index[tag]; !ok {
+				index[tag] = len(all)
+				all = append(all, tag)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return items, nil
+	}
+
+	current, err := store.tagVersions(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte, len(items))
+	for key, data := range items {
+		item, ok := pending[key]
+		if !ok {
+			result[key] = data
+			continue
+		}
+		valid := true
+		for i, tag := range item.tags {
+			if current[index[tag]] != item.versions[i] {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			result[key] = item.value
+		}
+	}
+	return result, nil
+}
+
+// encodeTagged 编码带标签的值
+func encodeTagged(tags []string, versions []uint64, value []byte) []byte {
+	data := []byte(tagMagic)
+	data = binary.AppendUvarint(data, uint64(len(tags)))
+	for i, tag := range tags {
+		data = binary.AppendUvarint(data, uint64(len(tag)))
+		data = append(data, tag...)
+		data = binary.AppendUvarint(data, versions[i])
+	}
+	return append(data, value...)
+}
+
+// decodeTagged 解码带标签的值，不是带标签的值时返回false
+func decodeTagged(data []byte) ([]string, []uint64, []byte, bool) {
+	if len(data) < len(tagMagic) || string(data[:len(tagMagic)]) != tagMagic {
+		return nil, nil, nil, false
+	}
+	rest := data[len(tagMagic):]
+
+	count, n := binary.Uvarint(rest)
+	if n <= 0 || count > uint64(len(rest)) {
+		return nil, nil, nil, false
+	}
+	rest = rest[n:]
+
+	tags := make([]string, count)
+	versions := make([]uint64, count)
+	for i := range tags {
+		size, n := binary.Uvarint(rest)
+		if n <= 0 || size > uint64(len(rest)-n) {
+			return nil, nil, nil, false
+		}
+		tags[i] = string(rest[n : n+int(size)])
+		rest = rest[n+int(size):]
+
+		versions[i], n = binary.Uvarint(rest)
+		if n <= 0 {
+			return nil, nil, nil, false
+		}
+		rest = rest[n:]
+	}
+	return tags, versions, rest, true
+}
+
+// uniqueTags 去除重复和空的标签
+func uniqueTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,196 @@
+package cache
+
+import "container/list"
+
+// W-TinyLFU中条目所在的区域
+const (
+	segmentWindow    uint8 = iota // 窗口：新条目先进入窗口
+	segmentProbation              // 主区的试用区：从窗口晋升或从保护区降级的条目
+	segmentProtected              // 主区的保护区：在试用区再次被访问的条目
+)
+
+// tinyLFU W-TinyLFU淘汰策略
+// 窗口占容量的1%，按LRU淘汰；窗口溢出的条目与试用区的末尾比较访问频率，频率更高的留下
+// 主区按SLRU组织，保护区占主区的80%
+type tinyLFU struct {
+	window    list.List
+	probation list.List
+	protected list.List
+	capacity  int
+	sketch    *countMinSketch
+}
+
+// newTinyLFU 创建W-TinyLFU策略
+// 未限制条目数时按当前条目数计算各区域的大小，频率统计的宽度按平均每个条目256字节估算
+func newTinyLFU(maxEntries int, maxBytes int64) *tinyLFU {
+	estimate := maxEntries
+	if estimate == 0 {
+		estimate = int(min(maxBytes/256, 1<<20))
+	}
+	return &tinyLFU{
+		capacity: maxEntries,
+		sketch:   newCountMinSketch(estimate),
+	}
+}
+
+func (p *tinyLFU) record(hash uint64) {
+	p.sketch.increment(hash)
+}
+
+func (p *tinyLFU) add(it *item, full bool) {
+	it.segment = segmentWindow
+	it.elem = p.window.PushFront(it)
+
+	// 未满时窗口溢出的条目直接进入试用区，已满时由victim决定去留
+	if !full {
+		for p.window.Len() > p.windowCap() {
+			p.move(p.window.Back().Value.(*item), segmentProbation)
+		}
+	}
+}
+
+func (p *tinyLFU) access(it *item) {
+	switch it.segment {
+	case segmentWindow:
+		p.window.MoveToFront(it.elem)
+	case segmentProbation:
+		p.move(it, segmentProtected)
+		for p.protected.Len() > p.protectedCap() {
+			p.move(p.protected.Back().Value.(*item), segmentProbation)
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(it.elem)
+	}
+}
+
+func (p *tinyLFU) remove(it *item) {
+	p.list(it.segment).Remove(it.elem)
+}
+
+func (p *tinyLFU) victim() *item {
+	main := p.mainVictim()
+	if p.window.Len() <= p.windowCap() && main != nil {
+		return main
+	}
+
+	back := p.window.Back()
+	if back == nil {
+		return main
+	}
+	candidate := back.Value.(*item)
+	if main == nil {
+		return candidate
+	}
+
+	// 窗口溢出的候选者频率更高时进入试用区，淘汰主区的条目
+	if p.sketch.estimate(candidate.hash) > p.sketch.estimate(main.hash) {
+		p.move(candidate, segmentProbation)
+		return main
+	}
+	return candidate
+}
+
+// mainVictim 主区中下一个要淘汰的条目
+func (p *tinyLFU) mainVictim() *item {
+	if back := p.probation.Back(); back != nil {
+		return back.Value.(*item)
+	}
+	if back := p.protected.Back(); back != nil {
+		return back.Value.(*item)
+	}
+	return nil
+}
+
+// move 将条目移到另一个区域的头部
+func (p *tinyLFU) move(it *item, segment uint8) {
+	p.list(it.segment).Remove(it.elem)
+	it.segment = segment
+	it.elem = p.list(segment).PushFront(it)
+}
+
+// list 区域对应的链表
+func (p *tinyLFU) list(segment uint8) *list.List {
+	switch segment {
+	case segmentProbation:
+		return &p.probation
+	case segmentProtected:
+		return &p.protected
+	default:
+		return &p.window
+	}
+}
+
+// size 容量，未限制条目数时使用当前条目数
+func (p *tinyLFU) size() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return p.window.Len() + p.probation.Len() + p.protected.Len()
+}
+
+// windowCap 窗口的容量
+func (p *tinyLFU) windowCap() int {
+	return max(1, p.size()/100)
+}
+
+// protectedCap 保护区的容量
+func (p *tinyLFU) protectedCap() int {
+	return max(1, (p.size()-p.windowCap())*8/10)
+}
+
+// countMinSketch 4位计数的Count-Min Sketch，估算访问频率
+// 累计记录次数达到宽度的10倍后所有计数减半，使频率随时间衰减
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint32
+	additions int
+	resetAt   int
+}
+
+// newCountMinSketch 创建频率统计，宽度按容量取2的幂，未知容量时使用默认宽度
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 1024
+	for width < capacity && width < 1<<20 {
+		width <<= 1
+	}
+
+	s := &countMinSketch{mask: uint32(width - 1), resetAt: width * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index 第i行的位置，使用双重哈希
+func (s *countMinSketch) index(hash uint64, i int) uint32 {
+	h1, h2 := uint32(hash), uint32(hash>>32)|1
+	return (h1 + uint32(i)*h2) & s.mask
+}
+
+// increment 记录一次访问
+func (s *countMinSketch) increment(hash uint64) {
+	for i := range s.rows {
+		if idx := s.index(hash, i); s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+// estimate 估算访问频率
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	result := uint8(15)
+	for i := range s.rows {
+		result = min(result, s.rows[i][s.index(hash, i)])
+	}
+	return result
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// ErrDecode 缓存值无法解码为目标类型，通常是类型或编解码器变更后读取了旧值
+var ErrDecode = errors.New("cache: decode value failed")
+
+// TypedCache 类型化缓存，在任意Cache之上按编解码器读写T类型的值
+type TypedCache[T any] struct {
+	cache Cache
+	codec Codec
+}
+
+// NewTypedCache 创建类型化缓存，默认使用JSON编解码，可通过WithCodec指定
+func NewTypedCache[T any](cache Cache, opts ...Option) *TypedCache[T] {
+	options := NewOptions(opts...)
+	if options.Codec == nil {
+		options.Codec = JSONCodec
+	}
+
+	return &TypedCache[T]{
+		cache: cache,
+		codec: options.Codec,
+	}
+}
+
+// Get 获取缓存，不存在时返回ErrNotFound，无法解码时返回ErrDecode
+func (c *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	data, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return value, err
+	}
+	return c.decode(key, data)
+}
+
+// Set 设置缓存，expiration为0时使用底层缓存的默认过期时间
+func (c *TypedCache[T]) Set(ctx context.Context, key string, value T, expiration time.Duration) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache: encode %s: %w", key, err)
+	}
+	return c.cache.Set(ctx, key, data, expiration)
+}
+
+// SetWithTags 设置带标签的缓存，任一标签失效后读取时视为不存在
+func (c *TypedCache[T]) SetWithTags(ctx context.Context, key string, value T, expiration time.Duration, tags ...string) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache: encode %s: %w", key, err)
+	}
+	return c.cache.SetWithTags(ctx, key, data, expiration, tags...)
+}
+
+// Delete 删除缓存
+func (c *TypedCache[T]) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+// GetMulti 批量获取缓存，不存在或无法解码的键不包含在结果中
+func (c *TypedCache[T]) GetMulti(ctx context.Context, keys []string) (map[string]T, error) {
+	items, err := c.cache.GetMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]T, len(items))
+	for key, data := range items {
+		value, err := c.decode(key, data)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to decode cache value", "key", key, "error", err)
+			continue
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// SetMulti 批量设置缓存
+func (c *TypedCache[T]) SetMulti(ctx context.Context, items map[string]T, expiration time.Duration) error {
+	encoded := make(map[string][]byte, len(items))
+	for key, value := range items {
+		data, err := c.codec.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cache: encode %s: %w", key, err)
+		}
+		encoded[key] = data
+	}
+	return c.cache.SetMulti(ctx, encoded, expiration)
+}
+
+// GetOrLoad 获取缓存，不存在或无法解码时调用loader加载并写入缓存
+// 并发加载合并和过期策略由底层缓存的GetOrLoad实现，loader返回ErrNotFound时按NilValueTTL缓存空值
+func (c *TypedCache[T]) GetOrLoad(ctx context.Context, key string, loader func(ctx context.Context) (T, error), expiration time.Duration, opts ...LoadOption) (T, error) {
+	load := func(ctx context.Context) ([]byte, error) {
+		value, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.codec.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("cache: encode %s: %w", key, err)
+		}
+		return data, nil
+	}
+
+	value, err := c.getOrLoad(ctx, key, load, expiration, opts)
+	if !errors.Is(err, ErrDecode) {
+		return value, err
+	}
+
+	// 类型或编解码器变更前写入的旧值，删除后重新加载
+	logger.WarnContext(ctx, "Failed to decode cache value, reloading", "key", key, "error", err)
+	if err := c.cache.Delete(ctx, key); err != nil {
+		logger.WarnContext(ctx, "Failed to delete cache", "key", key, "error", err)
+	}
+	return c.getOrLoad(ctx, key, load, expiration, opts)
+}
+
+// WarmUp 缓存预热，为不存在的键并发调用loader加载，单个键加载失败时记录日志并跳过
+func (c *TypedCache[T]) WarmUp(ctx context.Context, keys []string, loader func(ctx context.Context, key string) (T, error), expiration time.Duration) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	existing, err := c.cache.GetMulti(ctx, keys)
+	if err != nil {
+		return fmt.Errorf("failed to check existing keys: %w", err)
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if _, ok := existing[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		logger.InfoContext(ctx, "All cache keys already exist, no need to warm up")
+		return nil
+	}
+
+	logger.InfoContext(ctx, "Loading missing cache keys", "count", len(missing))
+
+	// 使用工作池限制并发数
+	concurrency := min(10, len(missing))
+	jobs := make(chan string)
+	loaded := make(map[string]T, len(missing))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				value, err := loader(ctx, key)
+				if err != nil {
+					logger.ErrorContext(ctx, "Failed to load data for cache key", "key", key, "error", err)
+					continue
+				}
+				mu.Lock()
+				loaded[key] = value
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, key := range missing {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := c.SetMulti(ctx, loaded, expiration); err != nil {
+		return fmt.Errorf("failed to set cache values: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Cache warm up completed", "count", len(loaded))
+	return nil
+}
+
+// getOrLoad 调用底层缓存的GetOrLoad并解码
+func (c *TypedCache[T]) getOrLoad(ctx context.Context, key string, load Loader, expiration time.Duration, opts []LoadOption) (T, error) {
+	data, err := c.cache.GetOrLoad(ctx, key, load, expiration, opts...)
+	if err != nil {
+		var value T
+		return value, err
+	}
+	return c.decode(key, data)
+}
+
+// decode 解码缓存值，GetOrLoad写入的空值返回ErrNotFound
+func (c *TypedCache[T]) decode(key string, data []byte) (T, error) {
+	var value T
+	if e, ok := decodeEntry(data); ok {
+		if e.isNil {
+			return value, ErrNotFound
+		}
+		data = e.value
+	}
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("%w: %s: %v", ErrDecode, key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,158 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// DBLocker 基于数据库的锁：Postgres使用pg_advisory_lock，MySQL使用GET_LOCK，SQLite使用数据库文件旁的文件锁
+// Postgres和MySQL的锁属于会话，持有期间占用一个连接，连接断开后数据库自动释放；续期只检查连接是否可用
+// 数据库锁不提供栅栏令牌，Token始终为0
+type DBLocker struct {
+	base
+	db      *sql.DB
+	dialect string
+	dir     string // SQLite锁文件所在的目录
+	prefix  string // SQLite锁文件名前缀
+}
+
+var _ Locker = (*DBLocker)(nil)
+
+// NewDBLocker 创建数据库锁，支持postgres、mysql和sqlite
+func NewDBLocker(db *gorm.DB, opts ...Option) (*DBLocker, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("lock: get database connection: %w", err)
+	}
+
+	l := &DBLocker{db: sqlDB, dialect: db.Dialector.Name()}
+	switch l.dialect {
+	case "postgres", "mysql":
+	case "sqlite":
+		l.dir, l.prefix = sqliteLockPath(db.Dialector)
+	default:
+		return nil, fmt.Errorf("lock: database %s does not support advisory locks", l.dialect)
+	}
+
+	l.base = base{driver: l, options: newOptions(DefaultOptions, opts)}
+	return l, nil
+}
+
+// sqliteLockPath 锁文件放在数据库文件所在的目录，内存数据库使用临时目录
+func sqliteLockPath(dialector gorm.Dialector) (dir, prefix string) {
+	var dsn string
+	if d, ok := dialector.(*sqlite.Dialector); ok {
+		dsn = d.DSN
+	}
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+
+	if dsn == "" || strings.Contains(dsn, ":memory:") {
+		return os.TempDir(), "sqlite"
+	}
+	return filepath.Dir(dsn), filepath.Base(dsn)
+}
+
+func (l *DBLocker) acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	if l.dialect == "sqlite" {
+		return acquireFile(filepath.Join(l.dir, l.prefix+".lock."+hashKey(key)))
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired sql.NullBool
+	var unlock string
+	var args []any
+	switch l.dialect {
+	case "postgres":
+		id := int64(fnvKey(key))
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&acquired)
+		unlock, args = "SELECT pg_advisory_unlock($1)", []any{id}
+	case "mysql":
+		name := mysqlLockName(key)
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired)
+		unlock, args = "SELECT RELEASE_LOCK(?)", []any{name}
+	}
+
+	if err != nil || !acquired.Bool {
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("lock: acquire %s: %w", key, err)
+		}
+		return nil, ErrNotAcquired
+	}
+	return &dbLease{conn: conn, unlock: unlock, args: args}, nil
+}
+
+// fnvKey Postgres咨询锁的64位键
+func fnvKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// hashKey 锁文件名中使用的键
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// mysqlLockName MySQL锁名最长64个字符，超过时使用哈希
+func mysqlLockName(key string) string {
+	if len(key) <= 64 {
+		return key
+	}
+	return "lock:" + hashKey(key)
+}
+
+// dbLease 数据库会话持有的锁
+type dbLease struct {
+	conn   *sql.Conn
+	unlock string
+	args   []any
+}
+
+func (m *dbLease) token() uint64 {
+	return 0
+}
+
+// refresh 会话锁不会过期，连接不可用时锁已随会话释放
+func (m *dbLease) refresh(ctx context.Context, ttl time.Duration) error {
+	if err := m.conn.PingContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return errors.Join(ErrLockLost, err)
+	}
+	return nil
+}
+
+func (m *dbLease) release(ctx context.Context) error {
+	defer m.conn.Close()
+
+	var released sql.NullBool
+	if err := m.conn.QueryRowContext(ctx, m.unlock, m.args...).Scan(&released); err != nil {
+		return err
+	}
+	if !released.Bool {
+		return ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+// Election 基于锁的领导者选举，同一个key同时只有一个实例当选
+type Election struct {
+	locker  Locker
+	key     string
+	opts    []Option
+	options Options
+	leader  atomic.Bool
+	token   atomic.Uint64
+}
+
+// NewElection 创建领导者选举
+func NewElection(locker Locker, key string, opts ...Option) *Election {
+	return &Election{
+		locker:  locker,
+		key:     key,
+		opts:    opts,
+		options: newOptions(DefaultOptions, opts),
+	}
+}
+
+// IsLeader 当前实例是否是领导者
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Token 当选时锁的栅栏令牌，未当选时为0
+func (e *Election) Token() uint64 {
+	return e.token.Load()
+}
+
+// Run 持续参与竞选，当选后调用fn，ctx取消时返回
+// fn的ctx在失去领导权或ctx取消时取消，fn应随之返回；fn返回后释放领导权，间隔RetryInterval后重新竞选
+func (e *Election) Run(ctx context.Context, fn func(ctx context.Context) error) {
+	for {
+		l, err := e.locker.Acquire(ctx, e.key, e.opts...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WarnContext(ctx, "Failed to campaign for leader", "key", e.key, "error", err)
+		} else {
+			e.lead(ctx, l, fn)
+		}
+
+		// 失去领导权或出错后稍等再竞选，让其他实例有机会当选
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.options.RetryInterval):
+		}
+	}
+}
+
+// lead 作为领导者执行fn，返回时释放领导权
+func (e *Election) lead(ctx context.Context, l Lock, fn func(ctx context.Context) error) {
+	e.token.Store(l.Token())
+	e.leader.Store(true)
+	logger.InfoContext(ctx, "Elected as leader", "key", e.key, "token", l.Token())
+
+	err := fn(l.Context())
+
+	e.leader.Store(false)
+	e.token.Store(0)
+	if err != nil && ctx.Err() == nil {
+		logger.ErrorContext(ctx, "Leader task failed", "key", e.key, "error", err)
+	}
+	if context.Cause(l.Context()) == ErrLockLost {
+		logger.WarnContext(ctx, "Leadership lost", "key", e.key)
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.options.TTL/3)
+	defer cancel()
+	if err := l.Release(releaseCtx); err != nil && err != ErrLockLost {
+		logger.WarnContext(ctx, "Failed to release leadership", "key", e.key, "error", err)
+	}
+}
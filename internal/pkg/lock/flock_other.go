@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package lock
+
+import "errors"
+
+// acquireFile 当前平台不支持文件锁
+func acquireFile(path string) (lease, error) {
+	return nil, errors.New("lock: file locks are not supported on this platform")
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// acquireFile 以非阻塞方式获取文件锁，进程退出时系统自动释放
+func acquireFile(path string) (lease, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrNotAcquired
+		}
+		return nil, err
+	}
+	return &fileLease{file: f}, nil
+}
+
+// fileLease 文件锁，锁文件不删除，删除会让其他进程锁住不同的文件
+type fileLease struct {
+	file *os.File
+}
+
+func (m *fileLease) token() uint64 {
+	return 0
+}
+
+// refresh 文件锁在关闭文件前一直有效
+func (m *fileLease) refresh(ctx context.Context, ttl time.Duration) error {
+	return nil
+}
+
+func (m *fileLease) release(ctx context.Context) error {
+	return m.file.Close()
+}
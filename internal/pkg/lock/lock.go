@@ -0,0 +1,272 @@
+// Package lock 提供跨实例的互斥锁和领导者选举
+package lock
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/logger"
+)
+
+var (
+	// ErrNotAcquired 锁被其他持有者占用
+	ErrNotAcquired = errors.New("lock: not acquired")
+
+	// ErrLockLost 锁已过期或被其他持有者获取，临界区可能已不再互斥
+	ErrLockLost = errors.New("lock: lost")
+
+	// errReleased 锁已由持有者释放
+	errReleased = errors.New("lock: released")
+)
+
+// Locker 互斥锁
+type Locker interface {
+	// TryAcquire 尝试获取锁，锁被占用时返回ErrNotAcquired
+	// ctx取消时停止续期并释放锁
+	TryAcquire(ctx context.Context, key string, opts ...Option) (Lock, error)
+
+	// Acquire 获取锁，锁被占用时按RetryInterval重试直到获取成功或ctx取消
+	// ctx取消时停止续期并释放锁
+	Acquire(ctx context.Context, key string, opts ...Option) (Lock, error)
+}
+
+// Lock 已获取的锁
+type Lock interface {
+	// Key 锁的名称
+	Key() string
+
+	// Token 栅栏令牌，同一个key后获取的锁令牌更大，0表示实现不提供令牌
+	// 写入受保护的资源时带上令牌，资源拒绝比已见过的令牌更小的写入，避免锁过期后旧持有者的写入
+	Token() uint64
+
+	// Context 锁的上下文，锁丢失、释放或获取锁的ctx取消时取消，context.Cause返回ErrLockLost表示锁已丢失
+	Context() context.Context
+
+	// Release 释放锁，锁已丢失时返回ErrLockLost
+	Release(ctx context.Context) error
+}
+
+// Options 锁选项
+type Options struct {
+	// TTL 锁的过期时间，持有者崩溃后最多经过TTL其他实例可以获取锁
+	TTL time.Duration
+
+	// RetryInterval Acquire的重试间隔，实际间隔带有随机抖动
+	RetryInterval time.Duration
+
+	// AutoRenew 是否自动续期，每TTL/3续期一次；不续期时锁在TTL后视为丢失
+	AutoRenew bool
+}
+
+// DefaultOptions 默认锁选项
+var DefaultOptions = Options{
+	TTL:           30 * time.Second,
+	RetryInterval: 100 * time.Millisecond,
+	AutoRenew:     true,
+}
+
+// Option 锁选项函数
+type Option func(*Options)
+
+// WithTTL 设置锁的过期时间
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+// WithRetryInterval 设置Acquire的重试间隔
+func WithRetryInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.RetryInterval = interval
+	}
+}
+
+// WithAutoRenew 设置是否自动续期
+func WithAutoRenew(enabled bool) Option {
+	return func(o *Options) {
+		o.AutoRenew = enabled
+	}
+}
+
+// newOptions 合并默认选项
+func newOptions(defaults Options, opts []Option) Options {
+	options := defaults
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultOptions.TTL
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = DefaultOptions.RetryInterval
+	}
+	return options
+}
+
+// driver 锁的存储实现
+type driver interface {
+	// acquire 获取锁，锁被占用时返回ErrNotAcquired
+	acquire(ctx context.Context, key string, ttl time.Duration) (lease, error)
+}
+
+// lease 存储中持有的锁
+type lease interface {
+	// token 栅栏令牌
+	token() uint64
+
+	// refresh 续期，锁已丢失时返回ErrLockLost，其他错误视为暂时失败
+	refresh(ctx context.Context, ttl time.Duration) error
+
+	// release 释放锁，锁已丢失时返回ErrLockLost
+	release(ctx context.Context) error
+}
+
+// base 基于driver实现Locker
+type base struct {
+	driver  driver
+	options Options
+}
+
+// TryAcquire 尝试获取锁
+func (b *base) TryAcquire(ctx context.Context, key string, opts ...Option) (Lock, error) {
+	o := newOptions(b.options, opts)
+
+	start := time.Now()
+	lease, err := b.driver.acquire(ctx, key, o.TTL)
+	if err != nil {
+		return nil, err
+	}
+	return newHeld(ctx, key, lease, o, start), nil
+}
+
+// Acquire 获取锁，锁被占用时重试
+func (b *base) Acquire(ctx context.Context, key string, opts ...Option) (Lock, error) {
+	o := newOptions(b.options, opts)
+
+	for {
+		l, err := b.TryAcquire(ctx, key, opts...)
+		if !errors.Is(err, ErrNotAcquired) {
+			return l, err
+		}
+
+		// 随机抖动避免多个实例同时重试
+		wait := o.RetryInterval/2 + rand.N(o.RetryInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// held 已获取的锁，后台续期直到释放、丢失或ctx取消
+type held struct {
+	key     string
+	lease   lease
+	options Options
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	done    chan struct{} // 续期协程已退出
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+func newHeld(parent context.Context, key string, lease lease, options Options, start time.Time) *held {
+	ctx, cancel := context.WithCancelCause(parent)
+	h := &held{
+		key:     key,
+		lease:   lease,
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go h.keepAlive(start.Add(options.TTL))
+	return h
+}
+
+// keepAlive 定期续期，续期失败超过锁的有效期时视为丢失
+func (h *held) keepAlive(validUntil time.Time) {
+	defer close(h.done)
+
+	var renew <-chan time.Time
+	if h.options.AutoRenew {
+		ticker := time.NewTicker(h.options.TTL / 3)
+		defer ticker.Stop()
+		renew = ticker.C
+	}
+
+	expiry := time.NewTimer(time.Until(validUntil))
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			if context.Cause(h.ctx) != errReleased {
+				// 获取锁的ctx已取消，释放锁让其他实例尽快获取
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(h.ctx), h.options.TTL/3)
+				h.release(ctx)
+				cancel()
+			}
+			return
+
+		case <-expiry.C:
+			logger.WarnContext(h.ctx, "Lock expired before renewal", "key", h.key)
+			h.cancel(ErrLockLost)
+
+		case <-renew:
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(h.ctx, h.options.TTL/3)
+			err := h.lease.refresh(ctx, h.options.TTL)
+			cancel()
+
+			switch {
+			case err == nil:
+				expiry.Reset(time.Until(start.Add(h.options.TTL)))
+			case errors.Is(err, ErrLockLost):
+				logger.WarnContext(h.ctx, "Lock lost", "key", h.key)
+				h.cancel(ErrLockLost)
+			case h.ctx.Err() == nil:
+				logger.WarnContext(h.ctx, "Failed to renew lock", "key", h.key, "error", err)
+			}
+		}
+	}
+}
+
+// release 释放存储中的锁，只执行一次
+func (h *held) release(ctx context.Context) error {
+	h.releaseOnce.Do(func() {
+		h.releaseErr = h.lease.release(ctx)
+		if h.releaseErr == nil && context.Cause(h.ctx) == ErrLockLost {
+			h.releaseErr = ErrLockLost
+		}
+	})
+	return h.releaseErr
+}
+
+// Key 锁的名称
+func (h *held) Key() string {
+	return h.key
+}
+
+// Token 栅栏令牌
+func (h *held) Token() uint64 {
+	return h.lease.token()
+}
+
+// Context 锁的上下文
+func (h *held) Context() context.Context {
+	return h.ctx
+}
+
+// Release 停止续期并释放锁
+func (h *held) Release(ctx context.Context) error {
+	h.cancel(errReleased)
+	<-h.done
+	return h.release(ctx)
+}
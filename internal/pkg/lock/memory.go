@@ -0,0 +1,81 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker 进程内的锁，只在当前进程内互斥，用于单实例部署和测试
+type MemoryLocker struct {
+	base
+	mu    sync.Mutex
+	locks map[string]*memoryLease
+	seq   uint64 // 栅栏令牌，所有key共用一个递增序列
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+// NewMemoryLocker 创建进程内的锁
+func NewMemoryLocker(opts ...Option) *MemoryLocker {
+	l := &MemoryLocker{locks: make(map[string]*memoryLease)}
+	l.base = base{driver: l, options: newOptions(DefaultOptions, opts)}
+	return l
+}
+
+// memoryLease 进程内持有的锁
+type memoryLease struct {
+	locker  *MemoryLocker
+	key     string
+	fence   uint64
+	expires time.Time
+}
+
+func (l *MemoryLocker) acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if current, ok := l.locks[key]; ok && now.Before(current.expires) {
+		return nil, ErrNotAcquired
+	}
+
+	l.seq++
+	lease := &memoryLease{locker: l, key: key, fence: l.seq, expires: now.Add(ttl)}
+	l.locks[key] = lease
+	return lease, nil
+}
+
+// heldLocked 是否仍持有锁，调用方持有l.mu
+func (m *memoryLease) heldLocked() bool {
+	return m.locker.locks[m.key] == m && time.Now().Before(m.expires)
+}
+
+func (m *memoryLease) token() uint64 {
+	return m.fence
+}
+
+func (m *memoryLease) refresh(ctx context.Context, ttl time.Duration) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	if !m.heldLocked() {
+		return ErrLockLost
+	}
+	m.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *memoryLease) release(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	if m.locker.locks[m.key] != m {
+		return ErrLockLost
+	}
+	delete(m.locker.locks, m.key)
+	if time.Now().After(m.expires) {
+		return ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireScript 获取锁并递增栅栏计数，锁被占用时返回0
+var acquireScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0
+`)
+
+// fenceScript 把栅栏计数提升到当选的令牌
+var fenceScript = redis.NewScript(`
+local current = tonumber(redis.call("get", KEYS[1]) or "0")
+if current < tonumber(ARGV[1]) then
+	redis.call("set", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// refreshScript 仍持有锁时续期
+var refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript 仍持有锁时删除
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker 基于Redis的锁，多个相互独立的实例时使用Redlock算法，在多数实例上获取成功才算持有
+// 每个实例保存key的栅栏计数，获取锁时取多数实例上递增后的最大值作为令牌，并写回这些实例；
+// 任意两个多数派至少有一个公共实例，只要多数实例正常，后获取的锁令牌一定更大
+type RedisLocker struct {
+	base
+	clients []redis.UniversalClient
+	quorum  int
+}
+
+var _ Locker = (*RedisLocker)(nil)
+
+// NewRedisLocker 创建Redis锁，clients为相互独立的Redis实例（不是同一个集群的节点）
+func NewRedisLocker(clients []redis.UniversalClient, opts ...Option) (*RedisLocker, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("lock: at least one Redis client is required")
+	}
+
+	l := &RedisLocker{
+		clients: clients,
+		quorum:  len(clients)/2 + 1,
+	}
+	l.base = base{driver: l, options: newOptions(DefaultOptions, opts)}
+	return l, nil
+}
+
+// redisKeys 锁和栅栏计数的键，使用相同的哈希标签，集群模式下位于同一个槽
+func redisKeys(key string) []string {
+	lockKey := "lock:{" + key + "}"
+	return []string{lockKey, lockKey + ":fence"}
+}
+
+// redisResult 单个实例的执行结果
+type redisResult struct {
+	val int64
+	err error
+}
+
+// each 在所有实例上并发执行fn
+func (l *RedisLocker) each(ctx context.Context, ttl time.Duration, fn func(ctx context.Context, client redis.UniversalClient) (int64, error)) []redisResult {
+	return eachClient(ctx, l.clients, ttl, fn)
+}
+
+// eachClient 在clients上并发执行fn，单个实例的超时为ttl/10，避免不可用的实例耗尽锁的有效期
+func eachClient(ctx context.Context, clients []redis.UniversalClient, ttl time.Duration, fn func(ctx context.Context, client redis.UniversalClient) (int64, error)) []redisResult {
+	results := make([]redisResult, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, ttl/10)
+			defer cancel()
+			results[i].val, results[i].err = fn(ctx, client)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// count 统计返回值为正数的实例数和出错的实例
+func count(results []redisResult) (ok int, errs []error) {
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			errs = append(errs, r.err)
+		case r.val > 0:
+			ok++
+		}
+	}
+	return ok, errs
+}
+
+func (l *RedisLocker) acquire(ctx context.Context, key string, ttl time.Duration) (lease, error) {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return nil, err
+	}
+
+	m := &redisLease{locker: l, keys: redisKeys(key), value: hex.EncodeToString(value), ttl: ttl}
+	start := time.Now()
+	results := l.each(ctx, ttl, func(ctx context.Context, client redis.UniversalClient) (int64, error) {
+		return acquireScript.Run(ctx, client, m.keys, m.value, ttl.Milliseconds()).Int64()
+	})
+
+	acquired := make([]redis.UniversalClient, 0, len(l.clients))
+	for i, r := range results {
+		if r.err == nil && r.val > 0 {
+			acquired = append(acquired, l.clients[i])
+			m.fence = max(m.fence, uint64(r.val))
+		}
+	}
+
+	// 扣除时钟漂移后仍在有效期内才算获取成功
+	drift := ttl/100 + 2*time.Millisecond
+	if len(acquired) >= l.quorum && time.Since(start) < ttl-drift && l.raiseFence(ctx, ttl, acquired, m) {
+		return m, nil
+	}
+
+	// 释放已获取的部分实例
+	m.release(context.WithoutCancel(ctx))
+	if _, errs := count(results); len(errs) > len(l.clients)-l.quorum {
+		return nil, fmt.Errorf("lock: acquire %s: %w", key, errors.Join(errs...))
+	}
+	return nil, ErrNotAcquired
+}
+
+// raiseFence 把多数实例的栅栏计数提升到令牌，之后获取的锁令牌更大
+func (l *RedisLocker) raiseFence(ctx context.Context, ttl time.Duration, clients []redis.UniversalClient, m *redisLease) bool {
+	if len(clients) == 1 {
+		return true
+	}
+
+	ok, _ := count(eachClient(ctx, clients, ttl, func(ctx context.Context, client redis.UniversalClient) (int64, error) {
+		return fenceScript.Run(ctx, client, m.keys[1:], m.fence).Int64()
+	}))
+	return ok >= l.quorum
+}
+
+// redisLease Redis中持有的锁
+type redisLease struct {
+	locker *RedisLocker
+	keys   []string
+	value  string
+	fence  uint64
+	ttl    time.Duration // 获取时的过期时间，用于计算释放的超时
+}
+
+func (m *redisLease) token() uint64 {
+	return m.fence
+}
+
+func (m *redisLease) refresh(ctx context.Context, ttl time.Duration) error {
+	ok, errs := count(m.locker.each(ctx, ttl, func(ctx context.Context, client redis.UniversalClient) (int64, error) {
+		return refreshScript.Run(ctx, client, m.keys[:1], m.value, ttl.Milliseconds()).Int64()
+	}))
+	switch {
+	case ok >= m.locker.quorum:
+		return nil
+	case ok+len(errs) >= m.locker.quorum:
+		// 出错的实例上可能仍持有锁，下次续期重试
+		return errors.Join(errs...)
+	default:
+		return ErrLockLost
+	}
+}
+
+func (m *redisLease) release(ctx context.Context) error {
+	ok, errs := count(m.locker.each(ctx, m.ttl, func(ctx context.Context, client redis.UniversalClient) (int64, error) {
+		return releaseScript.Run(ctx, client, m.keys[:1], m.value).Int64()
+	}))
+	switch {
+	case len(errs) > 0:
+		return errors.Join(errs...)
+	case ok < m.locker.quorum:
+		return ErrLockLost
+	default:
+		return nil
+	}
+}
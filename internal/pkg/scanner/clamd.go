@@ -0,0 +1,162 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClamdTimeout   = 60 * time.Second
+	defaultClamdChunkSize = 64 * 1024
+)
+
+// ClamdScanner ClamAV病毒扫描器，通过clamd的INSTREAM命令发送文件内容
+// 协议说明：https://docs.clamav.net/manual/Usage/Scanning.html#clamd
+type ClamdScanner struct {
+	Network   string        // 连接方式: tcp 或 unix
+	Address   string        // 地址，如 127.0.0.1:3310 或 /run/clamav/clamd.ctl
+	Timeout   time.Duration // 单个文件的扫描超时
+	ChunkSize int           // 每次发送的数据块大小
+}
+
+var _ Scanner = (*ClamdScanner)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewClamdScanner 创建ClamAV扫描器，network为空时按地址判断：以/开头为unix，否则为tcp
+func NewClamdScanner(network, address string, timeout time.Duration) *ClamdScanner {
+	if network == "" {
+		network = "tcp"
+		if strings.HasPrefix(address, "/") {
+			network = "unix"
+		}
+	}
+	if timeout <= 0 {
+		timeout = defaultClamdTimeout
+	}
+	return &ClamdScanner{
+		Network:   network,
+		Address:   address,
+		Timeout:   timeout,
+		ChunkSize: defaultClamdChunkSize,
+	}
+}
+
+// Name 扫描器名称
+func (c *ClamdScanner) Name() string {
+	return "clamav"
+}
+
+// Ping 检查clamd是否可用
+func (c *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd返回异常: %s", reply)
+	}
+	return nil
+}
+
+// Scan 扫描文件内容
+func (c *ClamdScanner) Scan(ctx context.Context, obj *Object) (*Result, error) {
+	reader, err := obj.Open()
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer reader.Close()
+
+	reply, err := c.command(ctx, "INSTREAM", reader)
+	if err != nil {
+		return nil, err
+	}
+	return parseClamdReply(c.Name(), reply)
+}
+
+// command 发送命令并读取以\0结尾的响应，body不为空时按INSTREAM格式分块发送
+func (c *ClamdScanner) command(ctx context.Context, name string, body io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return "", fmt.Errorf("连接clamd失败: %w", err)
+	}
+	defer conn.Close()
+
+	// ctx取消时关闭连接，中断阻塞的读写
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	writeErr := c.send(conn, name, body)
+
+	// clamd在超出StreamMaxLength时会先返回错误再关闭连接，写入失败时仍尝试读取响应
+	reply, readErr := bufio.NewReader(conn).ReadString(0)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("clamd扫描超时: %w", ctx.Err())
+	}
+	if readErr != nil && !(errors.Is(readErr, io.EOF) && reply != "") {
+		if writeErr != nil {
+			return "", fmt.Errorf("发送数据到clamd失败: %w", writeErr)
+		}
+		return "", fmt.Errorf("读取clamd响应失败: %w", readErr)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// send 发送z前缀的命令，body按[4字节大端长度][数据]分块发送，以长度0结束
+func (c *ClamdScanner) send(conn net.Conn, name string, body io.Reader) error {
+	if _, err := io.WriteString(conn, "z"+name+"\x00"); err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultClamdChunkSize
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(body, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取文件失败: %w", err)
+		}
+	}
+
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamdReply 解析扫描响应，如 "stream: OK"、"stream: Eicar-Signature FOUND"
+func parseClamdReply(scanner, reply string) (*Result, error) {
+	if i := strings.Index(reply, ": "); i >= 0 {
+		reply = reply[i+2:]
+	}
+
+	switch {
+	case reply == "OK":
+		return &Result{Clean: true, Scanner: scanner}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Scanner: scanner, Threat: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd扫描失败: %s", reply)
+	}
+}
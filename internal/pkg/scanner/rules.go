@@ -0,0 +1,226 @@
+package scanner
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// maxInspectDepth 未限制嵌套层数时检查的最大层数，避免递归压缩包
+	maxInspectDepth = 16
+	// defaultMaxNestedSize 嵌套压缩包读入内存检查的最大大小
+	defaultMaxNestedSize = 32 << 20
+)
+
+// zipMagic ZIP文件头，空压缩包只有目录结束记录
+var zipMagic = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}
+
+// RuleScanner 基于规则的内容策略扫描器
+// 检查文件名是否被禁止，ZIP格式的文件（包括docx、jar等）会检查其中的文件名和压缩包嵌套层数
+type RuleScanner struct {
+	MaxArchiveDepth int      // 压缩包最大嵌套层数，上传的压缩包本身为第1层，0表示不限制
+	ForbiddenNames  []string // 禁止的文件名模式（path.Match语法，不区分大小写），如 *.exe、autorun.inf
+	MaxNestedSize   int64    // 嵌套压缩包的最大大小，超过时视为违规
+}
+
+var _ Scanner = (*RuleScanner)(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// NewRuleScanner 创建规则扫描器，文件名模式无效时返回错误
+func NewRuleScanner(maxArchiveDepth int, forbiddenNames []string) (*RuleScanner, error) {
+	patterns := make([]string, 0, len(forbiddenNames))
+	for _, pattern := range forbiddenNames {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的文件名模式 %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return &RuleScanner{
+		MaxArchiveDepth: maxArchiveDepth,
+		ForbiddenNames:  patterns,
+		MaxNestedSize:   defaultMaxNestedSize,
+	}, nil
+}
+
+// Name 扫描器名称
+func (s *RuleScanner) Name() string {
+	return "rules"
+}
+
+// Scan 检查文件名和压缩包内容
+func (s *RuleScanner) Scan(ctx context.Context, obj *Object) (*Result, error) {
+	if threat := s.checkName(obj.Name); threat != "" {
+		return s.violation(threat), nil
+	}
+	if s.MaxArchiveDepth <= 0 && len(s.ForbiddenNames) == 0 {
+		return &Result{Clean: true, Scanner: s.Name()}, nil
+	}
+
+	ra, size, cleanup, err := s.openArchive(obj)
+	if err != nil {
+		return nil, err
+	}
+	if ra == nil {
+		return &Result{Clean: true, Scanner: s.Name()}, nil
+	}
+	defer cleanup()
+
+	threat, err := s.inspect(ctx, ra, size, 1)
+	if err != nil {
+		return nil, err
+	}
+	if threat != "" {
+		return s.violation(threat), nil
+	}
+	return &Result{Clean: true, Scanner: s.Name()}, nil
+}
+
+// inspect 检查压缩包中的文件名，遇到嵌套的压缩包时递归检查
+func (s *RuleScanner) inspect(ctx context.Context, ra io.ReaderAt, size int64, depth int) (string, error) {
+	if (s.MaxArchiveDepth > 0 && depth > s.MaxArchiveDepth) || depth > maxInspectDepth {
+		return fmt.Sprintf("archive nesting exceeds %d levels", depth-1), nil
+	}
+
+	// 文件头像ZIP但无法解析时交给其他扫描器处理
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return "", nil
+	}
+
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if threat := s.checkName(f.Name); threat != "" {
+			return threat, nil
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		nested, err := s.readNested(f)
+		if err != nil {
+			return "", err
+		}
+		if nested == nil {
+			continue
+		}
+		if int64(len(nested)) > s.maxNestedSize() {
+			return fmt.Sprintf("nested archive too large: %s", f.Name), nil
+		}
+
+		threat, err := s.inspect(ctx, bytes.NewReader(nested), int64(len(nested)), depth+1)
+		if err != nil || threat != "" {
+			return threat, err
+		}
+	}
+	return "", nil
+}
+
+// readNested 压缩包中的文件本身是ZIP时读入内存，最多读取MaxNestedSize+1字节
+func (s *RuleScanner) readNested(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		// 加密或使用不支持的压缩算法的条目无法检查内容，只检查文件名
+		return nil, nil
+	}
+	defer rc.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(rc, header); err != nil || !isZip(header) {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(rc, s.maxNestedSize()+1-int64(len(header))))
+	if err != nil {
+		return nil, fmt.Errorf("读取压缩包内的文件失败: %w", err)
+	}
+	return append(header, data...), nil
+}
+
+// openArchive 文件是ZIP时返回可随机读取的内容，不支持随机读取的内容写入临时文件
+func (s *RuleScanner) openArchive(obj *Object) (io.ReaderAt, int64, func(), error) {
+	reader, err := obj.Open()
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil || !isZip(header) {
+		reader.Close()
+		return nil, 0, nil, nil
+	}
+
+	// 上传的临时文件和本地文件支持随机读取，直接使用
+	if ra, ok := reader.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			reader.Close()
+			return nil, 0, nil, fmt.Errorf("读取文件大小失败: %w", err)
+		}
+		return ra, size, func() { reader.Close() }, nil
+	}
+
+	tmp, err := os.CreateTemp("", "scan-*.zip")
+	if err != nil {
+		reader.Close()
+		return nil, 0, nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(header), reader))
+	reader.Close()
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	return tmp, size, cleanup, nil
+}
+
+// checkName 检查文件名（不含路径）是否匹配禁止的模式
+func (s *RuleScanner) checkName(name string) string {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	for _, pattern := range s.ForbiddenNames {
+		if ok, _ := path.Match(pattern, base); ok {
+			return fmt.Sprintf("forbidden file name: %s", name)
+		}
+	}
+	return ""
+}
+
+func (s *RuleScanner) maxNestedSize() int64 {
+	if s.MaxNestedSize <= 0 {
+		return defaultMaxNestedSize
+	}
+	return s.MaxNestedSize
+}
+
+func (s *RuleScanner) violation(threat string) *Result {
+	return &Result{Scanner: s.Name(), Threat: threat}
+}
+
+// isZip 是否为ZIP文件头
+func isZip(header []byte) bool {
+	for _, magic := range zipMagic {
+		if bytes.Equal(header, magic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// Package scanner 上传文件扫描，支持病毒扫描（ClamAV）和基于规则的内容策略检查
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrInfected 文件未通过扫描
+var ErrInfected = errors.New("file rejected by scanner")
+
+// Object 待扫描的文件，Open每次调用返回从头读取的新Reader，多个扫描器依次读取
+type Object struct {
+	Name string                        // 原始文件名
+	Size int64                         // 文件大小，未知时为0
+	Open func() (io.ReadCloser, error) // 打开文件内容
+}
+
+// Result 扫描结果
+type Result struct {
+	Clean   bool   // 是否通过扫描
+	Scanner string // 给出结果的扫描器名称
+	Threat  string // 未通过时的威胁或违规描述
+}
+
+// Err 未通过扫描时返回包装了ErrInfected的错误
+func (r *Result) Err() error {
+	if r == nil || r.Clean {
+		return nil
+	}
+	return &InfectedError{Scanner: r.Scanner, Threat: r.Threat}
+}
+
+// InfectedError 未通过扫描的错误，errors.Is(err, ErrInfected)为true
+type InfectedError struct {
+	Scanner string
+	Threat  string
+}
+
+func (e *InfectedError) Error() string {
+	return e.Scanner + ": " + e.Threat
+}
+
+func (e *InfectedError) Unwrap() error {
+	return ErrInfected
+}
+
+// Scanner 文件扫描器
+// 文件未通过扫描时返回Clean为false的结果，扫描本身失败时返回error
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, obj *Object) (*Result, error)
+}
+
+// Chain 依次执行多个扫描器，任一扫描器未通过时停止
+type Chain []Scanner
+
+var _ Scanner = Chain(nil) // 用于接口断言，_ 变量编译后会被移除
+
+// Name 扫描器名称
+func (c Chain) Name() string {
+	return "chain"
+}
+
+// Scan 依次扫描，全部通过时返回Clean结果
+func (c Chain) Scan(ctx context.Context, obj *Object) (*Result, error) {
+	for _, s := range c {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := s.Scan(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Clean {
+			return result, nil
+		}
+	}
+	return &Result{Clean: true, Scanner: c.Name()}, nil
+}
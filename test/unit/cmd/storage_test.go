@@ -0,0 +1,129 @@
+package cmd_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/limitcool/starter/cmd"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// 命令在子进程中执行，失败时调用os.Exit
+func TestMain(m *testing.M) {
+	if args := os.Getenv("STARTER_TEST_ARGS"); args != "" {
+		os.Args = append([]string{"starter"}, strings.Split(args, "\n")...)
+		cmd.ExecuteCmd()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand 在子进程中执行命令，返回输出和是否成功
+func runCommand(t *testing.T, args ...string) (string, bool) {
+	c := exec.Command(os.Args[0], "-test.run=^$")
+	c.Env = append(os.Environ(), "STARTER_TEST_ARGS="+strings.Join(args, "\n"), "APP_ENV=test")
+	out, err := c.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok {
+		require.NoError(t, err)
+	}
+	return string(out), err == nil
+}
+
+// storageEnv 使用SQLite和本地存储的配置文件
+func storageEnv(t *testing.T) (configFile string, db *gorm.DB, storageDir string) {
+	dir := t.TempDir()
+	storageDir = filepath.Join(dir, "storage")
+	configFile = filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf(`
+driver: sqlite3
+database:
+  enabled: true
+  dbname: %s
+storage:
+  enabled: true
+  type: local
+  local:
+    path: %s
+  reconcile:
+    pendingTTL: 1h
+    orphanMinAge: 1h
+`, filepath.Join(dir, "app"), storageDir)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0o600))
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "app.db")), &gorm.Config{Logger: gormlogger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(
+		&model.File{}, &model.FileBlob{}, &model.FileVariant{}, &model.FileVersion{},
+		&model.StorageUsage{}, &model.StorageMigration{},
+	))
+	return configFile, db, storageDir
+}
+
+// writeOld 写入存储文件并把修改时间提前
+func writeOld(t *testing.T, path string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0o644))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+}
+
+func TestStorageReconcileCommand(t *testing.T) {
+	configFile, db, storageDir := storageEnv(t)
+
+	writeOld(t, filepath.Join(storageDir, "public", "orphan.txt"))
+	writeOld(t, filepath.Join(storageDir, "public", "pending.txt"))
+	require.NoError(t, db.Create(&model.File{
+		Path: "pending.txt", IsPublic: true, StorageType: "local", Status: model.FileStatusPending,
+		UUIDModel: model.UUIDModel{CreatedAt: time.Now().Add(-48 * time.Hour)},
+	}).Error)
+
+	// 仅输出报告
+	out, ok := runCommand(t, "storage", "reconcile", "-c", configFile, "--dry-run", "--delete-orphans")
+	require.True(t, ok, out)
+	assert.Contains(t, out, `"expired_pending": 1, "orphan_blobs": 1`)
+	assert.Contains(t, out, `"path": "orphan.txt", "public": true, "size": 7, "removed": false`)
+	assert.FileExists(t, filepath.Join(storageDir, "public", "orphan.txt"))
+	assert.FileExists(t, filepath.Join(storageDir, "public", "pending.txt"))
+
+	// --delete-orphans覆盖配置，删除孤立文件和过期的待上传记录
+	out, ok = runCommand(t, "storage", "reconcile", "-c", configFile, "--delete-orphans")
+	require.True(t, ok, out)
+	assert.Contains(t, out, `"path": "orphan.txt", "public": true, "size": 7, "removed": true`)
+	assert.NoFileExists(t, filepath.Join(storageDir, "public", "orphan.txt"))
+	assert.NoFileExists(t, filepath.Join(storageDir, "public", "pending.txt"))
+	var pending int64
+	require.NoError(t, db.Model(&model.File{}).Count(&pending).Error)
+	assert.Zero(t, pending)
+}
+
+func TestStorageMigrateCommand(t *testing.T) {
+	configFile, _, _ := storageEnv(t)
+
+	// 源存储和目标存储为必填参数
+	out, ok := runCommand(t, "storage", "migrate", "-c", configFile, "--to", "local")
+	assert.False(t, ok)
+	assert.Contains(t, out, `required flag(s) "from" not set`)
+
+	// 不支持的存储类型
+	out, ok = runCommand(t, "storage", "migrate", "-c", configFile, "--from", "local", "--to", "ftp")
+	assert.False(t, ok)
+	assert.Contains(t, out, "不支持的存储类型: ftp")
+
+	// 源存储和目标存储相同
+	out, ok = runCommand(t, "storage", "migrate", "-c", configFile, "--from", "local", "--to", "local")
+	assert.False(t, ok)
+	assert.Contains(t, out, "源存储和目标存储相同")
+}
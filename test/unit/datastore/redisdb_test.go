@@ -0,0 +1,151 @@
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/datastore/redisdb"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRedisClientModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance configs.RedisInstance
+		want     any
+		wantErr  string
+	}{
+		{name: "single", instance: configs.RedisInstance{Addr: "localhost:6379"}, want: &redis.Client{}},
+		{name: "sentinel", instance: configs.RedisInstance{Mode: configs.RedisSentinel, Addrs: []string{"a:26379", "b:26379"}, MasterName: "mymaster"}, want: &redis.Client{}},
+		{name: "cluster", instance: configs.RedisInstance{Mode: configs.RedisCluster, Addrs: []string{"a:7000", "b:7001"}}, want: &redis.ClusterClient{}},
+		{name: "no address", instance: configs.RedisInstance{}, wantErr: "no address"},
+		{name: "single with many addresses", instance: configs.RedisInstance{Addrs: []string{"a:6379", "b:6379"}}, wantErr: "one address"},
+		{name: "sentinel without master", instance: configs.RedisInstance{Mode: configs.RedisSentinel, Addr: "a:26379"}, wantErr: "master_name"},
+		{name: "cluster with db", instance: configs.RedisInstance{Mode: configs.RedisCluster, Addr: "a:7000", DB: 1}, wantErr: "db 1"},
+		{name: "unknown mode", instance: configs.RedisInstance{Mode: "proxy", Addr: "a:6379"}, wantErr: "unknown mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := redisdb.NewClient(tt.name, tt.instance)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer client.Close()
+			assert.IsType(t, tt.want, client)
+		})
+	}
+}
+
+func TestRedisOpenSkipsDisabled(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	clients, err := redisdb.Open(context.Background(), map[string]configs.RedisInstance{
+		"default": {Enabled: false, Addr: "localhost:6379"},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, clients.Len())
+	_, ok := clients.Get("default")
+	assert.False(t, ok)
+
+	// 连接失败时返回实例名称
+	_, err = redisdb.Open(context.Background(), map[string]configs.RedisInstance{
+		"session": {Enabled: true, Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "session")
+}
+
+// recordedSpan 记录结束时的名称和状态
+type recordedSpan struct {
+	noop.Span
+	recorder *spanRecorder
+	name     string
+	status   codes.Code
+	errors   int
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, description string) { s.status = code }
+
+func (s *recordedSpan) RecordError(err error, opts ...trace.EventOption) { s.errors++ }
+
+func (s *recordedSpan) End(opts ...trace.SpanEndOption) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.ended = append(s.recorder.ended, s)
+}
+
+// spanRecorder 记录结束的span的TracerProvider
+type spanRecorder struct {
+	noop.TracerProvider
+	mu    sync.Mutex
+	ended []*recordedSpan
+}
+
+func (r *spanRecorder) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{recorder: r}
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	recorder *spanRecorder
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{recorder: t.recorder, name: name}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestRedisTraceHook(t *testing.T) {
+	recorder := &spanRecorder{}
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(recorder)
+	defer otel.SetTracerProvider(previous)
+
+	var logs bytes.Buffer
+	logger.SetDefault(logger.NewZapLogger(&logs, logger.DebugLevel, logger.TextFormat))
+
+	// 连接不存在的地址，命令失败时同样结束span并记录错误
+	client, err := redisdb.NewClient("session", configs.RedisInstance{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		EnableTrace: true,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	require.Error(t, client.Get(ctx, "k").Err())
+	pipe := client.Pipeline()
+	pipe.Get(ctx, "a")
+	pipe.Set(ctx, "b", "1", 0)
+	_, err = pipe.Exec(ctx)
+	require.Error(t, err)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.ended, 2)
+	assert.Equal(t, "redis.get", recorder.ended[0].name)
+	assert.Equal(t, codes.Error, recorder.ended[0].status)
+	assert.Equal(t, 1, recorder.ended[0].errors)
+	assert.Equal(t, "redis.pipeline", recorder.ended[1].name)
+	assert.Equal(t, codes.Error, recorder.ended[1].status)
+
+	assert.Contains(t, logs.String(), "Redis command failed")
+	assert.Contains(t, logs.String(), "get set")
+}
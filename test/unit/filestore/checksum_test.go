@@ -0,0 +1,30 @@
+package filestore_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumReader(t *testing.T) {
+	cr := filestore.NewChecksumReader(strings.NewReader("hello world"))
+	data, err := io.ReadAll(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	checksum := cr.Checksum()
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", checksum.SHA256)
+	assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", checksum.MD5)
+	assert.Equal(t, int64(11), checksum.Size)
+}
+
+func TestComputeChecksumEmpty(t *testing.T) {
+	checksum, err := filestore.ComputeChecksum(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", checksum.SHA256)
+	assert.Equal(t, int64(0), checksum.Size)
+}
@@ -0,0 +1,215 @@
+package filestore_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMasterKey(t *testing.T, id string) configs.MasterKeyConfig {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return configs.MasterKeyConfig{ID: id, Key: base64.StdEncoding.EncodeToString(key)}
+}
+
+func newKeyring(t *testing.T, active string, keys ...configs.MasterKeyConfig) *filestore.Keyring {
+	keyring, err := filestore.NewKeyring(configs.EncryptionConfig{ActiveKey: active, Keys: keys})
+	require.NoError(t, err)
+	return keyring
+}
+
+func encrypt(t *testing.T, keyring *filestore.Keyring, plain []byte) []byte {
+	reader, err := keyring.NewEncryptReader(bytes.NewReader(plain))
+	require.NoError(t, err)
+	sealed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return sealed
+}
+
+func decrypt(keyring *filestore.Keyring, sealed []byte) ([]byte, error) {
+	reader, err := keyring.NewDecryptReader(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	keyring := newKeyring(t, "", newMasterKey(t, "key-1"))
+
+	for _, size := range []int{0, 1, 64*1024 - 1, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		plain := make([]byte, size)
+		_, err := rand.Read(plain)
+		require.NoError(t, err)
+
+		sealed := encrypt(t, keyring, plain)
+		assert.False(t, size > 16 && bytes.Contains(sealed, plain[:16]), "size %d", size)
+
+		got, err := decrypt(keyring, sealed)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, plain, got, "size %d", size)
+	}
+}
+
+func TestEncryptionTamperDetection(t *testing.T) {
+	keyring := newKeyring(t, "", newMasterKey(t, "key-1"))
+	plain := bytes.Repeat([]byte("x"), 150*1024)
+	sealed := encrypt(t, keyring, plain)
+
+	// 修改密文
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-100] ^= 1
+	_, err := decrypt(keyring, tampered)
+	assert.Error(t, err)
+
+	// 在分块边界截断
+	truncated := sealed[:len(sealed)-(150*1024-128*1024)-16]
+	_, err = decrypt(keyring, truncated)
+	assert.Error(t, err)
+
+	// 未知主密钥
+	_, err = decrypt(newKeyring(t, "", newMasterKey(t, "key-2")), sealed)
+	assert.Error(t, err)
+
+	// 非加密格式
+	_, err = decrypt(keyring, []byte("plain text"))
+	assert.ErrorIs(t, err, filestore.ErrNotEncrypted)
+}
+
+func TestKeyringFromFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0o600))
+
+	keyring, err := filestore.NewKeyring(configs.EncryptionConfig{
+		Keys: []configs.MasterKeyConfig{{ID: "file-key", KeyFile: keyFile}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "file-key", keyring.ActiveKeyID())
+
+	_, err = filestore.NewKeyring(configs.EncryptionConfig{
+		ActiveKey: "missing",
+		Keys:      []configs.MasterKeyConfig{{ID: "file-key", KeyFile: keyFile}},
+	})
+	assert.Error(t, err)
+
+	_, err = filestore.NewKeyring(configs.EncryptionConfig{
+		Keys: []configs.MasterKeyConfig{{ID: "short", Key: base64.StdEncoding.EncodeToString([]byte("short"))}},
+	})
+	assert.Error(t, err)
+}
+
+func readAll(t *testing.T, storage filestore.FileStorage, filePath string, isPublic bool) []byte {
+	reader, err := storage.GetFile(context.Background(), filePath, isPublic)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return data
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	key1 := newMasterKey(t, "key-1")
+	raw := filestore.NewLocalStorage(t.TempDir(), "")
+
+	storage, err := filestore.NewEncryptedStorage(raw, newKeyring(t, "", key1), []string{"contract"})
+	require.NoError(t, err)
+
+	contract := "documents/contracts/2026/10/a.pdf"
+	plain := []byte("confidential contract")
+
+	// 配置用途的私有文件加密存储
+	require.NoError(t, storage.UploadFile(ctx, contract, bytes.NewReader(plain), false))
+	assert.NotContains(t, string(readAll(t, raw, contract, false)), string(plain))
+	assert.Equal(t, plain, readAll(t, storage, contract, false))
+
+	// 公开文件和其他用途不加密
+	require.NoError(t, storage.UploadFile(ctx, contract, bytes.NewReader(plain), true))
+	assert.Equal(t, plain, readAll(t, raw, contract, true))
+	require.NoError(t, storage.UploadFile(ctx, "general/2026/10/18/b.txt", bytes.NewReader(plain), false))
+	assert.Equal(t, plain, readAll(t, raw, "general/2026/10/18/b.txt", false))
+
+	// 公开文件和其他用途的内容即使以加密文件头开头也原样返回，不尝试解密
+	ciphertext := readAll(t, raw, contract, false)
+	for _, c := range []struct {
+		path     string
+		isPublic bool
+	}{
+		{contract, true},
+		{"general/2026/10/18/sealed.bin", false},
+	} {
+		require.NoError(t, storage.UploadFile(ctx, c.path, bytes.NewReader(ciphertext), c.isPublic))
+		assert.Equal(t, ciphertext, readAll(t, storage, c.path, c.isPublic), c.path)
+	}
+
+	// 直传的明文文件可以读取，重新加密时被加密
+	direct := "documents/contracts/2026/10/c.pdf"
+	require.NoError(t, raw.UploadFile(ctx, direct, bytes.NewReader(plain), false))
+	assert.Equal(t, plain, readAll(t, storage, direct, false))
+	action, err := storage.Rewrap(ctx, direct, false)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.RewrapEncrypted, action)
+	assert.NotEqual(t, plain, readAll(t, raw, direct, false))
+
+	// 轮换主密钥后重新加密数据密钥，旧密钥移除后仍可读取
+	key2 := newMasterKey(t, "key-2")
+	rotated, err := filestore.NewEncryptedStorage(raw, newKeyring(t, "key-2", key1, key2), []string{"contract"})
+	require.NoError(t, err)
+
+	for _, filePath := range []string{contract, direct} {
+		action, err := rotated.Rewrap(ctx, filePath, false)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.RewrapRewrapped, action)
+	}
+	action, err = rotated.Rewrap(ctx, contract, false)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.RewrapSkipped, action)
+
+	onlyKey2, err := filestore.NewEncryptedStorage(raw, newKeyring(t, "", key2), []string{"contract"})
+	require.NoError(t, err)
+	assert.Equal(t, plain, readAll(t, onlyKey2, contract, false))
+	assert.Equal(t, plain, readAll(t, onlyKey2, direct, false))
+
+	_, err = filestore.NewEncryptedStorage(raw, newKeyring(t, "", key1), []string{"unknown"})
+	assert.Error(t, err)
+}
+
+func TestEncryptedStorageDownloadURL(t *testing.T) {
+	ctx := context.Background()
+	raw := filestore.NewLocalStorage(t.TempDir(), "http://localhost/uploads")
+	storage, err := filestore.NewEncryptedStorage(raw, newKeyring(t, "", newMasterKey(t, "key-1")), []string{"contract"})
+	require.NoError(t, err)
+
+	// 存储URL只能下载到密文，加密文件（包括回收站中的）没有可直接访问的URL
+	for _, filePath := range []string{"documents/contracts/2026/10/a.pdf", filestore.TrashDir + "/1/documents/contracts/2026/10/a.pdf"} {
+		_, err = storage.GetDownloadURL(ctx, filePath, false)
+		assert.ErrorIs(t, err, filestore.ErrDecryptionRequired, filePath)
+	}
+
+	// 公开文件和其他用途使用存储的URL
+	for _, c := range []struct {
+		path     string
+		isPublic bool
+	}{
+		{"documents/contracts/2026/10/a.pdf", true},
+		{"general/2026/10/18/b.txt", false},
+	} {
+		expected, err := raw.GetDownloadURL(ctx, c.path, c.isPublic)
+		require.NoError(t, err)
+		got, err := storage.GetDownloadURL(ctx, c.path, c.isPublic)
+		require.NoError(t, err)
+		assert.Equal(t, expected, got)
+	}
+}
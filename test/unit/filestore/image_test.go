@@ -0,0 +1,227 @@
+package filestore_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, newTestImage(32, 16), nil))
+	original := buf.Bytes()
+
+	// 在SOI之后插入一个带GPS信息的APP1(EXIF)段
+	exif := []byte("Exif\x00\x00GPSLatitude=31.2304")
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	segment = append(segment, exif...)
+
+	withExif := append([]byte{}, original[:2]...)
+	withExif = append(withExif, segment...)
+	withExif = append(withExif, original[2:]...)
+
+	stripped, err := filestore.StripImageMetadata(withExif)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(stripped, []byte("GPSLatitude")))
+	assert.Equal(t, original, stripped)
+
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+}
+
+// exifSegment 构造包含方向和GPS指针两个条目的APP1(EXIF)段，小端字节序
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 2, 0}
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x8825) // GPSInfo
+	tiff = append(tiff, 4, 0, 1, 0, 0, 0, 0x31, 0x2E, 0x32, 0x33)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = append(tiff, 3, 0, 1, 0, 0, 0)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withSegment 在SOI之后插入段
+func withSegment(jpegData, segment []byte) []byte {
+	data := append([]byte{}, jpegData[:2]...)
+	data = append(data, segment...)
+	return append(data, jpegData[2:]...)
+}
+
+func TestStripJPEGMetadataKeepsOrientation(t *testing.T) {
+	// 左半边红色、右半边蓝色的横向图片，方向6表示显示时需要顺时针旋转90度
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 32; y++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 32 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	original := buf.Bytes()
+
+	stripped, err := filestore.StripImageMetadata(withSegment(original, exifSegment(6)))
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(stripped, []byte{0x25, 0x88}), "GPS指针被移除")
+	assert.NotEqual(t, original, stripped, "保留方向标签")
+
+	// 再次移除元数据结果不变
+	again, err := filestore.StripImageMetadata(stripped)
+	require.NoError(t, err)
+	assert.Equal(t, stripped, again)
+
+	// 衍生图按方向旋转：宽高交换，原图左侧旋转到上方
+	processor := filestore.NewImageProcessor(configs.ImageConfig{Enabled: true})
+	result, err := processor.Resize(stripped, filestore.VariantSpec{Name: "thumb", Width: 100, Height: 100, Mode: filestore.ResizeModeFit, Format: "png"})
+	require.NoError(t, err)
+	assert.Equal(t, 32, result.Width)
+	assert.Equal(t, 64, result.Height)
+
+	variant, err := png.Decode(bytes.NewReader(result.Data))
+	require.NoError(t, err)
+	top := color.RGBAModel.Convert(variant.At(16, 8)).(color.RGBA)
+	bottom := color.RGBAModel.Convert(variant.At(16, 56)).(color.RGBA)
+	assert.Greater(t, top.R, top.B)
+	assert.Greater(t, bottom.B, bottom.R)
+
+	// 方向为1时不需要写回
+	stripped, err = filestore.StripImageMetadata(withSegment(original, exifSegment(1)))
+	require.NoError(t, err)
+	assert.Equal(t, original, stripped)
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newTestImage(8, 8)))
+	original := buf.Bytes()
+
+	// 在IHDR之后插入tEXt块
+	data := []byte("Comment\x00secret location")
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(data)))
+	copy(chunk[4:8], "tEXt")
+	chunk = append(chunk, data...)
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	chunk = binary.BigEndian.AppendUint32(chunk, crc)
+
+	ihdrEnd := 8 + 12 + 13
+	withText := append([]byte{}, original[:ihdrEnd]...)
+	withText = append(withText, chunk...)
+	withText = append(withText, original[ihdrEnd:]...)
+
+	stripped, err := filestore.StripImageMetadata(withText)
+	require.NoError(t, err)
+	assert.Equal(t, original, stripped)
+}
+
+func TestResizeVariant(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newTestImage(200, 100)))
+
+	processor := filestore.NewImageProcessor(configs.ImageConfig{Enabled: true})
+
+	testCases := []struct {
+		name       string
+		spec       filestore.VariantSpec
+		wantWidth  int
+		wantHeight int
+		wantFormat string
+	}{
+		{
+			name:       "fill crops to exact size",
+			spec:       filestore.VariantSpec{Name: "small", Width: 64, Height: 64, Mode: filestore.ResizeModeFill},
+			wantWidth:  64,
+			wantHeight: 64,
+			wantFormat: filestore.ImageFormatPNG,
+		},
+		{
+			name:       "fit keeps aspect ratio",
+			spec:       filestore.VariantSpec{Name: "thumb", Width: 100, Height: 100, Mode: filestore.ResizeModeFit, Format: "jpeg"},
+			wantWidth:  100,
+			wantHeight: 50,
+			wantFormat: filestore.ImageFormatJPEG,
+		},
+		{
+			name:       "never upscales",
+			spec:       filestore.VariantSpec{Name: "large", Width: 1000, Height: 0, Mode: filestore.ResizeModeFit},
+			wantWidth:  200,
+			wantHeight: 100,
+			wantFormat: filestore.ImageFormatPNG,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := processor.Resize(buf.Bytes(), tc.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantWidth, result.Width)
+			assert.Equal(t, tc.wantHeight, result.Height)
+			assert.Equal(t, tc.wantFormat, result.Format)
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(result.Data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantWidth, cfg.Width)
+		})
+	}
+}
+
+func TestVariantPath(t *testing.T) {
+	path := filestore.VariantPath("content/gallery/2025/01/02/abc.jpeg", "thumb", ".jpg")
+	assert.Equal(t, "content/gallery/2025/01/02/abc_thumb.jpg", path)
+}
+
+func TestResizeMaxPixels(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newTestImage(20, 20)))
+	spec := filestore.VariantSpec{Name: "thumb", Width: 10, Height: 10, Mode: filestore.ResizeModeFit}
+
+	processor := filestore.NewImageProcessor(configs.ImageConfig{Enabled: true, MaxPixels: 400})
+	_, err := processor.Resize(buf.Bytes(), spec)
+	require.NoError(t, err)
+
+	processor = filestore.NewImageProcessor(configs.ImageConfig{Enabled: true, MaxPixels: 399})
+	_, err = processor.Resize(buf.Bytes(), spec)
+	assert.ErrorIs(t, err, filestore.ErrImageTooLarge)
+
+	// 只有文件头的超大图片在解码像素之前被拒绝
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 100000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 100000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	bomb := []byte("\x89PNG\r\n\x1a\n")
+	bomb = binary.BigEndian.AppendUint32(bomb, 13)
+	bomb = append(bomb, ihdr...)
+	bomb = binary.BigEndian.AppendUint32(bomb, crc32.ChecksumIEEE(ihdr))
+
+	_, err = filestore.NewImageProcessor(configs.ImageConfig{Enabled: true}).Resize(bomb, spec)
+	assert.ErrorIs(t, err, filestore.ErrImageTooLarge)
+}
@@ -0,0 +1,139 @@
+package filestore_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathManagerDefaults(t *testing.T) {
+	pm := filestore.NewPathManager()
+
+	assert.Contains(t, pm.Usages(), filestore.FileUsageAvatar)
+	baseDir, ok := pm.GetBaseDir(filestore.FileUsageContract)
+	assert.True(t, ok)
+	assert.Equal(t, "documents/contracts", baseDir)
+
+	p, _, err := pm.GenerateFilePath(filestore.FileUsageAvatar, "me.PNG", 42)
+	require.NoError(t, err)
+	assert.Regexp(t, `^users/avatars/user_42/[0-9a-f-]+\.png$`, p)
+
+	assert.Error(t, pm.ValidateFile(filestore.FileUsageAvatar, "me.gif", "", 1))
+	assert.Error(t, pm.ValidateFile(filestore.FileUsageAvatar, "me.png", "", 6*1024*1024))
+
+	// 未配置的用途使用通用规则
+	p, _, err = pm.GenerateFilePath("unknown", "a.bin")
+	require.NoError(t, err)
+	assert.Regexp(t, `^general/\d{4}/\d{2}/\d{2}/`, p)
+}
+
+func TestPathManagerFromConfig(t *testing.T) {
+	pm, err := filestore.NewPathManagerFromConfig(configs.PathConfig{
+		Strict: true,
+		Usages: map[string]configs.UsageRule{
+			"invoice": {
+				BaseDir:     "/finance/invoices/",
+				DateLayout:  "2006-01",
+				MaxFileSize: 1024,
+				AllowedExts: []string{"PDF", ".xml"},
+				MimeTypes:   []string{"application/pdf", "text/*"},
+				Roles:       []string{"admin"},
+			},
+			"logo": {
+				BaseDir: "brand",
+				UserDir: true,
+				Public:  true,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	p, _, err := pm.GenerateFilePath("invoice", "a.pdf", 1)
+	require.NoError(t, err)
+	assert.Regexp(t, "^finance/invoices/"+regexp.QuoteMeta(time.Now().Format("2006-01"))+"/[0-9a-f-]+\\.pdf$", p)
+
+	assert.NoError(t, pm.ValidateFile("invoice", "a.pdf", "application/pdf", 100))
+	assert.NoError(t, pm.ValidateFile("invoice", "a.xml", "text/xml; charset=utf-8", 100))
+	assert.Error(t, pm.ValidateFile("invoice", "a.pdf", "image/png", 100))
+	assert.Error(t, pm.ValidateFile("invoice", "a.doc", "", 100))
+	assert.Error(t, pm.ValidateFile("invoice", "a.pdf", "", 2048))
+
+	assert.NoError(t, pm.CheckRole("invoice", filestore.RoleAdmin))
+	assert.Error(t, pm.CheckRole("invoice", filestore.RoleUser))
+	assert.NoError(t, pm.CheckRole("logo", filestore.RoleUser))
+
+	yes, no := true, false
+	assert.False(t, pm.IsPublic("invoice", nil))
+	assert.True(t, pm.IsPublic("logo", nil))
+	assert.False(t, pm.IsPublic("logo", &no))
+	assert.True(t, pm.IsPublic("invoice", &yes))
+
+	// 严格模式下拒绝未配置的用途
+	assert.Error(t, pm.ValidateFile(filestore.FileUsageGeneral, "a.txt", "", 1))
+	_, _, err = pm.GenerateFilePath(filestore.FileUsageGeneral, "a.txt")
+	assert.Error(t, err)
+}
+
+func TestPathManagerValidation(t *testing.T) {
+	valid := configs.UsageRule{BaseDir: "general"}
+	tests := []struct {
+		name   string
+		config configs.PathConfig
+	}{
+		{"invalid name", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": valid, "Bad Name": {BaseDir: "x"}}}},
+		{"empty base dir", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {}}}},
+		{"parent base dir", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": valid, "a": {BaseDir: "../etc"}}}},
+		{"trash base dir", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": valid, "a": {BaseDir: "trash/a"}}}},
+		{"duplicate base dir", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": valid, "a": {BaseDir: "general"}}}},
+		{"nested base dir", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": valid, "a": {BaseDir: "general/a"}}}},
+		{"static date layout", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", DateLayout: "daily"}}}},
+		{"unsafe date layout", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", DateLayout: "15:04"}}}},
+		{"negative size", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", MaxFileSize: -1}}}},
+		{"invalid ext", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", AllowedExts: []string{"tar.gz"}}}}},
+		{"invalid mime", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", MimeTypes: []string{"image"}}}}},
+		{"unknown role", configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "general", Roles: []string{"root"}}}}},
+		{"missing default", configs.PathConfig{Default: "other", Usages: map[string]configs.UsageRule{"general": valid}}},
+		{"missing general", configs.PathConfig{Usages: map[string]configs.UsageRule{"a": {BaseDir: "a"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := filestore.NewPathManagerFromConfig(tt.config)
+			assert.Error(t, err)
+		})
+	}
+
+	// 严格模式不要求默认用途
+	_, err := filestore.NewPathManagerFromConfig(configs.PathConfig{
+		Strict: true,
+		Usages: map[string]configs.UsageRule{"a": {BaseDir: "a"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestPathManagerReload(t *testing.T) {
+	pm := filestore.NewPathManager()
+
+	// 规则无效时保留原规则
+	err := pm.Reload(configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {}}})
+	assert.Error(t, err)
+	assert.Contains(t, pm.Usages(), filestore.FileUsageAvatar)
+
+	// 不允许修改已有用途的基础目录
+	err = pm.Reload(configs.PathConfig{Usages: map[string]configs.UsageRule{"general": {BaseDir: "misc"}}})
+	assert.Error(t, err)
+
+	err = pm.Reload(configs.PathConfig{Usages: map[string]configs.UsageRule{
+		"general": {BaseDir: "general", MaxFileSize: 10},
+		"invoice": {BaseDir: "finance/invoices"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []filestore.FileUsage{"general", "invoice"}, pm.Usages())
+	assert.Error(t, pm.ValidateFile(filestore.FileUsageGeneral, "a.txt", "", 11))
+	assert.Equal(t, filestore.FileUsageGeneral, pm.GetUsageFromString("avatar"))
+}
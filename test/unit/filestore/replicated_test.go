@@ -0,0 +1,177 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected storage failure")
+
+// faultyStorage 可注入故障的存储
+type faultyStorage struct {
+	filestore.FileStorage
+	down atomic.Bool
+}
+
+func newFaultyStorage(t *testing.T) *faultyStorage {
+	return &faultyStorage{FileStorage: filestore.NewLocalStorage(t.TempDir(), "http://localhost/uploads")}
+}
+
+func (f *faultyStorage) UploadFile(ctx context.Context, filePath string, reader io.Reader, isPublic bool) error {
+	if f.down.Load() {
+		return errInjected
+	}
+	return f.FileStorage.UploadFile(ctx, filePath, reader, isPublic)
+}
+
+func (f *faultyStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	if f.down.Load() {
+		return nil, errInjected
+	}
+	return f.FileStorage.GetFile(ctx, filePath, isPublic)
+}
+
+func (f *faultyStorage) FileExists(ctx context.Context, filePath string, isPublic bool) (bool, error) {
+	if f.down.Load() {
+		return false, errInjected
+	}
+	return f.FileStorage.FileExists(ctx, filePath, isPublic)
+}
+
+func (f *faultyStorage) DeleteFile(ctx context.Context, filePath string, isPublic bool) error {
+	if f.down.Load() {
+		return errInjected
+	}
+	return f.FileStorage.DeleteFile(ctx, filePath, isPublic)
+}
+
+func newReplicated(t *testing.T, config configs.ReplicationConfig) (*filestore.ReplicatedStorage, *faultyStorage, *faultyStorage) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	primary, secondary := newFaultyStorage(t), newFaultyStorage(t)
+	storage, err := filestore.NewReplicatedStorage(filestore.NewStorageManager(primary, secondary), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return storage, primary, secondary
+}
+
+func readFile(t *testing.T, storage filestore.FileStorage, filePath string) string {
+	reader, err := storage.GetFile(context.Background(), filePath, true)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReplicatedStorageMirrorSync(t *testing.T) {
+	storage, primary, secondary := newReplicated(t, configs.ReplicationConfig{Mode: filestore.ReplicationModeMirror})
+	ctx := context.Background()
+
+	require.NoError(t, storage.UploadFile(ctx, "a/1.txt", strings.NewReader("hello"), true))
+	assert.Equal(t, "hello", readFile(t, primary, "a/1.txt"))
+	assert.Equal(t, "hello", readFile(t, secondary, "a/1.txt"))
+
+	require.NoError(t, storage.DeleteFile(ctx, "a/1.txt", true))
+	for _, backend := range []filestore.FileStorage{primary, secondary} {
+		exists, err := backend.FileExists(ctx, "a/1.txt", true)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+}
+
+func TestReplicatedStorageMirrorAsyncRetry(t *testing.T) {
+	storage, _, secondary := newReplicated(t, configs.ReplicationConfig{
+		Mode:             filestore.ReplicationModeMirror,
+		Async:            true,
+		MaxRetries:       100,
+		RetryInterval:    10 * time.Millisecond,
+		FailureThreshold: 2,
+	})
+	ctx := context.Background()
+
+	// 备用存储故障时主存储写入仍然成功
+	secondary.down.Store(true)
+	require.NoError(t, storage.UploadFile(ctx, "a/1.txt", strings.NewReader("hello"), true))
+	assert.Equal(t, "hello", readFile(t, storage, "a/1.txt"))
+
+	assert.Eventually(t, func() bool {
+		return !storage.Health()[1].Healthy
+	}, time.Second, 5*time.Millisecond)
+	assert.Positive(t, storage.PendingReplications())
+	assert.True(t, storage.Health()[0].Healthy)
+
+	// 备用存储恢复后重试完成复制
+	secondary.down.Store(false)
+	assert.Eventually(t, func() bool {
+		return storage.PendingReplications() == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "hello", readFile(t, secondary, "a/1.txt"))
+
+	health := storage.Health()[1]
+	assert.True(t, health.Healthy)
+	assert.Equal(t, errInjected.Error(), health.LastError)
+}
+
+func TestReplicatedStorageFailoverRead(t *testing.T) {
+	storage, primary, secondary := newReplicated(t, configs.ReplicationConfig{
+		Mode:             filestore.ReplicationModeFailover,
+		FailureThreshold: 2,
+		ProbeInterval:    time.Hour,
+	})
+	ctx := context.Background()
+
+	// 故障转移模式只写入主存储
+	require.NoError(t, storage.UploadFile(ctx, "a/1.txt", strings.NewReader("primary"), true))
+	exists, err := secondary.FileExists(ctx, "a/1.txt", true)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// 主存储中不存在的文件从备用存储读取，不视为主存储故障
+	require.NoError(t, secondary.UploadFile(ctx, "a/2.txt", strings.NewReader("secondary"), true))
+	assert.Equal(t, "secondary", readFile(t, storage, "a/2.txt"))
+	exists, err = storage.FileExists(ctx, "a/2.txt", true)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Zero(t, storage.Health()[0].ConsecutiveFailures)
+
+	// 主存储故障时从备用存储读取
+	require.NoError(t, secondary.UploadFile(ctx, "a/1.txt", strings.NewReader("replica"), true))
+	primary.down.Store(true)
+	assert.Equal(t, "replica", readFile(t, storage, "a/1.txt"))
+	assert.Equal(t, "replica", readFile(t, storage, "a/1.txt"))
+	assert.False(t, storage.Health()[0].Healthy)
+
+	// 不健康的主存储在探测间隔内不再尝试
+	primary.down.Store(false)
+	assert.Equal(t, "replica", readFile(t, storage, "a/1.txt"))
+
+	// 两个存储中都不存在时返回错误
+	_, err = storage.GetFile(ctx, "a/3.txt", true)
+	assert.Error(t, err)
+}
+
+func TestNewReplicatedStorageValidation(t *testing.T) {
+	primary := filestore.NewLocalStorage(t.TempDir(), "")
+
+	_, err := filestore.NewReplicatedStorage(filestore.NewStorageManager(primary), configs.ReplicationConfig{})
+	assert.Error(t, err)
+
+	_, err = filestore.NewReplicatedStorage(
+		filestore.NewStorageManager(primary, filestore.NewLocalStorage(t.TempDir(), "")),
+		configs.ReplicationConfig{Mode: "unknown"},
+	)
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package filestore_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinIOUploadForm(t *testing.T) {
+	storage, err := filestore.NewMinIOStorage(filestore.MinIOConfig{
+		Endpoint:  "http://127.0.0.1:9000",
+		Bucket:    "uploads",
+		Region:    "us-east-1",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	})
+	require.NoError(t, err)
+
+	upload, err := storage.GetUploadForm(context.Background(), "users/avatars/a.png", true, filestore.PostPolicy{
+		ContentType: "image/png",
+		MaxSize:     1024,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "POST", upload.Method)
+	assert.Equal(t, "http://127.0.0.1:9000/uploads", upload.UploadURL)
+	assert.Equal(t, "public/users/avatars/a.png", upload.Headers["key"])
+	assert.Equal(t, "image/png", upload.Headers["Content-Type"])
+	assert.NotEmpty(t, upload.Headers["X-Amz-Signature"])
+
+	// 策略限制大小范围、类型前缀和对象键
+	data, err := base64.StdEncoding.DecodeString(upload.Headers["policy"])
+	require.NoError(t, err)
+	var policy struct {
+		Conditions []any `json:"conditions"`
+	}
+	require.NoError(t, json.Unmarshal(data, &policy))
+	assert.Contains(t, policy.Conditions, []any{"content-length-range", float64(0), float64(1024)})
+	assert.Contains(t, policy.Conditions, []any{"starts-with", "$Content-Type", "image/png"})
+	assert.Contains(t, policy.Conditions, map[string]any{"key": "public/users/avatars/a.png"})
+}
+
+func TestSplitFullPath(t *testing.T) {
+	path, isPublic, err := filestore.SplitFullPath("private/documents/a.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "documents/a.pdf", path)
+	assert.False(t, isPublic)
+
+	path, isPublic, err = filestore.SplitFullPath("/public/a.png")
+	require.NoError(t, err)
+	assert.Equal(t, "a.png", path)
+	assert.True(t, isPublic)
+
+	_, _, err = filestore.SplitFullPath("trash/a.png")
+	assert.Error(t, err)
+	_, _, err = filestore.SplitFullPath("public/")
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// blobs 按可见范围列出内容对象记录
+func blobs(t *testing.T, db *gorm.DB, isPublic bool) []model.FileBlob {
+	var result []model.FileBlob
+	require.NoError(t, db.Where("is_public = ?", isPublic).Find(&result).Error)
+	return result
+}
+
+// storeFile 通过统一上传写入内容，返回引用该内容的文件记录
+func storeFile(t *testing.T, service *handler.BlobService, storage filestore.FileStorage, filePath, content string, isPublic bool) *model.File {
+	path, checksum, err := service.Store(context.Background(), filePath, strings.NewReader(content), isPublic)
+	require.NoError(t, err)
+	return &model.File{Path: path, SHA256: checksum.SHA256, IsPublic: isPublic, StorageType: storage.GetStorageType()}
+}
+
+// uploadDirect 模拟客户端直传，内容直接写入存储，尚未登记
+func uploadDirect(t *testing.T, storage filestore.FileStorage, filePath, content string, isPublic bool) *model.File {
+	require.NoError(t, storage.UploadFile(context.Background(), filePath, strings.NewReader(content), isPublic))
+	return &model.File{Path: filePath, IsPublic: isPublic, StorageType: storage.GetStorageType()}
+}
+
+func TestBlobServiceDeduplicate(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	service := handler.NewBlobService(db, storage)
+
+	// 统一上传和直传的相同内容共享一个对象，直传写入的重复对象被删除
+	first := storeFile(t, service, storage, "general/a.txt", "same content", false)
+	second := uploadDirect(t, storage, "general/b.txt", "same content", false)
+	_, err := service.Register(ctx, second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "general/a.txt", second.Path)
+	assert.Equal(t, first.SHA256, second.SHA256)
+	assert.False(t, exists(t, storage, "general/b.txt", false))
+	stored := blobs(t, db, false)
+	require.Len(t, stored, 1)
+	assert.Equal(t, 2, stored[0].RefCount)
+
+	// 释放一个引用后保留对象，释放最后一个引用后删除对象和记录
+	require.NoError(t, service.Release(ctx, first))
+	assert.True(t, exists(t, storage, "general/a.txt", false))
+	assert.Equal(t, 1, blobs(t, db, false)[0].RefCount)
+
+	require.NoError(t, service.Release(ctx, second))
+	assert.False(t, exists(t, storage, "general/a.txt", false))
+	assert.Empty(t, blobs(t, db, false))
+
+	// 记录删除后相同内容可以重新登记
+	third := storeFile(t, service, storage, "general/c.txt", "same content", false)
+	assert.Equal(t, "general/c.txt", third.Path)
+	assert.Equal(t, 1, blobs(t, db, false)[0].RefCount)
+}
+
+func TestBlobServiceConcurrentRegister(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	service := handler.NewBlobService(db, storage)
+
+	// 确认上传和存储事件回调同时登记同一个直传对象，不会把共享的对象当作重复内容删除
+	uploadDirect(t, storage, "general/d.txt", "direct upload", false)
+	files := make([]*model.File, 2)
+	var wg sync.WaitGroup
+	for i := range files {
+		files[i] = &model.File{Path: "general/d.txt", StorageType: storage.GetStorageType()}
+		wg.Add(1)
+		go func(file *model.File) {
+			defer wg.Done()
+			_, err := service.Register(ctx, file)
+			assert.NoError(t, err)
+		}(files[i])
+	}
+	wg.Wait()
+
+	for _, file := range files {
+		assert.Equal(t, "general/d.txt", file.Path)
+	}
+	assert.True(t, exists(t, storage, "general/d.txt", false))
+	stored := blobs(t, db, false)
+	require.Len(t, stored, 1)
+	assert.Equal(t, 2, stored[0].RefCount)
+
+	// 未能完成上传的一方释放引用，对象仍然保留
+	require.NoError(t, service.Release(ctx, files[1]))
+	assert.True(t, exists(t, storage, "general/d.txt", false))
+	assert.Equal(t, 1, blobs(t, db, false)[0].RefCount)
+}
+
+func TestBlobServiceVisibility(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	service := handler.NewBlobService(db, storage)
+
+	// 公开和私有的相同内容分别保存，互不引用
+	private := storeFile(t, service, storage, "general/e.txt", "shared bytes", false)
+	public := storeFile(t, service, storage, "general/e.txt", "shared bytes", true)
+	assert.Equal(t, private.SHA256, public.SHA256)
+
+	for _, isPublic := range []bool{false, true} {
+		stored := blobs(t, db, isPublic)
+		require.Len(t, stored, 1)
+		assert.Equal(t, 1, stored[0].RefCount)
+		assert.True(t, exists(t, storage, "general/e.txt", isPublic))
+	}
+
+	// 删除私有文件不影响公开文件
+	require.NoError(t, service.Release(ctx, private))
+	assert.False(t, exists(t, storage, "general/e.txt", false))
+	assert.True(t, exists(t, storage, "general/e.txt", true))
+	assert.Len(t, blobs(t, db, true), 1)
+}
@@ -0,0 +1,153 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedFileDownloadURL(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db := newQuotaTestDB(t)
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	config := &configs.Config{}
+	config.JwtAuth.AccessSecret = "test-secret"
+	config.Storage.Encryption = configs.EncryptionConfig{
+		Enabled: true,
+		Keys:    []configs.MasterKeyConfig{{ID: "key-1", Key: base64.StdEncoding.EncodeToString(key)}},
+		Usages:  []string{"contract"},
+	}
+	config.Storage.Image = configs.ImageConfig{
+		Enabled:  true,
+		Variants: map[string][]configs.ImageVariant{"contract": {{Name: "thumb", Width: 4, Height: 4, Mode: "fit"}}},
+	}
+	raw := filestore.NewLocalStorage(t.TempDir(), "http://localhost/uploads")
+	storage, err := filestore.WithEncryption(*config, raw)
+	require.NoError(t, err)
+
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+	app := &testApp{
+		config:        config,
+		db:            db,
+		cache:         c,
+		responseCache: middleware.NewResponseCache(c, middleware.ResponseCacheOptions{TTL: time.Hour}),
+		storage:       storage,
+	}
+	// 解密下载的地址使用注册路由时的前缀
+	router := gin.New()
+	handler.NewFileHandler(app).InitRouters(router.Group("/api/v2"), router)
+
+	// 客户端直传的合同文件，确认上传时加密
+	plain := "confidential contract"
+	contract := &model.File{
+		OriginalName: "a.pdf", Path: "documents/contracts/2026/10/a.pdf", Usage: "contract", Size: int64(len(plain)),
+		StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusPending,
+	}
+	require.NoError(t, raw.UploadFile(ctx, contract.Path, strings.NewReader(plain), false))
+	require.NoError(t, db.Create(contract).Error)
+	require.NoError(t, handler.NewUploadService(db, storage, config).Complete(ctx, contract, true))
+
+	contentURL := "/api/v2/files/" + contract.ID + "/content"
+	assert.NotContains(t, string(readStored(t, raw, contract.Path)), plain)
+
+	general := &model.File{
+		OriginalName: "b.txt", Path: "general/2026/10/18/b.txt", Usage: "general",
+		StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusActive,
+	}
+	require.NoError(t, storage.UploadFile(ctx, general.Path, strings.NewReader(plain), false))
+	require.NoError(t, db.Create(general).Error)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	adminToken := testToken(t, config, 2, true)
+	downloadURL := func(file *model.File) string {
+		w := get("/api/v2/admin/files/"+file.ID+"/download", adminToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result response.Result[dto.FileDownloadResponse]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result.Data.DownloadURL
+	}
+
+	// 加密文件返回解密下载的地址，所有者通过该地址下载到明文
+	assert.Equal(t, contentURL, downloadURL(contract))
+	w := get(contentURL, testToken(t, config, 1, false))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, plain, w.Body.String())
+
+	// 其他用途使用存储的URL
+	expected, err := raw.GetDownloadURL(ctx, general.Path, false)
+	require.NoError(t, err)
+	assert.Equal(t, expected, downloadURL(general))
+
+	// 加密文件的衍生图同样加密存储，返回解密下载的地址
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	scan := &model.File{
+		OriginalName: "scan.png", Path: "documents/contracts/2026/10/scan.png", Usage: "contract",
+		Extension: ".png", MimeType: "image/png", Size: int64(buf.Len()),
+		StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusActive,
+	}
+	require.NoError(t, storage.UploadFile(ctx, scan.Path, bytes.NewReader(buf.Bytes()), false))
+	require.NoError(t, db.Create(scan).Error)
+
+	ownerToken := testToken(t, config, 1, false)
+	w = get("/api/v2/files/"+scan.ID+"/variants/thumb", ownerToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var variant response.Result[dto.FileVariantResponse]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &variant))
+	variantURL := "/api/v2/files/" + scan.ID + "/variants/thumb/content"
+	assert.Equal(t, variantURL, variant.Data.DownloadURL)
+
+	w = get(variantURL, ownerToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	thumb, err := png.Decode(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 4, thumb.Bounds().Dx())
+
+	// 其他用户不能下载私有文件的衍生图
+	assert.Equal(t, http.StatusForbidden, get(variantURL, testToken(t, config, 3, false)).Code)
+}
+
+// readStored 读取存储中保存的原始内容
+func readStored(t *testing.T, storage filestore.FileStorage, filePath string) []byte {
+	reader, err := storage.GetFile(context.Background(), filePath, false)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,110 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveEntryNames(t *testing.T) {
+	files := []model.File{
+		{OriginalName: "report.pdf"},
+		{OriginalName: "Report.PDF"},
+		{OriginalName: "report (1).pdf"},
+		{OriginalName: "../../etc/passwd"},
+		{OriginalName: `C:\docs\notes.txt`},
+		{OriginalName: "", UUIDModel: model.UUIDModel{ID: "file-id"}},
+		{OriginalName: "README"},
+		{OriginalName: "readme"},
+	}
+
+	assert.Equal(t, []string{
+		"report.pdf",
+		"Report (1).PDF",
+		"report (1) (1).pdf",
+		"passwd",
+		"notes.txt",
+		"file-id",
+		"README",
+		"readme (1)",
+	}, handler.ArchiveEntryNames(files))
+}
+
+func TestFileArchiveService(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	service := handler.NewFileArchiveService(db, storage)
+
+	create := func(userID int64, name, usage, content string) *model.File {
+		file := &model.File{
+			OriginalName: name, Path: "general/" + strings.ToLower(name) + "-" + usage, Usage: usage,
+			Size: int64(len(content)), MimeType: "text/plain", UploadedBy: userID, Status: 1,
+		}
+		require.NoError(t, storage.UploadFile(ctx, file.Path, strings.NewReader(content), false))
+		require.NoError(t, db.Create(file).Error)
+		return file
+	}
+	a := create(1, "a.txt", "document", "first")
+	b := create(1, "A.txt", "general", "second")
+	other := create(2, "c.txt", "document", "other")
+
+	// 按ID打包时保持请求顺序
+	files, err := service.Resolve(ctx, 1, &dto.FileArchiveRequest{FileIDs: []string{b.ID, a.ID, b.ID}})
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, b.ID, files[0].ID)
+
+	var buf bytes.Buffer
+	require.NoError(t, service.Write(ctx, &buf, files))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "A.txt", zr.File[0].Name)
+	assert.Equal(t, "a (1).txt", zr.File[1].Name)
+
+	rc, err := zr.File[1].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+
+	// 包含其他用户的文件时拒绝打包
+	_, err = service.Resolve(ctx, 1, &dto.FileArchiveRequest{FileIDs: []string{a.ID, other.ID}})
+	assert.True(t, errspec.ErrFileNotFound.Is(err))
+
+	// 按用途过滤只返回当前用户的文件，管理员不限制上传者
+	files, err = service.Resolve(ctx, 1, &dto.FileArchiveRequest{Usage: "document"})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	files, err = service.Resolve(ctx, 0, &dto.FileArchiveRequest{Usage: "document"})
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// 按标签过滤
+	require.NoError(t, model.NewTagRepo(db).SetFileTags(ctx, 1, b.ID, []string{"work"}))
+	files, err = service.Resolve(ctx, 1, &dto.FileArchiveRequest{Tag: "work"})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, b.ID, files[0].ID)
+
+	_, err = service.Resolve(ctx, 1, &dto.FileArchiveRequest{Tag: "missing"})
+	assert.True(t, errspec.ErrFileArchiveEmpty.Is(err))
+
+	_, err = service.Resolve(ctx, 1, &dto.FileArchiveRequest{})
+	assert.True(t, errspec.ErrInvalidParams.Is(err))
+}
@@ -0,0 +1,106 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/bloom"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// testApp 处理器测试使用的AppContext
+type testApp struct {
+	config        *configs.Config
+	db            *gorm.DB
+	cache         cache.Cache
+	responseCache *middleware.ResponseCache
+	storage       filestore.FileStorage
+}
+
+func (a *testApp) GetConfig() *configs.Config                  { return a.config }
+func (a *testApp) GetDB() *gorm.DB                             { return a.db }
+func (a *testApp) GetCache() cache.Cache                       { return a.cache }
+func (a *testApp) GetResponseCache() *middleware.ResponseCache { return a.responseCache }
+func (a *testApp) GetStorage() filestore.FileStorage           { return a.storage }
+func (a *testApp) GetPathManager() *filestore.PathManager      { return filestore.NewPathManager() }
+func (a *testApp) GetUserFilter() bloom.Filter                 { return nil }
+
+func TestPublicFileInfoCache(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	gin.SetMode(gin.TestMode)
+
+	db := newTestDB(t)
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+
+	// 与应用相同：响应缓存和RepoCache使用同一个缓存，RepoCache只负责失效
+	require.NoError(t, db.Use(model.NewRepoCache(c, model.RepoCacheOptions{})))
+	app := &testApp{
+		config:        &configs.Config{},
+		db:            db,
+		cache:         c,
+		responseCache: middleware.NewResponseCache(c, middleware.ResponseCacheOptions{TTL: time.Hour}),
+		storage:       filestore.NewLocalStorage(t.TempDir(), ""),
+	}
+	router := gin.New()
+	handler.NewFileHandler(app).InitRouters(router.Group("/api/v1"), router)
+
+	file := &model.File{OriginalName: "a.txt", Status: model.FileStatusActive, IsPublic: true}
+	file.ID = "6f1c3a52-1d7e-4c1b-9d3e-2a4b5c6d7e8f"
+	require.NoError(t, db.Create(file).Error)
+	other := &model.File{OriginalName: "b.txt", Status: model.FileStatusActive, IsPublic: true}
+	other.ID = "0b9e8d7c-6b5a-4f3e-8d2c-1b0a9f8e7d6c"
+	require.NoError(t, db.Create(other).Error)
+
+	get := func(id string) (*httptest.ResponseRecorder, model.File) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/files/"+id, nil))
+		var result response.Result[model.File]
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		}
+		return w, result.Data
+	}
+
+	w, got := get(file.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "a.txt", got.OriginalName)
+	w, _ = get(file.ID)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	get(other.ID)
+
+	// 按主键更新后只失效该文件
+	require.NoError(t, db.Model(file).Update("original_name", "renamed.txt").Error)
+	w, got = get(file.ID)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "renamed.txt", got.OriginalName)
+	w, _ = get(other.ID)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	// 没有主键条件的批量更新失效所有文件
+	require.NoError(t, db.Model(&model.File{}).Where("is_public = ?", true).Update("storage_type", "s3").Error)
+	w, got = get(other.ID)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "s3", got.StorageType)
+
+	// 删除后不再返回缓存的响应
+	require.NoError(t, db.Delete(&model.File{}, "id = ?", file.ID).Error)
+	w, _ = get(file.ID)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+}
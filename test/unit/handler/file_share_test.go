@@ -0,0 +1,133 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharePasswordLockout(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db := newQuotaTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.FileShare{}))
+
+	config := &configs.Config{}
+	config.JwtAuth.AccessSecret = "test-secret"
+	config.Storage.Share = configs.ShareConfig{
+		MaxPasswordFailures: 3,
+		MaxIPFailures:       5,
+		LockoutDuration:     time.Minute,
+	}
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+	app := &testApp{config: config, db: db, cache: c, storage: storage}
+	router := gin.New()
+	handler.NewFileShareHandler(app).InitRouters(router.Group("/api/v1"), router)
+
+	service := handler.NewFileShareService(db, storage, c, config)
+	newShare := func(name string) string {
+		file := &model.File{
+			OriginalName: name, Path: "general/" + name, Size: int64(len(name)),
+			StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusActive,
+		}
+		require.NoError(t, storage.UploadFile(ctx, file.Path, strings.NewReader(name), false))
+		require.NoError(t, db.Create(file).Error)
+		share, err := service.Create(ctx, 1, file, &dto.FileShareRequest{Password: "secret"})
+		require.NoError(t, err)
+		return share.Token
+	}
+	open := func(token, password, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/s/"+token, nil)
+		req.Header.Set(handler.SharePasswordHeader, password)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := newShare("a.txt")
+	second := newShare("b.txt")
+
+	// 同一链接输错3次后锁定，锁定期间正确的密码也被拒绝，其他IP同样被拒绝
+	for range 3 {
+		assert.Equal(t, http.StatusForbidden, open(first, "wrong", "192.0.2.1").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, open(first, "secret", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, open(first, "secret", "192.0.2.2").Code)
+
+	// 同一IP在所有链接上累计输错5次后锁定，其他IP不受影响
+	for range 2 {
+		assert.Equal(t, http.StatusForbidden, open(second, "wrong", "192.0.2.1").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, open(second, "secret", "192.0.2.1").Code)
+	w := open(second, "secret", "192.0.2.2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "b.txt", w.Body.String())
+
+	// 密码正确后重新统计该链接的错误次数
+	for range 2 {
+		assert.Equal(t, http.StatusForbidden, open(second, "wrong", "192.0.2.3").Code)
+	}
+	assert.Equal(t, http.StatusOK, open(second, "secret", "192.0.2.3").Code)
+	for range 2 {
+		assert.Equal(t, http.StatusForbidden, open(second, "wrong", "192.0.2.4").Code)
+	}
+	assert.Equal(t, http.StatusOK, open(second, "secret", "192.0.2.4").Code)
+
+	// 密码不从查询参数读取，可以通过POST表单提交
+	third := newShare("c.txt")
+	req := httptest.NewRequest(http.MethodGet, "/s/"+third+"?password=secret", nil)
+	req.RemoteAddr = "192.0.2.5:1234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/s/"+third, strings.NewReader(url.Values{"password": {"secret"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "192.0.2.5:1234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "c.txt", w.Body.String())
+
+	// 并发猜测时先占用次数再校验，只有限制内的请求会校验密码
+	fourth := newShare("d.txt")
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- open(fourth, "wrong", fmt.Sprintf("198.51.100.%d", i)).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusForbidden: 3, http.StatusTooManyRequests: 7}, counts)
+	assert.Equal(t, http.StatusTooManyRequests, open(fourth, "secret", "198.51.100.100").Code)
+}
@@ -0,0 +1,136 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestFileVersionService(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	config := &configs.Config{}
+	versions := handler.NewFileVersionService(db, storage, config)
+	blobs := handler.NewBlobService(db, storage)
+	quota := handler.NewQuotaService(db, config)
+
+	store := func(name, content string) *model.File {
+		path, checksum, err := blobs.Store(ctx, "documents/contracts/2026/"+name, strings.NewReader(content), false)
+		require.NoError(t, err)
+		return &model.File{
+			Name: name, OriginalName: name, Path: path, Size: checksum.Size, Extension: ".txt",
+			StorageType: storage.GetStorageType(), SHA256: checksum.SHA256, MD5: checksum.MD5,
+		}
+	}
+	read := func(version *model.FileVersion) string {
+		reader, err := storage.GetFile(ctx, version.Path, version.IsPublic)
+		require.NoError(t, err)
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	file := store("v1.txt", "one")
+	file.Usage, file.UploadedBy, file.Status, file.Version = "contract", 1, 1, 1
+	require.NoError(t, db.Create(file).Error)
+	require.NoError(t, quota.Consume(ctx, db, 1, file.Usage, file.Size))
+	v1Path := file.Path
+
+	// 替换后文件记录指向新内容，原内容保存为历史版本
+	require.NoError(t, versions.Replace(ctx, file, store("v2.txt", "second"), 2))
+	assert.Equal(t, 2, file.Version)
+	assert.Equal(t, "v2.txt", file.OriginalName)
+
+	var saved model.File
+	require.NoError(t, db.First(&saved, "id = ?", file.ID).Error)
+	assert.Equal(t, 2, saved.Version)
+	assert.Equal(t, int64(6), saved.Size)
+
+	items, err := versions.List(ctx, file)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.True(t, items[0].Latest)
+	assert.Equal(t, []int{2, 1}, []int{items[0].Version, items[1].Version})
+
+	v1, err := versions.Get(ctx, file, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "one", read(v1))
+
+	// 配额按最新版本计算，文件数不变
+	var usage model.StorageUsage
+	require.NoError(t, db.Where("user_id = ? AND file_usage = ?", 1, model.StorageUsageTotal).First(&usage).Error)
+	assert.Equal(t, int64(1), usage.Files)
+	assert.Equal(t, int64(6), usage.Bytes)
+
+	// 恢复历史版本生成新的最新版本
+	require.NoError(t, versions.Restore(ctx, file, 1, 2))
+	assert.Equal(t, 3, file.Version)
+	current, err := versions.Get(ctx, file, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "one", read(current))
+	assert.Equal(t, v1Path, file.Path, "相同内容引用已有对象")
+
+	_, err = versions.Get(ctx, file, 9)
+	assert.Error(t, err)
+
+	// 超过保留数量的历史版本被删除，仍被引用的存储对象保留
+	require.NoError(t, versions.Replace(ctx, file, store("v4.txt", "fourth"), 2))
+	items, err = versions.List(ctx, file)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, []int{4, 3, 2}, []int{items[0].Version, items[1].Version, items[2].Version})
+	assert.True(t, exists(t, storage, v1Path, false))
+
+	// 删除全部历史版本后只保留最新版本的内容
+	v2, err := versions.Get(ctx, file, 2)
+	require.NoError(t, err)
+	require.NoError(t, versions.DeleteAll(ctx, file.ID))
+	assert.False(t, exists(t, storage, v2.Path, false))
+	assert.False(t, exists(t, storage, v1Path, false))
+	assert.True(t, exists(t, storage, file.Path, false))
+	_, err = versions.Get(ctx, file, 3)
+	assert.Error(t, err)
+}
+
+func TestFileVersionConflict(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	versions := handler.NewFileVersionService(db, storage, &configs.Config{})
+	blobs := handler.NewBlobService(db, storage)
+
+	file := &model.File{Path: "a.txt", Usage: "contract", UploadedBy: 1, Status: 1, Version: 1}
+	require.NoError(t, db.Create(file).Error)
+	stale := *file
+
+	next := func(content string) *model.File {
+		path, checksum, err := blobs.Store(ctx, "documents/"+content+".txt", strings.NewReader(content), false)
+		require.NoError(t, err)
+		return &model.File{Path: path, Size: checksum.Size, SHA256: checksum.SHA256, StorageType: storage.GetStorageType()}
+	}
+
+	require.NoError(t, versions.Replace(ctx, file, next("a"), 0))
+
+	// 基于过期记录的替换与已保存的版本号冲突，新内容被释放
+	b := next("b")
+	assert.Error(t, versions.Replace(ctx, &stale, b, 0))
+	assert.Equal(t, 1, stale.Version)
+	assert.False(t, exists(t, storage, b.Path, false))
+	assert.ErrorIs(t, db.First(&model.FileBlob{}, "sha256 = ?", b.SHA256).Error, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,84 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader 记录读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestImageServiceSizeLimit(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	const maxSize = 1024
+	config := &configs.Config{}
+	config.Storage.PathConfig = configs.PathConfig{
+		Strict: true,
+		Usages: map[string]configs.UsageRule{"photo": {BaseDir: "photos", MaxFileSize: maxSize}},
+	}
+	config.Storage.Image = configs.ImageConfig{
+		Enabled:       true,
+		StripMetadata: true,
+		Variants:      map[string][]configs.ImageVariant{"photo": {{Name: "thumb", Width: 4, Height: 4, Mode: "fit"}}},
+	}
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	service := handler.NewImageService(db, storage, config)
+
+	// 超过用途的大小限制时只读取限制加一个字节
+	reader := &countingReader{r: bytes.NewReader(make([]byte, 10*maxSize))}
+	_, err := service.SanitizeUpload(ctx, "photo", "a.png", reader)
+	assert.True(t, errspec.ErrFileTooLarge.Is(err), err)
+	assert.Equal(t, int64(maxSize+1), reader.n)
+
+	var small bytes.Buffer
+	require.NoError(t, png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+	require.Less(t, small.Len(), maxSize)
+	_, err = service.SanitizeUpload(ctx, "photo", "a.png", bytes.NewReader(small.Bytes()))
+	assert.NoError(t, err)
+
+	// 存储中超过限制的图片不解码生成衍生图
+	noise := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range noise.Pix {
+		noise.Pix[i] = byte(rand.IntN(256))
+	}
+	var large bytes.Buffer
+	require.NoError(t, png.Encode(&large, noise))
+	require.Greater(t, large.Len(), maxSize)
+
+	file := &model.File{
+		OriginalName: "b.png", Path: "photos/b.png", Usage: "photo", Extension: ".png",
+		Size: int64(large.Len()), StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusActive,
+	}
+	require.NoError(t, storage.UploadFile(ctx, file.Path, bytes.NewReader(large.Bytes()), false))
+	require.NoError(t, db.Create(file).Error)
+
+	_, err = service.GetOrCreateVariant(ctx, file, "thumb")
+	assert.True(t, errspec.ErrFileTooLarge.Is(err), err)
+	assert.True(t, errspec.ErrFileTooLarge.Is(service.SanitizeStored(ctx, file)))
+}
@@ -0,0 +1,320 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/jwt"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newQuotaTestDB 测试数据库，额外迁移用户表用于确定配额角色
+func newQuotaTestDB(t *testing.T) *gorm.DB {
+	db := newTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+
+	require.NoError(t, db.Create(&model.User{SnowflakeModel: model.SnowflakeModel{ID: 1}, Username: "alice", Password: "x"}).Error)
+	require.NoError(t, db.Create(&model.User{SnowflakeModel: model.SnowflakeModel{ID: 2}, Username: "root", Password: "x", IsAdmin: true}).Error)
+	return db
+}
+
+// testToken 生成访问令牌
+func testToken(t *testing.T, config *configs.Config, userID int64, isAdmin bool) string {
+	token, err := jwt.GenerateToken(gojwt.MapClaims{"user_id": userID, "is_admin": isAdmin}, config.JwtAuth.AccessSecret, time.Hour)
+	require.NoError(t, err)
+	return token
+}
+
+// consume 在事务中占用配额
+func consume(quota *handler.QuotaService, db *gorm.DB, userID int64, usage string, size int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return quota.Consume(context.Background(), tx, userID, usage, size)
+	})
+}
+
+// usageOf 获取用户指定用途的用量记录
+func usageOf(t *testing.T, db *gorm.DB, userID int64, usage string) model.StorageUsage {
+	var u model.StorageUsage
+	require.NoError(t, db.Where("user_id = ? AND file_usage = ?", userID, usage).First(&u).Error)
+	return u
+}
+
+func TestQuotaBoundary(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newQuotaTestDB(t)
+
+	config := &configs.Config{}
+	config.Storage.Quota = configs.QuotaConfig{
+		Enabled: true,
+		Default: configs.QuotaLimit{MaxBytes: 100, MaxFiles: 3},
+		Usages:  map[string]configs.QuotaLimit{"avatar": {MaxBytes: 50}},
+	}
+	quota := handler.NewQuotaService(db, config)
+
+	// 单个文件超出限制时没有用量记录也会拒绝
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(quota.Check(ctx, 1, "document", 101)))
+	assert.NoError(t, quota.Check(ctx, 1, "document", 100))
+
+	// 恰好达到字节上限时允许，再多1字节拒绝
+	require.NoError(t, consume(quota, db, 1, "document", 60))
+	assert.NoError(t, quota.Check(ctx, 1, "document", 40))
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(quota.Check(ctx, 1, "document", 41)))
+	require.NoError(t, consume(quota, db, 1, "document", 40))
+	err := consume(quota, db, 1, "document", 1)
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(err))
+	assert.Equal(t, int64(100), usageOf(t, db, 1, model.StorageUsageTotal).Bytes)
+
+	// 用途配额超出时事务回滚，总用量不变
+	other := int64(3)
+	require.NoError(t, db.Create(&model.User{SnowflakeModel: model.SnowflakeModel{ID: other}, Username: "bob", Password: "x"}).Error)
+	require.NoError(t, consume(quota, db, other, "avatar", 50))
+	err = consume(quota, db, other, "avatar", 1)
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(err))
+	assert.Equal(t, int64(50), usageOf(t, db, other, model.StorageUsageTotal).Bytes)
+	assert.Equal(t, int64(1), usageOf(t, db, other, model.StorageUsageTotal).Files)
+
+	// 文件数上限
+	require.NoError(t, consume(quota, db, other, "document", 0))
+	require.NoError(t, consume(quota, db, other, "document", 0))
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(quota.Check(ctx, other, "document", 0)))
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(consume(quota, db, other, "document", 0)))
+	assert.Equal(t, int64(3), usageOf(t, db, other, model.StorageUsageTotal).Files)
+
+	// 未启用配额时只统计用量
+	config.Storage.Quota.Enabled = false
+	disabled := handler.NewQuotaService(db, config)
+	assert.NoError(t, disabled.Check(ctx, 1, "document", 1000))
+	require.NoError(t, consume(disabled, db, 1, "document", 1000))
+	assert.Equal(t, int64(1100), usageOf(t, db, 1, model.StorageUsageTotal).Bytes)
+}
+
+func TestQuotaConcurrentConsume(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	db := newQuotaTestDB(t)
+
+	config := &configs.Config{}
+	config.Storage.Quota = configs.QuotaConfig{
+		Enabled: true,
+		Default: configs.QuotaLimit{MaxBytes: 50},
+	}
+	quota := handler.NewQuotaService(db, config)
+
+	// 并发上传只有不超过配额的部分成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, exceeded := 0, 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := consume(quota, db, 1, "document", 10)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errspec.ErrStorageQuotaExceeded.Is(err):
+				exceeded++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, succeeded)
+	assert.Equal(t, 15, exceeded)
+	total := usageOf(t, db, 1, model.StorageUsageTotal)
+	assert.Equal(t, int64(50), total.Bytes)
+	assert.Equal(t, int64(5), total.Files)
+	assert.Equal(t, int64(50), usageOf(t, db, 1, "document").Bytes)
+}
+
+func TestQuotaRelease(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newQuotaTestDB(t)
+	quota := handler.NewQuotaService(db, &configs.Config{})
+
+	require.NoError(t, consume(quota, db, 1, "document", 30))
+
+	// 释放超过已用的字节数和文件数时减到0为止
+	for range 2 {
+		require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+			return quota.Release(ctx, tx, 1, "document", 100)
+		}))
+	}
+
+	for _, name := range []string{model.StorageUsageTotal, "document"} {
+		u := usageOf(t, db, 1, name)
+		assert.Zero(t, u.Bytes, name)
+		assert.Zero(t, u.Files, name)
+	}
+
+	// 没有用量记录时释放不报错
+	require.NoError(t, quota.Release(ctx, db, 1, "avatar", 10))
+}
+
+func TestQuotaOverridePrecedence(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newQuotaTestDB(t)
+
+	config := &configs.Config{}
+	config.Storage.Quota = configs.QuotaConfig{
+		Enabled: true,
+		Default: configs.QuotaLimit{MaxBytes: 1000},
+		Roles:   map[string]configs.QuotaLimit{handler.QuotaRoleAdmin: {MaxBytes: 5000}},
+		Usages:  map[string]configs.QuotaLimit{"avatar": {MaxBytes: 100}},
+	}
+	quota := handler.NewQuotaService(db, config)
+
+	limits := func(userID int64, usage string) (configs.QuotaLimit, configs.QuotaLimit) {
+		total, perUsage, err := quota.Limits(ctx, userID, usage)
+		require.NoError(t, err)
+		return total, perUsage
+	}
+
+	// 角色配额覆盖默认配额，用途配额只作用于对应用途
+	total, perUsage := limits(1, "avatar")
+	assert.Equal(t, int64(1000), total.MaxBytes)
+	assert.Equal(t, int64(100), perUsage.MaxBytes)
+	total, perUsage = limits(2, "document")
+	assert.Equal(t, int64(5000), total.MaxBytes)
+	assert.Zero(t, perUsage.MaxBytes)
+
+	// 单独设置覆盖角色配额和用途配额，0表示不限制
+	require.NoError(t, quota.SetOverride(ctx, 2, "", configs.QuotaLimit{MaxBytes: 200}))
+	require.NoError(t, quota.SetOverride(ctx, 2, "avatar", configs.QuotaLimit{}))
+	total, perUsage = limits(2, "avatar")
+	assert.Equal(t, int64(200), total.MaxBytes)
+	assert.Zero(t, perUsage.MaxBytes)
+	assert.NoError(t, quota.Check(ctx, 2, "avatar", 150))
+	assert.True(t, errspec.ErrStorageQuotaExceeded.Is(quota.Check(ctx, 2, "avatar", 201)))
+
+	// 单独设置只影响该用户
+	total, perUsage = limits(1, "avatar")
+	assert.Equal(t, int64(1000), total.MaxBytes)
+	assert.Equal(t, int64(100), perUsage.MaxBytes)
+
+	// 重复设置更新已有记录
+	require.NoError(t, quota.SetOverride(ctx, 2, "", configs.QuotaLimit{MaxBytes: 300}))
+	total, _ = limits(2, "")
+	assert.Equal(t, int64(300), total.MaxBytes)
+
+	// 删除后恢复使用配置
+	require.NoError(t, quota.DeleteOverride(ctx, 2, ""))
+	require.NoError(t, quota.DeleteOverride(ctx, 2, "avatar"))
+	total, perUsage = limits(2, "avatar")
+	assert.Equal(t, int64(5000), total.MaxBytes)
+	assert.Equal(t, int64(100), perUsage.MaxBytes)
+}
+
+func TestStorageQuotaEndpoints(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	gin.SetMode(gin.TestMode)
+	db := newQuotaTestDB(t)
+
+	config := &configs.Config{}
+	config.JwtAuth.AccessSecret = "test-secret"
+	config.Storage.Quota = configs.QuotaConfig{
+		Enabled: true,
+		Default: configs.QuotaLimit{MaxBytes: 1000, MaxFiles: 10},
+		Usages:  map[string]configs.QuotaLimit{"avatar": {MaxBytes: 100}},
+	}
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+	app := &testApp{
+		config:        config,
+		db:            db,
+		cache:         c,
+		responseCache: middleware.NewResponseCache(c, middleware.ResponseCacheOptions{TTL: time.Hour}),
+		storage:       filestore.NewLocalStorage(t.TempDir(), ""),
+	}
+	router := gin.New()
+	handler.NewFileHandler(app).InitRouters(router.Group("/api/v1"), router)
+
+	require.NoError(t, consume(handler.NewQuotaService(db, config), db, 1, "avatar", 40))
+
+	userToken, adminToken := testToken(t, config, 1, false), testToken(t, config, 2, true)
+
+	request := func(method, path, tokenString, body string) (int, dto.StorageUsageResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result response.Result[dto.StorageUsageResponse]
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		}
+		return w.Code, result.Data
+	}
+
+	// 当前用户的用量
+	code, usage := request(http.MethodGet, "/api/v1/user/storage", userToken, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), usage.UserID)
+	assert.True(t, usage.Enabled)
+	assert.Equal(t, handler.QuotaRoleUser, usage.Role)
+	assert.Equal(t, dto.StorageUsageItem{UsedBytes: 40, UsedFiles: 1, MaxBytes: 1000, MaxFiles: 10}, usage.Total)
+	require.Len(t, usage.Usages, 1)
+	assert.Equal(t, dto.StorageUsageItem{Usage: "avatar", UsedBytes: 40, UsedFiles: 1, MaxBytes: 100}, usage.Usages[0])
+
+	// 未登录和非管理员无法访问
+	code, _ = request(http.MethodGet, "/api/v1/user/storage", "", "")
+	assert.NotEqual(t, http.StatusOK, code)
+	code, _ = request(http.MethodGet, "/api/v1/admin/users/1/storage", userToken, "")
+	assert.NotEqual(t, http.StatusOK, code)
+
+	// 管理员查看和设置用户配额
+	code, usage = request(http.MethodGet, "/api/v1/admin/users/1/storage", adminToken, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(40), usage.Total.UsedBytes)
+
+	code, usage = request(http.MethodPut, "/api/v1/admin/users/1/storage/quota", adminToken, `{"usage":"document","max_bytes":500}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, usage.Usages, 2)
+	assert.Equal(t, dto.StorageUsageItem{Usage: "document", MaxBytes: 500, Overridden: true}, usage.Usages[1])
+	assert.False(t, usage.Total.Overridden)
+
+	code, _ = request(http.MethodPut, "/api/v1/admin/users/1/storage/quota", adminToken, `{"max_bytes":-1}`)
+	assert.NotEqual(t, http.StatusOK, code)
+
+	code, _ = request(http.MethodDelete, "/api/v1/admin/users/1/storage/quota?usage=document", adminToken, "")
+	require.Equal(t, http.StatusOK, code)
+	var overrides int64
+	require.NoError(t, db.Model(&model.StorageQuota{}).Unscoped().Where("user_id = ?", 1).Count(&overrides).Error)
+	assert.Zero(t, overrides)
+
+	// 不存在的用户
+	code, _ = request(http.MethodGet, "/api/v1/admin/users/99/storage", adminToken, "")
+	assert.NotEqual(t, http.StatusOK, code)
+	code, _ = request(http.MethodPut, "/api/v1/admin/users/99/storage/quota", adminToken, `{"max_bytes":1}`)
+	assert.NotEqual(t, http.StatusOK, code)
+}
@@ -0,0 +1,229 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reconcilePaths 对账报告中的路径，已排序
+func reconcilePaths(items []handler.ReconcileItem) []string {
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// backdate 把存储目录下的全部文件修改时间提前，使其超过孤立文件的最小存在时间
+func backdate(t *testing.T, dir string, age time.Duration) {
+	old := time.Now().Add(-age)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	require.NoError(t, err)
+}
+
+func TestReconcileService(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	dir := t.TempDir()
+	storage := filestore.NewLocalStorage(dir, "")
+	blobs := handler.NewBlobService(db, storage)
+	storageType := storage.GetStorageType()
+
+	put := func(path string, isPublic bool) {
+		require.NoError(t, storage.UploadFile(ctx, path, strings.NewReader(path), isPublic))
+	}
+	stale := time.Now().Add(-48 * time.Hour)
+
+	// 数据库引用的对象：文件、变体、内容对象、历史版本和回收站中的文件
+	put("general/active.txt", true)
+	require.NoError(t, db.Create(&model.File{
+		Path: "general/active.txt", StorageType: storageType, Status: model.FileStatusActive, IsPublic: true,
+		UUIDModel: model.UUIDModel{CreatedAt: stale},
+	}).Error)
+
+	put("variants/active_thumb.jpg", true)
+	require.NoError(t, db.Create(&model.FileVariant{
+		FileID: "variant-owner", Name: "thumb", Path: "variants/active_thumb.jpg", StorageType: storageType, IsPublic: true,
+	}).Error)
+
+	put("blobs/ab/abcdef", false)
+	require.NoError(t, db.Create(&model.FileBlob{
+		SHA256: "abcdef", Path: "blobs/ab/abcdef", StorageType: storageType, RefCount: 1,
+	}).Error)
+
+	put("versions/doc_v1.txt", false)
+	require.NoError(t, db.Create(&model.FileVersion{
+		FileID: "versioned", Version: 1, Path: "versions/doc_v1.txt", StorageType: storageType,
+	}).Error)
+
+	put("trash/deleted.txt", false)
+	trashed := &model.File{
+		Path: "general/deleted.txt", TrashPath: "trash/deleted.txt", StorageType: storageType,
+		Status: model.FileStatusActive,
+	}
+	require.NoError(t, db.Create(trashed).Error)
+	require.NoError(t, db.Delete(trashed).Error)
+
+	// 其他存储类型的记录不保护本地存储中的同名文件
+	put("general/other-storage.txt", true)
+	require.NoError(t, db.Create(&model.File{
+		Path: "general/other-storage.txt", StorageType: "s3", Status: model.FileStatusActive, IsPublic: true,
+	}).Error)
+
+	// 孤立文件
+	put("orphan/public.txt", true)
+	put("orphan/private.txt", false)
+
+	// 过期的待上传记录：直接写入的内容、去重后的内容对象和未通过扫描的文件
+	put("pending/stale.txt", true)
+	require.NoError(t, db.Create(&model.File{
+		Path: "pending/stale.txt", StorageType: storageType, Status: model.FileStatusPending, IsPublic: true,
+		UUIDModel: model.UUIDModel{CreatedAt: stale},
+	}).Error)
+	blobPath, checksum, err := blobs.Store(ctx, "pending/dedup.txt", strings.NewReader("pending content"), false)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&model.File{
+		Path: blobPath, StorageType: storageType, Status: model.FileStatusPending, SHA256: checksum.SHA256,
+		UUIDModel: model.UUIDModel{CreatedAt: stale},
+	}).Error)
+	put("pending/rejected.txt", false)
+	require.NoError(t, db.Create(&model.File{
+		Path: "pending/rejected.txt", StorageType: storageType, Status: model.FileStatusRejected,
+		UUIDModel: model.UUIDModel{CreatedAt: stale},
+	}).Error)
+
+	// 未过期的待上传记录
+	put("pending/fresh.txt", true)
+	require.NoError(t, db.Create(&model.File{
+		Path: "pending/fresh.txt", StorageType: storageType, Status: model.FileStatusPending, IsPublic: true,
+	}).Error)
+
+	// 存储中已丢失内容的记录
+	require.NoError(t, db.Create(&model.File{
+		Path: "general/missing.txt", StorageType: storageType, Status: model.FileStatusActive,
+	}).Error)
+
+	backdate(t, dir, 48*time.Hour)
+
+	// 最近写入的文件可能属于正在进行的上传
+	put("orphan/recent.txt", true)
+
+	newService := func(deleteOrphans bool) *handler.ReconcileService {
+		config := &configs.Config{}
+		config.Storage.Reconcile = configs.ReconcileConfig{
+			PendingTTL:    24 * time.Hour,
+			OrphanMinAge:  time.Hour,
+			DeleteOrphans: deleteOrphans,
+		}
+		return handler.NewReconcileService(db, storage, config)
+	}
+
+	expectedPending := []string{blobPath, "pending/rejected.txt", "pending/stale.txt"}
+	sort.Strings(expectedPending)
+	expectedOrphans := []string{"general/other-storage.txt", "orphan/private.txt", "orphan/public.txt"}
+
+	pendingCount := func() int64 {
+		var count int64
+		require.NoError(t, db.Model(&model.File{}).Where("status IN ?", []int{model.FileStatusPending, model.FileStatusRejected}).Count(&count).Error)
+		return count
+	}
+
+	// 仅生成报告时不删除任何数据
+	report, err := newService(true).Run(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, expectedPending, reconcilePaths(report.ExpiredPending))
+	assert.Equal(t, expectedOrphans, reconcilePaths(report.OrphanBlobs))
+	assert.Equal(t, []string{"general/missing.txt"}, reconcilePaths(report.MissingBlobs))
+	for _, item := range append(report.ExpiredPending, report.OrphanBlobs...) {
+		assert.False(t, item.Removed, item.Path)
+	}
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, int64(4), pendingCount())
+	assert.True(t, exists(t, storage, "orphan/public.txt", true))
+	assert.True(t, exists(t, storage, "pending/stale.txt", true))
+
+	// 未开启删除孤立文件时只清理过期的待上传记录
+	report, err = newService(false).Run(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, expectedPending, reconcilePaths(report.ExpiredPending))
+	for _, item := range report.ExpiredPending {
+		assert.True(t, item.Removed, item.Path)
+	}
+	for _, item := range report.OrphanBlobs {
+		assert.False(t, item.Removed, item.Path)
+	}
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, int64(1), pendingCount())
+	assert.False(t, exists(t, storage, "pending/stale.txt", true))
+	assert.False(t, exists(t, storage, "pending/rejected.txt", false))
+	assert.False(t, exists(t, storage, blobPath, false))
+	assert.True(t, exists(t, storage, "pending/fresh.txt", true))
+	assert.True(t, exists(t, storage, "orphan/public.txt", true))
+	var blobCount int64
+	require.NoError(t, db.Model(&model.FileBlob{}).Where("sha256 = ?", checksum.SHA256).Count(&blobCount).Error)
+	assert.Zero(t, blobCount)
+
+	// 删除孤立文件，数据库引用的对象都不受影响
+	report, err = newService(true).Run(ctx, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.ExpiredPending)
+	assert.Equal(t, expectedOrphans, reconcilePaths(report.OrphanBlobs))
+	for _, item := range report.OrphanBlobs {
+		assert.True(t, item.Removed, item.Path)
+	}
+	assert.Equal(t, []string{"general/missing.txt"}, reconcilePaths(report.MissingBlobs))
+	assert.Empty(t, report.Errors)
+
+	for _, orphan := range []struct {
+		path     string
+		isPublic bool
+	}{
+		{"orphan/public.txt", true},
+		{"orphan/private.txt", false},
+		{"general/other-storage.txt", true},
+	} {
+		assert.False(t, exists(t, storage, orphan.path, orphan.isPublic), orphan.path)
+	}
+	for _, kept := range []struct {
+		path     string
+		isPublic bool
+	}{
+		{"general/active.txt", true},
+		{"variants/active_thumb.jpg", true},
+		{"blobs/ab/abcdef", false},
+		{"versions/doc_v1.txt", false},
+		{"trash/deleted.txt", false},
+		{"pending/fresh.txt", true},
+		{"orphan/recent.txt", true},
+	} {
+		assert.True(t, exists(t, storage, kept.path, kept.isPublic), kept.path)
+	}
+
+	// 活跃文件不属于过期的待上传记录
+	var active int64
+	require.NoError(t, db.Model(&model.File{}).Where("path = ?", "general/active.txt").Count(&active).Error)
+	assert.Equal(t, int64(1), active)
+}
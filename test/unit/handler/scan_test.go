@@ -0,0 +1,113 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/limitcool/starter/internal/pkg/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanService(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	config := &configs.Config{}
+	config.Storage.Scan = configs.ScanConfig{
+		Enabled: true,
+		Rules:   configs.ScanRulesConfig{ForbiddenNames: []string{"*.exe"}},
+	}
+	service := handler.NewScanService(db, storage, config)
+	require.NoError(t, service.Err())
+
+	// 模拟客户端直传后确认上传
+	quarantine := func(name string, content []byte) *model.File {
+		file := &model.File{
+			OriginalName: name, Path: "general/2026/10/18/" + name, Usage: model.FileUsageGeneral,
+			StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusPending,
+		}
+		require.NoError(t, storage.UploadFile(ctx, file.Path, bytes.NewReader(content), false))
+		require.NoError(t, db.Create(file).Error)
+		require.NoError(t, service.Quarantine(ctx, file))
+		assert.Equal(t, model.FileStatusQuarantined, file.Status)
+		return file
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("tools/setup.exe")
+	require.NoError(t, err)
+	w.Write([]byte("MZ"))
+	require.NoError(t, zw.Close())
+
+	clean := quarantine("notes.txt", []byte("hello"))
+	infected := quarantine("tools.zip", archive.Bytes())
+
+	scanned, err := service.ScanPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, scanned)
+
+	// 通过扫描的文件完成上传并占用配额
+	var file model.File
+	require.NoError(t, db.First(&file, "id = ?", clean.ID).Error)
+	assert.Equal(t, model.FileStatusActive, file.Status)
+	assert.NotEmpty(t, file.SHA256)
+	assert.Equal(t, int64(5), file.Size)
+	assert.NotNil(t, file.ScannedAt)
+	assert.Equal(t, int64(1), usedFiles(t, db, 1))
+
+	// 未通过扫描的文件删除内容并记录原因
+	var rejected model.File
+	require.NoError(t, db.First(&rejected, "id = ?", infected.ID).Error)
+	assert.Equal(t, model.FileStatusRejected, rejected.Status)
+	assert.Equal(t, "rules: forbidden file name: tools/setup.exe", rejected.ScanResult)
+	assert.False(t, exists(t, storage, infected.Path, false))
+
+	// 已处理的文件不再扫描
+	scanned, err = service.ScanPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, scanned)
+}
+
+func TestScanServiceSync(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	object := func(name string) *scanner.Object {
+		return &scanner.Object{
+			Name: name,
+			Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("data")), nil },
+		}
+	}
+
+	config := &configs.Config{}
+	disabled := handler.NewScanService(nil, nil, config)
+	assert.NoError(t, disabled.Scan(ctx, object("setup.exe")))
+
+	config.Storage.Scan = configs.ScanConfig{
+		Enabled: true,
+		Rules:   configs.ScanRulesConfig{ForbiddenNames: []string{"*.exe"}},
+	}
+	service := handler.NewScanService(nil, nil, config)
+	assert.NoError(t, service.Scan(ctx, object("notes.txt")))
+	assert.True(t, errspec.ErrFileRejected.Is(service.Scan(ctx, object("setup.exe"))))
+
+	// 配置无效时拒绝全部文件
+	config.Storage.Scan.Rules.ForbiddenNames = []string{"[a-"}
+	invalid := handler.NewScanService(nil, nil, config)
+	assert.Error(t, invalid.Err())
+	assert.True(t, errspec.ErrFileScan.Is(invalid.Scan(ctx, object("notes.txt"))))
+}
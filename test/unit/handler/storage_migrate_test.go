@@ -0,0 +1,277 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// migrationStorage 本地存储，可指定存储类型以模拟两种存储后端，并注入中断和写入损坏
+type migrationStorage struct {
+	filestore.FileStorage
+	storageType string
+	reads       atomic.Int32
+	interrupt   func(reads int32) bool // 返回true时在本次读取前中断迁移
+	cancel      context.CancelFunc
+	corrupt     bool // 写入时追加多余内容
+}
+
+func newMigrationStorage(t *testing.T, storageType string) *migrationStorage {
+	return &migrationStorage{
+		FileStorage: filestore.NewLocalStorage(t.TempDir(), ""),
+		storageType: storageType,
+	}
+}
+
+func (m *migrationStorage) GetStorageType() string {
+	return m.storageType
+}
+
+func (m *migrationStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	if m.interrupt != nil && m.interrupt(m.reads.Add(1)) {
+		m.cancel()
+		return nil, context.Canceled
+	}
+	return m.FileStorage.GetFile(ctx, filePath, isPublic)
+}
+
+func (m *migrationStorage) UploadFile(ctx context.Context, filePath string, reader io.Reader, isPublic bool) error {
+	if m.corrupt {
+		reader = io.MultiReader(reader, strings.NewReader("corrupted"))
+	}
+	return m.FileStorage.UploadFile(ctx, filePath, reader, isPublic)
+}
+
+// migrationObject 迁移测试中的存储对象
+type migrationObject struct {
+	path     string
+	isPublic bool
+}
+
+// seedMigration 在源存储中写入文件并创建引用它们的记录，返回全部存储对象
+func seedMigration(t *testing.T, db *gorm.DB, source *migrationStorage) []migrationObject {
+	ctx := context.Background()
+	put := func(path string, isPublic bool) string {
+		content := "content of " + path
+		require.NoError(t, source.UploadFile(ctx, path, strings.NewReader(content), isPublic))
+		checksum, err := filestore.ComputeChecksum(strings.NewReader(content))
+		require.NoError(t, err)
+		return checksum.SHA256
+	}
+	storageType := source.GetStorageType()
+
+	// 两个文件记录共享同一个去重后的对象
+	sum := put("blobs/shared.txt", true)
+	for range 2 {
+		require.NoError(t, db.Create(&model.File{
+			Path: "blobs/shared.txt", IsPublic: true, SHA256: sum, StorageType: storageType, Status: model.FileStatusActive,
+		}).Error)
+	}
+	require.NoError(t, db.Create(&model.FileBlob{
+		SHA256: sum, IsPublic: true, Path: "blobs/shared.txt", StorageType: storageType, RefCount: 2,
+	}).Error)
+
+	sum = put("general/private.txt", false)
+	require.NoError(t, db.Create(&model.File{
+		Path: "general/private.txt", SHA256: sum, StorageType: storageType, Status: model.FileStatusActive,
+	}).Error)
+
+	put("variants/thumb.jpg", true)
+	require.NoError(t, db.Create(&model.FileVariant{
+		FileID: "owner", Name: "thumb", Path: "variants/thumb.jpg", IsPublic: true, StorageType: storageType,
+	}).Error)
+
+	sum = put("versions/doc_v1.txt", false)
+	require.NoError(t, db.Create(&model.FileVersion{
+		FileID: "owner", Version: 1, Path: "versions/doc_v1.txt", SHA256: sum, StorageType: storageType,
+	}).Error)
+
+	sum = put("trash/deleted.txt", false)
+	trashed := &model.File{
+		Path: "general/deleted.txt", TrashPath: "trash/deleted.txt", SHA256: sum, StorageType: storageType,
+		Status: model.FileStatusActive,
+	}
+	require.NoError(t, db.Create(trashed).Error)
+	require.NoError(t, db.Delete(trashed).Error)
+
+	return []migrationObject{
+		{"blobs/shared.txt", true},
+		{"general/private.txt", false},
+		{"variants/thumb.jpg", true},
+		{"versions/doc_v1.txt", false},
+		{"trash/deleted.txt", false},
+	}
+}
+
+func newMigrateTestDB(t *testing.T) *gorm.DB {
+	db := newTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.StorageMigration{}))
+	return db
+}
+
+// storageTypes 按存储类型统计引用对象的记录数，包括回收站中的文件
+func storageTypes(t *testing.T, db *gorm.DB) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, m := range []any{&model.File{}, &model.FileVariant{}, &model.FileBlob{}, &model.FileVersion{}} {
+		var rows []struct {
+			StorageType string
+			Count       int64
+		}
+		require.NoError(t, db.Unscoped().Model(m).Select("storage_type, count(*) AS count").Group("storage_type").Scan(&rows).Error)
+		for _, r := range rows {
+			counts[r.StorageType] += r.Count
+		}
+	}
+	return counts
+}
+
+// migrationStatus 按状态统计迁移进度记录
+func migrationStatus(t *testing.T, db *gorm.DB) map[string]int {
+	var items []model.StorageMigration
+	require.NoError(t, db.Find(&items).Error)
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Status]++
+	}
+	return counts
+}
+
+func TestStorageMigrate(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newMigrateTestDB(t)
+	source, target := newMigrationStorage(t, "s3"), newMigrationStorage(t, "local")
+	objects := seedMigration(t, db, source)
+
+	// 源文件内容与记录的摘要不一致
+	require.NoError(t, source.UploadFile(ctx, "general/corrupt.txt", strings.NewReader("changed"), false))
+	require.NoError(t, db.Create(&model.File{
+		Path: "general/corrupt.txt", SHA256: strings.Repeat("0", 64), StorageType: "s3", Status: model.FileStatusActive,
+	}).Error)
+
+	report, err := handler.NewStorageMigrateService(db, source, target).Run(ctx, handler.StorageMigrateOptions{
+		Concurrency: 3, Verify: true, DeleteSource: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "s3", report.Source)
+	assert.Equal(t, "local", report.Target)
+	assert.Equal(t, len(objects)+1, report.Total)
+	assert.Equal(t, len(objects), report.Migrated)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, len(objects), report.SourceDeleted)
+	require.Len(t, report.Errors, 1)
+	assert.Contains(t, report.Errors[0], "general/corrupt.txt")
+	assert.Contains(t, report.Errors[0], "校验和不匹配")
+
+	// 迁移成功的对象写入目标存储，删除源文件，并更新全部引用记录
+	for _, obj := range objects {
+		assert.True(t, exists(t, target, obj.path, obj.isPublic), obj.path)
+		assert.False(t, exists(t, source, obj.path, obj.isPublic), obj.path)
+	}
+	assert.Equal(t, map[string]int64{"local": 7, "s3": 1}, storageTypes(t, db))
+	var migrated model.StorageMigration
+	require.NoError(t, db.Where("path = ?", "versions/doc_v1.txt").First(&migrated).Error)
+	assert.NotEmpty(t, migrated.SHA256)
+	assert.Equal(t, int64(len("content of versions/doc_v1.txt")), migrated.Size)
+	assert.True(t, migrated.SourceDeleted)
+
+	// 校验失败的对象保留源文件，只删除已完成迁移的源文件
+	assert.True(t, exists(t, source, "general/corrupt.txt", false))
+	var failed model.StorageMigration
+	require.NoError(t, db.Where("path = ?", "general/corrupt.txt").First(&failed).Error)
+	assert.Equal(t, model.StorageMigrationFailed, failed.Status)
+	assert.Contains(t, failed.Error, "校验和不匹配")
+	assert.False(t, failed.SourceDeleted)
+	assert.Equal(t, map[string]int{model.StorageMigrationDone: len(objects), model.StorageMigrationFailed: 1}, migrationStatus(t, db))
+
+	// 相同的存储类型
+	_, err = handler.NewStorageMigrateService(db, target, newMigrationStorage(t, "local")).Run(ctx, handler.StorageMigrateOptions{})
+	assert.Error(t, err)
+}
+
+func TestStorageMigrateResume(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	db := newMigrateTestDB(t)
+	source, target := newMigrationStorage(t, "s3"), newMigrationStorage(t, "local")
+	objects := seedMigration(t, db, source)
+
+	// 迁移两个对象后中断
+	ctx, cancel := context.WithCancel(context.Background())
+	source.cancel = cancel
+	source.interrupt = func(reads int32) bool { return reads > 2 }
+	service := handler.NewStorageMigrateService(db, source, target)
+
+	report, err := service.Run(ctx, handler.StorageMigrateOptions{Concurrency: 1, DeleteSource: true})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, len(objects), report.Total)
+	assert.Equal(t, 2, report.Migrated)
+	assert.Zero(t, report.SourceDeleted, "中断时不删除源文件")
+	assert.Equal(t, 2, migrationStatus(t, db)[model.StorageMigrationDone])
+
+	// 重新执行时只迁移剩余的对象，并删除之前已迁移的源文件
+	source.interrupt = nil
+	report, err = service.Run(context.Background(), handler.StorageMigrateOptions{Concurrency: 1, DeleteSource: true})
+	require.NoError(t, err)
+	assert.Equal(t, len(objects)-2, report.Total)
+	assert.Equal(t, len(objects)-2, report.Migrated)
+	assert.Zero(t, report.Failed)
+	assert.Equal(t, len(objects), report.SourceDeleted)
+	assert.Empty(t, report.Errors)
+
+	for _, obj := range objects {
+		assert.True(t, exists(t, target, obj.path, obj.isPublic), obj.path)
+		assert.False(t, exists(t, source, obj.path, obj.isPublic), obj.path)
+	}
+	assert.Equal(t, map[string]int64{"local": 7}, storageTypes(t, db))
+	assert.Equal(t, map[string]int{model.StorageMigrationDone: len(objects)}, migrationStatus(t, db))
+
+	// 全部完成后再次执行没有待迁移的对象
+	report, err = service.Run(context.Background(), handler.StorageMigrateOptions{DeleteSource: true})
+	require.NoError(t, err)
+	assert.Zero(t, report.Total)
+	assert.Zero(t, report.SourceDeleted)
+}
+
+func TestStorageMigrateVerify(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+	db := newMigrateTestDB(t)
+	source, target := newMigrationStorage(t, "s3"), newMigrationStorage(t, "local")
+	objects := seedMigration(t, db, source)
+	target.corrupt = true
+	service := handler.NewStorageMigrateService(db, source, target)
+
+	// 读取目标文件发现内容不一致，记录保持不变且不删除源文件
+	report, err := service.Run(ctx, handler.StorageMigrateOptions{Concurrency: 2, Verify: true, DeleteSource: true})
+	require.NoError(t, err)
+	assert.Zero(t, report.Migrated)
+	assert.Equal(t, len(objects), report.Failed)
+	assert.Zero(t, report.SourceDeleted)
+	for _, msg := range report.Errors {
+		assert.Contains(t, msg, "校验目标文件失败")
+	}
+	for _, obj := range objects {
+		assert.True(t, exists(t, source, obj.path, obj.isPublic), obj.path)
+	}
+	assert.Equal(t, map[string]int64{"s3": 7}, storageTypes(t, db))
+	assert.Equal(t, map[string]int{model.StorageMigrationFailed: len(objects)}, migrationStatus(t, db))
+
+	// 目标存储恢复正常后重试失败的对象
+	target.corrupt = false
+	report, err = service.Run(ctx, handler.StorageMigrateOptions{Concurrency: 2, Verify: true})
+	require.NoError(t, err)
+	assert.Equal(t, len(objects), report.Migrated)
+	assert.Zero(t, report.SourceDeleted)
+	assert.Equal(t, map[string]int64{"local": 7}, storageTypes(t, db))
+	assert.Equal(t, map[string]int{model.StorageMigrationDone: len(objects)}, migrationStatus(t, db))
+}
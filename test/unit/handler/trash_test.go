@@ -0,0 +1,126 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/dto"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(
+		&model.File{}, &model.FileBlob{}, &model.FileVariant{},
+		&model.StorageUsage{}, &model.StorageQuota{},
+		&model.Tag{}, &model.FileTag{}, &model.FileVersion{},
+	))
+	return db
+}
+
+func exists(t *testing.T, storage filestore.FileStorage, filePath string, isPublic bool) bool {
+	ok, err := storage.FileExists(context.Background(), filePath, isPublic)
+	require.NoError(t, err)
+	return ok
+}
+
+func usedFiles(t *testing.T, db *gorm.DB, userID int64) int64 {
+	var usage model.StorageUsage
+	err := db.Where("user_id = ? AND file_usage = ?", userID, model.StorageUsageTotal).First(&usage).Error
+	require.NoError(t, err)
+	return usage.Files
+}
+
+func TestTrashService(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	config := &configs.Config{}
+	config.Storage.Trash = configs.TrashConfig{Enabled: true, Retention: time.Hour}
+	trash := handler.NewTrashService(db, storage, config)
+	blobs := handler.NewBlobService(db, storage)
+	quota := handler.NewQuotaService(db, config)
+
+	// 两个文件共享同一存储对象
+	upload := func(name string) *model.File {
+		path, checksum, err := blobs.Store(ctx, "general/2026/10/18/"+name, strings.NewReader("hello"), true)
+		require.NoError(t, err)
+		file := &model.File{
+			OriginalName: name, Path: path, Usage: model.FileUsageGeneral, Size: checksum.Size,
+			StorageType: storage.GetStorageType(), UploadedBy: 1, Status: 1, IsPublic: true,
+			SHA256: checksum.SHA256, MD5: checksum.MD5,
+		}
+		require.NoError(t, db.Create(file).Error)
+		require.NoError(t, quota.Consume(ctx, db, 1, file.Usage, file.Size))
+		return file
+	}
+	a, b := upload("a.txt"), upload("b.txt")
+	require.Equal(t, a.Path, b.Path)
+
+	// 移入回收站后原对象仍被另一个文件引用
+	require.NoError(t, trash.Remove(ctx, a))
+	assert.True(t, exists(t, storage, a.TrashPath, false))
+	assert.True(t, exists(t, storage, a.Path, true))
+	assert.ErrorIs(t, db.First(&model.File{}, "id = ?", a.ID).Error, gorm.ErrRecordNotFound)
+
+	// 最后一个引用移入回收站后删除原对象
+	require.NoError(t, trash.Trash(ctx, b))
+	assert.False(t, exists(t, storage, b.Path, true))
+
+	items, total, err := trash.List(ctx, 1, &dto.PageRequest{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, items, 2)
+
+	assert.Zero(t, usedFiles(t, db, 1))
+
+	// 恢复到原路径并重新占用配额
+	trashed, err := model.NewFileRepo(db).GetTrashed(ctx, a.ID, 1)
+	require.NoError(t, err)
+	require.NoError(t, trash.Restore(ctx, trashed))
+	assert.True(t, exists(t, storage, trashed.Path, true))
+	assert.False(t, exists(t, storage, a.TrashPath, false))
+	require.NoError(t, db.First(&model.File{}, "id = ? AND status = ?", a.ID, 1).Error)
+
+	assert.Equal(t, int64(1), usedFiles(t, db, 1))
+
+	_, err = model.NewFileRepo(db).GetTrashed(ctx, a.ID, 1)
+	assert.Error(t, err)
+
+	// 超过保留时间的文件被永久删除
+	require.NoError(t, db.Unscoped().Model(&model.File{}).Where("id = ?", b.ID).
+		Update("deleted_at", time.Now().Add(-2*time.Hour)).Error)
+	purged, err := trash.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.False(t, exists(t, storage, b.TrashPath, false))
+	assert.ErrorIs(t, db.Unscoped().First(&model.File{}, "id = ?", b.ID).Error, gorm.ErrRecordNotFound)
+}
+
+func TestTrashPath(t *testing.T) {
+	trashPath := filestore.TrashPath("id-1", "documents/contracts/a.pdf")
+	assert.Equal(t, "trash/id-1/documents/contracts/a.pdf", trashPath)
+	assert.Equal(t, "documents/contracts/a.pdf", filestore.OriginalPath(trashPath))
+	assert.Equal(t, "documents/a.pdf", filestore.OriginalPath("documents/a.pdf"))
+}
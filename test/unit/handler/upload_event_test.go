@@ -0,0 +1,152 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/configs"
+	"github.com/limitcool/starter/internal/filestore"
+	"github.com/limitcool/starter/internal/handler"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadEventService(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := filestore.NewLocalStorage(t.TempDir(), "")
+	config := &configs.Config{}
+	config.Storage.S3.Bucket = "uploads"
+	service := handler.NewUploadEventService(db, storage, config)
+
+	// 模拟客户端直传后对象存储发出的事件
+	file := &model.File{
+		OriginalName: "my notes.txt", Path: "general/2026/10/18/my notes.txt", Usage: model.FileUsageGeneral,
+		StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusPending,
+	}
+	require.NoError(t, storage.UploadFile(ctx, file.Path, strings.NewReader("hello"), false))
+	require.NoError(t, db.Create(file).Error)
+
+	record := func(name, bucket, key string) filestore.S3EventRecord {
+		return filestore.S3EventRecord{
+			EventName: name,
+			S3: filestore.S3EventEntity{
+				Bucket: filestore.S3EventBucket{Name: bucket},
+				Object: filestore.S3EventObject{Key: key, Size: 5},
+			},
+		}
+	}
+	key := "private/general/2026/10/18/my+notes.txt"
+
+	result := service.Handle(ctx, &filestore.S3Event{Records: []filestore.S3EventRecord{
+		record("s3:ObjectRemoved:Delete", "uploads", key),
+		record("s3:ObjectCreated:Post", "other", key),
+		record("s3:ObjectCreated:Post", "uploads", "public/general/2026/10/18/missing.txt"),
+		record("ObjectCreated:Put", "uploads", "unknown/a.txt"),
+		record("s3:ObjectCreated:Post", "uploads", key),
+	}})
+	assert.Equal(t, handler.UploadEventResult{Confirmed: 1, Skipped: 3, Failed: 1}, result)
+
+	var saved model.File
+	require.NoError(t, db.First(&saved, "id = ?", file.ID).Error)
+	assert.Equal(t, model.FileStatusActive, saved.Status)
+	assert.Equal(t, int64(5), saved.Size)
+	assert.NotEmpty(t, saved.SHA256)
+	assert.Equal(t, int64(1), usedFiles(t, db, 1))
+
+	// 重复的事件不再处理
+	result = service.Handle(ctx, &filestore.S3Event{Records: []filestore.S3EventRecord{record("s3:ObjectCreated:Post", "uploads", key)}})
+	assert.Equal(t, 1, result.Skipped)
+
+	// 确认接口与事件回调同时完成同一文件时只占用一次配额
+	other := &model.File{
+		OriginalName: "b.txt", Path: "general/2026/10/18/b.txt", Usage: model.FileUsageGeneral,
+		StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusPending,
+	}
+	require.NoError(t, storage.UploadFile(ctx, other.Path, strings.NewReader("world"), false))
+	require.NoError(t, db.Create(other).Error)
+	stale := *other
+
+	uploads := handler.NewUploadService(db, storage, config)
+	require.NoError(t, uploads.Complete(ctx, other, true))
+	require.NoError(t, uploads.Complete(ctx, &stale, true))
+	assert.Equal(t, model.FileStatusActive, stale.Status)
+	assert.Equal(t, int64(2), usedFiles(t, db, 1))
+	assert.True(t, exists(t, storage, other.Path, false))
+}
+
+// countingStorage 记录读取文件内容的次数
+type countingStorage struct {
+	filestore.FileStorage
+	reads atomic.Int32
+}
+
+func (s *countingStorage) GetFile(ctx context.Context, filePath string, isPublic bool) (io.ReadCloser, error) {
+	s.reads.Add(1)
+	return s.FileStorage.GetFile(ctx, filePath, isPublic)
+}
+
+func TestUploadServiceClaimBeforeProcessing(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	db := newTestDB(t)
+	storage := &countingStorage{FileStorage: filestore.NewLocalStorage(t.TempDir(), "")}
+	uploads := handler.NewUploadService(db, storage, &configs.Config{})
+
+	newPending := func(name string) *model.File {
+		file := &model.File{
+			OriginalName: name, Path: "general/2026/10/18/" + name, Usage: model.FileUsageGeneral,
+			StorageType: storage.GetStorageType(), UploadedBy: 1, Status: model.FileStatusPending,
+		}
+		require.NoError(t, storage.UploadFile(ctx, file.Path, strings.NewReader(name), false))
+		require.NoError(t, db.Create(file).Error)
+		return file
+	}
+
+	// 并发确认同一文件时只有认领成功的一方读取和登记内容
+	file := newPending("a.txt")
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func(file model.File) {
+			defer wg.Done()
+			assert.NoError(t, uploads.Complete(ctx, &file, true))
+		}(*file)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), storage.reads.Load())
+	assert.Equal(t, int64(1), usedFiles(t, db, 1))
+	var saved model.File
+	require.NoError(t, db.First(&saved, "id = ?", file.ID).Error)
+	assert.Equal(t, model.FileStatusActive, saved.Status)
+	assert.NotEmpty(t, saved.SHA256)
+
+	// 正在被其他请求确认的文件不重复处理，返回当前记录
+	busy := newPending("b.txt")
+	require.NoError(t, db.Model(busy).Update("status", model.FileStatusConfirming).Error)
+	storage.reads.Store(0)
+	require.NoError(t, uploads.Complete(ctx, busy, true))
+	assert.Equal(t, model.FileStatusConfirming, busy.Status)
+	assert.True(t, uploads.Confirming(busy))
+	assert.Zero(t, storage.reads.Load())
+
+	// 认领超时的文件视为处理中断，可以重新确认
+	require.NoError(t, db.Model(&model.File{}).Where("id = ?", busy.ID).
+		UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	require.NoError(t, db.First(busy, "id = ?", busy.ID).Error)
+	assert.False(t, uploads.Confirming(busy))
+	require.NoError(t, uploads.Complete(ctx, busy, true))
+	assert.Equal(t, model.FileStatusActive, busy.Status)
+	assert.Equal(t, int64(2), usedFiles(t, db, 1))
+}
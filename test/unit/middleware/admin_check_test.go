@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestAdminCheckWithDBUsesRepoCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+	require.NoError(t, db.Use(model.NewRepoCache(c, model.RepoCacheOptions{
+		Entities: map[string]time.Duration{"user": time.Minute},
+	})))
+
+	var queries atomic.Int32
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) {
+		queries.Add(1)
+	}))
+
+	repo := model.NewUserRepo(db)
+	admin := &model.User{Username: "root", Password: "hashed", IsAdmin: true}
+	require.NoError(t, repo.Create(ctx, admin))
+
+	router := gin.New()
+	router.GET("/admin", func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.GetHeader("X-User"), 10, 64)
+		c.Set("user_id", float64(id))
+	}, middleware.AdminCheckWithDB(repo), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("X-User", strconv.FormatInt(admin.ID, 10))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 每个请求都校验管理员身份，只有第一次查询数据库
+	for range 3 {
+		assert.Equal(t, http.StatusOK, get())
+	}
+	assert.Equal(t, int32(1), queries.Load())
+
+	// 缓存保留全部字段，取消管理员身份后立即失效
+	cached, err := repo.GetByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "hashed", cached.Password)
+	assert.Equal(t, int32(1), queries.Load())
+
+	require.NoError(t, db.Model(&model.User{}).Where("id = ?", admin.ID).Update("is_admin", false).Error)
+	assert.Equal(t, http.StatusForbidden, get())
+	assert.Equal(t, int32(2), queries.Load())
+}
@@ -0,0 +1,201 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/limitcool/starter/internal/api/response"
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/middleware"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cacheServer struct {
+	router *gin.Engine
+	cache  *middleware.ResponseCache
+	calls  atomic.Int32
+	value  atomic.Value
+}
+
+// newCacheServer 创建带响应缓存的路由，X-User请求头模拟认证中间件设置的用户ID
+func newCacheServer(t *testing.T, opts ...middleware.CacheOption) *cacheServer {
+	gin.SetMode(gin.TestMode)
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+
+	s := &cacheServer{
+		router: gin.New(),
+		cache:  middleware.NewResponseCache(c, middleware.ResponseCacheOptions{TTL: time.Minute}),
+	}
+	s.value.Store("v1")
+
+	auth := func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("user_id", uint(len(user)))
+		}
+	}
+	s.router.GET("/items/:id", auth, s.cache.Middleware(opts...), func(c *gin.Context) {
+		s.calls.Add(1)
+		if c.Param("id") == "missing" {
+			response.Error(c, errspec.ErrNotFound.New(c.Request.Context()))
+			return
+		}
+		response.Success(c, map[string]string{"id": c.Param("id"), "value": s.value.Load().(string)})
+	})
+	return s
+}
+
+func (s *cacheServer) get(path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func dataOf(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	var result response.Result[map[string]string]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return result.Data
+}
+
+func TestResponseCacheHit(t *testing.T) {
+	s := newCacheServer(t)
+
+	first := s.get("/items/1", map[string]string{"X-Request-ID": "req-1"})
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+	assert.NotEmpty(t, first.Header().Get("ETag"))
+	assert.NotEmpty(t, first.Header().Get("Last-Modified"))
+	assert.Equal(t, "public, no-cache", first.Header().Get("Cache-Control"))
+
+	second := s.get("/items/1", map[string]string{"X-Request-ID": "req-2"})
+	require.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+	assert.Equal(t, dataOf(t, first), dataOf(t, second))
+	assert.Contains(t, second.Body.String(), `"request_id":"req-2"`, "命中时使用当前请求的request_id")
+	assert.Equal(t, int32(1), s.calls.Load())
+
+	// 不同的路由参数和语言分别缓存
+	s.get("/items/2", nil)
+	s.get("/items/1", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, int32(3), s.calls.Load())
+}
+
+func TestResponseCacheConditional(t *testing.T) {
+	s := newCacheServer(t)
+	first := s.get("/items/1", nil)
+	etag := first.Header().Get("ETag")
+
+	w := s.get("/items/1", map[string]string{"If-None-Match": `"other", ` + etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = s.get("/items/1", map[string]string{"If-None-Match": `"other"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = s.get("/items/1", map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = s.get("/items/1", map[string]string{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 未命中时同样处理条件请求
+	w = s.get("/items/2", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestResponseCacheControl(t *testing.T) {
+	s := newCacheServer(t)
+	s.get("/items/1", nil)
+
+	// no-cache重新生成并更新缓存
+	s.value.Store("v2")
+	w := s.get("/items/1", map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "v2", dataOf(t, w)["value"])
+	assert.Equal(t, "v2", dataOf(t, s.get("/items/1", nil))["value"])
+	assert.Equal(t, int32(2), s.calls.Load())
+
+	// no-store既不读取也不写入缓存
+	s.value.Store("v3")
+	w = s.get("/items/1", map[string]string{"Cache-Control": "no-store"})
+	assert.Empty(t, w.Header().Get("X-Cache"))
+	assert.Equal(t, "v3", dataOf(t, w)["value"])
+	assert.Equal(t, "v2", dataOf(t, s.get("/items/1", nil))["value"])
+}
+
+func TestResponseCacheErrorsNotCached(t *testing.T) {
+	s := newCacheServer(t)
+	for range 2 {
+		w := s.get("/items/missing", nil)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("ETag"))
+	}
+	assert.Equal(t, int32(2), s.calls.Load())
+}
+
+func TestResponseCacheAuthScope(t *testing.T) {
+	s := newCacheServer(t)
+	w := s.get("/items/1", map[string]string{"X-User": "a"})
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	s.get("/items/1", map[string]string{"X-User": "bb"})
+	s.get("/items/1", nil)
+	assert.Equal(t, int32(3), s.calls.Load())
+
+	shared := newCacheServer(t, middleware.CacheShared())
+	shared.get("/items/1", map[string]string{"X-User": "a"})
+	w = shared.get("/items/1", map[string]string{"X-User": "bb"})
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+}
+
+func TestResponseCachePurge(t *testing.T) {
+	s := newCacheServer(t, middleware.CacheTags(func(c *gin.Context) []string {
+		return []string{"item:" + c.Param("id")}
+	}))
+	ctx := context.Background()
+	s.get("/items/1", nil)
+	s.get("/items/2", nil)
+
+	require.NoError(t, s.cache.Purge(ctx, "item:1"))
+	assert.Equal(t, "MISS", s.get("/items/1", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", s.get("/items/2", nil).Header().Get("X-Cache"))
+
+	require.NoError(t, s.cache.Purge(ctx, middleware.RouteTag("/items/:id")))
+	assert.Equal(t, "MISS", s.get("/items/2", nil).Header().Get("X-Cache"))
+}
+
+func TestResponseCacheDisabled(t *testing.T) {
+	var rc *middleware.ResponseCache
+	router := gin.New()
+	calls := 0
+	router.GET("/", rc.Middleware(), func(c *gin.Context) {
+		calls++
+		response.Success(c, "ok")
+	})
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("ETag"))
+	}
+	assert.Equal(t, 2, calls)
+	assert.NoError(t, rc.Purge(context.Background(), "any"))
+}
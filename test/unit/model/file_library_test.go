@@ -0,0 +1,143 @@
+package model_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&model.File{}, &model.Tag{}, &model.FileTag{}, &model.FileShare{}))
+	return db
+}
+
+func createFile(t *testing.T, db *gorm.DB, file model.File) model.File {
+	if file.Status == 0 {
+		file.Status = 1
+	}
+	if file.Usage == "" {
+		file.Usage = model.FileUsageGeneral
+	}
+	require.NoError(t, db.Create(&file).Error)
+	return file
+}
+
+func fileIDs(files []model.File) []string {
+	ids := make([]string, len(files))
+	for i := range files {
+		ids[i] = files[i].ID
+	}
+	return ids
+}
+
+func TestFileRepoListByFilter(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := model.NewFileRepo(db)
+	now := time.Now()
+
+	photo := createFile(t, db, model.File{OriginalName: "holiday.jpg", MimeType: "image/jpeg", Size: 300, UploadedBy: 1, UploadedAt: now.Add(-48 * time.Hour), IsPublic: true})
+	report := createFile(t, db, model.File{OriginalName: "report.pdf", MimeType: "application/pdf", Size: 100, UploadedBy: 1, UploadedAt: now, Usage: model.FileUsageAttach})
+	archive := createFile(t, db, model.File{OriginalName: "backup.zip", MimeType: "application/zip", Size: 200, UploadedBy: 1, UploadedAt: now})
+	createFile(t, db, model.File{OriginalName: "pending.jpg", MimeType: "image/jpeg", UploadedBy: 1, Status: -1})
+	createFile(t, db, model.File{OriginalName: "other.jpg", MimeType: "image/jpeg", UploadedBy: 2, Status: 1})
+
+	list := func(filter model.FileFilter) []string {
+		filter.UserID = 1
+		files, total, err := repo.ListByFilter(ctx, 1, 10, &filter)
+		require.NoError(t, err)
+		assert.Len(t, files, int(total))
+		return fileIDs(files)
+	}
+
+	// 只返回当前用户已完成上传的文件
+	assert.ElementsMatch(t, []string{photo.ID, report.ID, archive.ID}, list(model.FileFilter{}))
+
+	assert.Equal(t, []string{photo.ID}, list(model.FileFilter{Type: model.FileTypeImage}))
+	assert.Equal(t, []string{report.ID}, list(model.FileFilter{Type: model.FileTypeDocument}))
+	assert.Equal(t, []string{archive.ID}, list(model.FileFilter{Type: model.FileTypeOther}))
+	assert.Empty(t, list(model.FileFilter{Type: "unknown"}))
+	assert.Equal(t, []string{report.ID}, list(model.FileFilter{Usage: model.FileUsageAttach}))
+	assert.Equal(t, []string{archive.ID}, list(model.FileFilter{Keyword: "back"}))
+
+	isPublic := true
+	assert.Equal(t, []string{photo.ID}, list(model.FileFilter{IsPublic: &isPublic}))
+
+	start := now.Add(-time.Hour)
+	assert.ElementsMatch(t, []string{report.ID, archive.ID}, list(model.FileFilter{StartTime: &start}))
+
+	// 排序
+	assert.Equal(t, []string{photo.ID, archive.ID, report.ID}, list(model.FileFilter{SortBy: "size", SortDesc: true}))
+	assert.Equal(t, []string{archive.ID, photo.ID, report.ID}, list(model.FileFilter{SortBy: "original_name"}))
+
+	// 分页
+	files, total, err := repo.ListByFilter(ctx, 2, 2, &model.FileFilter{UserID: 1, SortBy: "size"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{photo.ID}, fileIDs(files))
+}
+
+func TestTagRepoSetFileTags(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := model.NewTagRepo(db)
+	fileRepo := model.NewFileRepo(db)
+
+	a := createFile(t, db, model.File{OriginalName: "a.txt", UploadedBy: 1})
+	b := createFile(t, db, model.File{OriginalName: "b.txt", UploadedBy: 1})
+	other := createFile(t, db, model.File{OriginalName: "c.txt", UploadedBy: 2})
+
+	require.NoError(t, repo.SetFileTags(ctx, 1, a.ID, []string{"work", "2026"}))
+	require.NoError(t, repo.SetFileTags(ctx, 1, b.ID, []string{"work"}))
+	require.NoError(t, repo.SetFileTags(ctx, 2, other.ID, []string{"work"}))
+
+	tags, err := repo.ListByFiles(ctx, []string{a.ID, b.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2026", "work"}, tags[a.ID])
+	assert.Equal(t, []string{"work"}, tags[b.ID])
+
+	counts, err := repo.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []model.TagCount{{Name: "2026", Files: 1}, {Name: "work", Files: 2}}, counts)
+
+	// 按标签过滤只匹配当前用户的标签
+	files, _, err := fileRepo.ListByFilter(ctx, 1, 10, &model.FileFilter{UserID: 1, Tag: "work", SortBy: "original_name"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{a.ID, b.ID}, fileIDs(files))
+
+	// 替换标签后删除不再使用的标签，之后可以重新创建
+	require.NoError(t, repo.SetFileTags(ctx, 1, a.ID, []string{"work"}))
+	counts, err = repo.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []model.TagCount{{Name: "work", Files: 2}}, counts)
+
+	var remaining int64
+	require.NoError(t, db.Unscoped().Model(&model.Tag{}).Where("user_id = ? AND name = ?", 1, "2026").Count(&remaining).Error)
+	assert.Zero(t, remaining)
+
+	require.NoError(t, repo.SetFileTags(ctx, 1, b.ID, []string{"2026"}))
+	tags, err = repo.ListByFiles(ctx, []string{b.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2026"}, tags[b.ID])
+
+	// 清除标签
+	require.NoError(t, repo.SetFileTags(ctx, 1, a.ID, nil))
+	tags, err = repo.ListByFiles(ctx, []string{a.ID})
+	require.NoError(t, err)
+	assert.Empty(t, tags[a.ID])
+}
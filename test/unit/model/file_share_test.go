@@ -0,0 +1,87 @@
+package model_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileShareRepo(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := model.NewFileShareRepo(db)
+
+	share := &model.FileShare{
+		FileID:        "file-1",
+		UserID:        1,
+		Token:         "token-1",
+		MaxDownloads:  3,
+		AllowedEmails: []string{"a@example.com"},
+	}
+	require.NoError(t, repo.Create(ctx, share))
+
+	got, err := repo.GetByToken(ctx, "token-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a@example.com"}, got.AllowedEmails)
+
+	_, err = repo.GetByToken(ctx, "missing")
+	assert.True(t, errspec.ErrShareNotFound.Is(err))
+
+	// 并发下载不会超出次数限制
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.IncrDownload(ctx, share.ID); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else {
+				assert.True(t, errspec.ErrShareLimitReached.Is(err))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, succeeded)
+
+	require.NoError(t, repo.IncrAccess(ctx, share.ID))
+	got, err = repo.GetByToken(ctx, "token-1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.DownloadCount)
+	assert.Equal(t, 1, got.AccessCount)
+	assert.NotNil(t, got.LastAccessedAt)
+	assert.True(t, got.Exhausted())
+
+	// 只能撤销自己的分享链接，撤销后无法访问
+	assert.True(t, errspec.ErrShareNotFound.Is(repo.Revoke(ctx, 2, share.ID)))
+	require.NoError(t, repo.Revoke(ctx, 1, share.ID))
+	assert.True(t, errspec.ErrShareNotFound.Is(repo.Revoke(ctx, 1, share.ID)))
+	_, err = repo.GetByToken(ctx, "token-1")
+	assert.True(t, errspec.ErrShareNotFound.Is(err))
+
+	shares, err := repo.ListByUser(ctx, 1, "file-1")
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+	assert.NotNil(t, shares[0].RevokedAt)
+}
+
+func TestFileShareExpired(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.False(t, (&model.FileShare{}).Expired(now))
+	assert.True(t, (&model.FileShare{ExpiresAt: &past}).Expired(now))
+	assert.False(t, (&model.FileShare{ExpiresAt: &future}).Expired(now))
+	assert.False(t, (&model.FileShare{MaxDownloads: 0, DownloadCount: 5}).Exhausted())
+}
@@ -0,0 +1,231 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/errspec"
+	"github.com/limitcool/starter/internal/model"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// article 测试用的实体
+type article struct {
+	model.SnowflakeModel
+
+	Slug  string `json:"slug" gorm:"size:50;not null;unique"`
+	Title string `json:"title" gorm:"size:100"`
+}
+
+func (article) TableName() string {
+	return "article"
+}
+
+// newCachedDB 启用仓库查询缓存的数据库，返回查询次数的计数
+func newCachedDB(t *testing.T, entities map[string]time.Duration) (*gorm.DB, *atomic.Int32) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+	db := newTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &article{}))
+
+	c := cache.NewMemoryCache()
+	t.Cleanup(func() { c.Close() })
+	require.NoError(t, db.Use(model.NewRepoCache(c, model.RepoCacheOptions{Entities: entities})))
+
+	var queries atomic.Int32
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) {
+		queries.Add(1)
+	}))
+	return db, &queries
+}
+
+func createArticle(t *testing.T, repo *model.GenericRepo[article], slug string) *article {
+	a := &article{Slug: slug}
+	require.NoError(t, repo.Create(context.Background(), a))
+	return a
+}
+
+func TestRepoCacheGetByID(t *testing.T) {
+	db, queries := newCachedDB(t, map[string]time.Duration{"article": time.Minute})
+	ctx := context.Background()
+	repo := model.NewGenericRepo[article](db)
+	a := createArticle(t, repo, "hello")
+
+	for range 3 {
+		got, err := repo.Get(ctx, a.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", got.Slug)
+	}
+	assert.Equal(t, int32(1), queries.Load())
+
+	// 按条件更新后失效
+	require.NoError(t, db.Model(&article{}).Where("id = ?", a.ID).Update("title", "Hello").Error)
+	got, err := repo.Get(ctx, a.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", got.Title)
+	assert.Equal(t, int32(2), queries.Load())
+
+	// Save后失效
+	got.Title = "Hello, world"
+	require.NoError(t, repo.Update(ctx, got))
+	got, err = repo.Get(ctx, a.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world", got.Title)
+
+	// 删除后失效，不存在的结果不缓存
+	require.NoError(t, repo.Delete(ctx, a.ID))
+	before := queries.Load()
+	_, err = repo.Get(ctx, a.ID, nil)
+	assert.True(t, errspec.ErrRecordNotExist.Is(err))
+	_, err = repo.Get(ctx, a.ID, nil)
+	assert.True(t, errspec.ErrRecordNotExist.Is(err))
+	assert.Equal(t, before+2, queries.Load())
+}
+
+func TestRepoCacheGetByUniqueField(t *testing.T) {
+	db, queries := newCachedDB(t, map[string]time.Duration{"article": time.Minute})
+	ctx := context.Background()
+	repo := model.NewGenericRepo[article](db)
+	a := createArticle(t, repo, "first")
+
+	for range 3 {
+		got, err := repo.GetByField(ctx, "slug", "first")
+		require.NoError(t, err)
+		assert.Equal(t, a.ID, got.ID)
+	}
+	// 查询唯一字段和按主键加载实体各一次
+	assert.Equal(t, int32(2), queries.Load())
+
+	// 修改唯一字段后旧的映射失效
+	a.Slug = "renamed"
+	require.NoError(t, repo.Update(ctx, a))
+	_, err := repo.GetByField(ctx, "slug", "first")
+	assert.Error(t, err)
+	got, err := repo.GetByField(ctx, "slug", "renamed")
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, got.ID)
+
+	// 非唯一字段不使用缓存
+	before := queries.Load()
+	for range 2 {
+		_, err := repo.GetByField(ctx, "title", "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, before+2, queries.Load())
+
+	_, err = repo.GetByField(ctx, "missing", "x")
+	assert.Error(t, err)
+}
+
+func TestRepoCacheTransaction(t *testing.T) {
+	db, queries := newCachedDB(t, map[string]time.Duration{"article": time.Minute})
+	ctx := context.Background()
+	repo := model.NewGenericRepo[article](db)
+	a := createArticle(t, repo, "tx")
+
+	// 注册插件后仍能获取原始连接
+	_, err := db.DB()
+	require.NoError(t, err)
+
+	title := func() string {
+		got, err := repo.Get(ctx, a.ID, nil)
+		require.NoError(t, err)
+		return got.Title
+	}
+	setTitle := func(tx *gorm.DB, value string) {
+		require.NoError(t, tx.Model(&article{}).Where("id = ?", a.ID).Update("title", value).Error)
+	}
+	assert.Empty(t, title())
+
+	errRollback := errors.New("rollback")
+	err = repo.Transaction(ctx, func(tx *gorm.DB) error {
+		setTitle(tx, "uncommitted")
+
+		// 事务中的读取不使用缓存，能看到未提交的修改
+		got, err := repo.WithTx(tx).Get(ctx, a.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "uncommitted", got.Title)
+
+		// 提交前事务外读取缓存中的旧值，未提交的值没有写入缓存
+		assert.Empty(t, title())
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	// 回滚不失效缓存
+	before := queries.Load()
+	assert.Empty(t, title())
+	assert.Equal(t, before, queries.Load())
+
+	// 提交后失效
+	require.NoError(t, repo.Transaction(ctx, func(tx *gorm.DB) error {
+		setTitle(tx, "committed")
+		return nil
+	}))
+	assert.Equal(t, "committed", title())
+
+	// 直接使用db.Transaction时同样在提交后失效，包括嵌套事务中的修改
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			setTitle(tx, "nested")
+			assert.Equal(t, "committed", title(), "提交前不失效")
+			return nil
+		})
+	}))
+	assert.Equal(t, "nested", title())
+
+	// 手动开启的事务回滚后不失效
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+	setTitle(tx, "rolled back")
+	assert.Equal(t, "nested", title())
+	require.NoError(t, tx.Rollback().Error)
+	before = queries.Load()
+	assert.Equal(t, "nested", title())
+	assert.Equal(t, before, queries.Load())
+
+	tx = db.Begin()
+	setTitle(tx, "manual")
+	require.NoError(t, tx.Commit().Error)
+	assert.Equal(t, "manual", title())
+}
+
+func TestRepoCacheDisabledEntity(t *testing.T) {
+	db, queries := newCachedDB(t, nil)
+	ctx := context.Background()
+	repo := model.NewGenericRepo[article](db)
+	a := createArticle(t, repo, "plain")
+
+	for range 2 {
+		_, err := repo.Get(ctx, a.ID, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), queries.Load())
+}
+
+func TestRepoCacheHiddenFields(t *testing.T) {
+	// 缓存保留json:"-"的字段，如用户的密码哈希
+	db, queries := newCachedDB(t, map[string]time.Duration{"user": time.Minute})
+	ctx := context.Background()
+	repo := model.NewUserRepo(db)
+	user := &model.User{Username: "alice", Password: "hashed-alice"}
+	require.NoError(t, repo.Create(ctx, user))
+
+	for range 2 {
+		got, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "hashed-alice", got.Password)
+	}
+	assert.Equal(t, int32(1), queries.Load())
+
+	got, err := repo.GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "hashed-alice", got.Password)
+}
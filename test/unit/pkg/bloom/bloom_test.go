@@ -0,0 +1,170 @@
+package bloom_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/internal/pkg/bloom"
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeSource 以固定批次添加 prefix0..prefix(n-1)
+func rangeSource(prefix string, n int) bloom.Source {
+	return func(ctx context.Context, add func(items ...string) error) error {
+		batch := make([]string, 0, 100)
+		for i := range n {
+			batch = append(batch, fmt.Sprintf("%s%d", prefix, i))
+			if len(batch) == cap(batch) {
+				if err := add(batch...); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+		return add(batch...)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	m, k := bloom.Estimate(1_000_000, 0.01)
+	assert.InDelta(t, 9_585_059, float64(m), 1)
+	assert.Equal(t, uint32(7), k)
+
+	_, err := bloom.NewMemoryFilter(100, 0)
+	assert.Error(t, err)
+	_, err = bloom.NewMemoryFilter(100, 1)
+	assert.Error(t, err)
+
+	// 超过Redis字符串上限时拒绝创建
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	_, err = bloom.NewRedisFilter(client, "bloom:huge", 1<<32, 0.0001)
+	assert.Error(t, err)
+}
+
+func TestMemoryFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := bloom.NewMemoryFilter(10_000, 0.01)
+	require.NoError(t, err)
+
+	// 未就绪时所有元素都可能存在
+	ok, err := f.Test(ctx, "anything")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ready, _ := f.Ready(ctx)
+	assert.False(t, ready)
+
+	require.NoError(t, f.Rebuild(ctx, rangeSource("user:", 10_000)))
+	ready, _ = f.Ready(ctx)
+	assert.True(t, ready)
+
+	// 没有漏判
+	for i := range 10_000 {
+		ok, err := f.Test(ctx, fmt.Sprintf("user:%d", i))
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	// 误判率接近配置值
+	falsePositives := 0
+	for i := range 10_000 {
+		if ok, _ := f.Test(ctx, fmt.Sprintf("other:%d", i)); ok {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/10_000, 0.02)
+
+	require.NoError(t, f.Add(ctx, "new"))
+	ok, _ = f.Test(ctx, "new")
+	assert.True(t, ok)
+}
+
+func TestMemoryFilterRebuild(t *testing.T) {
+	ctx := context.Background()
+	f, err := bloom.NewMemoryFilter(1000, 0.001)
+	require.NoError(t, err)
+	require.NoError(t, f.Rebuild(ctx, rangeSource("old:", 100)))
+
+	// 重建期间添加的元素保留在新的过滤器中，不在数据源中的旧元素被移除
+	err = f.Rebuild(ctx, func(ctx context.Context, add func(items ...string) error) error {
+		require.NoError(t, f.Add(ctx, "added-during-rebuild"))
+		return add("current")
+	})
+	require.NoError(t, err)
+	for _, item := range []string{"added-during-rebuild", "current"} {
+		ok, _ := f.Test(ctx, item)
+		assert.True(t, ok, item)
+	}
+	ok, _ := f.Test(ctx, "old:1")
+	assert.False(t, ok)
+
+	// 重建失败时保留原来的内容
+	errSource := errors.New("database unavailable")
+	err = f.Rebuild(ctx, func(ctx context.Context, add func(items ...string) error) error {
+		return errSource
+	})
+	assert.ErrorIs(t, err, errSource)
+	ok, _ = f.Test(ctx, "current")
+	assert.True(t, ok)
+}
+
+func TestSchedule(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	f, err := bloom.NewMemoryFilter(100, 0.01)
+	require.NoError(t, err)
+
+	var rebuilds atomic.Int32
+	source := func(ctx context.Context, add func(items ...string) error) error {
+		rebuilds.Add(1)
+		return add("item")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bloom.Schedule(ctx, f, source, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return rebuilds.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+	ready, _ := f.Ready(context.Background())
+	assert.True(t, ready)
+}
+
+func TestGetOrLoadWithFilter(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+	defer c.Close()
+
+	f, err := bloom.NewMemoryFilter(100, 0.001)
+	require.NoError(t, err)
+	require.NoError(t, f.Rebuild(ctx, rangeSource("", 10)))
+
+	var calls atomic.Int32
+	loader := func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+		return []byte("user"), nil
+	}
+
+	// 过滤器判定不存在时不调用loader
+	_, err = c.GetOrLoad(ctx, "user:404", loader, time.Minute, cache.WithFilter(f, "404"))
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Zero(t, calls.Load())
+
+	value, err := c.GetOrLoad(ctx, "user:7", loader, time.Minute, cache.WithFilter(f, "7"))
+	require.NoError(t, err)
+	assert.Equal(t, "user", string(value))
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,132 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBus 进程内的失效广播，模拟Redis发布订阅
+type memoryBus struct {
+	mu       sync.Mutex
+	handlers map[int]func(msg cache.InvalidateMessage)
+	next     int
+}
+
+func (b *memoryBus) Publish(ctx context.Context, msg cache.InvalidateMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(handler func(msg cache.InvalidateMessage)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers == nil {
+		b.handlers = make(map[int]func(msg cache.InvalidateMessage))
+	}
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+		return nil
+	}, nil
+}
+
+func TestLayeredCache(t *testing.T) {
+	ctx := context.Background()
+	remote := cache.NewMemoryCache()
+	bus := &memoryBus{}
+
+	a, err := cache.NewLayeredCache(remote, cache.LayeredOptions{LocalTTL: time.Minute, Invalidator: bus})
+	require.NoError(t, err)
+	b, err := cache.NewLayeredCache(remote, cache.LayeredOptions{LocalTTL: time.Minute, Invalidator: bus})
+	require.NoError(t, err)
+
+	require.NoError(t, a.Set(ctx, "k", []byte("v1"), 0))
+
+	// 第一次读取从L2加载，之后命中L1
+	value, err := b.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+	value, err = b.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+	assert.Equal(t, cache.LayerStats{Hits: 1, Misses: 1}, b.Stats().L1)
+	assert.Equal(t, cache.LayerStats{Hits: 1}, b.Stats().L2)
+
+	// 其他实例写入后本地副本失效
+	require.NoError(t, a.Set(ctx, "k", []byte("v2"), 0))
+	value, err = b.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+	assert.Equal(t, int64(2), b.Stats().Invalidations)
+	assert.Equal(t, int64(0), a.Stats().Invalidations, "忽略本实例发送的消息")
+
+	// 删除同时清除其他实例的本地副本
+	require.NoError(t, a.Delete(ctx, "k"))
+	_, err = b.Get(ctx, "k")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, int64(1), b.Stats().L2.Misses)
+
+	// 批量读取只从L2加载本地未命中的键
+	require.NoError(t, a.SetMulti(ctx, map[string][]byte{"x": []byte("1"), "y": []byte("2")}, 0))
+	_, err = b.Get(ctx, "x")
+	require.NoError(t, err)
+	before := b.Stats()
+	items, err := b.GetMulti(ctx, []string{"x", "y", "z"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"x": []byte("1"), "y": []byte("2")}, items)
+	after := b.Stats()
+	assert.Equal(t, int64(1), after.L1.Hits-before.L1.Hits)
+	assert.Equal(t, int64(1), after.L2.Hits-before.L2.Hits)
+	assert.Equal(t, int64(1), after.L2.Misses-before.L2.Misses)
+
+	// 清空后其他实例的本地缓存同样被清空
+	require.NoError(t, a.Clear(ctx))
+	_, err = b.Get(ctx, "y")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	require.NoError(t, a.Close())
+	require.NoError(t, b.Close())
+	assert.Empty(t, bus.handlers)
+}
+
+func TestLayeredCacheExpiration(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewLayeredCache(cache.NewMemoryCache(), cache.LayeredOptions{LocalTTL: time.Minute, LocalSize: 2})
+	require.NoError(t, err)
+
+	// 本地副本不超过写入时指定的过期时间
+	require.NoError(t, c.Set(ctx, "short", []byte("v"), 20*time.Millisecond))
+	time.Sleep(40 * time.Millisecond)
+	_, err = c.Get(ctx, "short")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	// 本地缓存已满时淘汰最久未使用的副本，读取仍然成功
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), 0))
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), 0))
+	for range 2 {
+		value, err := c.Get(ctx, "c")
+		require.NoError(t, err)
+		assert.Equal(t, "3", string(value))
+	}
+	assert.Equal(t, int64(0), c.Stats().L2.Hits)
+
+	value, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+	assert.Equal(t, int64(1), c.Stats().L2.Hits)
+}
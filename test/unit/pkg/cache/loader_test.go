@@ -0,0 +1,173 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrLoadCoalescing(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	layered, err := cache.NewLayeredCache(cache.NewMemoryCache(), cache.LayeredOptions{})
+	require.NoError(t, err)
+	defer layered.Close()
+
+	backends := map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"layered": layered,
+	}
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			var loads atomic.Int32
+			release := make(chan struct{})
+			loader := func(ctx context.Context) ([]byte, error) {
+				loads.Add(1)
+				<-release
+				return []byte("v"), nil
+			}
+
+			// 并发请求同一个键只调用一次loader
+			var wg sync.WaitGroup
+			for range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					value, err := c.GetOrLoad(ctx, "hot", loader, time.Minute)
+					assert.NoError(t, err)
+					assert.Equal(t, "v", string(value))
+				}()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			assert.Equal(t, int32(1), loads.Load())
+
+			value, err := c.GetOrLoad(ctx, "hot", loader, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, "v", string(value))
+			assert.Equal(t, int32(1), loads.Load())
+		})
+	}
+}
+
+func TestGetOrLoadNilValue(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(cache.WithLoadOptions(cache.WithNilValueTTL(time.Minute)))
+
+	var loads atomic.Int32
+	missing := func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		return nil, cache.ErrNotFound
+	}
+
+	// 数据不存在时缓存空值，不再调用loader
+	for range 3 {
+		_, err := c.GetOrLoad(ctx, "user:404", missing, time.Minute)
+		assert.ErrorIs(t, err, cache.ErrNotFound)
+	}
+	assert.Equal(t, int32(1), loads.Load())
+
+	users := cache.NewTypedCache[profile](c)
+	_, err := users.Get(ctx, "user:404")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	// 调用时传入的选项优先
+	_, err = c.GetOrLoad(ctx, "user:405", missing, time.Minute, cache.WithNilValueTTL(0))
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = c.GetOrLoad(ctx, "user:405", missing, time.Minute, cache.WithNilValueTTL(0))
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, int32(3), loads.Load())
+
+	// 其他错误不缓存
+	failed := errors.New("db down")
+	_, err = c.GetOrLoad(ctx, "user:500", func(ctx context.Context) ([]byte, error) {
+		return nil, failed
+	}, time.Minute)
+	assert.ErrorIs(t, err, failed)
+	_, err = c.Get(ctx, "user:500")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestGetOrLoadStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+
+	var version atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	loader := func(ctx context.Context) ([]byte, error) {
+		if version.Add(1) > 1 {
+			time.Sleep(20 * time.Millisecond)
+			defer func() { refreshed <- struct{}{} }()
+			return []byte("v2"), nil
+		}
+		return []byte("v1"), nil
+	}
+	opts := []cache.LoadOption{cache.WithStaleTTL(time.Minute), cache.WithEarlyExpiration(0)}
+
+	value, err := c.GetOrLoad(ctx, "k", loader, 30*time.Millisecond, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+
+	// 过期后立即返回旧值，同时在后台刷新
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	value, err = c.GetOrLoad(ctx, "k", loader, 30*time.Millisecond, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(value))
+	assert.Less(t, time.Since(start), 15*time.Millisecond)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("background refresh not triggered")
+	}
+	value, err = c.GetOrLoad(ctx, "k", loader, 30*time.Millisecond, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+
+	// 不返回旧值时过期后同步加载
+	time.Sleep(50 * time.Millisecond)
+	value, err = c.GetOrLoad(ctx, "k", loader, 30*time.Millisecond, cache.WithEarlyExpiration(0))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(value))
+	assert.Equal(t, int32(3), version.Load())
+}
+
+func TestGetOrLoadEarlyExpiration(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return []byte("v"), nil
+	}
+
+	// 系数足够大时在过期前就在后台刷新，读取不会阻塞
+	_, err := c.GetOrLoad(ctx, "k", loader, time.Hour, cache.WithEarlyExpiration(1e9))
+	require.NoError(t, err)
+	value, err := c.GetOrLoad(ctx, "k", loader, time.Hour, cache.WithEarlyExpiration(1e9))
+	require.NoError(t, err)
+	assert.Equal(t, "v", string(value))
+	assert.Eventually(t, func() bool { return loads.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	// 不提前刷新
+	_, err = c.GetOrLoad(ctx, "other", loader, time.Hour, cache.WithEarlyExpiration(0))
+	require.NoError(t, err)
+	_, err = c.GetOrLoad(ctx, "other", loader, time.Hour, cache.WithEarlyExpiration(0))
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(3), loads.Load())
+}
@@ -0,0 +1,134 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// 基准测试对比分片缓存与原先基于go-cache的实现（不限制容量）
+// go test ./test/unit/pkg/cache -run ^$ -bench Memory -benchmem
+
+const benchKeys = 1 << 16
+
+func benchKeySet() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:%d", i)
+	}
+	return keys
+}
+
+// zipfKeys 按Zipf分布生成访问序列，少量的键占大部分访问
+func zipfKeys(n int) []string {
+	keys := benchKeySet()
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.1, 1, benchKeys-1)
+	seq := make([]string, n)
+	for i := range seq {
+		seq[i] = keys[zipf.Uint64()]
+	}
+	return seq
+}
+
+func BenchmarkMemoryCacheGet(b *testing.B) {
+	ctx := context.Background()
+	keys := benchKeySet()
+	value := []byte("value")
+
+	b.Run("go-cache", func(b *testing.B) {
+		c := gocache.New(time.Hour, time.Hour)
+		for _, key := range keys {
+			c.Set(key, value, 0)
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			i := rand.IntN(benchKeys)
+			for pb.Next() {
+				c.Get(keys[i&(benchKeys-1)])
+				i++
+			}
+		})
+	})
+
+	for _, policy := range []cache.EvictionPolicy{cache.EvictionLRU, cache.EvictionTinyLFU} {
+		b.Run(string(policy), func(b *testing.B) {
+			c := cache.NewMemoryCache(cache.WithExpiration(time.Hour), cache.WithMaxEntries(benchKeys), cache.WithEviction(policy))
+			defer c.Close()
+			for _, key := range keys {
+				c.Set(ctx, key, value, 0)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(benchKeys)
+				for pb.Next() {
+					c.Get(ctx, keys[i&(benchKeys-1)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkMemoryCacheSet(b *testing.B) {
+	ctx := context.Background()
+	keys := benchKeySet()
+	value := []byte("value")
+
+	b.Run("go-cache", func(b *testing.B) {
+		c := gocache.New(time.Hour, time.Hour)
+		b.RunParallel(func(pb *testing.PB) {
+			i := rand.IntN(benchKeys)
+			for pb.Next() {
+				c.Set(keys[i&(benchKeys-1)], value, 0)
+				i++
+			}
+		})
+	})
+
+	for _, policy := range []cache.EvictionPolicy{cache.EvictionLRU, cache.EvictionTinyLFU} {
+		b.Run(string(policy), func(b *testing.B) {
+			// 容量小于键的数量，包含淘汰的开销
+			c := cache.NewMemoryCache(cache.WithExpiration(time.Hour), cache.WithMaxEntries(benchKeys/4), cache.WithEviction(policy))
+			defer c.Close()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(benchKeys)
+				for pb.Next() {
+					c.Set(ctx, keys[i&(benchKeys-1)], value, 0)
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemoryCacheHitRatio 容量为键数量的1/16时，Zipf分布下的命中率
+func BenchmarkMemoryCacheHitRatio(b *testing.B) {
+	ctx := context.Background()
+	seq := zipfKeys(1 << 18)
+	value := []byte("value")
+
+	for _, policy := range []cache.EvictionPolicy{cache.EvictionLRU, cache.EvictionTinyLFU} {
+		b.Run(string(policy), func(b *testing.B) {
+			c := cache.NewMemoryCache(cache.WithMaxEntries(benchKeys/16), cache.WithEviction(policy))
+			defer c.Close()
+
+			var hits, total int
+			b.ResetTimer()
+			for i := range b.N {
+				key := seq[i%len(seq)]
+				total++
+				if _, err := c.Get(ctx, key); err == nil {
+					hits++
+				} else {
+					c.Set(ctx, key, value, 0)
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(total)*100, "hit%")
+		})
+	}
+}
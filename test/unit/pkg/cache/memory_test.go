@@ -0,0 +1,179 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evictionLog 记录淘汰回调
+type evictionLog struct {
+	mu      sync.Mutex
+	reasons map[string]cache.EvictionReason
+}
+
+func (l *evictionLog) record(key string, value []byte, reason cache.EvictionReason) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reasons == nil {
+		l.reasons = make(map[string]cache.EvictionReason)
+	}
+	l.reasons[key] = reason
+}
+
+func (l *evictionLog) get(key string) cache.EvictionReason {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reasons[key]
+}
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	log := &evictionLog{}
+	c := cache.NewMemoryCache(cache.WithMaxEntries(3), cache.WithOnEvicted(log.record))
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, key, []byte(key), 0))
+	}
+	// 访问a后b成为最久未使用的条目
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "d", []byte("d"), 0))
+
+	assert.Equal(t, 3, c.Len())
+	_, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, cache.EvictionCapacity, log.get("b"))
+
+	// 默认容量同样生效
+	bounded := cache.NewMemoryCache()
+	defer bounded.Close()
+	for i := range 20000 {
+		require.NoError(t, bounded.Set(ctx, fmt.Sprintf("k%d", i), []byte("v"), 0))
+	}
+	assert.Equal(t, cache.DefaultOptions.MaxEntries, bounded.Len())
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	log := &evictionLog{}
+	c := cache.NewMemoryCache(cache.WithMaxEntries(0), cache.WithMaxBytes(4096), cache.WithOnEvicted(log.record))
+	defer c.Close()
+
+	value := []byte(strings.Repeat("x", 1000))
+	for i := range 10 {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("k%d", i), value, 0))
+		assert.LessOrEqual(t, c.Size(), int64(4096))
+	}
+	assert.Less(t, c.Len(), 10)
+	assert.Equal(t, cache.EvictionCapacity, log.get("k0"))
+
+	// 超过容量的单个值不写入
+	require.NoError(t, c.Set(ctx, "huge", make([]byte, 8192), 0))
+	_, err := c.Get(ctx, "huge")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, cache.EvictionCapacity, log.get("huge"))
+}
+
+func TestMemoryCacheEvictionReasons(t *testing.T) {
+	ctx := context.Background()
+	log := &evictionLog{}
+	c := cache.NewMemoryCache(cache.WithOnEvicted(log.record))
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, "replaced", []byte("1"), 0))
+	require.NoError(t, c.Set(ctx, "replaced", []byte("2"), 0))
+	assert.Equal(t, cache.EvictionReplaced, log.get("replaced"))
+
+	require.NoError(t, c.Set(ctx, "deleted", []byte("1"), 0))
+	require.NoError(t, c.Delete(ctx, "deleted"))
+	assert.Equal(t, cache.EvictionDeleted, log.get("deleted"))
+
+	require.NoError(t, c.Set(ctx, "expired", []byte("1"), 10*time.Millisecond))
+	require.NoError(t, c.Set(ctx, "swept", []byte("1"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, err := c.Get(ctx, "expired")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, cache.EvictionExpired, log.get("expired"))
+	c.DeleteExpired()
+	assert.Equal(t, cache.EvictionExpired, log.get("swept"))
+	assert.Equal(t, "expired", cache.EvictionExpired.String())
+}
+
+func TestMemoryCacheCounters(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+	defer c.Close()
+
+	n, err := c.Incr(ctx, "counter", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = c.Decr(ctx, "counter", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	value, err := c.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(value))
+
+	require.NoError(t, c.Set(ctx, "text", []byte("abc"), 0))
+	_, err = c.Incr(ctx, "text", 1)
+	assert.Error(t, err)
+
+	// 过期时间
+	require.NoError(t, c.Expire(ctx, "counter", time.Hour))
+	ttl, err := c.TTL(ctx, "counter")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	require.NoError(t, c.Set(ctx, "forever", []byte("1"), -1))
+	ttl, err = c.TTL(ctx, "forever")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+	assert.ErrorIs(t, c.Expire(ctx, "missing", time.Hour), cache.ErrNotFound)
+
+	require.NoError(t, c.Close())
+	_, err = c.Get(ctx, "counter")
+	assert.Error(t, err)
+}
+
+func TestMemoryCacheTinyLFU(t *testing.T) {
+	ctx := context.Background()
+
+	// 频繁访问的键在一次性扫描后仍然保留，LRU则全部被淘汰
+	survivors := func(policy cache.EvictionPolicy) int {
+		c := cache.NewMemoryCache(cache.WithMaxEntries(100), cache.WithShards(1), cache.WithEviction(policy))
+		defer c.Close()
+
+		for range 5 {
+			for i := range 50 {
+				key := fmt.Sprintf("hot:%d", i)
+				if _, err := c.Get(ctx, key); err != nil {
+					require.NoError(t, c.Set(ctx, key, []byte("v"), 0))
+				}
+			}
+		}
+		for i := range 1000 {
+			require.NoError(t, c.Set(ctx, fmt.Sprintf("scan:%d", i), []byte("v"), 0))
+		}
+		assert.LessOrEqual(t, c.Len(), 100)
+
+		n := 0
+		for i := range 50 {
+			if ok, _ := c.Exists(ctx, fmt.Sprintf("hot:%d", i)); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Equal(t, 0, survivors(cache.EvictionLRU))
+	assert.GreaterOrEqual(t, survivors(cache.EvictionTinyLFU), 45)
+}
@@ -0,0 +1,182 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheTags(t *testing.T) {
+	ctx := context.Background()
+	layered, err := cache.NewLayeredCache(cache.NewMemoryCache(), cache.LayeredOptions{})
+	require.NoError(t, err)
+	defer layered.Close()
+
+	backends := map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"layered": layered,
+	}
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, c.SetWithTags(ctx, "user:42:profile", []byte("p"), time.Minute, "user:42"))
+			require.NoError(t, c.SetWithTags(ctx, "user:42:orders", []byte("o"), time.Minute, "user:42", "orders"))
+			require.NoError(t, c.SetWithTags(ctx, "user:43:profile", []byte("q"), time.Minute, "user:43"))
+			require.NoError(t, c.Set(ctx, "plain", []byte("x"), time.Minute))
+
+			value, err := c.Get(ctx, "user:42:profile")
+			require.NoError(t, err)
+			assert.Equal(t, "p", string(value))
+
+			// 失效标签后带有该标签的值都不可见，其他值不受影响
+			require.NoError(t, c.InvalidateTags(ctx, "user:42"))
+			_, err = c.Get(ctx, "user:42:profile")
+			assert.ErrorIs(t, err, cache.ErrNotFound)
+
+			items, err := c.GetMulti(ctx, []string{"user:42:profile", "user:42:orders", "user:43:profile", "plain"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string][]byte{"user:43:profile": []byte("q"), "plain": []byte("x")}, items)
+
+			// 失效后重新写入的值可见
+			require.NoError(t, c.SetWithTags(ctx, "user:42:profile", []byte("p2"), time.Minute, "user:42"))
+			value, err = c.Get(ctx, "user:42:profile")
+			require.NoError(t, err)
+			assert.Equal(t, "p2", string(value))
+		})
+	}
+}
+
+func TestCacheTagsShared(t *testing.T) {
+	ctx := context.Background()
+	remote := cache.NewMemoryCache()
+
+	a, err := cache.NewLayeredCache(remote, cache.LayeredOptions{LocalTTL: time.Minute})
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := cache.NewLayeredCache(remote, cache.LayeredOptions{LocalTTL: time.Minute})
+	require.NoError(t, err)
+	defer b.Close()
+
+	// b的本地副本在a失效标签后同样失效，不需要广播
+	require.NoError(t, a.SetWithTags(ctx, "k", []byte("v"), 0, "t"))
+	value, err := b.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v", string(value))
+
+	require.NoError(t, a.InvalidateTags(ctx, "t"))
+	_, err = b.Get(ctx, "k")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = remote.Get(ctx, "k")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestGetOrLoadTags(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+
+	// 加载期间失效标签，写入的值随即失效
+	value, err := c.GetOrLoad(ctx, "user:42", func(ctx context.Context) ([]byte, error) {
+		require.NoError(t, c.InvalidateTags(ctx, "user:42"))
+		return []byte("old"), nil
+	}, time.Minute, cache.WithTags("user:42"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(value))
+
+	value, err = c.GetOrLoad(ctx, "user:42", func(ctx context.Context) ([]byte, error) {
+		return []byte("new"), nil
+	}, time.Minute, cache.WithTags("user:42"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(value))
+
+	users := cache.NewTypedCache[string](c)
+	require.NoError(t, users.SetWithTags(ctx, "name:42", "alice", time.Minute, "user:42"))
+	require.NoError(t, c.InvalidateTags(ctx, "user:42"))
+	_, err = users.Get(ctx, "name:42")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = c.GetOrLoad(ctx, "user:42", func(ctx context.Context) ([]byte, error) {
+		return nil, cache.ErrNotFound
+	}, time.Minute, cache.WithTags("user:42"))
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache()
+
+	users := c.Namespace("users")
+	posts := c.Namespace("posts")
+	require.NoError(t, users.Set(ctx, "1", []byte("alice"), time.Minute))
+	require.NoError(t, posts.Set(ctx, "1", []byte("hello"), time.Minute))
+
+	value, err := users.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", string(value))
+	_, err = c.Get(ctx, "1")
+	assert.ErrorIs(t, err, cache.ErrNotFound, "命名空间的键带有前缀")
+
+	items, err := users.GetMulti(ctx, []string{"1", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"1": []byte("alice")}, items)
+
+	// 下级命名空间随上级一起清空
+	profiles := users.Namespace("profiles")
+	require.NoError(t, profiles.Set(ctx, "1", []byte("bio"), time.Minute))
+	value, err = profiles.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "bio", string(value))
+
+	// 清空只影响该命名空间
+	require.NoError(t, users.Clear(ctx))
+	_, err = users.Get(ctx, "1")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = profiles.Get(ctx, "1")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	value, err = posts.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(value))
+
+	// 同名命名空间共享版本
+	require.NoError(t, users.Set(ctx, "1", []byte("bob"), time.Minute))
+	value, err = c.Namespace("users").Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", string(value))
+}
+
+func TestMemoryTagsExpire(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(cache.WithTagTTL(20 * time.Millisecond))
+	defer c.Close()
+	users := c.Namespace("users")
+
+	require.NoError(t, c.SetWithTags(ctx, "kept", []byte("k"), time.Minute, "a"))
+	require.NoError(t, c.SetWithTags(ctx, "forever", []byte("f"), -1, "b"))
+	require.NoError(t, c.SetWithTags(ctx, "stale", []byte("s"), -1, "c"))
+	require.NoError(t, c.InvalidateTags(ctx, "c"))
+	require.NoError(t, users.Set(ctx, "1", []byte("alice"), time.Minute))
+
+	// 空闲的标签被清除
+	time.Sleep(40 * time.Millisecond)
+	c.DeleteExpired()
+
+	// 未过期的缓存值引用的标签和命名空间保留
+	value, err := c.Get(ctx, "kept")
+	require.NoError(t, err)
+	assert.Equal(t, "k", string(value))
+	value, err = users.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", string(value))
+
+	// 标签被清除后重新分配的版本与之前不同，缓存值视为失效，失效过的值也不会重新可见
+	_, err = c.Get(ctx, "forever")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = c.Get(ctx, "stale")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	require.NoError(t, c.SetWithTags(ctx, "forever", []byte("f2"), -1, "b"))
+	value, err = c.Get(ctx, "forever")
+	require.NoError(t, err)
+	assert.Equal(t, "f2", string(value))
+}
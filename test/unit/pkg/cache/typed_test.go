@@ -0,0 +1,146 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/cache"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type profile struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Tags      []string          `json:"tags"`
+	Attrs     map[string]string `json:"attrs"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func TestCodecs(t *testing.T) {
+	in := profile{
+		ID: 42, Name: "alice", Tags: []string{"a", "b"},
+		Attrs:     map[string]string{"bio": strings.Repeat("x", 512)},
+		UpdatedAt: time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+	}
+
+	codecs := map[string]cache.Codec{
+		"json":    cache.JSONCodec,
+		"gob":     cache.GobCodec,
+		"msgpack": cache.MsgpackCodec,
+		"zstd":    cache.NewZstdCodec(cache.MsgpackCodec, 256),
+	}
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Marshal(in)
+			require.NoError(t, err)
+			var out profile
+			require.NoError(t, codec.Unmarshal(data, &out))
+			assert.Equal(t, in.ID, out.ID)
+			assert.Equal(t, in.Tags, out.Tags)
+			assert.Equal(t, in.Attrs, out.Attrs)
+			assert.True(t, in.UpdatedAt.Equal(out.UpdatedAt))
+		})
+	}
+
+	// 小于阈值的值不压缩
+	zstd := cache.NewZstdCodec(cache.JSONCodec, 1024)
+	small, err := zstd.Marshal("hi")
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0}, `"hi"`...), small)
+
+	large, err := zstd.Marshal(strings.Repeat("x", 4096))
+	require.NoError(t, err)
+	assert.Less(t, len(large), 1024)
+	var s string
+	require.NoError(t, zstd.Unmarshal(large, &s))
+	assert.Len(t, s, 4096)
+
+	assert.Error(t, zstd.Unmarshal([]byte{9, 1}, &s))
+}
+
+func TestTypedCache(t *testing.T) {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+
+	ctx := context.Background()
+	backend := cache.NewMemoryCache()
+	profiles := cache.NewTypedCache[profile](backend, cache.WithCodec(cache.MsgpackCodec))
+
+	_, err := profiles.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	require.NoError(t, profiles.Set(ctx, "user:1", profile{ID: 1, Name: "alice"}, time.Minute))
+	p, err := profiles.Get(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.Name)
+
+	// 其他格式写入的值无法解码
+	require.NoError(t, backend.Set(ctx, "user:2", []byte("not msgpack"), time.Minute))
+	_, err = profiles.Get(ctx, "user:2")
+	assert.ErrorIs(t, err, cache.ErrDecode)
+
+	items, err := profiles.GetMulti(ctx, []string{"user:1", "user:2", "user:3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:1"}, keysOf(items))
+
+	// 未命中或无法解码时调用loader并写入缓存
+	var loads atomic.Int32
+	loader := func(id int64) func(ctx context.Context) (profile, error) {
+		return func(ctx context.Context) (profile, error) {
+			loads.Add(1)
+			return profile{ID: id, Name: "loaded"}, nil
+		}
+	}
+	p, err = profiles.GetOrLoad(ctx, "user:1", loader(1), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.Name)
+	p, err = profiles.GetOrLoad(ctx, "user:2", loader(2), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "loaded", p.Name)
+	p, err = profiles.GetOrLoad(ctx, "user:2", loader(2), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), p.ID)
+	assert.Equal(t, int32(1), loads.Load())
+
+	// loader失败时不写入缓存
+	failed := errors.New("db down")
+	_, err = profiles.GetOrLoad(ctx, "user:4", func(ctx context.Context) (profile, error) {
+		return profile{}, failed
+	}, time.Minute)
+	assert.ErrorIs(t, err, failed)
+	_, err = profiles.Get(ctx, "user:4")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	// 预热只加载不存在的键
+	counts := cache.NewTypedCache[int](backend)
+	require.NoError(t, counts.Set(ctx, "count:a", 1, time.Minute))
+	var warmed []string
+	err = counts.WarmUp(ctx, []string{"count:a", "count:b", "count:c"}, func(ctx context.Context, key string) (int, error) {
+		if key == "count:c" {
+			return 0, failed
+		}
+		warmed = append(warmed, key)
+		return 2, nil
+	}, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"count:b"}, warmed)
+	n, err := counts.Get(ctx, "count:b")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = counts.Get(ctx, "count:c")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func keysOf[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
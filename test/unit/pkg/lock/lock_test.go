@@ -0,0 +1,182 @@
+package lock_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/limitcool/starter/internal/pkg/lock"
+	"github.com/limitcool/starter/internal/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func init() {
+	logger.SetDefault(logger.NewZapLogger(io.Discard, logger.InfoLevel, logger.TextFormat))
+}
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+	locker := lock.NewMemoryLocker()
+
+	first, err := locker.TryAcquire(ctx, "job")
+	require.NoError(t, err)
+	_, err = locker.TryAcquire(ctx, "job")
+	assert.ErrorIs(t, err, lock.ErrNotAcquired)
+
+	// 不同的key互不影响
+	other, err := locker.TryAcquire(ctx, "other")
+	require.NoError(t, err)
+	require.NoError(t, other.Release(ctx))
+
+	// Acquire等待释放
+	acquired := make(chan lock.Lock)
+	go func() {
+		l, err := locker.Acquire(ctx, "job", lock.WithRetryInterval(5*time.Millisecond))
+		assert.NoError(t, err)
+		acquired <- l
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, first.Release(ctx))
+	second := <-acquired
+	assert.Greater(t, second.Token(), first.Token(), "后获取的锁令牌更大")
+	assert.Error(t, first.Context().Err())
+	require.NoError(t, second.Release(ctx))
+
+	// Acquire随ctx取消返回
+	held, err := locker.TryAcquire(ctx, "job")
+	require.NoError(t, err)
+	defer held.Release(ctx)
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = locker.Acquire(timeout, "job")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLockRenewal(t *testing.T) {
+	ctx := context.Background()
+	locker := lock.NewMemoryLocker(lock.WithTTL(30 * time.Millisecond))
+
+	// 自动续期时超过TTL仍然持有
+	renewed, err := locker.TryAcquire(ctx, "renewed")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, renewed.Context().Err())
+	_, err = locker.TryAcquire(ctx, "renewed")
+	assert.ErrorIs(t, err, lock.ErrNotAcquired)
+	require.NoError(t, renewed.Release(ctx))
+
+	// 不续期时TTL后丢失
+	expiring, err := locker.TryAcquire(ctx, "expiring", lock.WithAutoRenew(false))
+	require.NoError(t, err)
+	select {
+	case <-expiring.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("lock not expired")
+	}
+	assert.ErrorIs(t, context.Cause(expiring.Context()), lock.ErrLockLost)
+	assert.ErrorIs(t, expiring.Release(ctx), lock.ErrLockLost)
+}
+
+func TestLockContextCancel(t *testing.T) {
+	locker := lock.NewMemoryLocker()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := locker.TryAcquire(ctx, "job")
+	require.NoError(t, err)
+
+	// 获取锁的ctx取消后自动释放
+	cancel()
+	assert.Eventually(t, func() bool {
+		l, err := locker.TryAcquire(context.Background(), "job")
+		if err != nil {
+			return false
+		}
+		l.Release(context.Background())
+		return true
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDBLockerSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	locker, err := lock.NewDBLocker(db)
+	require.NoError(t, err)
+
+	l, err := locker.TryAcquire(ctx, "migrations")
+	require.NoError(t, err)
+	assert.Zero(t, l.Token())
+
+	// 其他连接（进程）无法获取
+	other, err := lock.NewDBLocker(db)
+	require.NoError(t, err)
+	_, err = other.TryAcquire(ctx, "migrations")
+	assert.ErrorIs(t, err, lock.ErrNotAcquired)
+
+	require.NoError(t, l.Release(ctx))
+	l, err = other.TryAcquire(ctx, "migrations")
+	require.NoError(t, err)
+	require.NoError(t, l.Release(ctx))
+}
+
+func TestRedisLockerUnavailable(t *testing.T) {
+	_, err := lock.NewRedisLocker(nil)
+	assert.Error(t, err)
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	locker, err := lock.NewRedisLocker([]redis.UniversalClient{client})
+	require.NoError(t, err)
+
+	// 连接失败不是锁被占用，Acquire不重试
+	_, err = locker.Acquire(context.Background(), "job")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, lock.ErrNotAcquired)
+}
+
+func TestElection(t *testing.T) {
+	locker := lock.NewMemoryLocker(lock.WithTTL(100*time.Millisecond), lock.WithRetryInterval(5*time.Millisecond))
+
+	run := func(ctx context.Context, e *lock.Election) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			e.Run(ctx, func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+			close(done)
+		}()
+		return done
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	e1 := lock.NewElection(locker, "leader")
+	done1 := run(ctx1, e1)
+	require.Eventually(t, e1.IsLeader, time.Second, 5*time.Millisecond)
+	assert.NotZero(t, e1.Token())
+
+	e2 := lock.NewElection(locker, "leader")
+	done2 := run(ctx2, e2)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, e2.IsLeader(), "同时只有一个领导者")
+
+	// 领导者退出后其他实例当选
+	cancel1()
+	<-done1
+	assert.False(t, e1.IsLeader())
+	require.Eventually(t, e2.IsLeader, time.Second, 5*time.Millisecond)
+	assert.Greater(t, e2.Token(), uint64(0))
+
+	cancel2()
+	<-done2
+}
@@ -0,0 +1,202 @@
+package scanner_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitcool/starter/internal/pkg/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd 模拟clamd的PING和INSTREAM命令
+type fakeClamd struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	maxStream int
+	chunks    []int
+}
+
+func (f *fakeClamd) setMaxStream(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxStream = n
+}
+
+// lastChunks 返回并清空收到的数据块大小
+func (f *fakeClamd) lastChunks() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	chunks := f.chunks
+	f.chunks = nil
+	return chunks
+}
+
+func startFakeClamd(t *testing.T, network, address string) *fakeClamd {
+	l, err := net.Listen(network, address)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	f := &fakeClamd{listener: l, maxStream: 1 << 20}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch strings.TrimRight(cmd, "\x00") {
+	case "zPING":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM":
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			f.mu.Lock()
+			f.chunks = append(f.chunks, int(size))
+			exceeded := data.Len()+int(size) > f.maxStream
+			f.mu.Unlock()
+			if exceeded {
+				io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				return
+			}
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				return
+			}
+		}
+
+		if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+			io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+			return
+		}
+		io.WriteString(conn, "stream: OK\x00")
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+func object(name, content string) *scanner.Object {
+	return &scanner.Object{
+		Name: name,
+		Size: int64(len(content)),
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	ctx := context.Background()
+	server := startFakeClamd(t, "tcp", "127.0.0.1:0")
+	clamd := scanner.NewClamdScanner("", server.listener.Addr().String(), 5*time.Second)
+	assert.Equal(t, "tcp", clamd.Network)
+
+	require.NoError(t, clamd.Ping(ctx))
+
+	result, err := clamd.Scan(ctx, object("clean.txt", "hello world"))
+	require.NoError(t, err)
+	assert.True(t, result.Clean)
+
+	assert.Equal(t, []int{11}, server.lastChunks())
+
+	// 小数据块分多次发送
+	clamd.ChunkSize = 4
+	result, err = clamd.Scan(ctx, object("eicar.com", eicar))
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+	assert.Equal(t, "clamav", result.Scanner)
+	assert.Equal(t, "Eicar-Test-Signature", result.Threat)
+	assert.True(t, errors.Is(result.Err(), scanner.ErrInfected))
+	chunks := server.lastChunks()
+	assert.Len(t, chunks, (len(eicar)+3)/4)
+	assert.Equal(t, 4, chunks[0])
+
+	// 超过clamd的StreamMaxLength
+	server.setMaxStream(8)
+	_, err = clamd.Scan(ctx, object("large.bin", strings.Repeat("a", 64)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size limit exceeded")
+}
+
+func TestClamdScannerUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "clamd")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "clamd.sock")
+	startFakeClamd(t, "unix", socket)
+
+	clamd := scanner.NewClamdScanner("", socket, time.Second)
+	assert.Equal(t, "unix", clamd.Network)
+
+	result, err := clamd.Scan(context.Background(), object("eicar.com", eicar))
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	clamd := scanner.NewClamdScanner("tcp", address, time.Second)
+	_, err = clamd.Scan(context.Background(), object("clean.txt", "hello"))
+	assert.Error(t, err)
+}
+
+func TestClamdScannerTimeout(t *testing.T) {
+	// 接受连接但不响应
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	clamd := scanner.NewClamdScanner("tcp", l.Addr().String(), 100*time.Millisecond)
+	start := time.Now()
+	_, err = clamd.Scan(context.Background(), object("clean.txt", "hello"))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,147 @@
+package scanner_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/limitcool/starter/internal/pkg/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipOf 生成包含指定文件的ZIP，内容为[]byte时原样写入
+func zipOf(t *testing.T, entries map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func bytesObject(name string, content []byte) *scanner.Object {
+	return &scanner.Object{
+		Name: name,
+		Size: int64(len(content)),
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+	}
+}
+
+func TestRuleScanner(t *testing.T) {
+	ctx := context.Background()
+	rules, err := scanner.NewRuleScanner(2, []string{"*.EXE", "autorun.inf"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		obj    *scanner.Object
+		clean  bool
+		threat string
+	}{
+		{"普通文件", bytesObject("report.pdf", []byte("%PDF-1.7")), true, ""},
+		{"禁止的文件名", bytesObject("Setup.exe", []byte("MZ")), false, "forbidden file name: Setup.exe"},
+		{"压缩包", bytesObject("docs.zip", zipOf(t, map[string][]byte{"a.txt": []byte("a")})), true, ""},
+		{
+			"压缩包内禁止的文件名",
+			bytesObject("docs.zip", zipOf(t, map[string][]byte{"bin/tool.exe": []byte("MZ")})),
+			false, "forbidden file name: bin/tool.exe",
+		},
+		{
+			"不看扩展名识别压缩包",
+			bytesObject("docs.dat", zipOf(t, map[string][]byte{"AUTORUN.INF": []byte("")})),
+			false, "forbidden file name: AUTORUN.INF",
+		},
+		{
+			"允许的嵌套层数",
+			bytesObject("outer.zip", zipOf(t, map[string][]byte{
+				"inner.zip": zipOf(t, map[string][]byte{"a.txt": []byte("a")}),
+			})),
+			true, "",
+		},
+		{
+			"嵌套的压缩包中禁止的文件名",
+			bytesObject("outer.zip", zipOf(t, map[string][]byte{
+				"inner.zip": zipOf(t, map[string][]byte{"run.exe": []byte("MZ")}),
+			})),
+			false, "forbidden file name: run.exe",
+		},
+		{
+			"超过嵌套层数",
+			bytesObject("outer.zip", zipOf(t, map[string][]byte{
+				"inner.zip": zipOf(t, map[string][]byte{
+					"deepest.zip": zipOf(t, map[string][]byte{"a.txt": []byte("a")}),
+				}),
+			})),
+			false, "archive nesting exceeds 2 levels",
+		},
+		{"损坏的压缩包", bytesObject("broken.zip", []byte("PK\x03\x04broken")), true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rules.Scan(ctx, tt.obj)
+			require.NoError(t, err)
+			assert.Equal(t, tt.clean, result.Clean)
+			assert.Equal(t, tt.threat, result.Threat)
+		})
+	}
+}
+
+func TestRuleScannerNestedSize(t *testing.T) {
+	rules, err := scanner.NewRuleScanner(0, []string{"*.exe"})
+	require.NoError(t, err)
+	rules.MaxNestedSize = 64
+
+	inner := zipOf(t, map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 256)})
+	result, err := rules.Scan(context.Background(), bytesObject("outer.zip", zipOf(t, map[string][]byte{"inner.zip": inner})))
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+	assert.Equal(t, "nested archive too large: inner.zip", result.Threat)
+}
+
+func TestRuleScannerFile(t *testing.T) {
+	// 本地文件支持随机读取，直接解析，不写入临时文件
+	path := filepath.Join(t.TempDir(), "upload")
+	require.NoError(t, os.WriteFile(path, zipOf(t, map[string][]byte{"x/evil.exe": []byte("MZ")}), 0o600))
+
+	rules, err := scanner.NewRuleScanner(0, []string{"*.exe"})
+	require.NoError(t, err)
+
+	result, err := rules.Scan(context.Background(), &scanner.Object{
+		Name: "upload.zip",
+		Open: func() (io.ReadCloser, error) { return os.Open(path) },
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+}
+
+func TestRuleScannerInvalidPattern(t *testing.T) {
+	_, err := scanner.NewRuleScanner(0, []string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestChain(t *testing.T) {
+	rules, err := scanner.NewRuleScanner(0, []string{"*.exe"})
+	require.NoError(t, err)
+
+	// 规则未通过时不再调用后续扫描器
+	unreachable := scanner.NewClamdScanner("tcp", "127.0.0.1:1", 0)
+	result, err := scanner.Chain{rules, unreachable}.Scan(context.Background(), bytesObject("a.exe", nil))
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+	assert.Equal(t, "rules", result.Scanner)
+
+	_, err = scanner.Chain{rules, unreachable}.Scan(context.Background(), bytesObject("a.txt", nil))
+	assert.Error(t, err)
+}